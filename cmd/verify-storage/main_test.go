@@ -0,0 +1,83 @@
+package main
+
+import (
+	"context"
+	"slices"
+	"strings"
+	"testing"
+
+	"pistachio/internal/storage"
+)
+
+func TestVerify(t *testing.T) {
+	ctx := context.Background()
+	store := storage.NewLocal(t.TempDir(), nil)
+
+	put := func(key, content string) {
+		if err := store.Put(ctx, key, strings.NewReader(content), "application/octet-stream"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	put("photos/a.jpg", "photo a")
+	put("photos/originals/a.jpg", "photo a, as sent")
+	put("invoices/1.pdf", "%PDF- changed on disk")
+	put("attachments/old.pdf", "%PDF- from before hashes")
+	put("uploads/u/0", "chunk")
+	put("photos/left-behind.jpg", "no row")
+	put("quotes/left-behind.pdf", "no row either")
+
+	files := []storedFile{
+		{owner: "photo a", key: "photos/a.jpg", hash: storage.Hash([]byte("photo a"))},
+		{owner: "photo a original", key: "photos/originals/a.jpg", hash: storage.Hash([]byte("photo a, as sent"))},
+		{owner: "invoice 1", key: "invoices/1.pdf", hash: storage.Hash([]byte("%PDF- as rendered"))},
+		{owner: "attachment old", key: "attachments/old.pdf"},
+		{owner: "photo b", key: "photos/b.jpg", hash: storage.Hash([]byte("photo b"))},
+		{owner: "photo c thumbnail", key: "photos/variants/c/thumbnail.jpg"},
+	}
+
+	stored := map[string]bool{}
+	if err := store.Walk(ctx, func(key string) error { stored[key] = true; return nil }); err != nil {
+		t.Fatal(err)
+	}
+
+	found, err := verify(ctx, store, stored, files, []string{"uploads/u/0"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var missing []string
+	for _, f := range found.missing {
+		missing = append(missing, f.owner)
+	}
+	if want := []string{"photo b", "photo c thumbnail"}; !slices.Equal(missing, want) {
+		t.Errorf("got missing %v, want %v", missing, want)
+	}
+
+	if len(found.mismatched) != 1 || found.mismatched[0].owner != "invoice 1" ||
+		found.mismatched[0].got != storage.Hash([]byte("%PDF- changed on disk")) {
+		t.Errorf("got mismatched %+v, want invoice 1", found.mismatched)
+	}
+
+	if want := []string{"photos/left-behind.jpg", "quotes/left-behind.pdf"}; !slices.Equal(found.orphans, want) {
+		t.Errorf("got orphans %v, want %v", found.orphans, want)
+	}
+
+	if found.unhashed != 2 {
+		t.Errorf("got %d files without a hash, want 2", found.unhashed)
+	}
+	if found.problems() != 5 {
+		t.Errorf("got %d problems, want 5", found.problems())
+	}
+
+	// Everything in order
+	found, err = verify(ctx, store, map[string]bool{"photos/a.jpg": true}, files[:1], nil)
+	if err != nil || found.problems() != 0 {
+		t.Errorf("got %+v (%v), want nothing wrong", found, err)
+	}
+
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+	if _, err := verify(cancelled, store, stored, files, nil); err == nil {
+		t.Error("got no error once interrupted")
+	}
+}
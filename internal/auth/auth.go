@@ -0,0 +1,39 @@
+// Package auth protects the staff-only routes. The API has no user
+// accounts or sessions yet, so until it does, staff requests carry a
+// shared token: "Authorization: Bearer <STAFF_TOKEN>".
+package auth
+
+import (
+	"crypto/subtle"
+	"log"
+	"net/http"
+	"strings"
+)
+
+// Staff checks requests for the staff token.
+type Staff struct {
+	token []byte
+}
+
+// New returns a Staff for token. Without a token every request is
+// refused, so the routes are never open by mistake.
+func New(token string) *Staff {
+	if token == "" {
+		log.Printf("STAFF_TOKEN is not set; staff-only routes will refuse every request")
+	}
+	return &Staff{token: []byte(token)}
+}
+
+// Require only lets through requests with the staff token.
+func (s *Staff) Require(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || len(s.token) == 0 || subtle.ConstantTimeCompare([]byte(token), s.token) != 1 {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="pistachio"`)
+			http.Error(w, "staff token required", http.StatusUnauthorized)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,49 @@
+-- +goose Up
+CREATE TABLE document_counters (
+    series TEXT NOT NULL,
+    year INT NOT NULL,
+    last_value INT NOT NULL DEFAULT 0,
+    PRIMARY KEY (series, year)
+);
+
+CREATE TABLE quotes (
+    id UUID PRIMARY KEY,
+    quote_number TEXT NOT NULL UNIQUE,
+    customer_name TEXT NOT NULL,
+    customer_email TEXT,
+    customer_phone TEXT,
+    customer_address JSONB,
+    title TEXT NOT NULL,
+    description TEXT,
+    items JSONB NOT NULL,              -- array of line items
+    subtotal NUMERIC,
+    tax_rate NUMERIC,
+    tax_amount NUMERIC,
+    total NUMERIC NOT NULL,
+    status TEXT NOT NULL DEFAULT 'open', -- open / accepted / declined
+    public_token TEXT NOT NULL UNIQUE,
+    expires_at TIMESTAMP NOT NULL,
+    responded_at TIMESTAMP,
+    job_id UUID REFERENCES jobs(id),
+    invoice_id UUID REFERENCES invoices(id),
+    pdf_url TEXT,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+ALTER TABLE invoices
+    ADD COLUMN invoice_number TEXT,
+    ADD COLUMN issue_date TIMESTAMP,
+    ADD COLUMN due_date TIMESTAMP,
+    ADD COLUMN job_id UUID REFERENCES jobs(id),
+    ADD COLUMN quote_id UUID REFERENCES quotes(id);
+
+-- +goose Down
+ALTER TABLE invoices
+    DROP COLUMN IF EXISTS quote_id,
+    DROP COLUMN IF EXISTS job_id,
+    DROP COLUMN IF EXISTS due_date,
+    DROP COLUMN IF EXISTS issue_date,
+    DROP COLUMN IF EXISTS invoice_number;
+
+DROP TABLE IF EXISTS quotes;
+DROP TABLE IF EXISTS document_counters;
@@ -0,0 +1,34 @@
+-- +goose Up
+ALTER TABLE jobs ADD COLUMN job_type TEXT;
+
+CREATE TABLE time_entries (
+    id UUID PRIMARY KEY,
+    job_id UUID NOT NULL REFERENCES jobs(id),
+    user_name TEXT NOT NULL,
+    started_at TIMESTAMP NOT NULL,
+    ended_at TIMESTAMP,                -- NULL while the timer is running
+    break_minutes INT NOT NULL DEFAULT 0,
+    billable BOOLEAN NOT NULL DEFAULT TRUE,
+    notes TEXT,
+    invoice_id UUID REFERENCES invoices(id),
+    created_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+-- one running timer per technician per job
+CREATE UNIQUE INDEX time_entries_running_idx
+    ON time_entries (job_id, user_name) WHERE ended_at IS NULL;
+
+-- A rate applies to a technician, a job type, both, or neither (the default).
+CREATE TABLE labour_rates (
+    id UUID PRIMARY KEY,
+    user_name TEXT,
+    job_type TEXT,
+    hourly_rate NUMERIC NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    UNIQUE NULLS NOT DISTINCT (user_name, job_type)
+);
+
+-- +goose Down
+DROP TABLE IF EXISTS labour_rates;
+DROP TABLE IF EXISTS time_entries;
+ALTER TABLE jobs DROP COLUMN IF EXISTS job_type;
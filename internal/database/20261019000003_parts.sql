@@ -0,0 +1,42 @@
+-- +goose Up
+CREATE TABLE parts (
+    id UUID PRIMARY KEY,
+    sku TEXT NOT NULL UNIQUE,
+    description TEXT NOT NULL,
+    cost_price NUMERIC NOT NULL DEFAULT 0,
+    sell_price NUMERIC NOT NULL DEFAULT 0,   -- cost plus markup
+    tax_rate NUMERIC NOT NULL DEFAULT 0,     -- percent
+    stock_quantity NUMERIC NOT NULL DEFAULT 0,
+    reorder_level NUMERIC NOT NULL DEFAULT 0,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+-- Parts used on a job, priced at the time they were used
+CREATE TABLE job_parts (
+    id UUID PRIMARY KEY,
+    job_id UUID NOT NULL REFERENCES jobs(id),
+    part_id UUID NOT NULL REFERENCES parts(id),
+    quantity NUMERIC NOT NULL,
+    unit_cost NUMERIC NOT NULL,
+    unit_price NUMERIC NOT NULL,
+    tax_rate NUMERIC NOT NULL DEFAULT 0,
+    used_by TEXT,
+    invoice_id UUID REFERENCES invoices(id),
+    created_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+-- Parts a job is waiting on; fulfilled when the part is used on the job
+CREATE TABLE job_part_waits (
+    id UUID PRIMARY KEY,
+    job_id UUID NOT NULL REFERENCES jobs(id),
+    part_id UUID NOT NULL REFERENCES parts(id),
+    quantity NUMERIC NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    fulfilled_at TIMESTAMP
+);
+
+-- +goose Down
+DROP TABLE IF EXISTS job_part_waits;
+DROP TABLE IF EXISTS job_parts;
+DROP TABLE IF EXISTS parts;
@@ -0,0 +1,37 @@
+-- +goose Up
+CREATE TABLE job_templates (
+    id UUID PRIMARY KEY,
+    name TEXT NOT NULL UNIQUE,          -- e.g. "Annual boiler service"
+    job_type TEXT,
+    title TEXT NOT NULL,
+    description TEXT,
+    estimate NUMERIC,
+    line_items JSONB NOT NULL DEFAULT '[]', -- standard invoice lines
+    created_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+CREATE TABLE job_template_checklist_items (
+    id UUID PRIMARY KEY,
+    template_id UUID NOT NULL REFERENCES job_templates(id) ON DELETE CASCADE,
+    label TEXT NOT NULL,
+    required BOOLEAN NOT NULL DEFAULT TRUE,
+    position INT NOT NULL
+);
+
+ALTER TABLE jobs ADD COLUMN template_id UUID REFERENCES job_templates(id);
+
+CREATE TABLE job_checklist_items (
+    id UUID PRIMARY KEY,
+    job_id UUID NOT NULL REFERENCES jobs(id),
+    label TEXT NOT NULL,
+    required BOOLEAN NOT NULL DEFAULT TRUE,
+    position INT NOT NULL,
+    checked_by TEXT,
+    checked_at TIMESTAMP
+);
+
+-- +goose Down
+DROP TABLE IF EXISTS job_checklist_items;
+ALTER TABLE jobs DROP COLUMN IF EXISTS template_id;
+DROP TABLE IF EXISTS job_template_checklist_items;
+DROP TABLE IF EXISTS job_templates;
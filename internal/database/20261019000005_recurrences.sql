@@ -0,0 +1,29 @@
+-- +goose Up
+CREATE TABLE recurrences (
+    id UUID PRIMARY KEY,
+    kind TEXT NOT NULL,                 -- job / invoice
+    rule TEXT NOT NULL,                 -- RRULE, e.g. FREQ=MONTHLY;INTERVAL=6
+    starts_at TIMESTAMP NOT NULL,
+    template_id UUID REFERENCES job_templates(id), -- kind = job
+    customer_id UUID REFERENCES customers(id),     -- kind = job
+    invoice_id UUID REFERENCES invoices(id),       -- kind = invoice, copied each time
+    status TEXT NOT NULL DEFAULT 'active',         -- active / paused
+    resumed_at TIMESTAMP,               -- occurrences missed while paused are not created
+    created_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+-- One row per materialised or skipped occurrence. The primary key is what
+-- makes materialising idempotent.
+CREATE TABLE recurrence_occurrences (
+    recurrence_id UUID NOT NULL REFERENCES recurrences(id),
+    occurs_at TIMESTAMP NOT NULL,
+    status TEXT NOT NULL,               -- pending / created / skipped
+    job_id UUID REFERENCES jobs(id),
+    invoice_id UUID REFERENCES invoices(id),
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (recurrence_id, occurs_at)
+);
+
+-- +goose Down
+DROP TABLE IF EXISTS recurrence_occurrences;
+DROP TABLE IF EXISTS recurrences;
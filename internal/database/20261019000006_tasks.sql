@@ -0,0 +1,24 @@
+-- +goose Up
+CREATE TABLE tasks (
+    id UUID PRIMARY KEY,
+    kind TEXT NOT NULL,                 -- e.g. invoice.pdf
+    payload JSONB NOT NULL,
+    status TEXT NOT NULL DEFAULT 'pending', -- pending / running / done / dead
+    attempts INT NOT NULL DEFAULT 0,
+    max_attempts INT NOT NULL DEFAULT 8,
+    run_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    locked_at TIMESTAMP,
+    last_error TEXT,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX tasks_due_idx ON tasks (run_at) WHERE status = 'pending';
+
+ALTER TABLE invoices ADD COLUMN pdf_status TEXT NOT NULL DEFAULT 'ready'; -- pending / ready
+ALTER TABLE quotes ADD COLUMN pdf_status TEXT NOT NULL DEFAULT 'ready';
+
+-- +goose Down
+ALTER TABLE quotes DROP COLUMN IF EXISTS pdf_status;
+ALTER TABLE invoices DROP COLUMN IF EXISTS pdf_status;
+DROP TABLE IF EXISTS tasks;
@@ -0,0 +1,35 @@
+-- +goose Up
+CREATE TABLE document_emails (
+    id UUID PRIMARY KEY,
+    invoice_id UUID REFERENCES invoices(id),
+    quote_id UUID REFERENCES quotes(id),
+    template TEXT NOT NULL,            -- invoice / quote
+    to_address TEXT NOT NULL,
+    cc TEXT[] NOT NULL DEFAULT '{}',
+    bcc TEXT[] NOT NULL DEFAULT '{}',
+    message TEXT,                      -- optional note added to the body
+    subject TEXT,
+    status TEXT NOT NULL DEFAULT 'queued', -- queued / sent / failed
+    attempts INT NOT NULL DEFAULT 0,
+    last_error TEXT,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    sent_at TIMESTAMP,
+    CHECK ((invoice_id IS NULL) <> (quote_id IS NULL))
+);
+
+CREATE INDEX document_emails_invoice_idx ON document_emails (invoice_id);
+CREATE INDEX document_emails_quote_idx ON document_emails (quote_id);
+
+-- Latest delivery status, so it can be shown without reading the history
+ALTER TABLE invoices
+    ADD COLUMN email_status TEXT,      -- NULL until first sent
+    ADD COLUMN last_emailed_at TIMESTAMP;
+
+ALTER TABLE quotes
+    ADD COLUMN email_status TEXT,
+    ADD COLUMN last_emailed_at TIMESTAMP;
+
+-- +goose Down
+ALTER TABLE quotes DROP COLUMN IF EXISTS last_emailed_at, DROP COLUMN IF EXISTS email_status;
+ALTER TABLE invoices DROP COLUMN IF EXISTS last_emailed_at, DROP COLUMN IF EXISTS email_status;
+DROP TABLE IF EXISTS document_emails;
@@ -0,0 +1,58 @@
+-- +goose Up
+-- Single-row table of business-wide billing settings
+CREATE TABLE billing_settings (
+    id INT PRIMARY KEY DEFAULT 1 CHECK (id = 1),
+    payment_terms_days INT NOT NULL DEFAULT 14,
+    reminder_offsets INT[] NOT NULL DEFAULT '{-3,0,7,14}', -- days relative to the due date
+    reminders_enabled BOOLEAN NOT NULL DEFAULT TRUE,
+    updated_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+INSERT INTO billing_settings (id) VALUES (1);
+
+ALTER TABLE customers ADD COLUMN payment_terms_days INT; -- NULL: business default
+
+ALTER TABLE invoices
+    ADD COLUMN customer_id UUID REFERENCES customers(id),
+    ADD COLUMN status TEXT NOT NULL DEFAULT 'issued', -- issued / overdue / paid
+    ADD COLUMN amount_paid NUMERIC NOT NULL DEFAULT 0,
+    ADD COLUMN paid_at TIMESTAMP;
+
+UPDATE invoices i SET customer_id = j.customer_id FROM jobs j WHERE i.job_id = j.id;
+
+CREATE INDEX invoices_unpaid_idx ON invoices (due_date) WHERE status IN ('issued', 'overdue');
+
+CREATE TABLE invoice_payments (
+    id UUID PRIMARY KEY,
+    invoice_id UUID NOT NULL REFERENCES invoices(id),
+    amount NUMERIC NOT NULL CHECK (amount > 0),
+    method TEXT,                       -- e.g. bank transfer, card, cash
+    reference TEXT,
+    paid_at TIMESTAMP NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX invoice_payments_invoice_idx ON invoice_payments (invoice_id);
+
+-- One row per scheduled reminder, so each is only ever sent once
+CREATE TABLE invoice_reminders (
+    id UUID PRIMARY KEY,
+    invoice_id UUID NOT NULL REFERENCES invoices(id),
+    offset_days INT NOT NULL,
+    status TEXT NOT NULL,              -- queued / skipped
+    email_id UUID REFERENCES document_emails(id),
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    UNIQUE (invoice_id, offset_days)
+);
+
+-- +goose Down
+DROP TABLE IF EXISTS invoice_reminders;
+DROP TABLE IF EXISTS invoice_payments;
+DROP INDEX IF EXISTS invoices_unpaid_idx;
+ALTER TABLE invoices
+    DROP COLUMN IF EXISTS paid_at,
+    DROP COLUMN IF EXISTS amount_paid,
+    DROP COLUMN IF EXISTS status,
+    DROP COLUMN IF EXISTS customer_id;
+ALTER TABLE customers DROP COLUMN IF EXISTS payment_terms_days;
+DROP TABLE IF EXISTS billing_settings;
@@ -0,0 +1,31 @@
+-- +goose Up
+CREATE TABLE credit_notes (
+    id UUID PRIMARY KEY,
+    credit_note_number TEXT NOT NULL UNIQUE, -- own series, e.g. CRN-2026-0001
+    invoice_id UUID NOT NULL REFERENCES invoices(id),
+    reason TEXT NOT NULL,
+    items JSONB NOT NULL,              -- credited lines, positive amounts
+    subtotal NUMERIC NOT NULL,
+    tax_rate NUMERIC NOT NULL,
+    tax_amount NUMERIC NOT NULL,
+    total NUMERIC NOT NULL,            -- positive; printed as a negative
+    pdf_status TEXT NOT NULL DEFAULT 'pending',
+    pdf_url TEXT,
+    issue_date TIMESTAMP NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX credit_notes_invoice_idx ON credit_notes (invoice_id);
+
+-- Invoices are never deleted: voiding keeps the row with who/why/when
+ALTER TABLE invoices
+    ADD COLUMN amount_credited NUMERIC NOT NULL DEFAULT 0,
+    ADD COLUMN voided_at TIMESTAMP,
+    ADD COLUMN void_reason TEXT;
+
+-- +goose Down
+ALTER TABLE invoices
+    DROP COLUMN IF EXISTS void_reason,
+    DROP COLUMN IF EXISTS voided_at,
+    DROP COLUMN IF EXISTS amount_credited;
+DROP TABLE IF EXISTS credit_notes;
@@ -0,0 +1,44 @@
+-- +goose Up
+-- Line discounts live in the items JSON; everything else is stored as
+-- its own column so totals never have to be recalculated from scratch
+ALTER TABLE invoices
+    ADD COLUMN kind TEXT NOT NULL DEFAULT 'standard', -- standard / deposit
+    ADD COLUMN line_discount_total NUMERIC NOT NULL DEFAULT 0,
+    ADD COLUMN discount_type TEXT,                    -- percent / fixed
+    ADD COLUMN discount_value NUMERIC NOT NULL DEFAULT 0,
+    ADD COLUMN discount_amount NUMERIC NOT NULL DEFAULT 0,
+    ADD COLUMN surcharges JSONB NOT NULL DEFAULT '[]',
+    ADD COLUMN surcharge_total NUMERIC NOT NULL DEFAULT 0,
+    ADD COLUMN deposit_applied NUMERIC NOT NULL DEFAULT 0, -- paid deposits deducted from total
+    ADD COLUMN applied_to_invoice_id UUID REFERENCES invoices(id); -- deposits: the final invoice
+
+CREATE INDEX invoices_open_deposits_idx ON invoices (job_id)
+    WHERE kind = 'deposit' AND applied_to_invoice_id IS NULL;
+
+ALTER TABLE credit_notes
+    ADD COLUMN line_discount_total NUMERIC NOT NULL DEFAULT 0,
+    ADD COLUMN discount_type TEXT,
+    ADD COLUMN discount_value NUMERIC NOT NULL DEFAULT 0,
+    ADD COLUMN discount_amount NUMERIC NOT NULL DEFAULT 0,
+    ADD COLUMN surcharges JSONB NOT NULL DEFAULT '[]',
+    ADD COLUMN surcharge_total NUMERIC NOT NULL DEFAULT 0;
+
+-- +goose Down
+ALTER TABLE credit_notes
+    DROP COLUMN IF EXISTS surcharge_total,
+    DROP COLUMN IF EXISTS surcharges,
+    DROP COLUMN IF EXISTS discount_amount,
+    DROP COLUMN IF EXISTS discount_value,
+    DROP COLUMN IF EXISTS discount_type,
+    DROP COLUMN IF EXISTS line_discount_total;
+DROP INDEX IF EXISTS invoices_open_deposits_idx;
+ALTER TABLE invoices
+    DROP COLUMN IF EXISTS applied_to_invoice_id,
+    DROP COLUMN IF EXISTS deposit_applied,
+    DROP COLUMN IF EXISTS surcharge_total,
+    DROP COLUMN IF EXISTS surcharges,
+    DROP COLUMN IF EXISTS discount_amount,
+    DROP COLUMN IF EXISTS discount_value,
+    DROP COLUMN IF EXISTS discount_type,
+    DROP COLUMN IF EXISTS line_discount_total,
+    DROP COLUMN IF EXISTS kind;
@@ -0,0 +1,6 @@
+-- +goose Up
+-- Customers who receive Factur-X (PDF/A-3 with embedded CII XML) invoice PDFs
+ALTER TABLE customers ADD COLUMN facturx BOOLEAN NOT NULL DEFAULT FALSE;
+
+-- +goose Down
+ALTER TABLE customers DROP COLUMN IF EXISTS facturx;
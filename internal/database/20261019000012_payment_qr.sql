@@ -0,0 +1,6 @@
+-- +goose Up
+-- Whether invoice PDFs carry a payment QR code (EPC for EUR, else the payment link)
+ALTER TABLE billing_settings ADD COLUMN payment_qr BOOLEAN NOT NULL DEFAULT TRUE;
+
+-- +goose Down
+ALTER TABLE billing_settings DROP COLUMN IF EXISTS payment_qr;
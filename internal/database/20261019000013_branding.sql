@@ -0,0 +1,18 @@
+-- +goose Up
+-- Single-row table of the business's document branding
+CREATE TABLE branding_settings (
+    id INT PRIMARY KEY DEFAULT 1 CHECK (id = 1),
+    template TEXT NOT NULL DEFAULT 'classic', -- classic / modern / compact
+    primary_color TEXT NOT NULL DEFAULT '#000000',
+    accent_color TEXT NOT NULL DEFAULT '#E6E6E6',
+    font TEXT NOT NULL DEFAULT 'Roboto', -- family with TTFs in assets/font
+    logo_position TEXT NOT NULL DEFAULT 'right', -- left / right / none
+    hidden_sections TEXT[] NOT NULL DEFAULT '{}',
+    footer_text TEXT NOT NULL DEFAULT '',
+    updated_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+INSERT INTO branding_settings (id) VALUES (1);
+
+-- +goose Down
+DROP TABLE IF EXISTS branding_settings;
@@ -0,0 +1,8 @@
+-- +goose Up
+-- Language of the invoices, credit notes and quotes a customer receives
+ALTER TABLE customers ADD COLUMN language TEXT NOT NULL DEFAULT 'en'; -- en / cy / fr / de
+ALTER TABLE quotes ADD COLUMN language TEXT NOT NULL DEFAULT 'en';
+
+-- +goose Down
+ALTER TABLE quotes DROP COLUMN IF EXISTS language;
+ALTER TABLE customers DROP COLUMN IF EXISTS language;
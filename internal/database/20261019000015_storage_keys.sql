@@ -0,0 +1,23 @@
+-- +goose Up
+-- Files are addressed by storage key ("invoices/<id>.pdf") rather than
+-- by the /uploads/ URL they were served from
+ALTER TABLE invoices RENAME COLUMN pdf_url TO pdf_key;
+ALTER TABLE quotes RENAME COLUMN pdf_url TO pdf_key;
+ALTER TABLE credit_notes RENAME COLUMN pdf_url TO pdf_key;
+ALTER TABLE job_photos RENAME COLUMN file_url TO file_key;
+
+UPDATE invoices SET pdf_key = substr(pdf_key, length('/uploads/') + 1) WHERE pdf_key LIKE '/uploads/%';
+UPDATE quotes SET pdf_key = substr(pdf_key, length('/uploads/') + 1) WHERE pdf_key LIKE '/uploads/%';
+UPDATE credit_notes SET pdf_key = substr(pdf_key, length('/uploads/') + 1) WHERE pdf_key LIKE '/uploads/%';
+UPDATE job_photos SET file_key = substr(file_key, length('/uploads/') + 1) WHERE file_key LIKE '/uploads/%';
+
+-- +goose Down
+UPDATE job_photos SET file_key = '/uploads/' || file_key;
+UPDATE credit_notes SET pdf_key = '/uploads/' || pdf_key WHERE pdf_key IS NOT NULL;
+UPDATE quotes SET pdf_key = '/uploads/' || pdf_key WHERE pdf_key IS NOT NULL;
+UPDATE invoices SET pdf_key = '/uploads/' || pdf_key WHERE pdf_key IS NOT NULL;
+
+ALTER TABLE job_photos RENAME COLUMN file_key TO file_url;
+ALTER TABLE credit_notes RENAME COLUMN pdf_key TO pdf_url;
+ALTER TABLE quotes RENAME COLUMN pdf_key TO pdf_url;
+ALTER TABLE invoices RENAME COLUMN pdf_key TO pdf_url;
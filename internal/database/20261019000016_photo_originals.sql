@@ -0,0 +1,9 @@
+-- +goose Up
+-- Uploaded photos are kept as sent (original_key, staff only) and as a
+-- copy without GPS coordinates (file_key), which customers see
+ALTER TABLE job_photos ADD COLUMN original_key TEXT;
+ALTER TABLE job_photos ADD COLUMN content_type TEXT; -- sniffed from the content, e.g. image/jpeg
+
+-- +goose Down
+ALTER TABLE job_photos DROP COLUMN IF EXISTS content_type;
+ALTER TABLE job_photos DROP COLUMN IF EXISTS original_key;
@@ -0,0 +1,10 @@
+-- +goose Up
+-- Resized copies of each photo, made in the background after upload
+ALTER TABLE job_photos ADD COLUMN thumbnail_key TEXT;
+ALTER TABLE job_photos ADD COLUMN medium_key TEXT;
+ALTER TABLE job_photos ADD COLUMN variants_status TEXT NOT NULL DEFAULT 'pending'; -- pending / ready / failed / unsupported
+
+-- +goose Down
+ALTER TABLE job_photos DROP COLUMN IF EXISTS variants_status;
+ALTER TABLE job_photos DROP COLUMN IF EXISTS medium_key;
+ALTER TABLE job_photos DROP COLUMN IF EXISTS thumbnail_key;
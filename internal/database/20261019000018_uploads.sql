@@ -0,0 +1,45 @@
+-- +goose Up
+-- Files kept with a job besides photos: certificates, manuals, signed forms
+CREATE TABLE job_attachments (
+    id UUID PRIMARY KEY,
+    job_id UUID NOT NULL REFERENCES jobs(id),
+    file_name TEXT NOT NULL,           -- as sent by the client, for downloads
+    content_type TEXT NOT NULL,
+    size_bytes BIGINT NOT NULL,
+    file_key TEXT NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX job_attachments_job_idx ON job_attachments (job_id);
+
+-- Resumable uploads, sent in chunks from a known offset
+CREATE TABLE uploads (
+    id UUID PRIMARY KEY,
+    job_id UUID NOT NULL REFERENCES jobs(id),
+    upload_type TEXT NOT NULL,         -- photo / attachment
+    file_name TEXT NOT NULL,
+    size_bytes BIGINT NOT NULL,
+    received_bytes BIGINT NOT NULL DEFAULT 0,
+    status TEXT NOT NULL DEFAULT 'open', -- open / processing / complete / rejected
+    error TEXT,
+    result_id UUID,                    -- the photo or attachment, once complete
+    expires_at TIMESTAMP NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX uploads_expires_idx ON uploads (expires_at);
+
+CREATE TABLE upload_chunks (
+    id UUID PRIMARY KEY,
+    upload_id UUID NOT NULL REFERENCES uploads(id) ON DELETE CASCADE,
+    offset_bytes BIGINT NOT NULL,
+    size_bytes BIGINT NOT NULL,
+    chunk_key TEXT NOT NULL,
+    UNIQUE (upload_id, offset_bytes)
+);
+
+-- +goose Down
+DROP TABLE IF EXISTS upload_chunks;
+DROP TABLE IF EXISTS uploads;
+DROP TABLE IF EXISTS job_attachments;
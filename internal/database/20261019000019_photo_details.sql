@@ -0,0 +1,29 @@
+-- +goose Up
+ALTER TABLE job_photos
+    ADD COLUMN caption TEXT,
+    ADD COLUMN category TEXT CHECK (category IN ('before', 'during', 'after', 'issue', 'receipt')),
+    ADD COLUMN sort_order INT NOT NULL DEFAULT 0,
+    ADD COLUMN taken_at TIMESTAMP,     -- from EXIF, in the camera's local time
+    ADD COLUMN uploaded_by TEXT,
+    -- An after photo points to the before photo it pairs with
+    ADD COLUMN before_photo_id UUID UNIQUE REFERENCES job_photos(id) ON DELETE SET NULL;
+
+-- Details for a resumable photo upload, given when it starts
+ALTER TABLE uploads
+    ADD COLUMN caption TEXT,
+    ADD COLUMN category TEXT,
+    ADD COLUMN uploaded_by TEXT;
+
+-- +goose Down
+ALTER TABLE uploads
+    DROP COLUMN IF EXISTS uploaded_by,
+    DROP COLUMN IF EXISTS category,
+    DROP COLUMN IF EXISTS caption;
+
+ALTER TABLE job_photos
+    DROP COLUMN IF EXISTS before_photo_id,
+    DROP COLUMN IF EXISTS uploaded_by,
+    DROP COLUMN IF EXISTS taken_at,
+    DROP COLUMN IF EXISTS sort_order,
+    DROP COLUMN IF EXISTS category,
+    DROP COLUMN IF EXISTS caption;
@@ -0,0 +1,29 @@
+-- +goose Up
+-- SHA-256 hashes, in hex, of stored files, checked by cmd/verify-storage.
+-- Files stored before this have none and are only checked for existence.
+ALTER TABLE job_photos
+    ADD COLUMN sha256 TEXT,           -- the photo as uploaded (original_key)
+    ADD COLUMN file_sha256 TEXT;      -- the copy customers see (file_key)
+
+-- The same photo uploaded twice to a job is kept once
+CREATE UNIQUE INDEX job_photos_job_id_sha256_key ON job_photos (job_id, sha256);
+
+ALTER TABLE job_attachments ADD COLUMN sha256 TEXT;
+CREATE UNIQUE INDEX job_attachments_job_id_sha256_key ON job_attachments (job_id, sha256);
+
+ALTER TABLE invoices ADD COLUMN pdf_sha256 TEXT;
+ALTER TABLE quotes ADD COLUMN pdf_sha256 TEXT;
+ALTER TABLE credit_notes ADD COLUMN pdf_sha256 TEXT;
+
+-- +goose Down
+ALTER TABLE credit_notes DROP COLUMN IF EXISTS pdf_sha256;
+ALTER TABLE quotes DROP COLUMN IF EXISTS pdf_sha256;
+ALTER TABLE invoices DROP COLUMN IF EXISTS pdf_sha256;
+
+DROP INDEX IF EXISTS job_attachments_job_id_sha256_key;
+ALTER TABLE job_attachments DROP COLUMN IF EXISTS sha256;
+
+DROP INDEX IF EXISTS job_photos_job_id_sha256_key;
+ALTER TABLE job_photos
+    DROP COLUMN IF EXISTS file_sha256,
+    DROP COLUMN IF EXISTS sha256;
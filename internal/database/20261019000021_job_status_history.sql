@@ -0,0 +1,21 @@
+-- +goose Up
+-- Each change of a job's status. A job starts as 'new' when it is created.
+CREATE TABLE job_status_history (
+    id UUID PRIMARY KEY,
+    job_id UUID NOT NULL REFERENCES jobs(id) ON DELETE CASCADE,
+    from_status TEXT NOT NULL,
+    status TEXT NOT NULL,
+    changed_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX job_status_history_job_id_idx ON job_status_history (job_id, changed_at);
+
+-- Jobs that moved on before history was kept get their latest change,
+-- dated by when the job was last updated
+INSERT INTO job_status_history (id, job_id, from_status, status, changed_at)
+SELECT gen_random_uuid(), id, 'new', status, COALESCE(updated_at, created_at, NOW())
+FROM jobs
+WHERE status <> 'new';
+
+-- +goose Down
+DROP TABLE IF EXISTS job_status_history;
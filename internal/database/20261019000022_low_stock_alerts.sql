@@ -0,0 +1,9 @@
+-- +goose Up
+-- When a part last fell to or below its reorder level; NULL while it is
+-- above it. Shown by GET /parts/low-stock so the alert isn't lost.
+ALTER TABLE parts ADD COLUMN low_stock_since TIMESTAMP;
+
+UPDATE parts SET low_stock_since = updated_at WHERE stock_quantity <= reorder_level;
+
+-- +goose Down
+ALTER TABLE parts DROP COLUMN IF EXISTS low_stock_since;
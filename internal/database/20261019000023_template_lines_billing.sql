@@ -0,0 +1,16 @@
+-- +goose Up
+-- The invoice that billed a job's template line items, like invoice_id on
+-- time_entries and job_parts. Cleared when that invoice is voided.
+ALTER TABLE jobs ADD COLUMN template_lines_invoice_id UUID REFERENCES invoices(id);
+
+UPDATE jobs j
+SET template_lines_invoice_id = (
+    SELECT i.id FROM invoices i
+    WHERE i.job_id = j.id AND i.kind = 'standard' AND i.status <> 'void'
+    ORDER BY i.created_at
+    LIMIT 1
+)
+WHERE j.template_id IS NOT NULL;
+
+-- +goose Down
+ALTER TABLE jobs DROP COLUMN IF EXISTS template_lines_invoice_id;
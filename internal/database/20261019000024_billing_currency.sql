@@ -0,0 +1,18 @@
+-- +goose Up
+-- Currency invoices are issued in, and the IBAN and BIC printed on them
+-- and used for EPC payment QR codes on EUR invoices
+ALTER TABLE billing_settings
+    ADD COLUMN currency TEXT NOT NULL DEFAULT 'GBP', -- ISO 4217
+    ADD COLUMN iban TEXT NOT NULL DEFAULT '',
+    ADD COLUMN bic TEXT NOT NULL DEFAULT '';
+
+-- Invoices keep the currency they were issued in
+ALTER TABLE invoices ADD COLUMN currency TEXT NOT NULL DEFAULT 'GBP';
+
+-- +goose Down
+ALTER TABLE invoices DROP COLUMN IF EXISTS currency;
+
+ALTER TABLE billing_settings
+    DROP COLUMN IF EXISTS bic,
+    DROP COLUMN IF EXISTS iban,
+    DROP COLUMN IF EXISTS currency;
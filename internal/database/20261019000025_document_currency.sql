@@ -0,0 +1,17 @@
+-- +goose Up
+-- Quotes and credit notes keep their currency too, so a change to the
+-- billing currency only affects documents created after it. Credit notes
+-- take their invoice's currency; existing quotes keep the one they have
+-- been shown in so far
+ALTER TABLE quotes ADD COLUMN currency TEXT NOT NULL DEFAULT 'GBP';
+ALTER TABLE credit_notes ADD COLUMN currency TEXT NOT NULL DEFAULT 'GBP';
+
+UPDATE quotes SET currency = billing_settings.currency
+FROM billing_settings WHERE billing_settings.id = 1;
+
+UPDATE credit_notes SET currency = invoices.currency
+FROM invoices WHERE invoices.id = credit_notes.invoice_id;
+
+-- +goose Down
+ALTER TABLE credit_notes DROP COLUMN IF EXISTS currency;
+ALTER TABLE quotes DROP COLUMN IF EXISTS currency;
@@ -0,0 +1,313 @@
+package einvoice
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"pistachio/internal/models"
+)
+
+const (
+	invoiceTypeCommercial = "380"
+	unitCodeOne           = "C62"
+	endpointSchemeEmail   = "EM"
+	vatScheme             = "VAT"
+	notSubjectToVAT       = "Not subject to VAT"
+)
+
+var categoryOrder = map[string]int{"S": 0, "Z": 1, "O": 2}
+
+// taxKey identifies a VAT category and rate.
+type taxKey struct {
+	ID   string
+	Rate float64
+}
+
+func (k taxKey) category() TaxCategory {
+	c := TaxCategory{ID: k.ID, TaxScheme: TaxScheme{ID: vatScheme}}
+	if k.ID == "O" {
+		c.ExemptionReason = notSubjectToVAT
+		return c
+	}
+	rate := k.Rate
+	c.Percent = &rate
+	return c
+}
+
+// lineCategory picks the VAT category for a rate. A business without a
+// VAT number isn't VAT registered, so its zero-rate lines are outside the
+// scope of VAT rather than zero rated.
+func lineCategory(rate float64, vatRegistered bool) taxKey {
+	switch {
+	case rate > 0:
+		return taxKey{ID: "S", Rate: rate}
+	case vatRegistered:
+		return taxKey{ID: "Z", Rate: 0}
+	default:
+		return taxKey{ID: "O"}
+	}
+}
+
+// vatID prefixes a VAT number with its country code if it lacks one.
+func vatID(number, country string) string {
+	number = strings.ReplaceAll(strings.ToUpper(strings.TrimSpace(number)), " ", "")
+	if len(number) >= 2 && number[0] >= 'A' && number[0] <= 'Z' && number[1] >= 'A' && number[1] <= 'Z' {
+		return number
+	}
+	return country + number
+}
+
+// BuildUBL maps an invoice to a Peppol BIS Billing 3.0 UBL invoice. The
+// invoice discount becomes one document allowance per VAT category and
+// each surcharge a document charge. Tax is totalled per category; any
+// rounding difference from the invoice's own tax is put on the largest
+// category, so the payable amount matches the PDF.
+func BuildUBL(data models.InvoiceData) *Invoice {
+	currency := data.CurrencyCode()
+	amount := func(v float64) Amount { return Amount{Currency: currency, Value: round2(v)} }
+
+	sellerCountry := countryCode(data.Business.BusinessAddress.Country, "GB")
+	buyerCountry := countryCode(data.Customer.CustomerAddress.Country, sellerCountry)
+	vatRegistered := strings.TrimSpace(data.Business.VATNumber) != ""
+
+	inv := &Invoice{
+		Xmlns: ublInvoiceNS,
+		Cac:   ublCacNS,
+		Cbc:   ublCbcNS,
+
+		CustomizationID:      CustomizationID,
+		ProfileID:            ProfileID,
+		ID:                   data.InvoiceNumber,
+		IssueDate:            data.IssueDate.Format("2006-01-02"),
+		InvoiceTypeCode:      invoiceTypeCommercial,
+		Note:                 data.FooterNotes,
+		DocumentCurrencyCode: currency,
+		BuyerReference:       data.Reference,
+	}
+
+	if !data.DueDate.IsZero() {
+		inv.DueDate = data.DueDate.Format("2006-01-02")
+	}
+
+	// Without a purchase order reference, the invoice number lets the
+	// buyer match the invoice
+	if inv.BuyerReference == "" {
+		inv.BuyerReference = data.InvoiceNumber
+	}
+
+	// --- Parties ---
+	seller := Party{
+		EndpointID: Identifier{SchemeID: endpointSchemeEmail, Value: data.Business.Email},
+		PartyName:  &PartyName{Name: data.Business.Name},
+		PostalAddress: Address{
+			StreetName:           data.Business.BusinessAddress.Line1,
+			AdditionalStreetName: data.Business.BusinessAddress.Line2,
+			CityName:             data.Business.BusinessAddress.City,
+			PostalZone:           data.Business.BusinessAddress.Postcode,
+			Country:              Country{IdentificationCode: sellerCountry},
+		},
+		PartyLegalEntity: LegalEntity{RegistrationName: data.Business.Name, CompanyID: data.Business.CompanyReg},
+	}
+
+	if vatRegistered {
+		seller.PartyTaxScheme = &PartyTaxScheme{
+			CompanyID: vatID(data.Business.VATNumber, sellerCountry),
+			TaxScheme: TaxScheme{ID: vatScheme},
+		}
+	}
+
+	if data.Business.Phone != "" || data.Business.Email != "" {
+		seller.Contact = &Contact{Telephone: data.Business.Phone, ElectronicMail: data.Business.Email}
+	}
+
+	buyer := Party{
+		EndpointID: Identifier{SchemeID: endpointSchemeEmail, Value: data.Customer.Email},
+		PostalAddress: Address{
+			StreetName:           data.Customer.CustomerAddress.Line1,
+			AdditionalStreetName: data.Customer.CustomerAddress.Line2,
+			CityName:             data.Customer.CustomerAddress.City,
+			PostalZone:           data.Customer.CustomerAddress.Postcode,
+			Country:              Country{IdentificationCode: buyerCountry},
+		},
+		PartyLegalEntity: LegalEntity{RegistrationName: data.Customer.Name},
+	}
+
+	if data.Customer.Email != "" {
+		buyer.Contact = &Contact{ElectronicMail: data.Customer.Email}
+	}
+
+	inv.Supplier.Party = seller
+	inv.Customer.Party = buyer
+
+	// --- Payment ---
+	p := data.Payment
+	switch {
+	case p.IBAN != "":
+		code := "30"
+		if currency == "EUR" {
+			code = "58" // SEPA credit transfer
+		}
+		account := &FinancialAccount{ID: strings.ReplaceAll(p.IBAN, " ", ""), Name: p.AccountName}
+		if p.BIC != "" {
+			account.Branch = &Branch{ID: p.BIC}
+		}
+		inv.PaymentMeans = &PaymentMeans{Code: code, PaymentID: data.InvoiceNumber, Account: account}
+
+	case p.AccountNumber != "":
+		account := &FinancialAccount{ID: p.AccountNumber, Name: p.AccountName}
+		if p.SortCode != "" {
+			account.Branch = &Branch{ID: strings.ReplaceAll(p.SortCode, "-", "")}
+		}
+		inv.PaymentMeans = &PaymentMeans{Code: "30", PaymentID: data.InvoiceNumber, Account: account}
+	}
+
+	if p.Notes != "" {
+		inv.PaymentTerms = &PaymentTerms{Note: p.Notes}
+	}
+
+	// --- Lines ---
+	lineNet := map[taxKey]float64{}
+	lineTotal := 0.0
+
+	for i, item := range data.Items {
+		key := lineCategory(item.TaxRate, vatRegistered)
+
+		line := InvoiceLine{
+			ID:                  fmt.Sprint(i + 1),
+			InvoicedQuantity:    Quantity{UnitCode: unitCodeOne, Value: item.Quantity},
+			LineExtensionAmount: amount(item.LineTotal),
+			Item:                Item{Name: item.Description, ClassifiedTaxCategory: key.category()},
+			Price:               Price{PriceAmount: Amount{Currency: currency, Value: item.UnitPrice}},
+		}
+
+		if item.DiscountAmount > 0 {
+			line.AllowanceCharges = append(line.AllowanceCharges, AllowanceCharge{
+				Reason: "Discount",
+				Amount: amount(item.DiscountAmount),
+			})
+		}
+
+		inv.Lines = append(inv.Lines, line)
+		lineNet[key] += round2(item.LineTotal)
+		lineTotal += round2(item.LineTotal)
+	}
+
+	keys := make([]taxKey, 0, len(lineNet))
+	for key := range lineNet {
+		keys = append(keys, key)
+	}
+
+	// --- Document allowances and charges ---
+	allowances := map[taxKey]float64{}
+	charges := map[taxKey]float64{}
+
+	for _, s := range data.Surcharges {
+		key := lineCategory(s.TaxRate, vatRegistered)
+		charges[key] += round2(s.Amount)
+		if _, ok := lineNet[key]; !ok {
+			lineNet[key] = 0
+			keys = append(keys, key)
+		}
+	}
+
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].ID != keys[j].ID {
+			return categoryOrder[keys[i].ID] < categoryOrder[keys[j].ID]
+		}
+		return keys[i].Rate > keys[j].Rate
+	})
+
+	if data.Totals.Discount > 0 && lineTotal > 0 {
+		allocated := 0.0
+		var largest taxKey
+		for _, key := range keys {
+			allowances[key] = round2(data.Totals.Discount * lineNet[key] / lineTotal)
+			allocated += allowances[key]
+			if lineNet[key] > lineNet[largest] {
+				largest = key
+			}
+		}
+		allowances[largest] = round2(allowances[largest] + data.Totals.Discount - allocated)
+	}
+
+	for _, key := range keys {
+		if allowances[key] > 0 {
+			category := key.category()
+			inv.AllowanceCharges = append(inv.AllowanceCharges, AllowanceCharge{
+				Reason:      "Discount",
+				Amount:      amount(allowances[key]),
+				TaxCategory: &category,
+			})
+		}
+	}
+
+	for _, s := range data.Surcharges {
+		category := lineCategory(s.TaxRate, vatRegistered).category()
+		inv.AllowanceCharges = append(inv.AllowanceCharges, AllowanceCharge{
+			ChargeIndicator: true,
+			Reason:          s.Description,
+			Amount:          amount(s.Amount),
+			TaxCategory:     &category,
+		})
+	}
+
+	// --- Tax breakdown ---
+	taxTotal := 0.0
+	largest := -1
+
+	for _, key := range keys {
+		taxable := round2(lineNet[key] - allowances[key] + charges[key])
+		tax := round2(taxable * key.Rate / 100)
+
+		inv.TaxTotal.Subtotals = append(inv.TaxTotal.Subtotals, TaxSubtotal{
+			TaxableAmount: amount(taxable),
+			TaxAmount:     amount(tax),
+			Category:      key.category(),
+		})
+		taxTotal += tax
+
+		if key.Rate > 0 && (largest < 0 || tax > inv.TaxTotal.Subtotals[largest].TaxAmount.Value) {
+			largest = len(inv.TaxTotal.Subtotals) - 1
+		}
+	}
+
+	if diff := round2(data.Totals.TaxAmount - taxTotal); diff != 0 && largest >= 0 {
+		inv.TaxTotal.Subtotals[largest].TaxAmount.Value = round2(inv.TaxTotal.Subtotals[largest].TaxAmount.Value + diff)
+		taxTotal += diff
+	}
+
+	inv.TaxTotal.TaxAmount = amount(taxTotal)
+
+	// --- Totals ---
+	allowanceTotal := round2(data.Totals.Discount)
+	chargeTotal := 0.0
+	for _, v := range charges {
+		chargeTotal += v
+	}
+
+	exclusive := round2(lineTotal - allowanceTotal + chargeTotal)
+	inclusive := round2(exclusive + taxTotal)
+
+	inv.LegalMonetaryTotal = MonetaryTotal{
+		LineExtensionAmount: amount(lineTotal),
+		TaxExclusiveAmount:  amount(exclusive),
+		TaxInclusiveAmount:  amount(inclusive),
+		PayableAmount:       amount(inclusive - data.Totals.DepositApplied),
+	}
+
+	if allowanceTotal > 0 {
+		a := amount(allowanceTotal)
+		inv.LegalMonetaryTotal.AllowanceTotalAmount = &a
+	}
+	if chargeTotal > 0 {
+		c := amount(chargeTotal)
+		inv.LegalMonetaryTotal.ChargeTotalAmount = &c
+	}
+	if data.Totals.DepositApplied > 0 {
+		d := amount(data.Totals.DepositApplied)
+		inv.LegalMonetaryTotal.PrepaidAmount = &d
+	}
+
+	return inv
+}
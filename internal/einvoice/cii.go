@@ -0,0 +1,471 @@
+package einvoice
+
+import (
+	"encoding/xml"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"pistachio/internal/models"
+)
+
+// Factur-X / ZUGFeRD identifiers for the EN 16931 profile
+const (
+	FacturXGuideline = "urn:cen.eu:en16931:2017"
+	FacturXFileName  = "factur-x.xml"
+	FacturXLevel     = "EN 16931"
+
+	ciiRsmNS = "urn:un:unece:uncefact:data:standard:CrossIndustryInvoice:100"
+	ciiRamNS = "urn:un:unece:uncefact:data:standard:ReusableAggregateBusinessInformationEntity:100"
+	ciiUdtNS = "urn:un:unece:uncefact:data:standard:UnqualifiedDataType:100"
+	ciiQdtNS = "urn:un:unece:uncefact:data:standard:QualifiedDataType:100"
+
+	ciiDateFormat = "102" // YYYYMMDD
+)
+
+// ValidationError is returned when an invoice can't be exported because
+// it breaks EN 16931 rules.
+type ValidationError []Violation
+
+func (e ValidationError) Error() string {
+	msgs := make([]string, len(e))
+	for i, v := range e {
+		msgs[i] = v.Error()
+	}
+	return "invoice does not meet EN 16931: " + strings.Join(msgs, "; ")
+}
+
+// ciiAmount is a CII amount. Unlike UBL, only the tax total carries a
+// currency.
+type ciiAmount struct {
+	Currency string
+	Value    float64
+}
+
+func (a ciiAmount) MarshalXML(e *xml.Encoder, start xml.StartElement) error {
+	if a.Currency != "" {
+		start.Attr = append(start.Attr, xml.Attr{Name: xml.Name{Local: "currencyID"}, Value: a.Currency})
+	}
+	return e.EncodeElement(fmt.Sprintf("%.2f", a.Value), start)
+}
+
+// ciiDate is a date written as udt:DateTimeString in format 102.
+type ciiDate struct {
+	Value string
+}
+
+func (d ciiDate) MarshalXML(e *xml.Encoder, start xml.StartElement) error {
+	inner := xml.StartElement{
+		Name: xml.Name{Local: "udt:DateTimeString"},
+		Attr: []xml.Attr{{Name: xml.Name{Local: "format"}, Value: ciiDateFormat}},
+	}
+	if err := e.EncodeToken(start); err != nil {
+		return err
+	}
+	if err := e.EncodeElement(d.Value, inner); err != nil {
+		return err
+	}
+	return e.EncodeToken(start.End())
+}
+
+type ciiIndicator struct {
+	Value bool `xml:"udt:Indicator"`
+}
+
+type ciiID struct {
+	SchemeID string `xml:"schemeID,attr,omitempty"`
+	Value    string `xml:",chardata"`
+}
+
+// CrossIndustryInvoice is a UN/CEFACT CII D16B invoice, the XML embedded
+// in Factur-X and ZUGFeRD PDFs. Fields are declared in schema order.
+type CrossIndustryInvoice struct {
+	XMLName xml.Name `xml:"rsm:CrossIndustryInvoice"`
+	Rsm     string   `xml:"xmlns:rsm,attr"`
+	Ram     string   `xml:"xmlns:ram,attr"`
+	Udt     string   `xml:"xmlns:udt,attr"`
+	Qdt     string   `xml:"xmlns:qdt,attr"`
+
+	Context     ciiContext     `xml:"rsm:ExchangedDocumentContext"`
+	Document    ciiDocument    `xml:"rsm:ExchangedDocument"`
+	Transaction ciiTransaction `xml:"rsm:SupplyChainTradeTransaction"`
+}
+
+type ciiContext struct {
+	Guideline ciiIDWrapper `xml:"ram:GuidelineSpecifiedDocumentContextParameter"`
+}
+
+type ciiIDWrapper struct {
+	ID string `xml:"ram:ID"`
+}
+
+type ciiDocument struct {
+	ID        string    `xml:"ram:ID"`
+	TypeCode  string    `xml:"ram:TypeCode"`
+	IssueDate ciiDate   `xml:"ram:IssueDateTime"`
+	Notes     []ciiNote `xml:"ram:IncludedNote"`
+}
+
+type ciiNote struct {
+	Content string `xml:"ram:Content"`
+}
+
+type ciiTransaction struct {
+	Lines      []ciiLine           `xml:"ram:IncludedSupplyChainTradeLineItem"`
+	Agreement  ciiAgreement        `xml:"ram:ApplicableHeaderTradeAgreement"`
+	Delivery   struct{}            `xml:"ram:ApplicableHeaderTradeDelivery"`
+	Settlement ciiHeaderSettlement `xml:"ram:ApplicableHeaderTradeSettlement"`
+}
+
+type ciiLine struct {
+	Document   ciiLineDocument   `xml:"ram:AssociatedDocumentLineDocument"`
+	Product    ciiProduct        `xml:"ram:SpecifiedTradeProduct"`
+	Agreement  ciiLineAgreement  `xml:"ram:SpecifiedLineTradeAgreement"`
+	Delivery   ciiLineDelivery   `xml:"ram:SpecifiedLineTradeDelivery"`
+	Settlement ciiLineSettlement `xml:"ram:SpecifiedLineTradeSettlement"`
+}
+
+type ciiLineDocument struct {
+	LineID string `xml:"ram:LineID"`
+}
+
+type ciiProduct struct {
+	Name string `xml:"ram:Name"`
+}
+
+type ciiLineAgreement struct {
+	NetPrice ciiPrice `xml:"ram:NetPriceProductTradePrice"`
+}
+
+type ciiPrice struct {
+	Amount string `xml:"ram:ChargeAmount"`
+}
+
+type ciiLineDelivery struct {
+	Quantity Quantity `xml:"ram:BilledQuantity"`
+}
+
+type ciiLineSettlement struct {
+	Tax              ciiTax               `xml:"ram:ApplicableTradeTax"`
+	AllowanceCharges []ciiAllowanceCharge `xml:"ram:SpecifiedTradeAllowanceCharge"`
+	Summation        ciiLineSummation     `xml:"ram:SpecifiedTradeSettlementLineMonetarySummation"`
+}
+
+type ciiLineSummation struct {
+	LineTotal ciiAmount `xml:"ram:LineTotalAmount"`
+}
+
+// ciiTax is a VAT category. On lines and allowances only the type,
+// category and rate are set; in the header breakdown the amounts too.
+type ciiTax struct {
+	CalculatedAmount *ciiAmount `xml:"ram:CalculatedAmount,omitempty"`
+	TypeCode         string     `xml:"ram:TypeCode"`
+	ExemptionReason  string     `xml:"ram:ExemptionReason,omitempty"`
+	BasisAmount      *ciiAmount `xml:"ram:BasisAmount,omitempty"`
+	CategoryCode     string     `xml:"ram:CategoryCode"`
+	Rate             *float64   `xml:"ram:RateApplicablePercent,omitempty"`
+}
+
+type ciiAllowanceCharge struct {
+	ChargeIndicator ciiIndicator `xml:"ram:ChargeIndicator"`
+	Amount          ciiAmount    `xml:"ram:ActualAmount"`
+	Reason          string       `xml:"ram:Reason,omitempty"`
+	Tax             *ciiTax      `xml:"ram:CategoryTradeTax,omitempty"`
+}
+
+type ciiAgreement struct {
+	BuyerReference string   `xml:"ram:BuyerReference,omitempty"`
+	Seller         ciiParty `xml:"ram:SellerTradeParty"`
+	Buyer          ciiParty `xml:"ram:BuyerTradeParty"`
+}
+
+type ciiParty struct {
+	Name             string               `xml:"ram:Name"`
+	LegalOrg         *ciiIDWrapper        `xml:"ram:SpecifiedLegalOrganization,omitempty"`
+	Contact          *ciiContact          `xml:"ram:DefinedTradeContact,omitempty"`
+	Address          ciiAddress           `xml:"ram:PostalTradeAddress"`
+	URI              *ciiURI              `xml:"ram:URIUniversalCommunication,omitempty"`
+	TaxRegistrations []ciiTaxRegistration `xml:"ram:SpecifiedTaxRegistration"`
+}
+
+type ciiContact struct {
+	Phone *ciiNumber `xml:"ram:TelephoneUniversalCommunication,omitempty"`
+	Email *ciiURI    `xml:"ram:EmailURIUniversalCommunication,omitempty"`
+}
+
+type ciiNumber struct {
+	Number string `xml:"ram:CompleteNumber"`
+}
+
+type ciiURI struct {
+	ID ciiID `xml:"ram:URIID"`
+}
+
+type ciiAddress struct {
+	Postcode  string `xml:"ram:PostcodeCode,omitempty"`
+	LineOne   string `xml:"ram:LineOne,omitempty"`
+	LineTwo   string `xml:"ram:LineTwo,omitempty"`
+	City      string `xml:"ram:CityName,omitempty"`
+	CountryID string `xml:"ram:CountryID"`
+}
+
+type ciiTaxRegistration struct {
+	ID ciiID `xml:"ram:ID"`
+}
+
+type ciiHeaderSettlement struct {
+	PaymentReference string               `xml:"ram:PaymentReference,omitempty"`
+	Currency         string               `xml:"ram:InvoiceCurrencyCode"`
+	PaymentMeans     *ciiPaymentMeans     `xml:"ram:SpecifiedTradeSettlementPaymentMeans,omitempty"`
+	Taxes            []ciiTax             `xml:"ram:ApplicableTradeTax"`
+	AllowanceCharges []ciiAllowanceCharge `xml:"ram:SpecifiedTradeAllowanceCharge"`
+	PaymentTerms     *ciiPaymentTerms     `xml:"ram:SpecifiedTradePaymentTerms,omitempty"`
+	Summation        ciiHeaderSummation   `xml:"ram:SpecifiedTradeSettlementHeaderMonetarySummation"`
+}
+
+type ciiPaymentMeans struct {
+	TypeCode    string          `xml:"ram:TypeCode"`
+	Account     *ciiAccount     `xml:"ram:PayeePartyCreditorFinancialAccount,omitempty"`
+	Institution *ciiInstitution `xml:"ram:PayeeSpecifiedCreditorFinancialInstitution,omitempty"`
+}
+
+type ciiAccount struct {
+	IBAN          string `xml:"ram:IBANID,omitempty"`
+	Name          string `xml:"ram:AccountName,omitempty"`
+	ProprietaryID string `xml:"ram:ProprietaryID,omitempty"`
+}
+
+type ciiInstitution struct {
+	BIC string `xml:"ram:BICID"`
+}
+
+type ciiPaymentTerms struct {
+	Description string   `xml:"ram:Description,omitempty"`
+	DueDate     *ciiDate `xml:"ram:DueDateDateTime,omitempty"`
+}
+
+type ciiHeaderSummation struct {
+	LineTotal      ciiAmount  `xml:"ram:LineTotalAmount"`
+	ChargeTotal    *ciiAmount `xml:"ram:ChargeTotalAmount,omitempty"`
+	AllowanceTotal *ciiAmount `xml:"ram:AllowanceTotalAmount,omitempty"`
+	TaxBasisTotal  ciiAmount  `xml:"ram:TaxBasisTotalAmount"`
+	TaxTotal       ciiAmount  `xml:"ram:TaxTotalAmount"`
+	GrandTotal     ciiAmount  `xml:"ram:GrandTotalAmount"`
+	Prepaid        *ciiAmount `xml:"ram:TotalPrepaidAmount,omitempty"`
+	DuePayable     ciiAmount  `xml:"ram:DuePayableAmount"`
+}
+
+// BuildCII maps an invoice to a CII invoice at the Factur-X EN 16931
+// profile. It is built from the UBL invoice so both formats carry the
+// same VAT breakdown, allowances and totals.
+func BuildCII(data models.InvoiceData) *CrossIndustryInvoice {
+	return ciiFromUBL(BuildUBL(data))
+}
+
+// FacturX builds and validates the CII XML for an invoice, ready to be
+// embedded in its PDF. Invoices breaking EN 16931 rules return a
+// ValidationError.
+func FacturX(data models.InvoiceData) ([]byte, error) {
+	inv := BuildUBL(data)
+
+	if violations := Validate(inv); len(violations) > 0 {
+		return nil, ValidationError(violations)
+	}
+
+	out, err := xml.MarshalIndent(ciiFromUBL(inv), "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(xml.Header), out...), nil
+}
+
+func ciiFromUBL(inv *Invoice) *CrossIndustryInvoice {
+	money := func(a Amount) ciiAmount { return ciiAmount{Value: a.Value} }
+	optional := func(a *Amount) *ciiAmount {
+		if a == nil {
+			return nil
+		}
+		m := money(*a)
+		return &m
+	}
+
+	cii := &CrossIndustryInvoice{
+		Rsm: ciiRsmNS,
+		Ram: ciiRamNS,
+		Udt: ciiUdtNS,
+		Qdt: ciiQdtNS,
+
+		Context: ciiContext{Guideline: ciiIDWrapper{ID: FacturXGuideline}},
+		Document: ciiDocument{
+			ID:        inv.ID,
+			TypeCode:  inv.InvoiceTypeCode,
+			IssueDate: ciiDate{Value: ciiDateValue(inv.IssueDate)},
+		},
+	}
+
+	if inv.Note != "" {
+		cii.Document.Notes = []ciiNote{{Content: inv.Note}}
+	}
+
+	t := &cii.Transaction
+
+	// --- Lines ---
+	for _, line := range inv.Lines {
+		l := ciiLine{
+			Document:  ciiLineDocument{LineID: line.ID},
+			Product:   ciiProduct{Name: line.Item.Name},
+			Agreement: ciiLineAgreement{NetPrice: ciiPrice{Amount: strconv.FormatFloat(line.Price.PriceAmount.Value, 'f', -1, 64)}},
+			Delivery:  ciiLineDelivery{Quantity: line.InvoicedQuantity},
+			Settlement: ciiLineSettlement{
+				Tax:       ciiCategory(line.Item.ClassifiedTaxCategory, false),
+				Summation: ciiLineSummation{LineTotal: money(line.LineExtensionAmount)},
+			},
+		}
+
+		for _, ac := range line.AllowanceCharges {
+			l.Settlement.AllowanceCharges = append(l.Settlement.AllowanceCharges, ciiAllowanceCharge{
+				ChargeIndicator: ciiIndicator{Value: ac.ChargeIndicator},
+				Amount:          money(ac.Amount),
+				Reason:          ac.Reason,
+			})
+		}
+
+		t.Lines = append(t.Lines, l)
+	}
+
+	// --- Parties ---
+	t.Agreement = ciiAgreement{
+		BuyerReference: inv.BuyerReference,
+		Seller:         ciiPartyFromUBL(inv.Supplier.Party),
+		Buyer:          ciiPartyFromUBL(inv.Customer.Party),
+	}
+
+	// --- Settlement ---
+	s := &t.Settlement
+	s.Currency = inv.DocumentCurrencyCode
+
+	if pm := inv.PaymentMeans; pm != nil {
+		s.PaymentReference = pm.PaymentID
+		means := &ciiPaymentMeans{TypeCode: pm.Code}
+
+		if a := pm.Account; a != nil {
+			account := &ciiAccount{Name: a.Name}
+			if pm.Code == "58" || isIBAN(a.ID) {
+				account.IBAN = a.ID
+			} else {
+				account.ProprietaryID = a.ID
+			}
+			means.Account = account
+
+			if a.Branch != nil {
+				means.Institution = &ciiInstitution{BIC: a.Branch.ID}
+			}
+		}
+
+		s.PaymentMeans = means
+	}
+
+	for _, sub := range inv.TaxTotal.Subtotals {
+		tax := ciiCategory(sub.Category, true)
+		calculated := money(sub.TaxAmount)
+		basis := money(sub.TaxableAmount)
+		tax.CalculatedAmount = &calculated
+		tax.BasisAmount = &basis
+		s.Taxes = append(s.Taxes, tax)
+	}
+
+	for _, ac := range inv.AllowanceCharges {
+		c := ciiAllowanceCharge{
+			ChargeIndicator: ciiIndicator{Value: ac.ChargeIndicator},
+			Amount:          money(ac.Amount),
+			Reason:          ac.Reason,
+		}
+		if ac.TaxCategory != nil {
+			tax := ciiCategory(*ac.TaxCategory, false)
+			c.Tax = &tax
+		}
+		s.AllowanceCharges = append(s.AllowanceCharges, c)
+	}
+
+	if inv.PaymentTerms != nil || inv.DueDate != "" {
+		terms := &ciiPaymentTerms{}
+		if inv.PaymentTerms != nil {
+			terms.Description = inv.PaymentTerms.Note
+		}
+		if inv.DueDate != "" {
+			terms.DueDate = &ciiDate{Value: ciiDateValue(inv.DueDate)}
+		}
+		s.PaymentTerms = terms
+	}
+
+	total := inv.LegalMonetaryTotal
+	s.Summation = ciiHeaderSummation{
+		LineTotal:      money(total.LineExtensionAmount),
+		ChargeTotal:    optional(total.ChargeTotalAmount),
+		AllowanceTotal: optional(total.AllowanceTotalAmount),
+		TaxBasisTotal:  money(total.TaxExclusiveAmount),
+		TaxTotal:       ciiAmount{Currency: inv.DocumentCurrencyCode, Value: inv.TaxTotal.TaxAmount.Value},
+		GrandTotal:     money(total.TaxInclusiveAmount),
+		Prepaid:        optional(total.PrepaidAmount),
+		DuePayable:     money(total.PayableAmount),
+	}
+
+	return cii
+}
+
+// ciiCategory converts a UBL tax category. CII only carries the
+// exemption reason in the header breakdown.
+func ciiCategory(c TaxCategory, header bool) ciiTax {
+	tax := ciiTax{TypeCode: c.TaxScheme.ID, CategoryCode: c.ID, Rate: c.Percent}
+	if header {
+		tax.ExemptionReason = c.ExemptionReason
+	}
+	return tax
+}
+
+func ciiPartyFromUBL(p Party) ciiParty {
+	party := ciiParty{
+		Name: p.PartyLegalEntity.RegistrationName,
+		Address: ciiAddress{
+			Postcode:  p.PostalAddress.PostalZone,
+			LineOne:   p.PostalAddress.StreetName,
+			LineTwo:   p.PostalAddress.AdditionalStreetName,
+			City:      p.PostalAddress.CityName,
+			CountryID: p.PostalAddress.Country.IdentificationCode,
+		},
+	}
+
+	if p.PartyLegalEntity.CompanyID != "" {
+		party.LegalOrg = &ciiIDWrapper{ID: p.PartyLegalEntity.CompanyID}
+	}
+
+	if c := p.Contact; c != nil {
+		contact := &ciiContact{}
+		if c.Telephone != "" {
+			contact.Phone = &ciiNumber{Number: c.Telephone}
+		}
+		if c.ElectronicMail != "" {
+			contact.Email = &ciiURI{ID: ciiID{Value: c.ElectronicMail}}
+		}
+		party.Contact = contact
+	}
+
+	if p.EndpointID.Value != "" {
+		party.URI = &ciiURI{ID: ciiID{SchemeID: p.EndpointID.SchemeID, Value: p.EndpointID.Value}}
+	}
+
+	if p.PartyTaxScheme != nil {
+		party.TaxRegistrations = []ciiTaxRegistration{{ID: ciiID{SchemeID: "VA", Value: p.PartyTaxScheme.CompanyID}}}
+	}
+
+	return party
+}
+
+// ciiDateValue turns a UBL YYYY-MM-DD date into CII's YYYYMMDD.
+func ciiDateValue(date string) string {
+	return strings.ReplaceAll(date, "-", "")
+}
+
+func isIBAN(id string) bool {
+	return len(id) > 4 && id[0] >= 'A' && id[0] <= 'Z' && id[1] >= 'A' && id[1] <= 'Z'
+}
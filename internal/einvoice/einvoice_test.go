@@ -0,0 +1,168 @@
+package einvoice
+
+import (
+	"bytes"
+	"flag"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"pistachio/internal/models"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files in testdata")
+
+// fixtures are the invoices the golden files are made from: a VAT
+// registered UK business with discounts, a surcharge and a deposit, a
+// business that isn't VAT registered, and a euro invoice paid by IBAN.
+func fixtures() map[string]models.InvoiceData {
+	issued := time.Date(2026, 10, 19, 0, 0, 0, 0, time.UTC)
+	due := issued.AddDate(0, 0, 14)
+
+	business := models.BusinessInfo{
+		Name:            "Pistachio Ltd",
+		Email:           "accounts@pistachio.example",
+		Phone:           "020 7946 0000",
+		VATNumber:       "123 4567 89",
+		CompanyReg:      "01234567",
+		BusinessAddress: models.BusinessAddress{Line1: "1 High Street", City: "London", Postcode: "SW1A 1AA", Country: "UK"},
+	}
+	customer := models.CustomerInfo{
+		Name:            "Ada Customer",
+		Email:           "ada@example.com",
+		CustomerAddress: models.CustomerAddress{Line1: "12 Hill Road", Line2: "Flat 3B", City: "Leeds", Postcode: "LS1 1AA", Country: "UK"},
+	}
+
+	vat := func() models.InvoiceData {
+		items := []models.InvoiceItem{
+			{Description: "Boiler service", Quantity: 1, UnitPrice: 100, TaxRate: 20, Discount: models.Discount{Type: "percent", Value: 10}},
+			{Description: "Valve", Quantity: 2, UnitPrice: 25, TaxRate: 5, Discount: models.Discount{Type: "fixed", Value: 5}},
+			{Description: "Leaflet", Quantity: 3, UnitPrice: 1.33, TaxRate: 0},
+		}
+		discount := models.Discount{Type: "percent", Value: 7}
+		surcharges := []models.Surcharge{{Description: "Call-out fee", Amount: 40, TaxRate: 20}}
+
+		return models.InvoiceData{
+			InvoiceNumber: "INV-2026-0042",
+			IssueDate:     issued,
+			DueDate:       due,
+			Business:      business,
+			Customer:      customer,
+			Items:         items,
+			Discount:      discount,
+			Surcharges:    surcharges,
+			Totals:        models.CalculateInvoiceTotals(items, discount, surcharges, 60),
+			Payment:       models.PaymentInfo{AccountName: "Pistachio Ltd", SortCode: "00-00-00", AccountNumber: "12345678"},
+			FooterNotes:   "Thank you for your business",
+		}
+	}
+
+	noVAT := func() models.InvoiceData {
+		data := vat()
+		data.InvoiceNumber = "INV-2026-0043"
+		data.Business.VATNumber = ""
+		data.Items = []models.InvoiceItem{{Description: "Gutter clearing", Quantity: 2, UnitPrice: 45}}
+		data.Discount = models.Discount{}
+		data.Surcharges = nil
+		data.Totals = models.CalculateInvoiceTotals(data.Items, data.Discount, data.Surcharges, 0)
+		return data
+	}
+
+	euro := func() models.InvoiceData {
+		data := vat()
+		data.InvoiceNumber = "INV-2026-0044"
+		data.Currency = "EUR"
+		data.Reference = "PO-7781"
+		data.Business.VATNumber = "FR40303265045"
+		data.Business.BusinessAddress = models.BusinessAddress{Line1: "3 Rue de la Paix", City: "Paris", Postcode: "75002", Country: "France"}
+		data.Customer.CustomerAddress = models.CustomerAddress{Line1: "8 Quai Voltaire", City: "Paris", Postcode: "75007", Country: "FR"}
+		data.Items = []models.InvoiceItem{{Description: "Entretien chaudière", Quantity: 1, UnitPrice: 120, TaxRate: 20}}
+		data.Discount = models.Discount{}
+		data.Surcharges = nil
+		data.Totals = models.CalculateInvoiceTotals(data.Items, data.Discount, data.Surcharges, 0)
+		data.Payment = models.PaymentInfo{AccountName: "Pistachio SARL", IBAN: "FR7630006000011234567890189", BIC: "AGRIFRPP"}
+		return data
+	}
+
+	return map[string]models.InvoiceData{
+		"vat":    vat(),
+		"no-vat": noVAT(),
+		"euro":   euro(),
+	}
+}
+
+// golden compares got with testdata/name, or rewrites it with -update.
+func golden(t *testing.T, name string, got []byte) {
+	t.Helper()
+
+	path := filepath.Join("testdata", name)
+	if *update {
+		if err := os.WriteFile(path, got, 0o644); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+
+	want, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("%v (run go test -update to create it)", err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("%s differs from the golden file; run go test -update and review the diff\n%s", name, got)
+	}
+}
+
+func TestUBLGolden(t *testing.T) {
+	for name, data := range fixtures() {
+		t.Run(name, func(t *testing.T) {
+			inv := BuildUBL(data)
+			if violations := Validate(inv); len(violations) > 0 {
+				t.Errorf("violations: %v", violations)
+			}
+
+			out, err := Marshal(inv)
+			if err != nil {
+				t.Fatal(err)
+			}
+			golden(t, "ubl-"+name+".xml", out)
+		})
+	}
+}
+
+func TestCIIGolden(t *testing.T) {
+	for name, data := range fixtures() {
+		t.Run(name, func(t *testing.T) {
+			out, err := FacturX(data)
+			if err != nil {
+				t.Fatal(err)
+			}
+			golden(t, "cii-"+name+".xml", out)
+		})
+	}
+}
+
+func TestValidateViolations(t *testing.T) {
+	data := fixtures()["vat"]
+	data.InvoiceNumber = ""
+	data.Business.Name = ""
+	data.Currency = "EURO"
+
+	inv := BuildUBL(data)
+	inv.LegalMonetaryTotal.PayableAmount.Value += 1
+
+	rules := map[string]bool{}
+	for _, v := range Validate(inv) {
+		rules[v.Rule] = true
+	}
+
+	for _, rule := range []string{"BR-02", "BR-05", "BR-CO-16"} {
+		if !rules[rule] {
+			t.Errorf("want a %s violation, got %v", rule, rules)
+		}
+	}
+
+	if _, err := FacturX(data); err == nil {
+		t.Errorf("FacturX exported an invalid invoice")
+	}
+}
@@ -0,0 +1,49 @@
+package einvoice
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+)
+
+// TestSchemas checks the golden files against the official XML schemas
+// with xmllint. The schemas aren't kept in the repository; point these
+// at unpacked copies to run it:
+//
+//	UBL_XSD  xsd/maindoc/UBL-Invoice-2.1.xsd from the OASIS UBL 2.1 release
+//	CII_XSD  CrossIndustryInvoice_100pD16B.xsd from UN/CEFACT D16B
+func TestSchemas(t *testing.T) {
+	schemas := []struct {
+		env, pattern string
+	}{
+		{"UBL_XSD", "testdata/ubl-*.xml"},
+		{"CII_XSD", "testdata/cii-*.xml"},
+	}
+
+	for _, s := range schemas {
+		t.Run(s.env, func(t *testing.T) {
+			xsd := os.Getenv(s.env)
+			if xsd == "" {
+				t.Skip(s.env + " not set")
+			}
+
+			xmllint, err := exec.LookPath("xmllint")
+			if err != nil {
+				t.Skip("xmllint not installed")
+			}
+
+			files, err := filepath.Glob(s.pattern)
+			if err != nil || len(files) == 0 {
+				t.Fatalf("no golden files match %s", s.pattern)
+			}
+
+			for _, file := range files {
+				out, err := exec.Command(xmllint, "--noout", "--schema", xsd, file).CombinedOutput()
+				if err != nil {
+					t.Errorf("%s doesn't match the schema: %v\n%s", file, err, out)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,234 @@
+// Package einvoice maps invoices to structured e-invoice formats.
+package einvoice
+
+import (
+	"encoding/xml"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Peppol BIS Billing 3.0 identifiers
+const (
+	CustomizationID = "urn:cen.eu:en16931:2017#compliant#urn:fdc:peppol.eu:2017:poacc:billing:3.0"
+	ProfileID       = "urn:fdc:peppol.eu:2017:poacc:billing:01:1.0"
+
+	ublInvoiceNS = "urn:oasis:names:specification:ubl:schema:xsd:Invoice-2"
+	ublCacNS     = "urn:oasis:names:specification:ubl:schema:xsd:CommonAggregateComponents-2"
+	ublCbcNS     = "urn:oasis:names:specification:ubl:schema:xsd:CommonBasicComponents-2"
+)
+
+// Amount is a monetary value, always written with two decimals.
+type Amount struct {
+	Currency string
+	Value    float64
+}
+
+func (a Amount) MarshalXML(e *xml.Encoder, start xml.StartElement) error {
+	start.Attr = append(start.Attr, xml.Attr{Name: xml.Name{Local: "currencyID"}, Value: a.Currency})
+	return e.EncodeElement(fmt.Sprintf("%.2f", a.Value), start)
+}
+
+type Quantity struct {
+	UnitCode string
+	Value    float64
+}
+
+func (q Quantity) MarshalXML(e *xml.Encoder, start xml.StartElement) error {
+	start.Attr = append(start.Attr, xml.Attr{Name: xml.Name{Local: "unitCode"}, Value: q.UnitCode})
+	return e.EncodeElement(strconv.FormatFloat(q.Value, 'f', -1, 64), start)
+}
+
+type Identifier struct {
+	SchemeID string `xml:"schemeID,attr,omitempty"`
+	Value    string `xml:",chardata"`
+}
+
+// Invoice is a UBL 2.1 invoice. Fields are declared in schema order,
+// which UBL requires.
+type Invoice struct {
+	XMLName xml.Name `xml:"Invoice"`
+	Xmlns   string   `xml:"xmlns,attr"`
+	Cac     string   `xml:"xmlns:cac,attr"`
+	Cbc     string   `xml:"xmlns:cbc,attr"`
+
+	CustomizationID      string `xml:"cbc:CustomizationID"`
+	ProfileID            string `xml:"cbc:ProfileID"`
+	ID                   string `xml:"cbc:ID"`
+	IssueDate            string `xml:"cbc:IssueDate"`
+	DueDate              string `xml:"cbc:DueDate,omitempty"`
+	InvoiceTypeCode      string `xml:"cbc:InvoiceTypeCode"`
+	Note                 string `xml:"cbc:Note,omitempty"`
+	DocumentCurrencyCode string `xml:"cbc:DocumentCurrencyCode"`
+	BuyerReference       string `xml:"cbc:BuyerReference,omitempty"`
+
+	Supplier           PartyWrapper      `xml:"cac:AccountingSupplierParty"`
+	Customer           PartyWrapper      `xml:"cac:AccountingCustomerParty"`
+	PaymentMeans       *PaymentMeans     `xml:"cac:PaymentMeans,omitempty"`
+	PaymentTerms       *PaymentTerms     `xml:"cac:PaymentTerms,omitempty"`
+	AllowanceCharges   []AllowanceCharge `xml:"cac:AllowanceCharge"`
+	TaxTotal           TaxTotal          `xml:"cac:TaxTotal"`
+	LegalMonetaryTotal MonetaryTotal     `xml:"cac:LegalMonetaryTotal"`
+	Lines              []InvoiceLine     `xml:"cac:InvoiceLine"`
+}
+
+type PartyWrapper struct {
+	Party Party `xml:"cac:Party"`
+}
+
+type Party struct {
+	EndpointID       Identifier      `xml:"cbc:EndpointID"`
+	PartyName        *PartyName      `xml:"cac:PartyName,omitempty"`
+	PostalAddress    Address         `xml:"cac:PostalAddress"`
+	PartyTaxScheme   *PartyTaxScheme `xml:"cac:PartyTaxScheme,omitempty"`
+	PartyLegalEntity LegalEntity     `xml:"cac:PartyLegalEntity"`
+	Contact          *Contact        `xml:"cac:Contact,omitempty"`
+}
+
+type PartyName struct {
+	Name string `xml:"cbc:Name"`
+}
+
+type Address struct {
+	StreetName           string  `xml:"cbc:StreetName,omitempty"`
+	AdditionalStreetName string  `xml:"cbc:AdditionalStreetName,omitempty"`
+	CityName             string  `xml:"cbc:CityName,omitempty"`
+	PostalZone           string  `xml:"cbc:PostalZone,omitempty"`
+	Country              Country `xml:"cac:Country"`
+}
+
+type Country struct {
+	IdentificationCode string `xml:"cbc:IdentificationCode"`
+}
+
+type PartyTaxScheme struct {
+	CompanyID string    `xml:"cbc:CompanyID"`
+	TaxScheme TaxScheme `xml:"cac:TaxScheme"`
+}
+
+type TaxScheme struct {
+	ID string `xml:"cbc:ID"`
+}
+
+type LegalEntity struct {
+	RegistrationName string `xml:"cbc:RegistrationName"`
+	CompanyID        string `xml:"cbc:CompanyID,omitempty"`
+}
+
+type Contact struct {
+	Telephone      string `xml:"cbc:Telephone,omitempty"`
+	ElectronicMail string `xml:"cbc:ElectronicMail,omitempty"`
+}
+
+type PaymentMeans struct {
+	Code      string            `xml:"cbc:PaymentMeansCode"`
+	PaymentID string            `xml:"cbc:PaymentID,omitempty"`
+	Account   *FinancialAccount `xml:"cac:PayeeFinancialAccount,omitempty"`
+}
+
+type FinancialAccount struct {
+	ID     string  `xml:"cbc:ID"`
+	Name   string  `xml:"cbc:Name,omitempty"`
+	Branch *Branch `xml:"cac:FinancialInstitutionBranch,omitempty"`
+}
+
+type Branch struct {
+	ID string `xml:"cbc:ID"`
+}
+
+type PaymentTerms struct {
+	Note string `xml:"cbc:Note"`
+}
+
+// AllowanceCharge is a discount (ChargeIndicator false) or a charge. At
+// document level it carries its own tax category; on a line it doesn't.
+type AllowanceCharge struct {
+	ChargeIndicator bool         `xml:"cbc:ChargeIndicator"`
+	Reason          string       `xml:"cbc:AllowanceChargeReason"`
+	Amount          Amount       `xml:"cbc:Amount"`
+	TaxCategory     *TaxCategory `xml:"cac:TaxCategory,omitempty"`
+}
+
+// TaxCategory is a VAT category: S standard, Z zero rated or O not
+// subject to VAT. Category O has no percentage.
+type TaxCategory struct {
+	ID              string    `xml:"cbc:ID"`
+	Percent         *float64  `xml:"cbc:Percent,omitempty"`
+	ExemptionReason string    `xml:"cbc:TaxExemptionReason,omitempty"`
+	TaxScheme       TaxScheme `xml:"cac:TaxScheme"`
+}
+
+type TaxTotal struct {
+	TaxAmount Amount        `xml:"cbc:TaxAmount"`
+	Subtotals []TaxSubtotal `xml:"cac:TaxSubtotal"`
+}
+
+type TaxSubtotal struct {
+	TaxableAmount Amount      `xml:"cbc:TaxableAmount"`
+	TaxAmount     Amount      `xml:"cbc:TaxAmount"`
+	Category      TaxCategory `xml:"cac:TaxCategory"`
+}
+
+type MonetaryTotal struct {
+	LineExtensionAmount  Amount  `xml:"cbc:LineExtensionAmount"`
+	TaxExclusiveAmount   Amount  `xml:"cbc:TaxExclusiveAmount"`
+	TaxInclusiveAmount   Amount  `xml:"cbc:TaxInclusiveAmount"`
+	AllowanceTotalAmount *Amount `xml:"cbc:AllowanceTotalAmount,omitempty"`
+	ChargeTotalAmount    *Amount `xml:"cbc:ChargeTotalAmount,omitempty"`
+	PrepaidAmount        *Amount `xml:"cbc:PrepaidAmount,omitempty"`
+	PayableAmount        Amount  `xml:"cbc:PayableAmount"`
+}
+
+type InvoiceLine struct {
+	ID                  string            `xml:"cbc:ID"`
+	InvoicedQuantity    Quantity          `xml:"cbc:InvoicedQuantity"`
+	LineExtensionAmount Amount            `xml:"cbc:LineExtensionAmount"`
+	AllowanceCharges    []AllowanceCharge `xml:"cac:AllowanceCharge"`
+	Item                Item              `xml:"cac:Item"`
+	Price               Price             `xml:"cac:Price"`
+}
+
+type Item struct {
+	Name                  string      `xml:"cbc:Name"`
+	ClassifiedTaxCategory TaxCategory `xml:"cac:ClassifiedTaxCategory"`
+}
+
+type Price struct {
+	PriceAmount Amount `xml:"cbc:PriceAmount"`
+}
+
+// Marshal writes the invoice as an XML document.
+func Marshal(inv *Invoice) ([]byte, error) {
+	out, err := xml.MarshalIndent(inv, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(xml.Header), out...), nil
+}
+
+func round2(v float64) float64 {
+	return math.Round(v*100) / 100
+}
+
+// countryCode turns the free-text country on an address into an ISO
+// 3166 code, falling back to def.
+func countryCode(country, def string) string {
+	c := strings.ToUpper(strings.TrimSpace(country))
+	switch c {
+	case "":
+		return def
+	case "UK", "UNITED KINGDOM", "GREAT BRITAIN", "ENGLAND", "SCOTLAND", "WALES", "NORTHERN IRELAND":
+		return "GB"
+	case "IRELAND":
+		return "IE"
+	case "FRANCE":
+		return "FR"
+	case "GERMANY":
+		return "DE"
+	}
+	if len(c) == 2 {
+		return c
+	}
+	return def
+}
@@ -0,0 +1,272 @@
+package einvoice
+
+import (
+	"fmt"
+	"math"
+	"strings"
+)
+
+// Violation is a broken business rule, named by its EN 16931 or Peppol
+// rule id so it can be looked up in the specification.
+type Violation struct {
+	Rule    string `json:"rule"`
+	Message string `json:"message"`
+}
+
+func (v Violation) Error() string {
+	return v.Rule + ": " + v.Message
+}
+
+// sameAmount compares two amounts to the cent.
+func sameAmount(a, b float64) bool {
+	return math.Abs(a-b) < 0.005
+}
+
+// Validate checks the invoice against the Peppol BIS Billing 3.0 rules
+// that can be broken by our data: mandatory fields, the totals
+// arithmetic and the VAT category rules. It mirrors the official
+// schematron for these rules so invoices can be checked offline, before
+// they are sent.
+func Validate(inv *Invoice) []Violation {
+	var v []Violation
+	fail := func(rule, format string, args ...any) {
+		v = append(v, Violation{Rule: rule, Message: fmt.Sprintf(format, args...)})
+	}
+
+	// --- Document ---
+	if inv.CustomizationID != CustomizationID {
+		fail("BR-01", "specification identifier must be %s", CustomizationID)
+	}
+	if inv.ProfileID != ProfileID {
+		fail("PEPPOL-EN16931-R001", "business process must be %s", ProfileID)
+	}
+	if inv.ID == "" {
+		fail("BR-02", "invoice number is required")
+	}
+	if inv.IssueDate == "" {
+		fail("BR-03", "issue date is required")
+	}
+	if inv.InvoiceTypeCode == "" {
+		fail("BR-04", "invoice type code is required")
+	}
+	if len(inv.DocumentCurrencyCode) != 3 {
+		fail("BR-05", "document currency code is required")
+	}
+	if inv.BuyerReference == "" {
+		fail("PEPPOL-EN16931-R003", "buyer reference or purchase order reference is required")
+	}
+
+	// --- Parties ---
+	seller := inv.Supplier.Party
+	buyer := inv.Customer.Party
+
+	if seller.PartyLegalEntity.RegistrationName == "" {
+		fail("BR-06", "seller name is required")
+	}
+	if buyer.PartyLegalEntity.RegistrationName == "" {
+		fail("BR-07", "buyer name is required")
+	}
+	if seller.PostalAddress.Country.IdentificationCode == "" {
+		fail("BR-09", "seller country code is required")
+	}
+	if buyer.PostalAddress.Country.IdentificationCode == "" {
+		fail("BR-11", "buyer country code is required")
+	}
+	if seller.EndpointID.Value == "" {
+		fail("PEPPOL-EN16931-R020", "seller electronic address is required")
+	}
+	if buyer.EndpointID.Value == "" {
+		fail("PEPPOL-EN16931-R010", "buyer electronic address is required; set the customer's email")
+	}
+
+	sellerVAT := ""
+	if seller.PartyTaxScheme != nil {
+		sellerVAT = seller.PartyTaxScheme.CompanyID
+		if !strings.HasPrefix(sellerVAT, seller.PostalAddress.Country.IdentificationCode) && len(sellerVAT) > 2 && !strings.HasPrefix(sellerVAT, "EL") {
+			fail("BR-CO-09", "seller VAT identifier %s must start with a country code", sellerVAT)
+		}
+	}
+
+	// --- Payment ---
+	if inv.PaymentMeans != nil {
+		code := inv.PaymentMeans.Code
+		if (code == "30" || code == "58") && (inv.PaymentMeans.Account == nil || inv.PaymentMeans.Account.ID == "") {
+			fail("BR-61", "credit transfer needs the payee account identifier")
+		}
+	}
+
+	total := inv.LegalMonetaryTotal
+	if total.PayableAmount.Value > 0 && inv.DueDate == "" && inv.PaymentTerms == nil {
+		fail("BR-CO-25", "a positive amount due needs a due date or payment terms")
+	}
+
+	// --- Currency ---
+	checkCurrency := func(a Amount, where string) {
+		if a.Currency != inv.DocumentCurrencyCode {
+			fail("PEPPOL-EN16931-R051", "%s is in %s, not the document currency %s", where, a.Currency, inv.DocumentCurrencyCode)
+		}
+	}
+	checkCurrency(total.PayableAmount, "payable amount")
+	checkCurrency(inv.TaxTotal.TaxAmount, "tax total")
+
+	// --- Lines ---
+	if len(inv.Lines) == 0 {
+		fail("BR-16", "at least one invoice line is required")
+	}
+
+	net := map[taxKey]float64{}
+	lineSum := 0.0
+
+	for _, line := range inv.Lines {
+		if line.ID == "" {
+			fail("BR-21", "every line needs an identifier")
+		}
+		if line.Item.Name == "" {
+			fail("BR-25", "line %s needs an item name", line.ID)
+		}
+		if line.Price.PriceAmount.Value < 0 {
+			fail("BR-27", "line %s has a negative price", line.ID)
+		}
+		checkCurrency(line.LineExtensionAmount, "line "+line.ID)
+
+		for _, ac := range line.AllowanceCharges {
+			if ac.Reason == "" {
+				fail("BR-42", "line %s allowance needs a reason", line.ID)
+			}
+		}
+
+		allowance := 0.0
+		for _, ac := range line.AllowanceCharges {
+			if ac.ChargeIndicator {
+				allowance -= ac.Amount.Value
+			} else {
+				allowance += ac.Amount.Value
+			}
+		}
+		expected := round2(line.InvoicedQuantity.Value*line.Price.PriceAmount.Value - allowance)
+		if !sameAmount(expected, line.LineExtensionAmount.Value) {
+			fail("PEPPOL-EN16931-R120", "line %s net amount %.2f should be %.2f", line.ID, line.LineExtensionAmount.Value, expected)
+		}
+
+		key := keyOf(line.Item.ClassifiedTaxCategory)
+		net[key] += line.LineExtensionAmount.Value
+		lineSum += line.LineExtensionAmount.Value
+	}
+
+	// --- Document allowances and charges ---
+	allowanceSum, chargeSum := 0.0, 0.0
+
+	for _, ac := range inv.AllowanceCharges {
+		if ac.TaxCategory == nil {
+			fail("BR-32", "document allowances and charges need a VAT category")
+			continue
+		}
+		if ac.Reason == "" {
+			fail("BR-33", "document allowances and charges need a reason")
+		}
+
+		key := keyOf(*ac.TaxCategory)
+		if ac.ChargeIndicator {
+			chargeSum += ac.Amount.Value
+			net[key] += ac.Amount.Value
+		} else {
+			allowanceSum += ac.Amount.Value
+			net[key] -= ac.Amount.Value
+		}
+	}
+
+	// --- Totals ---
+	optional := func(a *Amount) float64 {
+		if a == nil {
+			return 0
+		}
+		return a.Value
+	}
+
+	if !sameAmount(total.LineExtensionAmount.Value, lineSum) {
+		fail("BR-CO-10", "sum of line net amounts is %.2f, not %.2f", lineSum, total.LineExtensionAmount.Value)
+	}
+	if !sameAmount(optional(total.AllowanceTotalAmount), allowanceSum) {
+		fail("BR-CO-11", "sum of allowances is %.2f, not %.2f", allowanceSum, optional(total.AllowanceTotalAmount))
+	}
+	if !sameAmount(optional(total.ChargeTotalAmount), chargeSum) {
+		fail("BR-CO-12", "sum of charges is %.2f, not %.2f", chargeSum, optional(total.ChargeTotalAmount))
+	}
+
+	exclusive := total.LineExtensionAmount.Value - optional(total.AllowanceTotalAmount) + optional(total.ChargeTotalAmount)
+	if !sameAmount(total.TaxExclusiveAmount.Value, exclusive) {
+		fail("BR-CO-13", "total without VAT should be %.2f", exclusive)
+	}
+
+	// --- VAT breakdown ---
+	if len(inv.TaxTotal.Subtotals) == 0 {
+		fail("BR-CO-18", "at least one VAT breakdown is required")
+	}
+
+	taxSum := 0.0
+	seen := map[taxKey]bool{}
+	missingVAT := map[string]bool{}
+
+	for _, sub := range inv.TaxTotal.Subtotals {
+		key := keyOf(sub.Category)
+		seen[key] = true
+		taxSum += sub.TaxAmount.Value
+
+		rule := "BR-" + key.ID
+
+		if !sameAmount(sub.TaxableAmount.Value, net[key]) {
+			fail(rule+"-08", "taxable amount for %s %g%% should be %.2f", key.ID, key.Rate, round2(net[key]))
+		}
+
+		// The schematron allows a cent either way for rounding
+		expected := round2(sub.TaxableAmount.Value * key.Rate / 100)
+		if math.Abs(sub.TaxAmount.Value-expected) > 0.01+1e-9 {
+			fail(rule+"-09", "tax for %s %g%% should be %.2f", key.ID, key.Rate, expected)
+		}
+
+		switch key.ID {
+		case "S", "Z":
+			if sellerVAT == "" && !missingVAT[key.ID] {
+				missingVAT[key.ID] = true // once per category, not per rate
+				fail(rule+"-02", "category %s needs the seller's VAT identifier", key.ID)
+			}
+		case "O":
+			if sellerVAT != "" {
+				fail("BR-O-02", "category O can't be used with a seller VAT identifier")
+			}
+			if sub.Category.ExemptionReason == "" {
+				fail("BR-O-10", "category O needs an exemption reason")
+			}
+		}
+	}
+
+	for key := range net {
+		if !seen[key] {
+			fail("BR-CO-18", "no VAT breakdown for category %s %g%%", key.ID, key.Rate)
+		}
+	}
+
+	if !sameAmount(inv.TaxTotal.TaxAmount.Value, taxSum) {
+		fail("BR-CO-14", "VAT total should be the sum of the breakdown, %.2f", taxSum)
+	}
+
+	inclusive := total.TaxExclusiveAmount.Value + inv.TaxTotal.TaxAmount.Value
+	if !sameAmount(total.TaxInclusiveAmount.Value, inclusive) {
+		fail("BR-CO-15", "total with VAT should be %.2f", inclusive)
+	}
+
+	payable := total.TaxInclusiveAmount.Value - optional(total.PrepaidAmount)
+	if !sameAmount(total.PayableAmount.Value, payable) {
+		fail("BR-CO-16", "amount due should be %.2f", payable)
+	}
+
+	return v
+}
+
+func keyOf(c TaxCategory) taxKey {
+	key := taxKey{ID: c.ID}
+	if c.Percent != nil {
+		key.Rate = *c.Percent
+	}
+	return key
+}
@@ -1,11 +1,13 @@
 package invoices
 
 import (
-	"fmt"
+	"bytes"
+	"io"
 	"os"
-	"path/filepath"
+	"strings"
+	"time"
 
-	// "time"
+	"pistachio/internal/einvoice"
 	"pistachio/internal/models"
 
 	"github.com/jung-kurt/gofpdf"
@@ -13,6 +15,29 @@ import (
 
 const logoPath = "assets/gnome.png"
 
+const (
+	pageWidth    = 210.0
+	pageHeight   = 297.0
+	leftMargin   = 20.0
+	rightMargin  = 20.0
+	topMargin    = 20.0
+	bottomMargin = 20.0
+	contentWidth = pageWidth - leftMargin - rightMargin
+
+	// tableBottom is as low as the items table goes, leaving room for
+	// the continuation note and the page footer
+	tableBottom = pageHeight - bottomMargin - 6
+
+	logoWidth = 30.0
+
+	metaLabelWidth = 35.0
+	metaValueWidth = 35.0
+
+	// minFontScale is how far fitFont shrinks text before letting it
+	// overflow
+	minFontScale = 0.75
+)
+
 func drawAddress(pdf *gofpdf.Fpdf, addr models.CustomerAddress, lineHeight float64) {
 	lines := []string{
 		addr.Line1,
@@ -47,41 +72,79 @@ func drawAddressBusiness(pdf *gofpdf.Fpdf, addr models.BusinessAddress, lineHeig
 
 func drawMetaRow(pdf *gofpdf.Fpdf, x float64, label, value string) {
 	pdf.SetX(x)
-	pdf.SetFont("Roboto", "B", 12)
+	pdf.SetFont(defaultFont, "B", 12)
 	pdf.Cell(35, 6, label)
-	pdf.SetFont("Roboto", "", 12)
+	pdf.SetFont(defaultFont, "", 12)
 	pdf.Cell(45, 6, value)
 	pdf.Ln(6)
 }
 
-func drawItemsTableHeader(pdf *gofpdf.Fpdf, colDesc, colQty, colUnit, colTotal float64) {
-	pdf.SetFont("Roboto", "B", 12)
-	pdf.SetFillColor(230, 230, 230)
+// documentLabels holds the catalogue keys of the wording that differs
+// between the documents rendered by this package.
+type documentLabels struct {
+	Title          string
+	NumberLabel    string
+	DueLabel       string // empty: no due date row
+	ReferenceLabel string // shown with data.Reference when set
+	TotalLabel     string
+	Negative       bool // print amounts as negatives, for credit notes
+}
 
-	pdf.CellFormat(colDesc, 8, "Description", "1", 0, "", true, 0, "")
-		pdf.CellFormat(colUnit, 8, "Unit Price", "1", 0, "R", true, 0, "")
-	pdf.CellFormat(colQty, 8, "Qty", "1", 0, "C", true, 0, "")
-	pdf.CellFormat(colTotal, 8, "Total", "1", 0, "R", true, 0, "")
-	pdf.Ln(8)
+var invoiceLabels = documentLabels{
+	Title:       "invoice.title",
+	NumberLabel: "invoice.number",
+	DueLabel:    "invoice.due",
+	TotalLabel:  "invoice.total",
+}
 
-	pdf.SetFont("Roboto", "", 12)
+var quoteLabels = documentLabels{
+	Title:       "quote.title",
+	NumberLabel: "quote.number",
+	DueLabel:    "quote.due",
+	TotalLabel:  "quote.total",
 }
 
-func GenerateInvoicePDF(data models.InvoiceData, outputDir string) (string, error) {
+var creditNoteLabels = documentLabels{
+	Title:          "credit_note.title",
+	NumberLabel:    "credit_note.number",
+	ReferenceLabel: "credit_note.invoice",
+	TotalLabel:     "credit_note.total",
+	Negative:       true,
+}
 
+// newDocument returns an A4 page with the branding's font registered and
+// the page footer every document shares: the branding's footer text, if
+// any, over the page number.
+func newDocument(b Branding, loc locale) *gofpdf.Fpdf {
 	pdf := gofpdf.New("P", "mm", "A4", "")
-	pdf.SetMargins(20, 20, 20)
+	pdf.SetMargins(leftMargin, topMargin, rightMargin)
 	pdf.AddPage()
 
+	// Register fonts, falling back to Roboto if the branding's are gone
+	files, err := fontFiles(b.Font)
+	if err != nil {
+		b.Font = defaultFont
+		files, _ = fontFiles(defaultFont)
+	}
+	for style, path := range files {
+		pdf.AddUTF8Font(b.Font, style, path)
+	}
+
 	pdf.AliasNbPages("")
 	pdf.SetFooterFunc(func() {
 		pdf.SetY(-15)
-		pdf.SetFont("Roboto", "", 9)
+		pdf.SetFont(b.Font, "", 9)
 		pdf.SetTextColor(120, 120, 120)
+
+		if b.FooterText != "" {
+			pdf.SetY(-20)
+			pdf.CellFormat(0, 5, b.FooterText, "", 1, "C", false, 0, "")
+		}
+
 		pdf.CellFormat(
 			0,
 			10,
-			fmt.Sprintf("Page %d of {nb}", pdf.PageNo()),
+			loc.t("page", pdf.PageNo(), "{nb}"),
 			"",
 			0,
 			"C",
@@ -91,290 +154,829 @@ func GenerateInvoicePDF(data models.InvoiceData, outputDir string) (string, erro
 		)
 	})
 
-	// Register fonts
-	pdf.AddUTF8Font("Roboto", "", "assets/font/Roboto-Regular.ttf")
-	pdf.AddUTF8Font("Roboto", "B", "assets/font/Roboto-Bold.ttf")
-	pdf.AddUTF8Font("Roboto", "I", "assets/font/Roboto-Italic.ttf")
+	pdf.SetFont(b.Font, "", 12)
+
+	return pdf
+}
+
+type totalRow struct {
+	Label  string
+	Amount float64
+}
+
+// totalsRows lists the totals block down to tax. Discounts and
+// surcharges only get a row when the document has them; the deposit and
+// grand total rows are drawn separately.
+func totalsRows(data models.InvoiceData, loc locale) []totalRow {
+	t := data.Totals
+	rows := []totalRow{{loc.t("totals.subtotal"), t.Subtotal}}
 
-	pdf.SetFont("Roboto", "", 12)
+	if t.LineDiscounts > 0 {
+		rows = append(rows, totalRow{loc.t("totals.line_discount"), -t.LineDiscounts})
+	}
 
-	// ============================
-	// HEADER SECTION
-	// ============================
-	// Logo
+	if t.Discount > 0 {
+		label := loc.t("totals.discount")
+		if data.Discount.Type == "percent" {
+			label = loc.t("totals.discount_pct", loc.number(data.Discount.Value, 2, true))
+		}
+		rows = append(rows, totalRow{label, -t.Discount})
+	}
 
-	pageWidth := 210.0
-	rightMargin := 20.0
-	leftMargin := 20.0
+	for _, s := range data.Surcharges {
+		rows = append(rows, totalRow{s.Description + ":", s.Amount})
+	}
 
-	logoWidth := 30.0
-	logoX := pageWidth - rightMargin - logoWidth
-	logoY := 20.0
+	return append(rows, totalRow{loc.t("totals.tax", loc.number(t.TaxRate, 1, false)), t.TaxAmount})
+}
 
-	headerTop := 20.0
+// itemDescription notes a line's discount after its description; the
+// line total is already net of it.
+func itemDescription(item models.InvoiceItem, loc locale, currency string) string {
+	switch {
+	case item.DiscountAmount <= 0:
+		return item.Description
+	case item.Discount.Type == "percent":
+		return loc.t("item.less", item.Description, loc.number(item.Discount.Value, 2, true)+"%")
+	default:
+		return loc.t("item.less", item.Description, loc.money(item.DiscountAmount, currency))
+	}
+}
 
-	pageHeight := 297.0
-	bottomMargin := 20.0
-	footerHeight := 35.0
-	totalsHeight := 30.0
-	// rowHeight := 8.0
+// Option changes how a document PDF is produced.
+type Option func(*pdfOptions)
 
-	usableBottomY := pageHeight - bottomMargin - footerHeight - totalsHeight
+type pdfOptions struct {
+	facturX   bool
+	paymentQR bool
+	branding  Branding
+	language  string
 
-	if data.Business.LogoPath != "" {
-		if _, err := os.Stat(data.Business.LogoPath); err == nil {
-			pdf.Image(data.Business.LogoPath, logoX, logoY, logoWidth, 0, false, "", 0, "")
+	// convert post-processes the finished PDF before it is written
+	convert func([]byte) ([]byte, error)
+}
+
+func buildOptions(opts []Option) pdfOptions {
+	o := pdfOptions{branding: DefaultBranding()}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return o
+}
+
+// WithFacturX produces a PDF/A-3b Factur-X (ZUGFeRD) invoice: the same
+// layout, with the invoice as Cross-Industry-Invoice XML at the EN 16931
+// profile embedded as factur-x.xml. Invoices that break EN 16931 rules
+// fail with an einvoice.ValidationError.
+func WithFacturX() Option {
+	return func(o *pdfOptions) { o.facturX = true }
+}
+
+// WithPaymentQR adds a QR code to the payment details: an EPC (SEPA
+// credit transfer) code for EUR invoices with an IBAN, otherwise the
+// payment link.
+func WithPaymentQR() Option {
+	return func(o *pdfOptions) { o.paymentQR = true }
+}
+
+// WithBranding renders the document with a business's template, colours,
+// font and sections instead of the default classic look.
+func WithBranding(b Branding) Option {
+	return func(o *pdfOptions) { o.branding = b }
+}
+
+// WithLanguage renders the document's wording, dates and amounts in
+// one of Languages(); unknown languages fall back to English.
+func WithLanguage(lang string) Option {
+	return func(o *pdfOptions) { o.language = lang }
+}
+
+// GenerateInvoicePDF renders an invoice to w.
+func GenerateInvoicePDF(data models.InvoiceData, w io.Writer, opts ...Option) error {
+	o := buildOptions(opts)
+
+	if o.facturX {
+		xml, err := einvoice.FacturX(data)
+		if err != nil {
+			return err
+		}
+
+		o.convert = func(pdf []byte) ([]byte, error) {
+			return toPDFA3(pdf,
+				pdfaInfo{
+					Title:    localeFor(o.language).t(invoiceLabels.Title) + " " + data.InvoiceNumber,
+					Author:   data.Business.Name,
+					Producer: "Pistachio",
+					Created:  time.Now(),
+				},
+				pdfaAttachment{
+					FileName:         einvoice.FacturXFileName,
+					Data:             xml,
+					DocumentType:     "INVOICE",
+					Version:          "1.0",
+					ConformanceLevel: einvoice.FacturXLevel,
+				},
+			)
 		}
 	}
 
-	// Business info (right of logo)
-	// pdf.SetXY(logoX - 60, 60)
-	pdf.SetXY(leftMargin, headerTop)
-	pdf.SetFont("Roboto", "B", 20)
-	pdf.Cell(0, 10, data.Business.Name)
-	pdf.Ln(10)
+	return writeDocumentPDF(data, invoiceLabels, w, o)
+}
 
-	pdf.SetFont("Roboto", "", 12)
+// GenerateQuotePDF renders a quote with the invoice layout. The quote
+// number goes in InvoiceNumber and the expiry date in DueDate.
+func GenerateQuotePDF(data models.InvoiceData, w io.Writer, opts ...Option) error {
+	return writeDocumentPDF(data, quoteLabels, w, buildOptions(opts))
+}
 
-	leftColX := leftMargin
-	leftColWidth := 90.0
+// GenerateCreditNotePDF renders a credit note with the invoice layout.
+// Amounts are passed in as positive values and printed as negatives; the
+// credited invoice's number goes in Reference.
+func GenerateCreditNotePDF(data models.InvoiceData, w io.Writer, opts ...Option) error {
+	return writeDocumentPDF(data, creditNoteLabels, w, buildOptions(opts))
+}
 
-	metaLabelWidth := 30.0
-	metaValueWidth := 40.0
-	metaStartX := pageWidth - rightMargin - metaLabelWidth - metaValueWidth
+// writeDocumentPDF renders a document to w. Nothing is written if
+// rendering or conversion fails.
+func writeDocumentPDF(data models.InvoiceData, labels documentLabels, w io.Writer, o pdfOptions) error {
+	pdf, err := renderDocument(data, labels, o)
+	if err != nil {
+		return err
+	}
 
-	// Business Address
-	if data.Business.BusinessAddress.Line1 != "" {
-		drawAddressBusiness(pdf, data.Business.BusinessAddress, 6)
-		pdf.Ln(2)
+	var buf bytes.Buffer
+	if err := pdf.Output(&buf); err != nil {
+		return err
 	}
 
-	// Business Email
-	if data.Business.Email != "" {
-		pdf.SetX(leftColX)
-		pdf.Cell(leftColWidth, 6, data.Business.Email)
-		pdf.Ln(6)
+	out := buf.Bytes()
+	if o.convert != nil {
+		if out, err = o.convert(out); err != nil {
+			return err
+		}
 	}
 
-	// Business Phone
-	if data.Business.Phone != "" {
-		pdf.SetX(leftColX)
-		pdf.Cell(leftColWidth, 6, data.Business.Phone)
-		pdf.Ln(6)
+	_, err = w.Write(out)
+	return err
+}
+
+// renderer draws one document with a template and branding. Each
+// section is a method; templates differ only in their settings.
+type renderer struct {
+	pdf    *gofpdf.Fpdf
+	t      Template
+	b      Branding
+	o      pdfOptions
+	data   models.InvoiceData
+	labels documentLabels
+	loc    locale
+
+	sign      float64 // -1 for credit notes
+	amountDue float64
+	primary   rgb
+	accent    rgb
+}
+
+// newRenderer starts a document: an empty first page set up with the
+// branding's template, font and colours.
+func newRenderer(data models.InvoiceData, labels documentLabels, o pdfOptions) *renderer {
+	b := o.branding
+	t, ok := templates[b.Template]
+	if !ok {
+		t = templates[defaultTemplate]
+	}
+	if _, err := fontFiles(b.Font); err != nil {
+		b.Font = defaultFont
 	}
 
-	// Website
-	if data.Business.Website != "" {
-		pdf.SetX(leftColX)
-		pdf.Cell(leftColWidth, 6, data.Business.Website)
-		pdf.Ln(6)
+	loc := localeFor(o.language)
+
+	r := &renderer{
+		pdf:       newDocument(b, loc),
+		t:         t,
+		b:         b,
+		o:         o,
+		data:      data,
+		labels:    labels,
+		loc:       loc,
+		sign:      1,
+		amountDue: data.Totals.TotalAmount,
+		primary:   mustColor(b.PrimaryColor),
+		accent:    mustColor(b.AccentColor),
 	}
 
-	// VAT number / Company registration
-	if data.Business.VATNumber != "" {
-		pdf.SetX(leftColX)
-		pdf.Cell(0, 6, "VAT: "+data.Business.VATNumber)
-		pdf.Ln(6)
+	if labels.Negative {
+		r.sign = -1
+	}
+	if data.Totals.DepositApplied > 0 {
+		r.amountDue = data.Totals.AmountDue
 	}
 
-	if data.Business.CompanyReg != "" {
-		pdf.SetX(leftColX)
-		pdf.Cell(0, 6, "Company Reg: "+data.Business.CompanyReg)
-		pdf.Ln(6)
+	return r
+}
+
+func renderDocument(data models.InvoiceData, labels documentLabels, o pdfOptions) (*gofpdf.Fpdf, error) {
+	r := newRenderer(data, labels, o)
+	b := r.b
+
+	r.header()
+	r.title()
+
+	if r.t.SideBySide {
+		if err := r.billToAndPayment(); err != nil {
+			return nil, err
+		}
+	} else {
+		if b.shows(SectionBillTo) {
+			r.billTo()
+		}
+		if b.shows(SectionPaymentDetails) {
+			if err := r.payment(leftMargin, contentWidth); err != nil {
+				return nil, err
+			}
+		}
 	}
 
-	pdf.Ln(5)
+	if b.shows(SectionThankYou) {
+		r.thankYou()
+	}
 
-	// Invoice metadata on right side
-	drawMetaRow(pdf, metaStartX, "Invoice No:", data.InvoiceNumber)
-	drawMetaRow(pdf, metaStartX, "Issue Date:", data.IssueDate.Format("02 Jan 2006"))
-	drawMetaRow(pdf, metaStartX, "Due Date:", data.DueDate.Format("02 Jan 2006"))
+	r.items()
+	r.totals()
 
-	pdf.Ln(15)
+	if b.shows(SectionNotes) {
+		r.notes()
+	}
 
-	// =====================================
-	// TITLE
-	// =====================================
-	pdf.SetFont("Roboto", "B", 18)
-	pdf.Cell(0, 12, "INVOICE")
-	pdf.Ln(18)
-
-	// =====================================
-	// BILL TO SECTION
-	// =====================================
-	pdf.SetFont("Roboto", "B", 14)
-	pdf.Cell(0, 8, "Bill To:")
-	pdf.Ln(10)
-
-	pdf.SetFont("Roboto", "", 12)
-	pdf.Cell(0, 6, data.Customer.Name)
-	pdf.Ln(6)
+	return r.pdf, r.pdf.Error()
+}
 
-	if data.Customer.CustomerAddress.Line1 != "" {
-		drawAddress(pdf, data.Customer.CustomerAddress, 6)
-		pdf.Ln(2)
+func (r *renderer) font(style string, size float64) {
+	r.pdf.SetFont(r.b.Font, style, size)
+}
+
+func (r *renderer) textColor(c rgb) {
+	r.pdf.SetTextColor(c.R, c.G, c.B)
+}
+
+// money formats an amount in the document's language and currency.
+func (r *renderer) money(v float64) string {
+	return r.loc.money(v, r.data.CurrencyCode())
+}
+
+// totalsHeight is the space the totals block needs, so it is never split
+// across pages: the gap above it, a row per total and the grand total.
+func (r *renderer) totalsHeight() float64 {
+	h := 6 + 6*float64(len(totalsRows(r.data, r.loc))) + 10
+	if r.data.Totals.DepositApplied > 0 {
+		h += 12 // total and deposit rows
 	}
+	return h
+}
 
-	if data.Customer.Email != "" {
-		pdf.Cell(0, 6, data.Customer.Email)
-		pdf.Ln(10)
+// =====================================
+// HEADER: logo, business details and document meta
+// =====================================
+func (r *renderer) header() {
+	pdf := r.pdf
+	textX := leftMargin
+	logoBottom := topMargin
+
+	if logo := r.data.Business.LogoPath; logo != "" && r.b.LogoPosition != LogoNone {
+		if _, err := os.Stat(logo); err == nil {
+			logoX := pageWidth - rightMargin - logoWidth
+			if r.b.LogoPosition == LogoLeft {
+				logoX = leftMargin
+				textX = leftMargin + logoWidth + 8
+			}
+
+			info := pdf.RegisterImage(logo, "")
+			if info != nil {
+				pdf.Image(logo, logoX, topMargin, logoWidth, 0, false, "", 0, "")
+				logoBottom = topMargin + logoWidth*info.Height()/info.Width()
+			}
+		}
 	}
 
-	// =====================================
-	// PAYMENT INFORMATION
-	// =====================================
-	// Reset Font
+	pdf.SetLeftMargin(textX)
+	pdf.SetXY(textX, topMargin)
+
+	// A long business name wraps rather than running under a right logo
+	nameWidth := pageWidth - rightMargin - textX
+	if logoBottom > topMargin && r.b.LogoPosition == LogoRight {
+		nameWidth -= logoWidth + 8
+	}
+
+	r.textColor(r.primary)
+	for _, line := range r.fitLines("B", r.t.NameSize, nameWidth, r.data.Business.Name) {
+		pdf.Cell(nameWidth, r.t.NameSize/2, line)
+		pdf.Ln(r.t.NameSize / 2)
+	}
 	pdf.SetTextColor(0, 0, 0)
-	pdf.SetFont("Roboto", "B", 12)
 
-	pdf.SetFont("Roboto", "B", 14)
-	pdf.Cell(0, 8, "Payment Details")
-	pdf.Ln(10)
+	r.font("", r.t.BaseSize)
+	if r.b.shows(SectionBusinessDetails) {
+		r.businessDetails()
+	}
+
+	pdf.SetLeftMargin(leftMargin)
+	if pdf.GetY() < logoBottom {
+		pdf.SetY(logoBottom)
+	}
 
-	pdf.SetFont("Roboto", "", 12)
+	pdf.Ln(5)
 
-	if data.Payment.AccountName != "" {
-		pdf.Cell(0, 6, "Account Name: "+data.Payment.AccountName)
-		pdf.Ln(6)
+	// Document metadata on the right side
+	meta := [][2]string{
+		{r.loc.t(r.labels.NumberLabel), r.data.InvoiceNumber},
+		{r.loc.t("issue_date"), r.loc.date(r.data.IssueDate)},
 	}
-	if data.Payment.BankName != "" {
-		pdf.Cell(0, 6, "Bank: "+data.Payment.BankName)
-		pdf.Ln(6)
+	if r.labels.DueLabel != "" {
+		meta = append(meta, [2]string{r.loc.t(r.labels.DueLabel), r.loc.date(r.data.DueDate)})
 	}
-	if data.Payment.SortCode != "" {
-		pdf.Cell(0, 6, "Sort Code: "+data.Payment.SortCode)
-		pdf.Ln(6)
+	if r.labels.ReferenceLabel != "" && r.data.Reference != "" {
+		meta = append(meta, [2]string{r.loc.t(r.labels.ReferenceLabel), r.data.Reference})
 	}
-	if data.Payment.AccountNumber != "" {
-		pdf.Cell(0, 6, "Account Number: "+data.Payment.AccountNumber)
-		pdf.Ln(6)
+
+	// Labels are as wide as the longest in the document's language
+	r.font("B", r.t.BaseSize)
+	labelWidth := metaLabelWidth
+	for _, row := range meta {
+		labelWidth = max(labelWidth, pdf.GetStringWidth(row[0])+2*pdf.GetCellMargin())
 	}
-	if data.Payment.IBAN != "" {
-		pdf.Cell(0, 6, "IBAN: "+data.Payment.IBAN)
-		pdf.Ln(6)
+	labelWidth = min(labelWidth, contentWidth/2-metaValueWidth)
+
+	metaX := pageWidth - rightMargin - labelWidth - metaValueWidth
+	for _, row := range meta {
+		r.metaRow(metaX, labelWidth, row[0], row[1])
 	}
-	if data.Payment.BIC != "" {
-		pdf.Cell(0, 6, "BIC: "+data.Payment.BIC)
-		pdf.Ln(6)
+
+	pdf.Ln(r.t.LineHeight * 2.5)
+}
+
+func (r *renderer) businessDetails() {
+	pdf := r.pdf
+	lh := r.t.LineHeight
+	bus := r.data.Business
+
+	var contact []string
+	for _, s := range []string{bus.Email, bus.Phone, bus.Website} {
+		if s != "" {
+			contact = append(contact, s)
+		}
+	}
+	if bus.VATNumber != "" {
+		contact = append(contact, r.loc.t("vat_number", bus.VATNumber))
+	}
+	if bus.CompanyReg != "" {
+		contact = append(contact, r.loc.t("company_reg", bus.CompanyReg))
 	}
 
-	if data.Payment.Notes != "" {
-		pdf.Ln(4)
-		pdf.MultiCell(0, 6, data.Payment.Notes, "", "", false)
+	if r.t.InlineInfo {
+		var address []string
+		a := bus.BusinessAddress
+		for _, s := range []string{a.Line1, a.Line2, a.City, a.Postcode, a.Country} {
+			if s != "" {
+				address = append(address, s)
+			}
+		}
+		if len(address) > 0 {
+			pdf.MultiCell(0, lh, strings.Join(address, ", "), "", "", false)
+		}
+		if len(contact) > 0 {
+			pdf.MultiCell(0, lh, strings.Join(contact, "  ·  "), "", "", false)
+		}
+		return
 	}
 
-	pdf.Ln(10)
+	if bus.BusinessAddress.Line1 != "" {
+		drawAddressBusiness(pdf, bus.BusinessAddress, lh)
+		pdf.Ln(2)
+	}
 
-	// =====================================
-	// THANK YOU MESSAGE
-	// =====================================
-	pdf.Ln(4)
-	pdf.SetFont("Roboto", "", 11)
-	pdf.SetTextColor(80, 80, 80)
+	for _, line := range contact {
+		pdf.Cell(0, lh, line)
+		pdf.Ln(lh)
+	}
+}
 
-	pdf.MultiCell(
-		0,
-		6,
-		"Thank you for your business!",
-		"",
-		"",
-		false,
-	)
+func (r *renderer) metaRow(x, labelWidth float64, label, value string) {
+	pdf := r.pdf
+	pdf.SetX(x)
+	r.fitFont("B", r.t.BaseSize, labelWidth, label)
+	pdf.Cell(labelWidth, r.t.LineHeight, label)
+	r.fitFont("", r.t.BaseSize, metaValueWidth, value)
+	pdf.Cell(metaValueWidth, r.t.LineHeight, value)
+	pdf.Ln(r.t.LineHeight)
+}
 
-	pdf.Ln(6)
+// fitFont sets the font, shrinking it down to minFontScale of size so a
+// translated label fits in a cell of the given width.
+func (r *renderer) fitFont(style string, size, width float64, text string) {
+	r.font(style, size)
+	room := width - 2*r.pdf.GetCellMargin()
+
+	for s := size; r.pdf.GetStringWidth(text) > room && s > size*minFontScale; {
+		s = max(s-0.5, size*minFontScale)
+		r.font(style, s)
+	}
+}
 
-	// Reset for table
+// fitLines is fitFont for text such as names, which wraps onto more
+// lines when it doesn't fit at the smallest size.
+func (r *renderer) fitLines(style string, size, width float64, text string) []string {
+	r.fitFont(style, size, width, text)
+	return wrapText(r.pdf, text, width-2*r.pdf.GetCellMargin())
+}
+
+// =====================================
+// TITLE
+// =====================================
+func (r *renderer) title() {
+	pdf := r.pdf
+	r.font("B", r.t.TitleSize)
+
+	if r.t.TitleBand {
+		pdf.SetFillColor(r.accent.R, r.accent.G, r.accent.B)
+		r.textColor(r.accent.contrast())
+		pdf.CellFormat(0, r.t.TitleSize*0.7, "  "+r.loc.t(r.labels.Title), "", 1, "L", true, 0, "")
+		pdf.SetTextColor(0, 0, 0)
+		pdf.Ln(r.t.LineHeight * 1.5)
+		return
+	}
+
+	r.textColor(r.primary)
+	pdf.Cell(0, r.t.TitleSize*2/3, r.loc.t(r.labels.Title))
 	pdf.SetTextColor(0, 0, 0)
-	pdf.SetFont("Roboto", "B", 12)
+	pdf.Ln(r.t.TitleSize)
+}
 
-	// =====================================
-	// ITEMS TABLE
-	// =====================================
-	pdf.SetFont("Roboto", "B", 12)
+// =====================================
+// BILL TO SECTION
+// =====================================
+func (r *renderer) billTo() {
+	pdf := r.pdf
+	lh := r.t.LineHeight
 
-	colDesc := 80.0
-	colQty := 20.0
-	colUnit := 35.0
-	colTotal := 35.0
+	r.font("B", r.t.HeadingSize)
+	pdf.Cell(0, lh+2, r.loc.t("bill_to"))
+	pdf.Ln(lh + 4)
 
-	// Ensure space for header + at least one row
-	tableHeaderHeight := 8.0
-	rowHeight := 8.0
+	// Beside the payment details, the right margin is moved in
+	left, _, right, _ := pdf.GetMargins()
+	width := pageWidth - left - right
 
-	if pdf.GetY()+tableHeaderHeight+rowHeight > usableBottomY {
-		pdf.AddPage()
+	for _, line := range r.fitLines("", r.t.BaseSize, width, r.data.Customer.Name) {
+		pdf.Cell(width, lh, line)
+		pdf.Ln(lh)
 	}
+	r.font("", r.t.BaseSize)
 
-	drawItemsTableHeader(pdf, colDesc, colQty, colUnit, colTotal)
+	if r.data.Customer.CustomerAddress.Line1 != "" {
+		drawAddress(pdf, r.data.Customer.CustomerAddress, lh)
+		pdf.Ln(2)
+	}
 
-	for _, item := range data.Items {
+	if r.data.Customer.Email != "" {
+		for _, line := range r.fitLines("", r.t.BaseSize, width, r.data.Customer.Email) {
+			pdf.Cell(width, lh, line)
+			pdf.Ln(lh)
+		}
+		r.font("", r.t.BaseSize)
+		pdf.Ln(4)
+	}
+}
 
-		if pdf.GetY()+rowHeight > usableBottomY {
+// billToAndPayment puts the customer on the left and the payment details
+// on the right, continuing below whichever is longer.
+func (r *renderer) billToAndPayment() error {
+	pdf := r.pdf
+	top := pdf.GetY()
+	half := contentWidth / 2
+	bottom := top
+
+	if r.b.shows(SectionBillTo) {
+		pdf.SetRightMargin(rightMargin + half)
+		r.billTo()
+		pdf.SetRightMargin(rightMargin)
+		bottom = pdf.GetY()
+	}
 
-			pdf.SetFont("Roboto", "I", 9)
-			pdf.SetTextColor(120, 120, 120)
-			pdf.CellFormat(0, 5, "Items continued on next page…", "", 1, "R", false, 0, "")
+	if r.b.shows(SectionPaymentDetails) {
+		pdf.SetLeftMargin(leftMargin + half)
+		pdf.SetXY(leftMargin+half, top)
+		err := r.payment(leftMargin+half, half)
+		pdf.SetLeftMargin(leftMargin)
+		pdf.SetX(leftMargin)
+		if err != nil {
+			return err
+		}
+	}
+
+	if pdf.GetY() < bottom {
+		pdf.SetY(bottom)
+	}
+	return nil
+}
+
+// =====================================
+// PAYMENT INFORMATION
+// =====================================
+
+// payment draws the bank details, payment link and QR code in a column
+// of the given width starting at x. Quotes carry no bank details, so the
+// section is skipped when empty.
+func (r *renderer) payment(x, width float64) error {
+	pdf := r.pdf
+	p := r.data.Payment
+	lh := r.t.LineHeight
+
+	if p == (models.PaymentInfo{}) {
+		return nil
+	}
+
+	sectionTop := pdf.GetY()
+	sectionBottom := sectionTop
+	textWidth := width
+
+	// The QR code sits to the right of the bank details, its caption
+	// wrapped underneath
+	if r.o.paymentQR {
+		if payload, caption := paymentQR(r.data, r.amountDue); payload != "" {
+			qrX := x + width - qrSize
+			if err := drawQR(pdf, payload, qrX, sectionTop, qrSize); err != nil {
+				return err
+			}
+
+			r.font("", 9)
+			pdf.SetTextColor(100, 100, 100)
+			sectionBottom = sectionTop + qrSize
+			for _, line := range wrapText(pdf, r.loc.t(caption), qrSize-2*pdf.GetCellMargin()) {
+				pdf.SetXY(qrX, sectionBottom)
+				pdf.CellFormat(qrSize, 4, line, "", 0, "C", false, 0, "")
+				sectionBottom += 4
+			}
 			pdf.SetTextColor(0, 0, 0)
 
-			pdf.AddPage()
-			drawItemsTableHeader(pdf, colDesc, colQty, colUnit, colTotal)
+			pdf.SetXY(x, sectionTop)
+			textWidth = width - qrSize - 5
 		}
+	}
 
-		pdf.CellFormat(colDesc, rowHeight, item.Description, "1", 0, "", false, 0, "")
-		pdf.CellFormat(colUnit, rowHeight, fmt.Sprintf("£%.2f", item.UnitPrice), "1", 0, "R", false, 0, "")
-		pdf.CellFormat(colQty, rowHeight, fmt.Sprintf("%.2f", item.Quantity), "1", 0, "C", false, 0, "")
-		pdf.CellFormat(colTotal, rowHeight, fmt.Sprintf("£%.2f", item.LineTotal), "1", 0, "R", false, 0, "")
-		pdf.Ln(rowHeight)
+	r.fitFont("B", r.t.HeadingSize, textWidth, r.loc.t("payment_details"))
+	pdf.Cell(textWidth, lh+2, r.loc.t("payment_details"))
+	pdf.Ln(lh + 4)
+
+	r.font("", r.t.BaseSize)
+
+	for _, row := range [][2]string{
+		{"account_name", p.AccountName},
+		{"bank", p.BankName},
+		{"sort_code", p.SortCode},
+		{"account_number", p.AccountNumber},
+		{"iban", p.IBAN},
+		{"bic", p.BIC},
+	} {
+		if row[1] != "" {
+			for _, line := range r.fitLines("", r.t.BaseSize, textWidth, r.loc.t(row[0], row[1])) {
+				pdf.CellFormat(textWidth, lh, line, "", 0, "", false, 0, "")
+				pdf.Ln(lh)
+			}
+		}
+	}
+	r.font("", r.t.BaseSize)
+
+	if p.PaymentLink != "" {
+		label := r.loc.t("pay_online")
+		labelWidth := pdf.GetStringWidth(label)
+		pdf.Cell(labelWidth, lh, label)
+		r.textColor(r.linkColor())
+		r.font("U", r.t.BaseSize)
+		pdf.CellFormat(textWidth-labelWidth, lh, p.PaymentLink, "", 0, "", false, 0, p.PaymentLink)
+		r.font("", r.t.BaseSize)
+		pdf.SetTextColor(0, 0, 0)
+		pdf.Ln(lh)
 	}
 
-	// drawItemsTableHeader(pdf, colDesc, colQty, colUnit, colTotal)
+	if p.Notes != "" {
+		pdf.Ln(4)
+		pdf.MultiCell(textWidth, lh, p.Notes, "", "", false)
+	}
 
-	// for i, item := range data.Items {
+	// Leave room for the QR code and its caption
+	if pdf.GetY() < sectionBottom {
+		pdf.SetY(sectionBottom)
+	}
 
-	// 	// Estimate row height (safe even if description grows later)
-	// 	rowHeight := 8.0
+	pdf.Ln(lh + 4)
+	return nil
+}
 
-	// 	// BEFORE writing the row, check space
-	// 	if pdf.GetY()+rowHeight > usableBottomY {
+// linkColor is the primary colour, or the usual link blue when that is
+// plain black.
+func (r *renderer) linkColor() rgb {
+	if r.primary == (rgb{}) {
+		return rgb{20, 80, 200}
+	}
+	return r.primary
+}
 
-	// 		// Optional continuation note
-	// 		pdf.SetFont("Roboto", "I", 9)
-	// 		pdf.SetTextColor(120, 120, 120)
+// =====================================
+// THANK YOU MESSAGE
+// =====================================
+func (r *renderer) thankYou() {
+	pdf := r.pdf
+	pdf.Ln(4)
+	r.font("", r.t.SmallSize+1)
+	pdf.SetTextColor(80, 80, 80)
+	pdf.MultiCell(0, r.t.LineHeight, r.loc.t("thank_you"), "", "", false)
+	pdf.SetTextColor(0, 0, 0)
+	pdf.Ln(r.t.LineHeight)
+}
 
-	// 		// Move cursor to right margin and align text right
-	// 		pdf.CellFormat(
-	// 			0, // full width
-	// 			5,
-	// 			"Items continued on next page…",
-	// 			"",
-	// 			1,   // line break
-	// 			"R", // RIGHT aligned
-	// 			false,
-	// 			0,
-	// 			"",
-	// 		)
-	// 		pdf.SetTextColor(0, 0, 0)
+// =====================================
+// ITEMS TABLE
+// =====================================
+
+// itemColumns are the items table's headings and alignments, in the
+// order of the template's column widths, so headings and cells always
+// line up.
+var itemColumns = [4]struct{ Title, Align string }{
+	{"column.description", "L"},
+	{"column.unit_price", "R"},
+	{"column.qty", "C"},
+	{"column.total", "R"},
+}
 
-	// 		pdf.Ln(6)
+func (r *renderer) itemsHeader() {
+	pdf := r.pdf
+	h := r.t.RowHeight
 
-	// 		pdf.AddPage()
-	// 		drawItemsTableHeader(pdf, colDesc, colQty, colUnit, colTotal)
-	// 	}
+	r.font("B", r.t.BaseSize)
+	pdf.SetFillColor(r.accent.R, r.accent.G, r.accent.B)
+	r.textColor(r.accent.contrast())
 
-	// 	pdf.CellFormat(colDesc, rowHeight, item.Description, "1", 0, "", false, 0, "")
-	// 	pdf.CellFormat(colQty, rowHeight, fmt.Sprintf("%.2f", item.Quantity), "1", 0, "C", false, 0, "")
-	// 	pdf.CellFormat(colUnit, rowHeight, fmt.Sprintf("£%.2f", item.UnitPrice), "1", 0, "R", false, 0, "")
-	// 	pdf.CellFormat(colTotal, rowHeight, fmt.Sprintf("£%.2f", item.LineTotal), "1", 0, "R", false, 0, "")
-	// 	pdf.Ln(rowHeight)
+	for i, col := range itemColumns {
+		title := r.loc.t(col.Title)
+		r.fitFont("B", r.t.BaseSize, r.t.Columns[i], title)
+		pdf.CellFormat(r.t.Columns[i], h, title, r.t.RowBorder, 0, col.Align, true, 0, "")
+	}
+	pdf.Ln(h)
 
-	// 	_ = i // (useful later for zebra striping)
-	// }
+	pdf.SetTextColor(0, 0, 0)
+	r.font("", r.t.BaseSize)
+}
 
-	// =====================================
-	// TOTALS
-	// =====================================
+// continueItems notes that the table carries on and repeats its header
+// on a new page.
+func (r *renderer) continueItems() {
+	pdf := r.pdf
+	r.font("I", 9)
+	pdf.SetTextColor(120, 120, 120)
+	pdf.CellFormat(0, 5, r.loc.t("items_continued"), "", 1, "R", false, 0, "")
+	pdf.SetTextColor(0, 0, 0)
+
+	pdf.AddPage()
+	r.itemsHeader()
+}
+
+// rowHeight is the height of an item row with n description lines. A
+// one-line row is the template's row height.
+func (r *renderer) rowHeight(n int) float64 {
+	return float64(n)*r.t.LineHeight + r.t.RowHeight - r.t.LineHeight
+}
+
+func (r *renderer) items() {
+	pdf := r.pdf
+	lh := r.t.LineHeight
+	pad := (r.t.RowHeight - lh) / 2
+
+	// A row that can't fit on an empty page is split across pages
+	maxRow := tableBottom - topMargin - r.t.RowHeight
+
+	// Ensure space for header + at least one row
+	if pdf.GetY()+2*r.t.RowHeight > tableBottom {
+		pdf.AddPage()
+	}
+
+	r.itemsHeader()
+
+	for _, item := range r.data.Items {
+		lines := wrapText(pdf, itemDescription(item, r.loc, r.data.CurrencyCode()), r.t.Columns[0]-2*pdf.GetCellMargin())
+		values := [4]string{
+			"",
+			r.money(r.sign * item.UnitPrice),
+			r.loc.number(item.Quantity, 2, false),
+			r.money(r.sign * item.LineTotal),
+		}
+
+		if h := r.rowHeight(len(lines)); pdf.GetY()+h > tableBottom && h <= maxRow {
+			r.continueItems()
+		}
+
+		for len(lines) > 0 {
+			fit := int((tableBottom - pdf.GetY() - 2*pad) / lh)
+			if fit < 1 {
+				r.continueItems()
+				continue
+			}
+
+			n := min(fit, len(lines))
+			r.itemRow(lines[:n], values)
+			lines = lines[n:]
+
+			// Amounts are printed on the first part of a split row only
+			values = [4]string{}
+			if len(lines) > 0 {
+				r.continueItems()
+			}
+		}
+	}
+}
+
+// itemRow draws one row: the description lines top-aligned in the first
+// column, the values on the first line of the others.
+func (r *renderer) itemRow(lines []string, values [4]string) {
+	pdf := r.pdf
+	lh := r.t.LineHeight
+	pad := (r.t.RowHeight - lh) / 2
+	y := pdf.GetY()
+	h := r.rowHeight(len(lines))
+
+	x := leftMargin
+	for i, w := range r.t.Columns {
+		if r.t.RowBorder == "1" {
+			pdf.Rect(x, y, w, h, "D")
+		}
+
+		if i == 0 {
+			for j, line := range lines {
+				pdf.SetXY(x, y+pad+float64(j)*lh)
+				pdf.CellFormat(w, lh, line, "", 0, itemColumns[i].Align, false, 0, "")
+			}
+		} else {
+			pdf.SetXY(x, y+pad)
+			r.fitFont("", r.t.BaseSize, w, values[i])
+			pdf.CellFormat(w, lh, values[i], "", 0, itemColumns[i].Align, false, 0, "")
+		}
+
+		x += w
+	}
+
+	if r.t.RowBorder == "B" {
+		pdf.Line(leftMargin, y+h, x, y+h)
+	}
+
+	r.font("", r.t.BaseSize)
+	pdf.SetXY(leftMargin, y+h)
+}
+
+// wrapText breaks s into lines no wider than width in the current font,
+// at spaces where possible and within words that are too long for a
+// line on their own.
+func wrapText(pdf *gofpdf.Fpdf, s string, width float64) []string {
+	var lines []string
+
+	for _, para := range strings.Split(strings.ReplaceAll(s, "\r", ""), "\n") {
+		line := ""
+		for _, word := range strings.Fields(para) {
+			candidate := word
+			if line != "" {
+				candidate = line + " " + word
+			}
+			if pdf.GetStringWidth(candidate) <= width {
+				line = candidate
+				continue
+			}
+
+			if line != "" {
+				lines = append(lines, line)
+			}
+
+			// Break a word wider than the column
+			line = ""
+			for _, c := range word {
+				if line != "" && pdf.GetStringWidth(line+string(c)) > width {
+					lines = append(lines, line)
+					line = ""
+				}
+				line += string(c)
+			}
+		}
+		lines = append(lines, line)
+	}
+
+	return lines
+}
+
+// =====================================
+// TOTALS
+// =====================================
+func (r *renderer) totals() {
+	pdf := r.pdf
+	sign := r.sign
 
-	if pdf.GetY()+totalsHeight > pageHeight-bottomMargin {
+	if pdf.GetY()+r.totalsHeight() > pageHeight-bottomMargin {
 		pdf.AddPage()
 	}
 
@@ -383,85 +985,48 @@ func GenerateInvoicePDF(data models.InvoiceData, outputDir string) (string, erro
 	labelCol := 120.0
 	rightCol := 50.0
 
-	pdf.SetFont("Roboto", "", 12)
-	pdf.CellFormat(labelCol, 8, "Subtotal:", "", 0, "R", false, 0, "")
-	pdf.CellFormat(rightCol, 8, fmt.Sprintf("£%.2f", data.Totals.Subtotal), "", 0, "R", false, 0, "")
-	pdf.Ln(6)
+	r.font("", r.t.BaseSize)
+	for _, row := range totalsRows(r.data, r.loc) {
+		pdf.CellFormat(labelCol, 8, row.Label, "", 0, "R", false, 0, "")
+		pdf.CellFormat(rightCol, 8, r.money(sign*row.Amount), "", 0, "R", false, 0, "")
+		pdf.Ln(6)
+	}
 
-	pdf.CellFormat(labelCol, 8, fmt.Sprintf("Tax (%.1f%%):", data.Totals.TaxRate), "", 0, "R", false, 0, "")
-	pdf.CellFormat(rightCol, 8, fmt.Sprintf("£%.2f", data.Totals.TaxAmount), "", 0, "R", false, 0, "")
-	pdf.Ln(6)
+	if r.data.Totals.DepositApplied > 0 {
+		pdf.CellFormat(labelCol, 8, r.loc.t("totals.total"), "", 0, "R", false, 0, "")
+		pdf.CellFormat(rightCol, 8, r.money(sign*r.data.Totals.TotalAmount), "", 0, "R", false, 0, "")
+		pdf.Ln(6)
 
-	pdf.SetFont("Roboto", "B", 14)
-	pdf.CellFormat(labelCol, 10, "Amount Due:", "", 0, "R", false, 0, "")
-	pdf.CellFormat(rightCol, 10, fmt.Sprintf("£%.2f", data.Totals.TotalAmount), "", 0, "R", false, 0, "")
-	pdf.Ln(15)
+		pdf.CellFormat(labelCol, 8, r.loc.t("totals.deposit"), "", 0, "R", false, 0, "")
+		pdf.CellFormat(rightCol, 8, r.money(-sign*r.data.Totals.DepositApplied), "", 0, "R", false, 0, "")
+		pdf.Ln(6)
+	}
 
-	// // =====================================
-	// // PAYMENT INFORMATION
-	// // =====================================
-	// pdf.SetFont("Roboto", "B", 14)
-	// pdf.Cell(0, 8, "Payment Details")
-	// pdf.Ln(10)
-
-	// pdf.SetFont("Roboto", "", 12)
-
-	// if data.Payment.AccountName != "" {
-	// 	pdf.Cell(0, 6, "Account Name: "+data.Payment.AccountName)
-	// 	pdf.Ln(6)
-	// }
-	// if data.Payment.BankName != "" {
-	// 	pdf.Cell(0, 6, "Bank: "+data.Payment.BankName)
-	// 	pdf.Ln(6)
-	// }
-	// if data.Payment.SortCode != "" {
-	// 	pdf.Cell(0, 6, "Sort Code: "+data.Payment.SortCode)
-	// 	pdf.Ln(6)
-	// }
-	// if data.Payment.AccountNumber != "" {
-	// 	pdf.Cell(0, 6, "Account Number: "+data.Payment.AccountNumber)
-	// 	pdf.Ln(6)
-	// }
-	// if data.Payment.IBAN != "" {
-	// 	pdf.Cell(0, 6, "IBAN: "+data.Payment.IBAN)
-	// 	pdf.Ln(6)
-	// }
-	// if data.Payment.BIC != "" {
-	// 	pdf.Cell(0, 6, "BIC: "+data.Payment.BIC)
-	// 	pdf.Ln(6)
-	// }
-
-	// if data.Payment.Notes != "" {
-	// 	pdf.Ln(4)
-	// 	pdf.MultiCell(0, 6, data.Payment.Notes, "", "", false)
-	// }
-
-	// pdf.Ln(10)
-
-	// =====================================
-	// FOOTER NOTES (CONTENT)
-	// =====================================
-	if data.FooterNotes != "" {
-
-		// Ensure notes don’t collide with footer
-		if pdf.GetY()+20 > pageHeight-bottomMargin {
-			pdf.AddPage()
-		}
+	r.font("B", r.t.HeadingSize)
+	r.textColor(r.primary)
+	pdf.CellFormat(labelCol, 10, r.loc.t(r.labels.TotalLabel), "", 0, "R", false, 0, "")
+	r.fitFont("B", r.t.HeadingSize, rightCol, r.money(sign*r.amountDue))
+	pdf.CellFormat(rightCol, 10, r.money(sign*r.amountDue), "", 0, "R", false, 0, "")
+	pdf.SetTextColor(0, 0, 0)
+	pdf.Ln(15)
+}
 
-		pdf.SetFont("Roboto", "", 10)
-		pdf.SetTextColor(100, 100, 100)
-		pdf.MultiCell(0, 5, data.FooterNotes, "", "", false)
+// =====================================
+// FOOTER NOTES (CONTENT)
+// =====================================
+func (r *renderer) notes() {
+	pdf := r.pdf
+	if r.data.FooterNotes == "" {
+		return
 	}
 
-	// Save file
-	os.MkdirAll(outputDir, os.ModePerm)
-	filename := fmt.Sprintf("%s.pdf", data.InvoiceID)
-	path := filepath.Join(outputDir, filename)
-
-	err := pdf.OutputFileAndClose(path)
-	if err != nil {
-		return "", err
+	// Ensure notes don’t collide with footer
+	if pdf.GetY()+20 > pageHeight-bottomMargin {
+		pdf.AddPage()
 	}
 
-	return path, nil
+	r.font("", r.t.SmallSize)
+	pdf.SetTextColor(100, 100, 100)
+	pdf.MultiCell(0, 5, r.data.FooterNotes, "", "", false)
+	pdf.SetTextColor(0, 0, 0)
 }
@@ -0,0 +1,546 @@
+package invoices
+
+import (
+	"bytes"
+	"compress/zlib"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf16"
+
+	"pistachio/internal/models"
+
+	"github.com/jung-kurt/gofpdf"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files in testdata")
+
+// TestMain runs the tests from the repository root, where the fonts in
+// assets/font are.
+func TestMain(m *testing.M) {
+	if err := os.Chdir("../.."); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	os.Exit(m.Run())
+}
+
+// invoiceWithLines is an invoice with n numbered lines, the same every run.
+func invoiceWithLines(n int) models.InvoiceData {
+	items := make([]models.InvoiceItem, n)
+	for i := range items {
+		items[i] = models.InvoiceItem{
+			Description: fmt.Sprintf("Line %d: replace washer and reseal joint", i+1),
+			Quantity:    float64(i%3 + 1),
+			UnitPrice:   12.5 + float64(i%7),
+			TaxRate:     20,
+		}
+	}
+
+	issued := time.Date(2026, 10, 19, 9, 0, 0, 0, time.UTC)
+
+	return models.InvoiceData{
+		InvoiceID:     "golden",
+		InvoiceNumber: fmt.Sprintf("INV-2026-%04d", n),
+		IssueDate:     issued,
+		DueDate:       issued.AddDate(0, 0, 14),
+		Business: models.BusinessInfo{
+			Name:      "Pistachio Ltd",
+			Email:     "support@pistachio.com",
+			VATNumber: "GB123456789",
+			BusinessAddress: models.BusinessAddress{
+				Line1: "1 High Street", City: "Bristol", Postcode: "BS1 1AA", Country: "United Kingdom",
+			},
+		},
+		Customer: models.CustomerInfo{
+			Name:  "Ada Customer",
+			Email: "ada@example.com",
+			CustomerAddress: models.CustomerAddress{
+				Line1: "2 Low Road", City: "Bath", Postcode: "BA1 1AA",
+			},
+		},
+		Payment: models.PaymentInfo{
+			BankName:      "Barclays",
+			AccountName:   "Pistachio Ltd",
+			SortCode:      "00-00-00",
+			AccountNumber: "00000000",
+		},
+		Items:  items,
+		Totals: models.CalculateTotals(items),
+	}
+}
+
+// textRun is a string drawn by a Tj operator: where it starts, in mm
+// from the top left of the page, and the font it's drawn in.
+type textRun struct {
+	x, y  float64
+	style string // "", "B" or "I"
+	size  float64
+	text  string
+}
+
+var (
+	fontResource = regexp.MustCompile(`/F(\w+) (\d+) 0 R`)
+	fontObject   = regexp.MustCompile(`(?m)^(\d+) 0 obj\n<</Type /Font\n/Subtype /Type0\n/BaseFont /utf8[a-z]+([BI]?)\n`)
+	textOperator = regexp.MustCompile(`/F(\w+) ([\d.]+) Tf|([\d.-]+) ([\d.-]+) Td \(`)
+)
+
+// pdfPages returns the text drawn on each page of a PDF written by
+// gofpdf, in drawing order.
+func pdfPages(t *testing.T, pdf []byte) [][]textRun {
+	t.Helper()
+
+	// Font resource names to styles, through the font objects
+	objectStyles := map[string]string{}
+	for _, m := range fontObject.FindAllSubmatch(pdf, -1) {
+		objectStyles[string(m[1])] = string(m[2])
+	}
+	styles := map[string]string{}
+	for _, m := range fontResource.FindAllSubmatch(pdf, -1) {
+		if style, ok := objectStyles[string(m[2])]; ok {
+			styles[string(m[1])] = style
+		}
+	}
+
+	var pages [][]textRun
+	for _, content := range pageContents(t, pdf) {
+		pages = append(pages, showText(content, styles))
+	}
+
+	return pages
+}
+
+// pageContents returns the inflated content stream of each page of a PDF
+// written by gofpdf.
+func pageContents(t *testing.T, pdf []byte) [][]byte {
+	t.Helper()
+
+	var contents [][]byte
+	for rest := pdf; ; {
+		start := bytes.Index(rest, []byte("stream\n"))
+		if start < 0 {
+			break
+		}
+		rest = rest[start+len("stream\n"):]
+		end := bytes.Index(rest, []byte("\nendstream"))
+		if end < 0 {
+			t.Fatal("unterminated stream")
+		}
+		stream := rest[:end]
+		rest = rest[end+len("\nendstream"):]
+
+		zr, err := zlib.NewReader(bytes.NewReader(stream))
+		if err != nil {
+			continue
+		}
+		content, err := io.ReadAll(zr)
+		if err != nil || !bytes.Contains(content, []byte(")Tj")) {
+			continue
+		}
+		contents = append(contents, content)
+	}
+
+	return contents
+}
+
+// showText decodes the UTF-16BE strings of a page's Tj operators,
+// keeping track of the font set by Tf.
+func showText(content []byte, styles map[string]string) []textRun {
+	const k = 72 / 25.4 // points per mm
+
+	var runs []textRun
+	var style string
+	var size float64
+
+	for i := 0; i < len(content); i++ {
+		loc := textOperator.FindSubmatchIndex(content[i:])
+		if loc == nil {
+			break
+		}
+		m := textOperator.FindSubmatch(content[i+loc[0] : i+loc[1]])
+		i += loc[0]
+
+		if m[1] != nil {
+			style = styles[string(m[1])]
+			size, _ = strconv.ParseFloat(string(m[2]), 64)
+			i += len(m[0]) - 1
+			continue
+		}
+
+		x, _ := strconv.ParseFloat(string(m[3]), 64)
+		y, _ := strconv.ParseFloat(string(m[4]), 64)
+
+		var raw []byte
+		for i += len(m[0]); i < len(content) && content[i] != ')'; i++ {
+			c := content[i]
+			if c == '\\' {
+				i++
+				switch c = content[i]; c {
+				case 'r':
+					c = '\r'
+				case 'n':
+					c = '\n'
+				}
+			}
+			raw = append(raw, c)
+		}
+
+		if !bytes.HasPrefix(content[i+1:], []byte("Tj")) {
+			continue
+		}
+
+		units := make([]uint16, len(raw)/2)
+		for j := range units {
+			units[j] = uint16(raw[2*j])<<8 | uint16(raw[2*j+1])
+		}
+		runs = append(runs, textRun{
+			x:     x / k,
+			y:     pageHeight - y/k,
+			style: style,
+			size:  size,
+			text:  string(utf16.Decode(units)),
+		})
+	}
+
+	return runs
+}
+
+// texts returns the strings of runs.
+func texts(runs []textRun) []string {
+	s := make([]string, len(runs))
+	for i, run := range runs {
+		s[i] = run.text
+	}
+	return s
+}
+
+func TestInvoicePDFGolden(t *testing.T) {
+	for _, lines := range []int{1, 30, 300} {
+		t.Run(fmt.Sprintf("%d lines", lines), func(t *testing.T) {
+			var buf bytes.Buffer
+			if err := GenerateInvoicePDF(invoiceWithLines(lines), &buf); err != nil {
+				t.Fatal(err)
+			}
+
+			pages := pdfPages(t, buf.Bytes())
+			if len(pages) == 0 {
+				t.Fatal("no text found in the PDF")
+			}
+
+			var got strings.Builder
+			for i, page := range pages {
+				fmt.Fprintf(&got, "--- page %d ---\n%s\n", i+1, strings.Join(texts(page), "\n"))
+			}
+
+			path := filepath.Join("internal/invoices/testdata", fmt.Sprintf("invoice-%d-lines.txt", lines))
+			if *update {
+				if err := os.WriteFile(path, []byte(got.String()), 0o644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			want, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatalf("%v (run with -update to create it)", err)
+			}
+			if got.String() != string(want) {
+				t.Errorf("text differs from %s (run with -update to accept):\n%s", path, got.String())
+			}
+
+			// Every page repeats the items header and is numbered out
+			// of the total
+			for i, page := range pages {
+				text := strings.Join(texts(page), "\n")
+				for _, column := range []string{"Description", "Unit Price", "Qty", "Total"} {
+					if !containsLine(texts(page), column) {
+						t.Errorf("page %d is missing the %q column header", i+1, column)
+					}
+				}
+				if want := fmt.Sprintf("Page %d of %d", i+1, len(pages)); !strings.Contains(text, want) {
+					t.Errorf("page %d is missing %q", i+1, want)
+				}
+				if i < len(pages)-1 && !strings.Contains(text, "Items continued on next page…") {
+					t.Errorf("page %d doesn't say the items continue", i+1)
+				}
+			}
+
+			last := strings.Join(texts(pages[len(pages)-1]), "\n")
+			if !strings.Contains(last, fmt.Sprintf("Line %d: ", lines)) || !strings.Contains(last, "Amount Due:") {
+				t.Errorf("last page is missing the last line or the amount due:\n%s", last)
+			}
+		})
+	}
+}
+
+func containsLine(lines []string, s string) bool {
+	for _, line := range lines {
+		if line == s {
+			return true
+		}
+	}
+	return false
+}
+
+// longInvoice has names, bank details and descriptions longer than any
+// column, and every kind of totals row.
+func longInvoice() models.InvoiceData {
+	data := invoiceWithLines(0)
+	data.Business.Name = "Pistachio Plumbing, Heating and Bathroom Renovations of Greater Bristol Ltd"
+	data.Customer.Name = "The Right Honourable Lady Augusta Wilhelmina Fotheringay-Phipps-Montmorency"
+	data.Customer.Email = "augusta.wilhelmina.fotheringay-phipps-montmorency@a-very-long-domain.example.co.uk"
+	data.Payment.AccountName = "Pistachio Plumbing, Heating and Bathroom Renovations of Greater Bristol Ltd"
+	data.Payment.IBAN = "GB82WEST12345698765432"
+	data.Payment.BIC = "WESTGB2LXXX"
+
+	data.Items = []models.InvoiceItem{
+		{
+			Description: strings.Repeat("Remove the old cast iron radiators, flush the system and fit thermostatic valves. ", 6),
+			Quantity:    250, UnitPrice: 9999.99, TaxRate: 20,
+		},
+		{
+			Description: "Parts: " + strings.Repeat("TRV-15MM-ANGLED-CHROME-", 8),
+			Quantity:    1, UnitPrice: 18.75, TaxRate: 20,
+			Discount: models.Discount{Type: "percent", Value: 12.5},
+		},
+		{
+			Description: "Call-out\nLabour (evening rate)\nWaste disposal",
+			Quantity:    3.5, UnitPrice: 85, TaxRate: 20,
+		},
+	}
+	data.Discount = models.Discount{Type: "fixed", Value: 100}
+	data.Surcharges = []models.Surcharge{{Description: "Congestion charge", Amount: 15, TaxRate: 20}}
+	data.Totals = models.CalculateInvoiceTotals(data.Items, data.Discount, data.Surcharges, 500)
+
+	return data
+}
+
+// measurer returns the width in mm of text in the default font.
+func measurer(t *testing.T) func(style string, size float64, text string) float64 {
+	t.Helper()
+
+	files, err := fontFiles(defaultFont)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pdf := gofpdf.New("P", "mm", "A4", "")
+	for style, path := range files {
+		pdf.AddUTF8Font(defaultFont, style, path)
+	}
+	pdf.AddPage()
+
+	return func(style string, size float64, text string) float64 {
+		pdf.SetFont(defaultFont, style, size)
+		return pdf.GetStringWidth(text)
+	}
+}
+
+// TestLayoutFits renders long names and descriptions with every template
+// and language, and checks each string drawn stays within the margins,
+// its items table column and its side of the totals block, and that the
+// totals block is on one page. Statements are checked the same way in
+// every language.
+func TestLayoutFits(t *testing.T) {
+	const (
+		eps         = 0.01
+		cellMargin  = 1.0 // gofpdf's default for mm
+		totalsLabel = leftMargin + 120
+	)
+
+	width := measurer(t)
+
+	for _, name := range TemplateNames() {
+		for _, lang := range Languages() {
+			for _, labels := range []documentLabels{invoiceLabels, creditNoteLabels} {
+				t.Run(name+"/"+lang+"/"+labels.Title, func(t *testing.T) {
+					data := longInvoice()
+					loc := localeFor(lang)
+					tmpl := templates[name]
+
+					b := DefaultBranding()
+					b.Template = name
+
+					var buf bytes.Buffer
+					err := writeDocumentPDF(data, labels, &buf, pdfOptions{branding: b, language: lang, paymentQR: true})
+					if err != nil {
+						t.Fatal(err)
+					}
+
+					totals := map[string]bool{
+						loc.t("totals.total"):    true,
+						loc.t("totals.deposit"):  true,
+						loc.t(labels.TotalLabel): true,
+					}
+					for _, row := range totalsRows(data, loc) {
+						totals[row.Label] = true
+					}
+
+					totalsPage := -1
+					for p, page := range pdfPages(t, buf.Bytes()) {
+						inTable := false
+
+						for i, run := range page {
+							w := width(run.style, run.size, run.text)
+
+							if run.x < leftMargin-eps || run.x+w > pageWidth-rightMargin+eps {
+								t.Errorf("page %d: %q runs outside the margins (%.1f to %.1fmm)", p+1, run.text, run.x, run.x+w)
+							}
+
+							switch {
+							case run.text == loc.t("column.description"):
+								inTable = true
+							case run.text == loc.t("items_continued"):
+								inTable = false
+							case totals[run.text]:
+								inTable = false
+
+								if totalsPage >= 0 && totalsPage != p {
+									t.Errorf("totals block split between pages %d and %d", totalsPage+1, p+1)
+								}
+								totalsPage = p
+
+								if run.x+w > totalsLabel-cellMargin+eps {
+									t.Errorf("totals label %q runs into the amounts (ends at %.1fmm)", run.text, run.x+w)
+								}
+								if i+1 < len(page) && page[i+1].x < totalsLabel+cellMargin-eps {
+									t.Errorf("amount %q runs into the totals labels (starts at %.1fmm)", page[i+1].text, page[i+1].x)
+								}
+								if run.y > pageHeight-bottomMargin {
+									t.Errorf("totals label %q is in the page footer (at %.1fmm)", run.text, run.y)
+								}
+							}
+
+							if !inTable {
+								continue
+							}
+
+							left := leftMargin
+							for _, colWidth := range tmpl.Columns {
+								if run.x < left+colWidth {
+									if run.x+w > left+colWidth-cellMargin+eps {
+										t.Errorf("page %d: %q overflows its %.0fmm column (%.1f to %.1fmm)", p+1, run.text, colWidth, run.x, run.x+w)
+									}
+									break
+								}
+								left += colWidth
+							}
+						}
+					}
+
+					if totalsPage < 0 {
+						t.Error("no totals block found")
+					}
+				})
+			}
+		}
+	}
+
+	// Statements have a table of their own, the widths WriteStatementPDF
+	// draws; the balance brought forward spans the middle four columns.
+	statementColumns := []float64{25, 35, 47, 21, 21, 21}
+	forwardWidth := 35.0 + 47 + 21 + 21
+
+	for _, lang := range Languages() {
+		t.Run("statement/"+lang, func(t *testing.T) {
+			loc := localeFor(lang)
+
+			data := statementWithEntries("EUR")
+			data.Entries = append(data.Entries, models.StatementEntry{
+				Date: data.To, Type: "invoice", Reference: "INV-2026-0002", Description: "Deposit invoice",
+				Debit: 12345.67, Balance: 12495.67,
+			})
+			data.ClosingBalance = 12495.67
+
+			var buf bytes.Buffer
+			if err := WriteStatementPDF(data, &buf, WithLanguage(lang)); err != nil {
+				t.Fatal(err)
+			}
+
+			header, inTable := false, false
+			for p, page := range pdfPages(t, buf.Bytes()) {
+				for _, run := range page {
+					w := width(run.style, run.size, run.text)
+
+					if run.x < leftMargin-eps || run.x+w > pageWidth-rightMargin+eps {
+						t.Errorf("page %d: %q runs outside the margins (%.1f to %.1fmm)", p+1, run.text, run.x, run.x+w)
+					}
+
+					switch run.text {
+					case loc.t("statement.period"):
+						if run.x+w > leftMargin+35-cellMargin+eps {
+							t.Errorf("%q runs into the period (ends at %.1fmm)", run.text, run.x+w)
+						}
+					case loc.t("statement.date"):
+						header, inTable = true, true
+					case loc.t("statement.due"):
+						inTable = false
+					case loc.t("statement.forward"):
+						if run.x+w > leftMargin+statementColumns[0]+forwardWidth-cellMargin+eps {
+							t.Errorf("%q overflows its cell (ends at %.1fmm)", run.text, run.x+w)
+						}
+						continue
+					}
+
+					if !inTable {
+						continue
+					}
+
+					left := leftMargin
+					for _, colWidth := range statementColumns {
+						if run.x < left+colWidth {
+							if run.x+w > left+colWidth-cellMargin+eps {
+								t.Errorf("page %d: %q overflows its %.0fmm column (%.1f to %.1fmm)", p+1, run.text, colWidth, run.x, run.x+w)
+							}
+							break
+						}
+						left += colWidth
+					}
+				}
+			}
+
+			if !header || inTable {
+				t.Error("no translated table header and balance due found")
+			}
+		})
+	}
+}
+
+// TestTotalsKeptTogether adds lines one at a time, so the totals block
+// meets the bottom of the page at every offset, and checks it is never
+// split.
+func TestTotalsKeptTogether(t *testing.T) {
+	for _, deposit := range []float64{0, 10} {
+		for lines := 1; lines <= 45; lines++ {
+			data := invoiceWithLines(lines)
+			data.Totals = models.CalculateInvoiceTotals(data.Items, models.Discount{}, nil, deposit)
+
+			var buf bytes.Buffer
+			if err := GenerateInvoicePDF(data, &buf); err != nil {
+				t.Fatal(err)
+			}
+
+			pages := map[string]int{}
+			for p, page := range pdfPages(t, buf.Bytes()) {
+				for _, run := range page {
+					switch run.text {
+					case "Subtotal:", "Total:", "Less deposit paid:", "Amount Due:":
+						pages[run.text] = p
+						if run.y > pageHeight-bottomMargin {
+							t.Errorf("%d lines: %q is in the page footer (at %.1fmm)", lines, run.text, run.y)
+						}
+					}
+				}
+			}
+
+			if pages["Subtotal:"] != pages["Amount Due:"] || (deposit > 0 && pages["Total:"] != pages["Amount Due:"]) {
+				t.Errorf("%d lines, deposit %.2f: totals split across pages %v", lines, deposit, pages)
+			}
+		}
+	}
+}
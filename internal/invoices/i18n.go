@@ -0,0 +1,409 @@
+package invoices
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"time"
+)
+
+// DefaultLanguage is used for customers without a language preference
+// and for any message a catalogue is missing.
+const DefaultLanguage = "en"
+
+// locale is a language's wording, dates and number format for documents.
+type locale struct {
+	Name string
+
+	// DateLayout is a time layout. Months, if set, replaces the English
+	// month abbreviation it produces.
+	DateLayout string
+	Months     [12]string
+
+	Decimal     string
+	Thousands   string // empty: no grouping
+	SymbolAfter bool   // 12,50 £ rather than £12.50
+
+	Messages map[string]string
+}
+
+var locales = map[string]locale{
+	"en": {
+		Name:       "English",
+		DateLayout: "02 Jan 2006",
+		Decimal:    ".",
+		Messages: map[string]string{
+			"invoice.title":        "INVOICE",
+			"invoice.number":       "Invoice No:",
+			"invoice.due":          "Due Date:",
+			"invoice.total":        "Amount Due:",
+			"quote.title":          "QUOTE",
+			"quote.number":         "Quote No:",
+			"quote.due":            "Valid Until:",
+			"quote.total":          "Quote Total:",
+			"credit_note.title":    "CREDIT NOTE",
+			"credit_note.number":   "Credit Note No:",
+			"credit_note.invoice":  "Invoice No:",
+			"credit_note.total":    "Total Credit:",
+			"issue_date":           "Issue Date:",
+			"vat_number":           "VAT: %s",
+			"company_reg":          "Company Reg: %s",
+			"bill_to":              "Bill To:",
+			"payment_details":      "Payment Details",
+			"account_name":         "Account Name: %s",
+			"bank":                 "Bank: %s",
+			"sort_code":            "Sort Code: %s",
+			"account_number":       "Account Number: %s",
+			"iban":                 "IBAN: %s",
+			"bic":                  "BIC: %s",
+			"pay_online":           "Pay online: ",
+			"qr.epc":               "Scan with your banking app",
+			"qr.link":              "Scan to pay online",
+			"thank_you":            "Thank you for your business!",
+			"column.description":   "Description",
+			"column.unit_price":    "Unit Price",
+			"column.qty":           "Qty",
+			"column.total":         "Total",
+			"item.less":            "%s (less %s)",
+			"items_continued":      "Items continued on next page…",
+			"totals.subtotal":      "Subtotal:",
+			"totals.line_discount": "Line discounts:",
+			"totals.discount":      "Discount:",
+			"totals.discount_pct":  "Discount (%s%%):",
+			"totals.tax":           "Tax (%s%%):",
+			"totals.total":         "Total:",
+			"totals.deposit":       "Less deposit paid:",
+			"report.title":         "JOB REPORT",
+			"report.job":           "Job No:",
+			"report.customer":      "Customer:",
+			"report.before":        "Before",
+			"report.after":         "After",
+			"report.taken":         "Taken %s",
+			"report.missing":       "Photo not available",
+			"statement.title":      "STATEMENT OF ACCOUNT",
+			"statement.period":     "Period:",
+			"statement.date":       "Date",
+			"statement.reference":  "Reference",
+			"statement.details":    "Details",
+			"statement.debit":      "Debit",
+			"statement.credit":     "Credit",
+			"statement.balance":    "Balance",
+			"statement.forward":    "Balance brought forward",
+			"statement.due":        "Balance Due:",
+			"page":                 "Page %d of %s",
+		},
+	},
+	"cy": {
+		Name:       "Cymraeg",
+		DateLayout: "02 Jan 2006",
+		Months:     [12]string{"Ion", "Chwef", "Maw", "Ebr", "Mai", "Meh", "Gorff", "Awst", "Medi", "Hyd", "Tach", "Rhag"},
+		Decimal:    ".",
+		Messages: map[string]string{
+			"invoice.title":        "ANFONEB",
+			"invoice.number":       "Rhif Anfoneb:",
+			"invoice.due":          "Dyddiad Dyledus:",
+			"invoice.total":        "Swm Dyledus:",
+			"quote.title":          "DYFYNBRIS",
+			"quote.number":         "Rhif Dyfynbris:",
+			"quote.due":            "Dilys Tan:",
+			"quote.total":          "Cyfanswm y Dyfynbris:",
+			"credit_note.title":    "NODYN CREDYD",
+			"credit_note.number":   "Rhif Nodyn Credyd:",
+			"credit_note.invoice":  "Rhif Anfoneb:",
+			"credit_note.total":    "Cyfanswm Credyd:",
+			"issue_date":           "Dyddiad:",
+			"vat_number":           "TAW: %s",
+			"company_reg":          "Rhif Cwmni: %s",
+			"bill_to":              "Bil i:",
+			"payment_details":      "Manylion Talu",
+			"account_name":         "Enw'r Cyfrif: %s",
+			"bank":                 "Banc: %s",
+			"sort_code":            "Cod Didoli: %s",
+			"account_number":       "Rhif Cyfrif: %s",
+			"pay_online":           "Talu ar-lein: ",
+			"qr.epc":               "Sganiwch gyda'ch ap bancio",
+			"qr.link":              "Sganiwch i dalu ar-lein",
+			"thank_you":            "Diolch am eich busnes!",
+			"column.description":   "Disgrifiad",
+			"column.unit_price":    "Pris Uned",
+			"column.qty":           "Nifer",
+			"column.total":         "Cyfanswm",
+			"item.less":            "%s (llai %s)",
+			"items_continued":      "Eitemau'n parhau ar y dudalen nesaf…",
+			"totals.subtotal":      "Is-gyfanswm:",
+			"totals.line_discount": "Gostyngiadau llinell:",
+			"totals.discount":      "Gostyngiad:",
+			"totals.discount_pct":  "Gostyngiad (%s%%):",
+			"totals.tax":           "TAW (%s%%):",
+			"totals.total":         "Cyfanswm:",
+			"totals.deposit":       "Llai'r blaendal a dalwyd:",
+			"report.title":         "ADRODDIAD GWAITH",
+			"report.job":           "Rhif y Swydd:",
+			"report.customer":      "Cwsmer:",
+			"report.before":        "Cyn",
+			"report.after":         "Ar ôl",
+			"report.taken":         "Tynnwyd %s",
+			"report.missing":       "Dim llun ar gael",
+			"statement.title":      "DATGANIAD CYFRIF",
+			"statement.period":     "Cyfnod:",
+			"statement.date":       "Dyddiad",
+			"statement.reference":  "Cyfeirnod",
+			"statement.details":    "Manylion",
+			"statement.debit":      "Debyd",
+			"statement.credit":     "Credyd",
+			"statement.balance":    "Balans",
+			"statement.forward":    "Balans a ddygwyd ymlaen",
+			"statement.due":        "Balans Dyledus:",
+			"page":                 "Tudalen %d o %s",
+		},
+	},
+	"fr": {
+		Name:        "Français",
+		DateLayout:  "02/01/2006",
+		Decimal:     ",",
+		Thousands:   "\u00a0", // no-break space
+		SymbolAfter: true,
+		Messages: map[string]string{
+			"invoice.title":        "FACTURE",
+			"invoice.number":       "Facture n° :",
+			"invoice.due":          "Échéance :",
+			"invoice.total":        "Montant dû :",
+			"quote.title":          "DEVIS",
+			"quote.number":         "Devis n° :",
+			"quote.due":            "Valable jusqu'au :",
+			"quote.total":          "Total du devis :",
+			"credit_note.title":    "AVOIR",
+			"credit_note.number":   "Avoir n° :",
+			"credit_note.invoice":  "Facture n° :",
+			"credit_note.total":    "Total de l'avoir :",
+			"issue_date":           "Date :",
+			"vat_number":           "N° TVA : %s",
+			"company_reg":          "N° d'immatriculation : %s",
+			"bill_to":              "Facturer à :",
+			"payment_details":      "Modalités de paiement",
+			"account_name":         "Titulaire du compte : %s",
+			"bank":                 "Banque : %s",
+			"sort_code":            "Code guichet : %s",
+			"account_number":       "N° de compte : %s",
+			"iban":                 "IBAN : %s",
+			"bic":                  "BIC : %s",
+			"pay_online":           "Payer en ligne : ",
+			"qr.epc":               "Scannez avec votre appli bancaire",
+			"qr.link":              "Scannez pour payer en ligne",
+			"thank_you":            "Merci de votre confiance !",
+			"column.description":   "Désignation",
+			"column.unit_price":    "Prix unitaire",
+			"column.qty":           "Qté",
+			"column.total":         "Total",
+			"item.less":            "%s (remise %s)",
+			"items_continued":      "Suite des articles page suivante…",
+			"totals.subtotal":      "Sous-total :",
+			"totals.line_discount": "Remises sur lignes :",
+			"totals.discount":      "Remise :",
+			"totals.discount_pct":  "Remise (%s %%) :",
+			"totals.tax":           "TVA (%s %%) :",
+			"totals.total":         "Total :",
+			"totals.deposit":       "Acompte versé :",
+			"report.title":         "RAPPORT D'INTERVENTION",
+			"report.job":           "N° d'intervention :",
+			"report.customer":      "Client :",
+			"report.before":        "Avant",
+			"report.after":         "Après",
+			"report.taken":         "Prise le %s",
+			"report.missing":       "Photo non disponible",
+			"statement.title":      "RELEVÉ DE COMPTE",
+			"statement.period":     "Période :",
+			"statement.date":       "Date",
+			"statement.reference":  "Référence",
+			"statement.details":    "Détails",
+			"statement.debit":      "Débit",
+			"statement.credit":     "Crédit",
+			"statement.balance":    "Solde",
+			"statement.forward":    "Solde reporté",
+			"statement.due":        "Solde dû :",
+			"page":                 "Page %d sur %s",
+		},
+	},
+	"de": {
+		Name:        "Deutsch",
+		DateLayout:  "02.01.2006",
+		Decimal:     ",",
+		Thousands:   ".",
+		SymbolAfter: true,
+		Messages: map[string]string{
+			"invoice.title":        "RECHNUNG",
+			"invoice.number":       "Rechnungsnr.:",
+			"invoice.due":          "Fällig am:",
+			"invoice.total":        "Fälliger Betrag:",
+			"quote.title":          "ANGEBOT",
+			"quote.number":         "Angebotsnr.:",
+			"quote.due":            "Gültig bis:",
+			"quote.total":          "Angebotssumme:",
+			"credit_note.title":    "GUTSCHRIFT",
+			"credit_note.number":   "Gutschriftsnr.:",
+			"credit_note.invoice":  "Rechnungsnr.:",
+			"credit_note.total":    "Gutschriftsbetrag:",
+			"issue_date":           "Datum:",
+			"vat_number":           "USt-IdNr.: %s",
+			"company_reg":          "Handelsregister: %s",
+			"bill_to":              "Rechnung an:",
+			"payment_details":      "Zahlungsinformationen",
+			"account_name":         "Kontoinhaber: %s",
+			"bank":                 "Bank: %s",
+			"sort_code":            "Sort Code: %s",
+			"account_number":       "Kontonummer: %s",
+			"pay_online":           "Online bezahlen: ",
+			"qr.epc":               "Mit Ihrer Banking-App scannen",
+			"qr.link":              "Scannen und online bezahlen",
+			"thank_you":            "Vielen Dank für Ihren Auftrag!",
+			"column.description":   "Beschreibung",
+			"column.unit_price":    "Einzelpreis",
+			"column.qty":           "Menge",
+			"column.total":         "Gesamt",
+			"item.less":            "%s (abzüglich %s)",
+			"items_continued":      "Fortsetzung auf der nächsten Seite…",
+			"totals.subtotal":      "Zwischensumme:",
+			"totals.line_discount": "Positionsrabatte:",
+			"totals.discount":      "Rabatt:",
+			"totals.discount_pct":  "Rabatt (%s %%):",
+			"totals.tax":           "MwSt. (%s %%):",
+			"totals.total":         "Gesamt:",
+			"totals.deposit":       "Abzüglich Anzahlung:",
+			"report.title":         "ARBEITSBERICHT",
+			"report.job":           "Auftrags-Nr.:",
+			"report.customer":      "Kunde:",
+			"report.before":        "Vorher",
+			"report.after":         "Nachher",
+			"report.taken":         "Aufgenommen am %s",
+			"report.missing":       "Foto nicht verfügbar",
+			"statement.title":      "KONTOAUSZUG",
+			"statement.period":     "Zeitraum:",
+			"statement.date":       "Datum",
+			"statement.reference":  "Referenz",
+			"statement.details":    "Details",
+			"statement.debit":      "Soll",
+			"statement.credit":     "Haben",
+			"statement.balance":    "Saldo",
+			"statement.forward":    "Saldovortrag",
+			"statement.due":        "Offener Betrag:",
+			"page":                 "Seite %d von %s",
+		},
+	},
+}
+
+// Languages lists the supported document languages.
+func Languages() []string {
+	codes := make([]string, 0, len(locales))
+	for code := range locales {
+		codes = append(codes, code)
+	}
+	sort.Strings(codes)
+	return codes
+}
+
+// SupportedLanguage reports whether documents can be rendered in lang.
+func SupportedLanguage(lang string) bool {
+	_, ok := locales[lang]
+	return ok
+}
+
+// localeFor returns lang's locale, or English for unknown languages.
+func localeFor(lang string) locale {
+	if l, ok := locales[lang]; ok {
+		return l
+	}
+	return locales[DefaultLanguage]
+}
+
+// t looks up a message, falling back to English, and formats it with
+// args.
+func (l locale) t(key string, args ...any) string {
+	msg, ok := l.Messages[key]
+	if !ok {
+		msg, ok = locales[DefaultLanguage].Messages[key]
+	}
+	if !ok {
+		return key
+	}
+	if len(args) == 0 {
+		return msg
+	}
+	return fmt.Sprintf(msg, args...)
+}
+
+func (l locale) date(t time.Time) string {
+	s := t.Format(l.DateLayout)
+	if l.Months[0] != "" {
+		s = strings.Replace(s, t.Format("Jan"), l.Months[t.Month()-1], 1)
+	}
+	return s
+}
+
+// number formats v with the locale's separators. Trailing zeros after
+// the decimal point are dropped when trim is set, e.g. for tax rates.
+func (l locale) number(v float64, decimals int, trim bool) string {
+	s := fmt.Sprintf("%.*f", decimals, math.Abs(v))
+	whole, frac, _ := strings.Cut(s, ".")
+
+	if trim {
+		frac = strings.TrimRight(frac, "0")
+	}
+
+	if l.Thousands != "" {
+		var b strings.Builder
+		for i, c := range whole {
+			if i > 0 && (len(whole)-i)%3 == 0 {
+				b.WriteString(l.Thousands)
+			}
+			b.WriteRune(c)
+		}
+		whole = b.String()
+	}
+
+	if v < 0 && strings.Trim(s, "0.") != "" {
+		whole = "-" + whole
+	}
+	if frac == "" {
+		return whole
+	}
+	return whole + l.Decimal + frac
+}
+
+// currencySymbols are the symbols amounts are shown with. Other
+// currencies are shown with their ISO 4217 code.
+var currencySymbols = map[string]string{
+	"GBP": "£",
+	"EUR": "€",
+	"USD": "$",
+}
+
+// money puts the sign before the amount, e.g. -£12.50 or -12,50 €. An
+// empty currency is GBP.
+func (l locale) money(v float64, currency string) string {
+	amount := l.number(math.Abs(v), 2, false)
+
+	sign := ""
+	if v < 0 && amount != l.number(0, 2, false) {
+		sign = "-"
+	}
+
+	if currency == "" {
+		currency = "GBP"
+	}
+	symbol, ok := currencySymbols[currency]
+	if !ok {
+		symbol = currency + "\u00a0"
+	}
+
+	if l.SymbolAfter {
+		return sign + amount + "\u00a0" + strings.TrimSuffix(symbol, "\u00a0")
+	}
+	return sign + symbol + amount
+}
+
+// FormatMoney formats an amount in a currency (ISO 4217, empty for GBP)
+// the way English documents show it, e.g. -£12.50 or €1234.00.
+func FormatMoney(v float64, currency string) string {
+	return localeFor(DefaultLanguage).money(v, currency)
+}
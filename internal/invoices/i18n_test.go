@@ -0,0 +1,32 @@
+package invoices
+
+import "testing"
+
+func TestMoney(t *testing.T) {
+	tests := []struct {
+		lang     string
+		currency string
+		v        float64
+		want     string
+	}{
+		{"en", "", 12.5, "£12.50"},
+		{"en", "GBP", -12.5, "-£12.50"},
+		{"en", "EUR", 1234, "€1234.00"},
+		{"en", "USD", 0.1, "$0.10"},
+		{"en", "CHF", 5, "CHF\u00a05.00"},
+		{"en", "GBP", -0.001, "£0.00"},
+		{"fr", "EUR", -1234.5, "-1\u00a0234,50\u00a0€"},
+		{"de", "GBP", 1234.5, "1.234,50\u00a0£"},
+		{"de", "CHF", 5, "5,00\u00a0CHF"},
+	}
+
+	for _, tt := range tests {
+		if got := localeFor(tt.lang).money(tt.v, tt.currency); got != tt.want {
+			t.Errorf("%s money(%v, %q) = %q, want %q", tt.lang, tt.v, tt.currency, got, tt.want)
+		}
+	}
+
+	if got := FormatMoney(-12.5, "EUR"); got != "-€12.50" {
+		t.Errorf("FormatMoney(-12.5, EUR) = %q, want -€12.50", got)
+	}
+}
@@ -0,0 +1,104 @@
+package invoices
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+)
+
+// srgbProfile builds an ICC v2 sRGB display profile for the PDF/A
+// output intent. It is generated rather than bundled so no profile has to
+// be downloaded; the primaries are the D50-adapted sRGB values and the
+// tone curve is the sRGB curve sampled at 1024 points.
+func srgbProfile() []byte {
+	xyz := func(x, y, z float64) []byte {
+		b := []byte("XYZ \x00\x00\x00\x00")
+		for _, v := range []float64{x, y, z} {
+			b = binary.BigEndian.AppendUint32(b, uint32(int32(math.Round(v*65536))))
+		}
+		return b
+	}
+
+	text := func(s string) []byte {
+		return append([]byte("text\x00\x00\x00\x00"), append([]byte(s), 0)...)
+	}
+
+	desc := func(s string) []byte {
+		b := []byte("desc\x00\x00\x00\x00")
+		b = binary.BigEndian.AppendUint32(b, uint32(len(s)+1))
+		b = append(b, s...)
+		b = append(b, 0)
+		b = append(b, make([]byte, 4+4+2+1+67)...) // empty Unicode and ScriptCode descriptions
+		return b
+	}
+
+	curve := []byte("curv\x00\x00\x00\x00")
+	const points = 1024
+	curve = binary.BigEndian.AppendUint32(curve, points)
+	for i := 0; i < points; i++ {
+		v := float64(i) / (points - 1)
+		if v <= 0.04045 {
+			v /= 12.92
+		} else {
+			v = math.Pow((v+0.055)/1.055, 2.4)
+		}
+		curve = binary.BigEndian.AppendUint16(curve, uint16(math.Round(v*65535)))
+	}
+
+	tags := []struct {
+		sig  string
+		data []byte
+	}{
+		{"desc", desc("sRGB IEC61966-2.1")},
+		{"cprt", text("No copyright, use freely")},
+		{"wtpt", xyz(0.9642, 1.0, 0.8249)},
+		{"rXYZ", xyz(0.4361, 0.2225, 0.0139)},
+		{"gXYZ", xyz(0.3851, 0.7169, 0.0971)},
+		{"bXYZ", xyz(0.1431, 0.0606, 0.7141)},
+		{"rTRC", curve},
+		{"gTRC", curve},
+		{"bTRC", curve},
+	}
+
+	// Tag data follows the 128 byte header and the tag table, each tag
+	// aligned to four bytes. The three curves share one copy.
+	offset := 128 + 4 + 12*len(tags)
+	var table, data bytes.Buffer
+	binary.Write(&table, binary.BigEndian, uint32(len(tags)))
+
+	var curveOffset, curveSize int
+	for _, t := range tags {
+		at, size := offset+data.Len(), len(t.data)
+		if t.sig == "gTRC" || t.sig == "bTRC" {
+			at, size = curveOffset, curveSize
+		} else {
+			data.Write(t.data)
+			for data.Len()%4 != 0 {
+				data.WriteByte(0)
+			}
+		}
+		if t.sig == "rTRC" {
+			curveOffset, curveSize = at, size
+		}
+
+		table.WriteString(t.sig)
+		binary.Write(&table, binary.BigEndian, uint32(at))
+		binary.Write(&table, binary.BigEndian, uint32(size))
+	}
+
+	size := 128 + table.Len() + data.Len()
+	header := make([]byte, 128)
+	binary.BigEndian.PutUint32(header[0:], uint32(size))
+	binary.BigEndian.PutUint32(header[8:], 0x02100000) // version 2.1
+	copy(header[12:], "mntr")
+	copy(header[16:], "RGB ")
+	copy(header[20:], "XYZ ")
+	binary.BigEndian.PutUint16(header[24:], 2026) // creation date
+	binary.BigEndian.PutUint16(header[26:], 1)
+	binary.BigEndian.PutUint16(header[28:], 1)
+	copy(header[36:], "acsp")
+	copy(header[68:], xyz(0.9642, 1.0, 0.8249)[8:]) // D50 illuminant
+
+	out := append(header, table.Bytes()...)
+	return append(out, data.Bytes()...)
+}
@@ -0,0 +1,106 @@
+package invoices
+
+import (
+	"bytes"
+	"crypto/md5"
+	"fmt"
+	"image"
+	"image/draw"
+	"image/png"
+	"strings"
+
+	"pistachio/internal/models"
+
+	"github.com/boombuler/barcode"
+	"github.com/boombuler/barcode/qr"
+	"github.com/jung-kurt/gofpdf"
+)
+
+const (
+	qrSize       = 32.0 // mm, large enough to scan from a printed page
+	qrPixelsPer  = 8    // image pixels per QR module, so the code stays sharp
+	epcMaxAmount = 999999999.99
+)
+
+// paymentQR returns what the invoice's payment QR code encodes and the
+// catalogue key of the caption printed under it. EUR invoices with an
+// IBAN get an EPC (SEPA credit transfer) code that banking apps turn
+// into a payment; otherwise the payment link is encoded. Empty when
+// there is neither.
+func paymentQR(data models.InvoiceData, amount float64) (payload, caption string) {
+	p := data.Payment
+
+	if data.CurrencyCode() == "EUR" && p.IBAN != "" && amount > 0 && amount <= epcMaxAmount {
+		return epcPayload(data, amount), "qr.epc"
+	}
+
+	if p.PaymentLink != "" {
+		return p.PaymentLink, "qr.link"
+	}
+
+	return "", ""
+}
+
+// epcPayload is an EPC069-12 version 002 QR payload. The invoice number
+// is the remittance text, so the payment can be matched to the invoice.
+func epcPayload(data models.InvoiceData, amount float64) string {
+	p := data.Payment
+
+	name := p.AccountName
+	if name == "" {
+		name = data.Business.Name
+	}
+
+	lines := []string{
+		"BCD",
+		"002",
+		"1", // UTF-8
+		"SCT",
+		strings.ReplaceAll(p.BIC, " ", ""),
+		truncate(name, 70),
+		strings.ReplaceAll(p.IBAN, " ", ""),
+		fmt.Sprintf("EUR%.2f", amount),
+		"", // purpose
+		"", // structured reference
+		truncate(data.InvoiceNumber, 140),
+	}
+	return strings.Join(lines, "\n")
+}
+
+func truncate(s string, n int) string {
+	r := []rune(s)
+	if len(r) > n {
+		return string(r[:n])
+	}
+	return s
+}
+
+// drawQR draws a QR code as a size×size mm image at x, y. EPC codes
+// require error correction level M, which suits URLs too.
+func drawQR(pdf *gofpdf.Fpdf, payload string, x, y, size float64) error {
+	code, err := qr.Encode(payload, qr.M, qr.Unicode)
+	if err != nil {
+		return fmt.Errorf("failed to encode QR code: %w", err)
+	}
+
+	modules := code.Bounds().Dx()
+	code, err = barcode.Scale(code, modules*qrPixelsPer, modules*qrPixelsPer)
+	if err != nil {
+		return fmt.Errorf("failed to scale QR code: %w", err)
+	}
+
+	// 8-bit grey, as gofpdf can't read 16-bit PNGs
+	img := image.NewGray(code.Bounds())
+	draw.Draw(img, img.Bounds(), code, code.Bounds().Min, draw.Src)
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return fmt.Errorf("failed to encode QR image: %w", err)
+	}
+
+	name := fmt.Sprintf("qr-%x", md5.Sum([]byte(payload)))
+	pdf.RegisterImageOptionsReader(name, gofpdf.ImageOptions{ImageType: "PNG"}, &buf)
+	pdf.ImageOptions(name, x, y, size, size, false, gofpdf.ImageOptions{ImageType: "PNG"}, 0, "")
+
+	return pdf.Error()
+}
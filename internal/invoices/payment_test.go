@@ -0,0 +1,112 @@
+package invoices
+
+import (
+	"testing"
+
+	"pistachio/internal/models"
+
+	"github.com/jung-kurt/gofpdf"
+)
+
+func paymentData(currency, iban, link string) models.InvoiceData {
+	return models.InvoiceData{
+		InvoiceNumber: "INV-2026-0001",
+		Currency:      currency,
+		Business:      models.BusinessInfo{Name: "Pistachio Ltd"},
+		Payment: models.PaymentInfo{
+			AccountName: "Pistachio Ltd",
+			IBAN:        iban,
+			BIC:         "COBA DEFF XXX",
+			PaymentLink: link,
+		},
+	}
+}
+
+func TestPaymentQR(t *testing.T) {
+	const (
+		iban = "DE89 3704 0044 0532 0130 00"
+		link = "https://pay.example.com/pistachio?reference=INV-2026-0001"
+	)
+
+	tests := []struct {
+		name        string
+		data        models.InvoiceData
+		amount      float64
+		wantPayload string
+		wantCaption string
+	}{
+		{
+			name:   "EUR with IBAN",
+			data:   paymentData("EUR", iban, link),
+			amount: 1234.5,
+			wantPayload: "BCD\n002\n1\nSCT\nCOBADEFFXXX\nPistachio Ltd\nDE89370400440532013000\n" +
+				"EUR1234.50\n\n\nINV-2026-0001",
+			wantCaption: "qr.epc",
+		},
+		{
+			name:        "GBP with payment link",
+			data:        paymentData("GBP", iban, link),
+			amount:      120,
+			wantPayload: link,
+			wantCaption: "qr.link",
+		},
+		{
+			name:        "default currency with payment link",
+			data:        paymentData("", "", link),
+			amount:      120,
+			wantPayload: link,
+			wantCaption: "qr.link",
+		},
+		{
+			name:        "EUR without IBAN",
+			data:        paymentData("EUR", "", link),
+			amount:      120,
+			wantPayload: link,
+			wantCaption: "qr.link",
+		},
+		{
+			name:        "EUR with nothing due",
+			data:        paymentData("EUR", iban, link),
+			amount:      0,
+			wantPayload: link,
+			wantCaption: "qr.link",
+		},
+		{
+			name:   "nothing configured",
+			data:   paymentData("GBP", "", ""),
+			amount: 120,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			payload, caption := paymentQR(tt.data, tt.amount)
+			if payload != tt.wantPayload {
+				t.Errorf("got payload %q, want %q", payload, tt.wantPayload)
+			}
+			if caption != tt.wantCaption {
+				t.Errorf("got caption %q, want %q", caption, tt.wantCaption)
+			}
+
+			if payload == "" {
+				return
+			}
+			pdf := gofpdf.New("P", "mm", "A4", "")
+			pdf.AddPage()
+			if err := drawQR(pdf, payload, 10, 10, qrSize); err != nil {
+				t.Errorf("drawQR: %v", err)
+			}
+		})
+	}
+}
+
+func TestEPCPayloadFallsBackToBusinessName(t *testing.T) {
+	data := paymentData("EUR", "DE89370400440532013000", "")
+	data.Payment.AccountName = ""
+
+	payload, _ := paymentQR(data, 10)
+	want := "BCD\n002\n1\nSCT\nCOBADEFFXXX\nPistachio Ltd\nDE89370400440532013000\nEUR10.00\n\n\nINV-2026-0001"
+	if payload != want {
+		t.Errorf("got payload %q, want %q", payload, want)
+	}
+}
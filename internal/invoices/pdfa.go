@@ -0,0 +1,308 @@
+package invoices
+
+import (
+	"bytes"
+	"compress/zlib"
+	"crypto/md5"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"html"
+	"regexp"
+	"strconv"
+	"time"
+	"unicode/utf16"
+)
+
+// pdfaInfo is the document information written to both the PDF info
+// dictionary and its XMP metadata, which PDF/A requires to agree.
+type pdfaInfo struct {
+	Title    string
+	Author   string
+	Producer string
+	Created  time.Time
+}
+
+// pdfaAttachment is an XML file embedded as the document's associated
+// file, with the Factur-X XMP properties describing it.
+type pdfaAttachment struct {
+	FileName         string
+	Data             []byte
+	DocumentType     string
+	Version          string
+	ConformanceLevel string
+}
+
+var (
+	trailerSizeRe = regexp.MustCompile(`/Size (\d+)`)
+	trailerRootRe = regexp.MustCompile(`/Root (\d+) 0 R`)
+	trailerInfoRe = regexp.MustCompile(`/Info (\d+) 0 R`)
+	startXrefRe   = regexp.MustCompile(`startxref\s+(\d+)\s+%%EOF\s*$`)
+	pagesRe       = regexp.MustCompile(`/Pages \d+ 0 R`)
+)
+
+// toPDFA3 rewrites a PDF produced by gofpdf as PDF/A-3b with an embedded
+// associated file. gofpdf writes the info dictionary and catalog as its
+// last two objects; those are replaced, and the sRGB output intent, XMP
+// metadata and the attachment are appended before a fresh xref table.
+// Everything needed is generated here, so no network access is used.
+func toPDFA3(src []byte, info pdfaInfo, file pdfaAttachment) ([]byte, error) {
+	headerEnd := bytes.IndexByte(src, '\n') + 1
+	if headerEnd == 0 || !bytes.HasPrefix(src, []byte("%PDF-1.")) {
+		return nil, errors.New("pdfa: not a PDF")
+	}
+
+	m := startXrefRe.FindSubmatch(src)
+	if m == nil {
+		return nil, errors.New("pdfa: startxref not found")
+	}
+	xrefAt, _ := strconv.Atoi(string(m[1]))
+
+	trailer := src[bytes.LastIndex(src, []byte("trailer")):]
+	size, err := trailerRef(trailerSizeRe, trailer)
+	if err != nil {
+		return nil, err
+	}
+	root, err := trailerRef(trailerRootRe, trailer)
+	if err != nil {
+		return nil, err
+	}
+	infoNum, err := trailerRef(trailerInfoRe, trailer)
+	if err != nil {
+		return nil, err
+	}
+
+	offsets, err := xrefOffsets(src[xrefAt:], size)
+	if err != nil {
+		return nil, err
+	}
+
+	// Every object before the info dictionary is kept as it is
+	cut := offsets[infoNum]
+	for n := 1; n < size; n++ {
+		if n != infoNum && n != root && offsets[n] > cut {
+			return nil, errors.New("pdfa: info and catalog are not the last objects")
+		}
+	}
+
+	catalog, err := objectAt(src, offsets[root])
+	if err != nil {
+		return nil, err
+	}
+	pages := pagesRe.Find(catalog)
+	if pages == nil {
+		return nil, errors.New("pdfa: catalog has no page tree")
+	}
+
+	// PDF/A needs a comment of binary characters after the header, which
+	// moves every kept object along by the same amount
+	var out bytes.Buffer
+	out.WriteString("%PDF-1.7\n%\xe2\xe3\xcf\xd3\n")
+	shift := out.Len() - headerEnd
+
+	// PDF/A also needs annotations to be printable, which gofpdf's links
+	// aren't flagged as. Objects after each link move along further.
+	link := []byte("/Type /Annot /Subtype /Link ")
+	printable := []byte("/Type /Annot /Subtype /Link /F 4 ")
+
+	for n := range offsets {
+		if offsets[n] > 0 && offsets[n] < cut {
+			links := bytes.Count(src[headerEnd:offsets[n]], link)
+			offsets[n] += shift + links*(len(printable)-len(link))
+		}
+	}
+
+	out.Write(bytes.ReplaceAll(src[headerEnd:cut], link, printable))
+
+	object := func(n int, body string) {
+		for len(offsets) <= n {
+			offsets = append(offsets, 0)
+		}
+		offsets[n] = out.Len()
+		fmt.Fprintf(&out, "%d 0 obj\n%s\nendobj\n", n, body)
+	}
+
+	stream := func(n int, dict string, data []byte) {
+		for len(offsets) <= n {
+			offsets = append(offsets, 0)
+		}
+		offsets[n] = out.Len()
+		fmt.Fprintf(&out, "%d 0 obj\n<<%s /Length %d>>\nstream\n", n, dict, len(data))
+		out.Write(data)
+		out.WriteString("\nendstream\nendobj\n")
+	}
+
+	created := pdfDate(info.Created)
+	embedded, filespec, icc, intent, metadata := size, size+1, size+2, size+3, size+4
+
+	stream(embedded, fmt.Sprintf(
+		"/Type /EmbeddedFile /Subtype /text#2Fxml /Filter /FlateDecode /Params << /ModDate %s /Size %d /CheckSum <%x> >>",
+		created, len(file.Data), md5.Sum(file.Data),
+	), deflate(file.Data))
+
+	object(filespec, fmt.Sprintf(
+		"<< /Type /Filespec /F (%s) /UF %s /Desc %s /AFRelationship /Alternative /EF << /F %d 0 R /UF %d 0 R >> >>",
+		file.FileName, pdfString(file.FileName), pdfString("Factur-X invoice"), embedded, embedded,
+	))
+
+	stream(icc, "/N 3 /Filter /FlateDecode", deflate(srgbProfile()))
+
+	object(intent, fmt.Sprintf(
+		"<< /Type /OutputIntent /S /GTS_PDFA1 /OutputConditionIdentifier (sRGB IEC61966-2.1) /Info (sRGB IEC61966-2.1) /RegistryName (http://www.color.org) /DestOutputProfile %d 0 R >>",
+		icc,
+	))
+
+	// Metadata stays uncompressed so it can be read without a PDF parser
+	stream(metadata, "/Type /Metadata /Subtype /XML", []byte(xmpPacket(info, file)))
+
+	object(infoNum, fmt.Sprintf(
+		"<< /Title %s /Author %s /Producer %s /CreationDate %s /ModDate %s >>",
+		pdfString(info.Title), pdfString(info.Author), pdfString(info.Producer), created, created,
+	))
+
+	object(root, fmt.Sprintf(
+		"<< /Type /Catalog %s /Metadata %d 0 R /OutputIntents [%d 0 R] /AF [%d 0 R] /Names << /EmbeddedFiles << /Names [(%s) %d 0 R] >> >> >>",
+		pages, metadata, intent, filespec, file.FileName, filespec,
+	))
+
+	// --- Cross-reference table ---
+	xref := out.Len()
+	fmt.Fprintf(&out, "xref\n0 %d\n0000000000 65535 f \n", len(offsets))
+	for _, offset := range offsets[1:] {
+		fmt.Fprintf(&out, "%010d 00000 n \n", offset)
+	}
+
+	id := md5.Sum(out.Bytes())
+	fmt.Fprintf(&out, "trailer\n<< /Size %d /Root %d 0 R /Info %d 0 R /ID [<%x> <%x>] >>\nstartxref\n%d\n%%%%EOF\n",
+		len(offsets), root, infoNum, id, id, xref)
+
+	return out.Bytes(), nil
+}
+
+func trailerRef(re *regexp.Regexp, trailer []byte) (int, error) {
+	m := re.FindSubmatch(trailer)
+	if m == nil {
+		return 0, fmt.Errorf("pdfa: trailer has no %s", re.String())
+	}
+	return strconv.Atoi(string(m[1]))
+}
+
+// xrefOffsets reads the byte offset of every object from a single
+// section xref table; entry 0 is the free list head.
+func xrefOffsets(xref []byte, size int) ([]int, error) {
+	lines := bytes.Split(xref, []byte("\n"))
+	if len(lines) < size+2 || string(lines[0]) != "xref" {
+		return nil, errors.New("pdfa: unexpected xref table")
+	}
+
+	offsets := make([]int, size)
+	for n := 1; n < size; n++ {
+		line := lines[n+2]
+		if len(line) < 10 {
+			return nil, fmt.Errorf("pdfa: bad xref entry for object %d", n)
+		}
+		offset, err := strconv.Atoi(string(line[:10]))
+		if err != nil {
+			return nil, fmt.Errorf("pdfa: bad xref entry for object %d", n)
+		}
+		offsets[n] = offset
+	}
+	return offsets, nil
+}
+
+func objectAt(src []byte, offset int) ([]byte, error) {
+	end := bytes.Index(src[offset:], []byte("endobj"))
+	if end < 0 {
+		return nil, fmt.Errorf("pdfa: no object at %d", offset)
+	}
+	return src[offset : offset+end], nil
+}
+
+func deflate(data []byte) []byte {
+	var buf bytes.Buffer
+	w := zlib.NewWriter(&buf)
+	w.Write(data)
+	w.Close()
+	return buf.Bytes()
+}
+
+// pdfString encodes text as a UTF-16 hex string, which needs no
+// escaping and keeps non-Latin characters.
+func pdfString(s string) string {
+	units := utf16.Encode([]rune(s))
+	b := []byte{0xfe, 0xff}
+	for _, u := range units {
+		b = append(b, byte(u>>8), byte(u))
+	}
+	return "<" + hex.EncodeToString(b) + ">"
+}
+
+func pdfDate(t time.Time) string {
+	return "(D:" + t.UTC().Format("20060102150405") + "+00'00')"
+}
+
+// xmpPacket is the document's XMP metadata: the PDF/A-3b identification,
+// the properties mirrored from the info dictionary, and the Factur-X
+// properties with the extension schema that declares them.
+func xmpPacket(info pdfaInfo, file pdfaAttachment) string {
+	esc := html.EscapeString
+	created := info.Created.UTC().Format("2006-01-02T15:04:05+00:00")
+
+	return `<?xpacket begin="` + "\ufeff" + `" id="W5M0MpCehiHzreSzNTczkc9d"?>
+<x:xmpmeta xmlns:x="adobe:ns:meta/">
+<rdf:RDF xmlns:rdf="http://www.w3.org/1999/02/22-rdf-syntax-ns#">
+<rdf:Description rdf:about="" xmlns:pdfaid="http://www.aiim.org/pdfa/ns/id/">
+  <pdfaid:part>3</pdfaid:part>
+  <pdfaid:conformance>B</pdfaid:conformance>
+</rdf:Description>
+<rdf:Description rdf:about="" xmlns:dc="http://purl.org/dc/elements/1.1/">
+  <dc:format>application/pdf</dc:format>
+  <dc:title><rdf:Alt><rdf:li xml:lang="x-default">` + esc(info.Title) + `</rdf:li></rdf:Alt></dc:title>
+  <dc:creator><rdf:Seq><rdf:li>` + esc(info.Author) + `</rdf:li></rdf:Seq></dc:creator>
+</rdf:Description>
+<rdf:Description rdf:about="" xmlns:pdf="http://ns.adobe.com/pdf/1.3/">
+  <pdf:Producer>` + esc(info.Producer) + `</pdf:Producer>
+</rdf:Description>
+<rdf:Description rdf:about="" xmlns:xmp="http://ns.adobe.com/xap/1.0/">
+  <xmp:CreateDate>` + created + `</xmp:CreateDate>
+  <xmp:ModifyDate>` + created + `</xmp:ModifyDate>
+</rdf:Description>
+<rdf:Description rdf:about="" xmlns:pdfaExtension="http://www.aiim.org/pdfa/ns/extension/" xmlns:pdfaSchema="http://www.aiim.org/pdfa/ns/schema#" xmlns:pdfaProperty="http://www.aiim.org/pdfa/ns/property#">
+  <pdfaExtension:schemas>
+    <rdf:Bag>
+      <rdf:li rdf:parseType="Resource">
+        <pdfaSchema:schema>Factur-X PDFA Extension Schema</pdfaSchema:schema>
+        <pdfaSchema:namespaceURI>urn:factur-x:pdfa:CrossIndustryDocument:invoice:1p0#</pdfaSchema:namespaceURI>
+        <pdfaSchema:prefix>fx</pdfaSchema:prefix>
+        <pdfaSchema:property>
+          <rdf:Seq>` +
+		xmpProperty("DocumentFileName", "name of the embedded XML invoice file") +
+		xmpProperty("DocumentType", "type of the hybrid document") +
+		xmpProperty("Version", "version of the Factur-X XML schema") +
+		xmpProperty("ConformanceLevel", "Factur-X profile of the embedded XML") + `
+          </rdf:Seq>
+        </pdfaSchema:property>
+      </rdf:li>
+    </rdf:Bag>
+  </pdfaExtension:schemas>
+</rdf:Description>
+<rdf:Description rdf:about="" xmlns:fx="urn:factur-x:pdfa:CrossIndustryDocument:invoice:1p0#">
+  <fx:DocumentType>` + esc(file.DocumentType) + `</fx:DocumentType>
+  <fx:DocumentFileName>` + esc(file.FileName) + `</fx:DocumentFileName>
+  <fx:Version>` + esc(file.Version) + `</fx:Version>
+  <fx:ConformanceLevel>` + esc(file.ConformanceLevel) + `</fx:ConformanceLevel>
+</rdf:Description>
+</rdf:RDF>
+</x:xmpmeta>
+<?xpacket end="w"?>`
+}
+
+func xmpProperty(name, description string) string {
+	return `
+            <rdf:li rdf:parseType="Resource">
+              <pdfaProperty:name>` + name + `</pdfaProperty:name>
+              <pdfaProperty:valueType>Text</pdfaProperty:valueType>
+              <pdfaProperty:category>external</pdfaProperty:category>
+              <pdfaProperty:description>` + description + `</pdfaProperty:description>
+            </rdf:li>`
+}
@@ -0,0 +1,255 @@
+package invoices
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+
+	"pistachio/internal/einvoice"
+)
+
+var (
+	startXref    = regexp.MustCompile(`startxref\n(\d+)\n%%EOF\n$`)
+	xrefHeader   = regexp.MustCompile(`^xref\n0 (\d+)\n`)
+	xrefEntry    = regexp.MustCompile(`^(\d{10}) (\d{5}) ([nf]) \n$`)
+	streamLength = regexp.MustCompile(`/Length (\d+)`)
+)
+
+// pdfFile is a PDF read through its cross-reference table.
+type pdfFile struct {
+	objects map[int][]byte // object number to the object's body
+	trailer []byte
+}
+
+// readPDF reads the xref table a PDF's startxref points at, and checks
+// every entry is the offset of the object it numbers.
+func readPDF(t *testing.T, pdf []byte) pdfFile {
+	t.Helper()
+
+	m := startXref.FindSubmatch(pdf)
+	if m == nil {
+		t.Fatal("no startxref at the end of the file")
+	}
+	xrefAt, _ := strconv.Atoi(string(m[1]))
+	if xrefAt >= len(pdf) {
+		t.Fatalf("startxref %d is past the end of the file", xrefAt)
+	}
+
+	rest := pdf[xrefAt:]
+	h := xrefHeader.FindSubmatch(rest)
+	if h == nil {
+		t.Fatalf("startxref %d doesn't point at an xref table", xrefAt)
+	}
+	size, _ := strconv.Atoi(string(h[1]))
+	rest = rest[len(h[0]):]
+
+	f := pdfFile{objects: map[int][]byte{}}
+	for n := 0; n < size; n++ {
+		if len(rest) < 20 {
+			t.Fatalf("xref table ends at entry %d of %d", n, size)
+		}
+		e := xrefEntry.FindSubmatch(rest[:20])
+		if e == nil {
+			t.Fatalf("xref entry %d is malformed: %q", n, rest[:20])
+		}
+		rest = rest[20:]
+
+		if n == 0 {
+			if string(e[3]) != "f" {
+				t.Error("xref entry 0 isn't the free list head")
+			}
+			continue
+		}
+
+		offset, _ := strconv.Atoi(string(e[1]))
+		header := fmt.Sprintf("%d 0 obj\n", n)
+		if offset >= len(pdf) || !bytes.HasPrefix(pdf[offset:], []byte(header)) {
+			t.Fatalf("xref offset %d for object %d doesn't point at it", offset, n)
+		}
+		body := pdf[offset+len(header):]
+		end := bytes.Index(body, []byte("\nendobj\n"))
+		if end < 0 {
+			t.Fatalf("object %d has no endobj", n)
+		}
+		f.objects[n] = body[:end]
+	}
+
+	if !bytes.HasPrefix(rest, []byte("trailer\n")) {
+		t.Fatal("no trailer after the xref table")
+	}
+	f.trailer = rest
+	if !bytes.Contains(f.trailer, []byte(fmt.Sprintf("/Size %d ", size))) {
+		t.Errorf("trailer /Size doesn't match the %d xref entries", size)
+	}
+
+	return f
+}
+
+// ref returns the object a dictionary's key refers to, e.g. "/Root" or
+// "/AF [".
+func (f pdfFile) ref(t *testing.T, dict []byte, key string) []byte {
+	t.Helper()
+
+	m := regexp.MustCompile(regexp.QuoteMeta(key) + ` ?(\d+) 0 R`).FindSubmatch(dict)
+	if m == nil {
+		t.Fatalf("no %s reference in %q", key, dict)
+	}
+	n, _ := strconv.Atoi(string(m[1]))
+	obj, ok := f.objects[n]
+	if !ok {
+		t.Fatalf("%s refers to object %d, which isn't in the xref table", key, n)
+	}
+	return obj
+}
+
+// stream returns a stream object's data, inflated if it's compressed,
+// and checks its /Length.
+func stream(t *testing.T, obj []byte) []byte {
+	t.Helper()
+
+	dict, data, ok := bytes.Cut(obj, []byte(">>\nstream\n"))
+	if !ok {
+		t.Fatalf("not a stream: %q", obj)
+	}
+	data, ok = bytes.CutSuffix(data, []byte("\nendstream"))
+	if !ok {
+		t.Fatal("stream has no endstream")
+	}
+
+	m := streamLength.FindSubmatch(dict)
+	if m == nil {
+		t.Fatal("stream has no /Length")
+	}
+	if n, _ := strconv.Atoi(string(m[1])); n != len(data) {
+		t.Fatalf("stream /Length doesn't match its %d bytes", len(data))
+	}
+
+	if !bytes.Contains(dict, []byte("/FlateDecode")) {
+		return data
+	}
+	zr, err := zlib.NewReader(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, err := io.ReadAll(zr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return out
+}
+
+// xmpValue returns the text of the first XMP element with the given
+// namespace and name.
+func xmpValue(t *testing.T, xmp []byte, space, local string) string {
+	t.Helper()
+
+	d := xml.NewDecoder(bytes.NewReader(xmp))
+	for {
+		tok, err := d.Token()
+		if err == io.EOF {
+			return ""
+		}
+		if err != nil {
+			t.Fatalf("XMP isn't well-formed: %v", err)
+		}
+		if el, ok := tok.(xml.StartElement); ok && el.Name.Space == space && el.Name.Local == local {
+			var s string
+			if err := d.DecodeElement(&s, &el); err != nil {
+				t.Fatal(err)
+			}
+			return s
+		}
+	}
+}
+
+func TestFacturXStructure(t *testing.T) {
+	data := invoiceWithLines(3)
+	// A link annotation moves the objects after it along
+	data.Payment.PaymentLink = "https://pay.example.com/INV-2026-0003"
+
+	var buf bytes.Buffer
+	if err := GenerateInvoicePDF(data, &buf, WithFacturX()); err != nil {
+		t.Fatal(err)
+	}
+	pdf := buf.Bytes()
+
+	if !bytes.HasPrefix(pdf, []byte("%PDF-1.7\n%")) || pdf[10] < 128 {
+		t.Error("header isn't %PDF-1.7 followed by a binary comment")
+	}
+
+	f := readPDF(t, pdf)
+	catalog := f.ref(t, f.trailer, "/Root")
+	if !bytes.Contains(catalog, []byte("/Type /Catalog")) {
+		t.Fatalf("trailer /Root isn't the catalog: %q", catalog)
+	}
+	if pages := f.ref(t, catalog, "/Pages"); !bytes.Contains(pages, []byte("/Type /Pages")) {
+		t.Errorf("catalog /Pages isn't the page tree: %q", pages)
+	}
+
+	for _, annot := range f.objects {
+		if bytes.Contains(annot, []byte("/Subtype /Link")) && !bytes.Contains(annot, []byte("/F 4 ")) {
+			t.Errorf("link annotation isn't printable: %q", annot)
+		}
+	}
+
+	// Output intent with an embedded sRGB profile
+	intent := f.ref(t, catalog, "/OutputIntents [")
+	if !bytes.Contains(intent, []byte("/S /GTS_PDFA1")) {
+		t.Errorf("output intent isn't GTS_PDFA1: %q", intent)
+	}
+	if icc := stream(t, f.ref(t, intent, "/DestOutputProfile")); len(icc) < 128 || string(icc[36:40]) != "acsp" {
+		t.Error("output intent's profile isn't an ICC profile")
+	}
+
+	// The attachment, reachable as both the associated file and the
+	// catalog's only embedded file
+	filespec := f.ref(t, catalog, "/AF [")
+	named := f.ref(t, catalog, "/EmbeddedFiles << /Names [("+einvoice.FacturXFileName+")")
+	if !bytes.Equal(filespec, named) {
+		t.Error("/AF and /EmbeddedFiles name different files")
+	}
+	if !bytes.Contains(filespec, []byte("/AFRelationship /Alternative")) {
+		t.Errorf("attachment isn't an /Alternative: %q", filespec)
+	}
+
+	want, err := einvoice.FacturX(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	embedded := f.ref(t, filespec, "/EF << /F")
+	if got := stream(t, embedded); !bytes.Equal(got, want) {
+		t.Errorf("embedded %s differs from the CII XML\n%s", einvoice.FacturXFileName, got)
+	}
+	if !bytes.Contains(embedded, []byte(fmt.Sprintf("/Size %d ", len(want)))) {
+		t.Error("embedded file's /Size doesn't match the CII XML")
+	}
+
+	// XMP metadata
+	xmp := stream(t, f.ref(t, catalog, "/Metadata"))
+	checks := []struct {
+		space, local, want string
+	}{
+		{"http://www.aiim.org/pdfa/ns/id/", "part", "3"},
+		{"http://www.aiim.org/pdfa/ns/id/", "conformance", "B"},
+		{"urn:factur-x:pdfa:CrossIndustryDocument:invoice:1p0#", "DocumentFileName", einvoice.FacturXFileName},
+		{"urn:factur-x:pdfa:CrossIndustryDocument:invoice:1p0#", "ConformanceLevel", einvoice.FacturXLevel},
+	}
+	for _, c := range checks {
+		if got := xmpValue(t, xmp, c.space, c.local); got != c.want {
+			t.Errorf("XMP %s = %q, want %q", c.local, got, c.want)
+		}
+	}
+
+	if info := f.ref(t, f.trailer, "/Info"); !bytes.Contains(info, []byte("/Producer "+pdfString("Pistachio"))) {
+		t.Errorf("info dictionary doesn't match the XMP: %q", info)
+	}
+	if !strings.Contains(string(xmp), "<pdf:Producer>Pistachio</pdf:Producer>") {
+		t.Error("XMP has no producer")
+	}
+}
@@ -0,0 +1,170 @@
+package invoices
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+
+	"pistachio/internal/models"
+
+	"github.com/jung-kurt/gofpdf"
+)
+
+const (
+	reportColumnGap   = 10.0
+	reportImageHeight = 75.0
+	reportCaptionSize = 9.0
+	reportCaptionLH   = 4.5
+	reportMaxCaption  = 3 // lines
+)
+
+var reportLabels = documentLabels{
+	Title:       "report.title",
+	NumberLabel: "report.job",
+}
+
+// GenerateJobReportPDF renders a job report to w: the job and its before
+// and after photos, a pair to a row. Reports use the business's branding
+// and the customer's language; the other options don't apply.
+func GenerateJobReportPDF(data models.JobReportData, w io.Writer, opts ...Option) error {
+	o := buildOptions(opts)
+
+	r := newRenderer(models.InvoiceData{
+		Business:      data.Business,
+		Customer:      data.Customer,
+		InvoiceNumber: data.Reference,
+		IssueDate:     data.Date,
+	}, reportLabels, o)
+
+	r.header()
+	r.title()
+	r.reportJob(data)
+
+	for i, pair := range data.Pairs {
+		r.reportPair(i, pair)
+	}
+
+	return r.pdf.Output(w)
+}
+
+func (r *renderer) reportJob(data models.JobReportData) {
+	pdf := r.pdf
+	lh := r.t.LineHeight
+
+	r.font("B", r.t.HeadingSize)
+	pdf.MultiCell(0, lh+2, data.JobTitle, "", "", false)
+	pdf.Ln(1)
+
+	r.font("", r.t.BaseSize)
+	if data.JobDescription != "" {
+		pdf.MultiCell(0, lh, data.JobDescription, "", "", false)
+		pdf.Ln(2)
+	}
+
+	customer := r.loc.t("report.customer") + " " + data.Customer.Name
+	if data.Customer.CustomerAddress.Line1 != "" {
+		customer += ", " + data.Customer.CustomerAddress.Line1
+	}
+	pdf.MultiCell(0, lh, customer, "", "", false)
+	pdf.Ln(lh * 1.5)
+}
+
+// reportPair draws a before photo and its after photo side by side,
+// starting a new page if the row doesn't fit.
+func (r *renderer) reportPair(i int, pair models.ReportPhotoPair) {
+	pdf := r.pdf
+	colWidth := (contentWidth - reportColumnGap) / 2
+
+	r.font("", reportCaptionSize)
+	before := r.reportCaption(pair.Before, colWidth)
+	after := r.reportCaption(pair.After, colWidth)
+
+	labelHeight := r.t.LineHeight + 2
+	rowHeight := labelHeight + reportImageHeight + 2 + float64(max(len(before), len(after)))*reportCaptionLH + 8
+
+	if pdf.GetY()+rowHeight > tableBottom {
+		pdf.AddPage()
+	}
+
+	top := pdf.GetY()
+	for col, side := range []struct {
+		label   string
+		photo   models.ReportPhoto
+		caption []string
+	}{
+		{"report.before", pair.Before, before},
+		{"report.after", pair.After, after},
+	} {
+		x := leftMargin + float64(col)*(colWidth+reportColumnGap)
+
+		pdf.SetXY(x, top)
+		r.font("B", r.t.HeadingSize)
+		r.textColor(r.primary)
+		pdf.Cell(colWidth, labelHeight, r.loc.t(side.label))
+		pdf.SetTextColor(0, 0, 0)
+
+		r.reportImage(fmt.Sprintf("pair-%d-%d", i, col), side.photo.Image, x, top+labelHeight, colWidth, reportImageHeight)
+
+		r.font("", reportCaptionSize)
+		pdf.SetXY(x, top+labelHeight+reportImageHeight+2)
+		for _, line := range side.caption {
+			pdf.SetX(x)
+			pdf.CellFormat(colWidth, reportCaptionLH, line, "", 2, "", false, 0, "")
+		}
+	}
+
+	pdf.SetXY(leftMargin, top+rowHeight)
+}
+
+// reportCaption is a photo's caption, cut to reportMaxCaption lines, and
+// when it was taken.
+func (r *renderer) reportCaption(p models.ReportPhoto, width float64) []string {
+	room := width - 2*r.pdf.GetCellMargin()
+
+	var lines []string
+	if p.Caption != "" {
+		lines = wrapText(r.pdf, p.Caption, room)
+		if len(lines) > reportMaxCaption {
+			// Shorten the last line kept until the ellipsis fits after it
+			last := []rune(lines[reportMaxCaption-1])
+			for len(last) > 0 && r.pdf.GetStringWidth(string(last)+"…") > room {
+				last = last[:len(last)-1]
+			}
+			lines = append(lines[:reportMaxCaption-1], strings.TrimRight(string(last), " ")+"…")
+		}
+	}
+	if p.TakenAt != nil {
+		lines = append(lines, r.loc.t("report.taken", r.loc.date(*p.TakenAt)))
+	}
+	return lines
+}
+
+// reportImage fits a JPEG into the box, centred, or draws a grey box
+// saying the photo isn't available.
+func (r *renderer) reportImage(name string, image []byte, x, y, w, h float64) {
+	pdf := r.pdf
+
+	if len(image) > 0 {
+		opt := gofpdf.ImageOptions{ImageType: "JPG"}
+		info := pdf.RegisterImageOptionsReader(name, opt, bytes.NewReader(image))
+		if info != nil && pdf.Ok() {
+			iw, ih := w, w*info.Height()/info.Width()
+			if ih > h {
+				iw, ih = h*info.Width()/info.Height(), h
+			}
+			pdf.ImageOptions(name, x+(w-iw)/2, y+(h-ih)/2, iw, ih, false, opt, 0, "")
+			return
+		}
+		// A photo we can't read shouldn't lose the whole report
+		pdf.ClearError()
+	}
+
+	pdf.SetFillColor(235, 235, 235)
+	pdf.Rect(x, y, w, h, "F")
+	pdf.SetXY(x, y+h/2-3)
+	r.font("", reportCaptionSize)
+	pdf.SetTextColor(120, 120, 120)
+	pdf.CellFormat(w, 6, r.loc.t("report.missing"), "", 0, "C", false, 0, "")
+	pdf.SetTextColor(0, 0, 0)
+}
@@ -0,0 +1,134 @@
+package invoices
+
+import (
+	"bytes"
+	"image"
+	"image/jpeg"
+	"strings"
+	"testing"
+	"time"
+
+	"pistachio/internal/models"
+)
+
+func reportJPEG(t *testing.T, w, h int) []byte {
+	t.Helper()
+
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, image.NewRGBA(image.Rect(0, 0, w, h)), nil); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// jobReport has five pairs: the first with portrait and landscape
+// photos, the second with one missing and one that won't decode, and the
+// rest with captions longer than reportMaxCaption lines.
+func jobReport(t *testing.T) models.JobReportData {
+	taken := time.Date(2026, 10, 12, 14, 5, 0, 0, time.UTC)
+	long := strings.Repeat("Corroded compression fitting under the kitchen sink, replaced with a new isolating valve. ", 4)
+
+	data := models.JobReportData{
+		Business:       longInvoice().Business,
+		Customer:       longInvoice().Customer,
+		Reference:      "1A2B3C4D",
+		JobTitle:       "Replace kitchen sink isolating valves and reseal the worktop",
+		JobDescription: "Leak reported under the sink.",
+		Date:           time.Date(2026, 10, 19, 9, 0, 0, 0, time.UTC),
+		Pairs: []models.ReportPhotoPair{
+			{
+				Before: models.ReportPhoto{Image: reportJPEG(t, 60, 80), Caption: "Leaking valve"},
+				After:  models.ReportPhoto{Image: reportJPEG(t, 80, 60), Caption: "New valve", TakenAt: &taken},
+			},
+			{
+				Before: models.ReportPhoto{Caption: "Missing"},
+				After:  models.ReportPhoto{Image: []byte("not a JPEG"), Caption: "Broken"},
+			},
+		},
+	}
+	for i := 0; i < 3; i++ {
+		data.Pairs = append(data.Pairs, models.ReportPhotoPair{
+			Before: models.ReportPhoto{Caption: long, TakenAt: &taken},
+			After:  models.ReportPhoto{Caption: long},
+		})
+	}
+	return data
+}
+
+// TestJobReport renders a report in every language and checks each pair
+// is drawn whole on one page, with text inside its column.
+func TestJobReport(t *testing.T) {
+	const eps = 0.01
+
+	width := measurer(t)
+	colWidth := (contentWidth - reportColumnGap) / 2
+	afterX := leftMargin + colWidth + reportColumnGap
+
+	for _, lang := range Languages() {
+		t.Run(lang, func(t *testing.T) {
+			data := jobReport(t)
+			loc := localeFor(lang)
+
+			var buf bytes.Buffer
+			if err := GenerateJobReportPDF(data, &buf, WithLanguage(lang)); err != nil {
+				t.Fatal(err)
+			}
+
+			// Only the two photos that decode are embedded
+			if got := bytes.Count(buf.Bytes(), []byte("/Subtype /Image")); got != 2 {
+				t.Errorf("got %d images, want 2", got)
+			}
+
+			pages := pdfPages(t, buf.Bytes())
+			if len(pages) < 2 {
+				t.Errorf("got %d pages, want the pairs to run onto a second", len(pages))
+			}
+
+			counts := map[string]int{}
+			cut := 0
+			for p, page := range pages {
+				inPairs := false
+				for _, run := range page {
+					if run.y > pageHeight-bottomMargin {
+						continue // the page footer
+					}
+
+					w := width(run.style, run.size, run.text)
+					counts[run.text]++
+
+					if run.x < leftMargin-eps || run.x+w > pageWidth-rightMargin+eps {
+						t.Errorf("page %d: %q runs outside the margins (%.1f to %.1fmm)", p+1, run.text, run.x, run.x+w)
+					}
+					if run.y > tableBottom {
+						t.Errorf("page %d: %q runs into the page footer (at %.1fmm)", p+1, run.text, run.y)
+					}
+
+					if run.text == loc.t("report.before") {
+						inPairs = true
+					}
+					if inPairs && run.x < afterX-eps && run.x+w > leftMargin+colWidth+eps {
+						t.Errorf("page %d: %q runs into the after column", p+1, run.text)
+					}
+					if strings.HasSuffix(run.text, "…") {
+						cut++
+					}
+				}
+			}
+
+			for _, key := range []string{"report.before", "report.after"} {
+				if got := counts[loc.t(key)]; got != len(data.Pairs) {
+					t.Errorf("%q drawn %d times, want %d", loc.t(key), got, len(data.Pairs))
+				}
+			}
+			if got := counts[loc.t("report.missing")]; got != 8 {
+				t.Errorf("%q drawn %d times, want 8", loc.t("report.missing"), got)
+			}
+			if cut != 6 {
+				t.Errorf("got %d captions cut short, want 6", cut)
+			}
+			if taken := loc.t("report.taken", loc.date(*data.Pairs[0].After.TakenAt)); counts[taken] != 4 {
+				t.Errorf("%q drawn %d times, want 4", taken, counts[taken])
+			}
+		})
+	}
+}
@@ -0,0 +1,137 @@
+package invoices
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"pistachio/internal/models"
+
+	"github.com/jung-kurt/gofpdf"
+)
+
+func drawStatementHeader(pdf *gofpdf.Fpdf, loc locale, colDate, colRef, colDesc, colAmount float64) {
+	pdf.SetFillColor(230, 230, 230)
+
+	statementCell(pdf, "B", colDate, 7, loc.t("statement.date"), "", true)
+	statementCell(pdf, "B", colRef, 7, loc.t("statement.reference"), "", true)
+	statementCell(pdf, "B", colDesc, 7, loc.t("statement.details"), "", true)
+	statementCell(pdf, "B", colAmount, 7, loc.t("statement.debit"), "R", true)
+	statementCell(pdf, "B", colAmount, 7, loc.t("statement.credit"), "R", true)
+	statementCell(pdf, "B", colAmount, 7, loc.t("statement.balance"), "R", true)
+	pdf.Ln(7)
+}
+
+// statementCell draws a bordered table cell, shrinking the font as
+// fitFont does so long details and large amounts stay in their column.
+func statementCell(pdf *gofpdf.Fpdf, style string, w, h float64, text, align string, fill bool) {
+	pdf.SetFont("Roboto", style, 10)
+	room := w - 2*pdf.GetCellMargin()
+
+	for s := 10.0; pdf.GetStringWidth(text) > room && s > 10*minFontScale; {
+		s = max(s-0.5, 10*minFontScale)
+		pdf.SetFont("Roboto", style, s)
+	}
+
+	pdf.CellFormat(w, h, text, "1", 0, align, fill, 0, "")
+}
+
+// amountOrBlank leaves zero debits and credits empty, as on a bank
+// statement.
+func amountOrBlank(loc locale, v float64, currency string) string {
+	if v == 0 {
+		return ""
+	}
+	return loc.money(v, currency)
+}
+
+// WriteStatementPDF renders a customer statement to w. Statements are
+// produced on request rather than stored, so nothing is written to disk.
+// They are in the customer's language; the other options don't apply.
+func WriteStatementPDF(data models.StatementData, w io.Writer, opts ...Option) error {
+	loc := localeFor(buildOptions(opts).language)
+	pdf := newDocument(DefaultBranding(), loc)
+
+	pageHeight := 297.0
+	bottomMargin := 20.0
+	footerHeight := 15.0
+	usableBottomY := pageHeight - bottomMargin - footerHeight
+
+	// ============================
+	// HEADER SECTION
+	// ============================
+	if data.Business.LogoPath != "" {
+		if _, err := os.Stat(data.Business.LogoPath); err == nil {
+			pdf.Image(data.Business.LogoPath, 160, 20, 30, 0, false, "", 0, "")
+		}
+	}
+
+	pdf.SetXY(20, 20)
+	pdf.SetFont("Roboto", "B", 20)
+	pdf.Cell(0, 10, data.Business.Name)
+	pdf.Ln(10)
+
+	pdf.SetFont("Roboto", "", 12)
+	drawAddressBusiness(pdf, data.Business.BusinessAddress, 6)
+	pdf.Ln(6)
+
+	pdf.SetFont("Roboto", "B", 16)
+	pdf.Cell(0, 8, loc.t("statement.title"))
+	pdf.Ln(10)
+
+	pdf.SetFont("Roboto", "B", 12)
+	pdf.Cell(0, 6, data.Customer.Name)
+	pdf.Ln(6)
+	pdf.SetFont("Roboto", "", 12)
+	drawAddress(pdf, data.Customer.CustomerAddress, 6)
+	pdf.Ln(4)
+
+	drawMetaRow(pdf, 20, loc.t("statement.period"), fmt.Sprintf("%s – %s", loc.date(data.From), loc.date(data.To)))
+	pdf.Ln(4)
+
+	// =====================================
+	// ENTRIES
+	// =====================================
+	colDate := 25.0
+	colRef := 35.0
+	colDesc := 47.0
+	colAmount := 21.0
+	rowHeight := 7.0
+
+	drawStatementHeader(pdf, loc, colDate, colRef, colDesc, colAmount)
+
+	statementCell(pdf, "", colDate, rowHeight, loc.date(data.From), "", false)
+	statementCell(pdf, "", colRef+colDesc+2*colAmount, rowHeight, loc.t("statement.forward"), "", false)
+	statementCell(pdf, "", colAmount, rowHeight, loc.money(data.OpeningBalance, data.Currency), "R", false)
+	pdf.Ln(rowHeight)
+
+	for _, e := range data.Entries {
+		if pdf.GetY()+rowHeight > usableBottomY {
+			pdf.AddPage()
+			drawStatementHeader(pdf, loc, colDate, colRef, colDesc, colAmount)
+		}
+
+		statementCell(pdf, "", colDate, rowHeight, loc.date(e.Date), "", false)
+		statementCell(pdf, "", colRef, rowHeight, e.Reference, "", false)
+		statementCell(pdf, "", colDesc, rowHeight, e.Description, "", false)
+		statementCell(pdf, "", colAmount, rowHeight, amountOrBlank(loc, e.Debit, data.Currency), "R", false)
+		statementCell(pdf, "", colAmount, rowHeight, amountOrBlank(loc, e.Credit, data.Currency), "R", false)
+		statementCell(pdf, "", colAmount, rowHeight, loc.money(e.Balance, data.Currency), "R", false)
+		pdf.Ln(rowHeight)
+	}
+
+	// =====================================
+	// CLOSING BALANCE
+	// =====================================
+	if pdf.GetY()+20 > usableBottomY {
+		pdf.AddPage()
+	}
+
+	pdf.Ln(6)
+	pdf.SetFont("Roboto", "B", 14)
+	pdf.CellFormat(120, 10, loc.t("statement.due"), "", 0, "R", false, 0, "")
+	pdf.CellFormat(50, 10, loc.money(data.ClosingBalance, data.Currency), "", 0, "R", false, 0, "")
+	pdf.Ln(10)
+
+	return pdf.Output(w)
+}
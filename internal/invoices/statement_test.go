@@ -0,0 +1,64 @@
+package invoices
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"pistachio/internal/models"
+)
+
+// statementWithEntries is a statement with an invoice, a part payment
+// and a credit note.
+func statementWithEntries(currency string) models.StatementData {
+	from := time.Date(2026, 7, 1, 0, 0, 0, 0, time.UTC)
+	data := invoiceWithLines(0)
+
+	return models.StatementData{
+		Business:       data.Business,
+		Customer:       data.Customer,
+		Currency:       currency,
+		From:           from,
+		To:             from.AddDate(0, 3, -1),
+		OpeningBalance: 100,
+		Entries: []models.StatementEntry{
+			{Date: from.AddDate(0, 0, 3), Type: "invoice", Reference: "INV-2026-0001", Description: "Invoice", Debit: 240, Balance: 340},
+			{Date: from.AddDate(0, 0, 10), Type: "payment", Reference: "INV-2026-0001", Description: "Payment", Credit: 140, Balance: 200},
+			{Date: from.AddDate(0, 0, 12), Type: "credit_note", Reference: "CRN-2026-0001", Description: "Credit against INV-2026-0001", Credit: 50, Balance: 150},
+		},
+		ClosingBalance: 150,
+	}
+}
+
+func TestStatementCurrency(t *testing.T) {
+	tests := []struct {
+		currency string
+		want     string
+		notWant  string
+	}{
+		{"EUR", "€150.00", "£"},
+		{"GBP", "£150.00", "€"},
+		{"", "£150.00", "€"},
+	}
+
+	for _, tt := range tests {
+		var buf bytes.Buffer
+		if err := WriteStatementPDF(statementWithEntries(tt.currency), &buf); err != nil {
+			t.Fatal(err)
+		}
+
+		var text []string
+		for _, page := range pdfPages(t, buf.Bytes()) {
+			text = append(text, texts(page)...)
+		}
+		all := strings.Join(text, "\n")
+
+		if !containsLine(text, tt.want) {
+			t.Errorf("%q: no %s closing balance in\n%s", tt.currency, tt.want, all)
+		}
+		if strings.Contains(all, tt.notWant) {
+			t.Errorf("%q: statement shows %s amounts:\n%s", tt.currency, tt.notWant, all)
+		}
+	}
+}
@@ -0,0 +1,216 @@
+package invoices
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	defaultTemplate = "classic"
+	defaultFont     = "Roboto"
+	fontDir         = "assets/font"
+)
+
+// Sections of a document that can be hidden. The items table and totals
+// are always shown.
+const (
+	SectionBusinessDetails = "business_details"
+	SectionBillTo          = "bill_to"
+	SectionPaymentDetails  = "payment_details"
+	SectionThankYou        = "thank_you"
+	SectionNotes           = "notes"
+)
+
+var sections = []string{
+	SectionBusinessDetails,
+	SectionBillTo,
+	SectionPaymentDetails,
+	SectionThankYou,
+	SectionNotes,
+}
+
+// Logo positions
+const (
+	LogoLeft  = "left"
+	LogoRight = "right"
+	LogoNone  = "none"
+)
+
+// Branding is a business's look for its invoices, quotes and credit
+// notes: which template they use and how it is dressed.
+type Branding struct {
+	Template       string   `json:"template"`
+	PrimaryColor   string   `json:"primary_color"` // #RRGGBB: business name, title and amount due
+	AccentColor    string   `json:"accent_color"`  // #RRGGBB: table header and title band
+	Font           string   `json:"font"`          // family with TTFs in assets/font, e.g. Roboto
+	LogoPosition   string   `json:"logo_position"` // left / right / none
+	HiddenSections []string `json:"hidden_sections"`
+	FooterText     string   `json:"footer_text"` // printed above the page number on every page
+}
+
+// DefaultBranding is the classic template in black and grey, the look
+// documents had before branding existed.
+func DefaultBranding() Branding {
+	return Branding{
+		Template:       defaultTemplate,
+		PrimaryColor:   "#000000",
+		AccentColor:    "#E6E6E6",
+		Font:           defaultFont,
+		LogoPosition:   LogoRight,
+		HiddenSections: []string{},
+	}
+}
+
+// Validate checks the branding can be rendered: a known template and
+// logo position, valid colours and a font whose files exist.
+func (b Branding) Validate() error {
+	if _, ok := templates[b.Template]; !ok {
+		return fmt.Errorf("template must be one of %s", strings.Join(TemplateNames(), ", "))
+	}
+
+	for name, c := range map[string]string{"primary_color": b.PrimaryColor, "accent_color": b.AccentColor} {
+		if _, err := parseColor(c); err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+	}
+
+	switch b.LogoPosition {
+	case LogoLeft, LogoRight, LogoNone:
+	default:
+		return errors.New("logo_position must be left, right or none")
+	}
+
+	for _, s := range b.HiddenSections {
+		if !slices.Contains(sections, s) {
+			return fmt.Errorf("unknown section %q, expected one of %s", s, strings.Join(sections, ", "))
+		}
+	}
+
+	if _, err := fontFiles(b.Font); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (b Branding) shows(section string) bool {
+	return !slices.Contains(b.HiddenSections, section)
+}
+
+type rgb struct{ R, G, B int }
+
+func parseColor(s string) (rgb, error) {
+	if len(s) != 7 || s[0] != '#' {
+		return rgb{}, fmt.Errorf("%q is not a #RRGGBB colour", s)
+	}
+	v, err := strconv.ParseUint(s[1:], 16, 32)
+	if err != nil {
+		return rgb{}, fmt.Errorf("%q is not a #RRGGBB colour", s)
+	}
+	return rgb{int(v >> 16 & 0xff), int(v >> 8 & 0xff), int(v & 0xff)}, nil
+}
+
+// mustColor parses a colour that Validate has already checked, falling
+// back to black.
+func mustColor(s string) rgb {
+	c, _ := parseColor(s)
+	return c
+}
+
+// contrast returns black or white, whichever reads better on c.
+func (c rgb) contrast() rgb {
+	if 299*c.R+587*c.G+114*c.B > 128000 {
+		return rgb{0, 0, 0}
+	}
+	return rgb{255, 255, 255}
+}
+
+// fontFiles finds the TTFs for a font family: Regular and Bold are
+// required, Italic falls back to Regular.
+func fontFiles(family string) (map[string]string, error) {
+	if family == "" || strings.ContainsAny(family, `/\.`) {
+		return nil, fmt.Errorf("invalid font %q", family)
+	}
+
+	files := map[string]string{}
+	for style, suffix := range map[string]string{"": "Regular", "B": "Bold", "I": "Italic"} {
+		path := fmt.Sprintf("%s/%s-%s.ttf", fontDir, family, suffix)
+		if _, err := os.Stat(path); err == nil {
+			files[style] = path
+		}
+	}
+
+	if files[""] == "" || files["B"] == "" {
+		return nil, fmt.Errorf("font %s needs %s/%s-Regular.ttf and %s-Bold.ttf", family, fontDir, family, family)
+	}
+	if files["I"] == "" {
+		files["I"] = files[""]
+	}
+	return files, nil
+}
+
+// Template is a built-in layout. Sizes are font points, heights and
+// widths millimetres.
+type Template struct {
+	Name string
+
+	NameSize    float64 // business name
+	TitleSize   float64 // document title
+	HeadingSize float64 // section headings such as "Bill To:"
+	BaseSize    float64
+	SmallSize   float64 // thank you message, notes and captions
+
+	LineHeight float64
+	RowHeight  float64 // item rows and the table header
+
+	// Columns are the widths of Description, Unit Price, Qty and Total,
+	// summing to the 170mm between the margins
+	Columns [4]float64
+
+	RowBorder  string // CellFormat border of item cells: "1" boxed, "B" ruled
+	TitleBand  bool   // title on a full-width band of the accent colour
+	SideBySide bool   // bill to and payment details in two columns
+	InlineInfo bool   // business contact details on one line
+}
+
+var templates = map[string]Template{
+	"classic": {
+		Name:     "classic",
+		NameSize: 20, TitleSize: 18, HeadingSize: 14, BaseSize: 12, SmallSize: 10,
+		LineHeight: 6, RowHeight: 8,
+		Columns:   [4]float64{80, 35, 20, 35},
+		RowBorder: "1",
+	},
+	"modern": {
+		Name:     "modern",
+		NameSize: 22, TitleSize: 16, HeadingSize: 12, BaseSize: 11, SmallSize: 9,
+		LineHeight: 5.5, RowHeight: 8,
+		Columns:   [4]float64{90, 30, 20, 30},
+		RowBorder: "B",
+		TitleBand: true,
+	},
+	"compact": {
+		Name:     "compact",
+		NameSize: 16, TitleSize: 14, HeadingSize: 11, BaseSize: 10, SmallSize: 8,
+		LineHeight: 4.5, RowHeight: 6,
+		Columns:    [4]float64{95, 30, 15, 30},
+		RowBorder:  "B",
+		SideBySide: true,
+		InlineInfo: true,
+	},
+}
+
+// TemplateNames lists the built-in templates.
+func TemplateNames() []string {
+	names := make([]string, 0, len(templates))
+	for name := range templates {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,137 @@
+package invoices
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestBrandingValidate(t *testing.T) {
+	for _, name := range TemplateNames() {
+		b := DefaultBranding()
+		b.Template = name
+		if err := b.Validate(); err != nil {
+			t.Errorf("%s template: %v", name, err)
+		}
+	}
+
+	tests := []struct {
+		name   string
+		change func(b *Branding)
+	}{
+		{"unknown template", func(b *Branding) { b.Template = "fancy" }},
+		{"colour name", func(b *Branding) { b.PrimaryColor = "red" }},
+		{"short colour", func(b *Branding) { b.AccentColor = "#FFF" }},
+		{"colour without #", func(b *Branding) { b.AccentColor = "1234567" }},
+		{"not hex", func(b *Branding) { b.PrimaryColor = "#GG0000" }},
+		{"logo position", func(b *Branding) { b.LogoPosition = "top" }},
+		{"unknown section", func(b *Branding) { b.HiddenSections = []string{"items"} }},
+		{"font with a path", func(b *Branding) { b.Font = "../Roboto" }},
+		{"font without files", func(b *Branding) { b.Font = "ComicSans" }},
+		{"no font", func(b *Branding) { b.Font = "" }},
+	}
+
+	for _, tt := range tests {
+		b := DefaultBranding()
+		tt.change(&b)
+		if err := b.Validate(); err == nil {
+			t.Errorf("%s: got no error for %+v", tt.name, b)
+		}
+	}
+}
+
+func TestColorContrast(t *testing.T) {
+	tests := []struct {
+		color string
+		want  rgb
+	}{
+		{"#FFFFFF", rgb{0, 0, 0}},
+		{"#E6E6E6", rgb{0, 0, 0}},
+		{"#FFFF00", rgb{0, 0, 0}},
+		{"#000000", rgb{255, 255, 255}},
+		{"#1F3A93", rgb{255, 255, 255}},
+	}
+
+	for _, tt := range tests {
+		c, err := parseColor(tt.color)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := c.contrast(); got != tt.want {
+			t.Errorf("contrast(%s) = %v, want %v", tt.color, got, tt.want)
+		}
+	}
+}
+
+// TestHiddenSections renders every template with sections hidden and
+// shown, and looks for each section's text.
+func TestHiddenSections(t *testing.T) {
+	data := invoiceWithLines(2)
+
+	marks := map[string]string{
+		SectionBusinessDetails: data.Business.Email,
+		SectionBillTo:          data.Customer.Name,
+		SectionPaymentDetails:  data.Payment.BankName,
+		SectionThankYou:        localeFor("en").t("thank_you"),
+	}
+
+	for _, name := range TemplateNames() {
+		for section, mark := range marks {
+			for _, hidden := range []bool{false, true} {
+				b := DefaultBranding()
+				b.Template = name
+				if hidden {
+					b.HiddenSections = []string{section}
+				}
+
+				var buf bytes.Buffer
+				if err := GenerateInvoicePDF(data, &buf, WithBranding(b)); err != nil {
+					t.Fatal(err)
+				}
+
+				found := false
+				for _, page := range pdfPages(t, buf.Bytes()) {
+					for _, text := range texts(page) {
+						found = found || strings.Contains(text, mark)
+					}
+				}
+				if found == hidden {
+					t.Errorf("%s, %s hidden=%v: %q drawn=%v", name, section, hidden, mark, found)
+				}
+			}
+		}
+	}
+}
+
+func TestBrandingDrawn(t *testing.T) {
+	b := DefaultBranding()
+	b.Template = "modern"
+	b.PrimaryColor = "#AA0000"
+	b.AccentColor = "#003366"
+	b.FooterText = "Registered in England No. 01234567"
+
+	var buf bytes.Buffer
+	if err := GenerateInvoicePDF(invoiceWithLines(60), &buf, WithBranding(b)); err != nil {
+		t.Fatal(err)
+	}
+
+	pages := pdfPages(t, buf.Bytes())
+	if len(pages) < 2 {
+		t.Fatalf("got %d pages, want the invoice to run onto a second", len(pages))
+	}
+	for i, page := range pages {
+		if !containsLine(texts(page), b.FooterText) {
+			t.Errorf("page %d has no footer text", i+1)
+		}
+	}
+
+	contents := bytes.Join(pageContents(t, buf.Bytes()), nil)
+	for name, op := range map[string]string{
+		"primary": "0.667 0.000 0.000 rg",
+		"accent":  "0.000 0.200 0.400 rg",
+	} {
+		if !bytes.Contains(contents, []byte(op)) {
+			t.Errorf("%s colour isn't used", name)
+		}
+	}
+}
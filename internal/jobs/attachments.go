@@ -0,0 +1,286 @@
+package jobs
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"pistachio/internal/links"
+	"pistachio/internal/photos"
+	"pistachio/internal/storage"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// JobAttachment is a document kept with a job, such as a gas safety
+// certificate, a manual or a signed form.
+type JobAttachment struct {
+	ID          uuid.UUID `json:"id"`
+	JobID       uuid.UUID `json:"job_id"`
+	FileName    string    `json:"file_name"`
+	ContentType string    `json:"content_type"`
+	Size        int64     `json:"size"` // bytes
+	FileURL     string    `json:"file_url"`
+	CreatedAt   string    `json:"created_at"`
+	Duplicate   bool      `json:"duplicate,omitempty"` // on upload: the job already had this file, which is returned instead
+}
+
+const (
+	maxAttachmentSize  = 50 << 20 // 50 MB
+	maxFileNameLength  = 200
+	attachmentTypesMsg = "attachments must be PDF documents or JPEG, PNG, WebP or HEIC images"
+)
+
+func attachmentPublicPath(id uuid.UUID) string {
+	return "/public/attachments/" + id.String()
+}
+
+// UploadAttachmentsHandler takes one or more attachments, each in its
+// own "file" field. Each file succeeds or fails on its own.
+func UploadAttachmentsHandler(db *pgxpool.Pool, store storage.Storage, signer *links.Signer) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		jobID, err := uuid.Parse(chi.URLParam(r, "id"))
+		if err != nil {
+			http.Error(w, "invalid job id", http.StatusBadRequest)
+			return
+		}
+
+		ctx := context.Background()
+
+		if !jobExists(ctx, db, jobID) {
+			http.Error(w, "job not found", http.StatusNotFound)
+			return
+		}
+
+		resp := BatchUploadResponse{Files: []BatchUploadResult{}}
+		err = eachUploadedFile(w, r, maxAttachmentSize, func(fileName string, data []byte, _ url.Values, err error) {
+			result := BatchUploadResult{FileName: fileName, Status: http.StatusOK}
+			if err == nil {
+				var attachment JobAttachment
+				attachment, err = saveAttachment(ctx, db, store, signer, jobID, fileName, data)
+				result.Attachment = &attachment
+			}
+			if err != nil {
+				result = BatchUploadResult{FileName: fileName, Status: uploadErrorStatus(err), Error: err.Error()}
+			}
+			resp.Files = append(resp.Files, result)
+		})
+
+		if err != nil && len(resp.Files) == 0 {
+			http.Error(w, err.Error(), uploadErrorStatus(err))
+			return
+		}
+		if err != nil {
+			resp.Files = append(resp.Files, BatchUploadResult{Status: uploadErrorStatus(err), Error: err.Error()})
+		}
+
+		json.NewEncoder(w).Encode(resp)
+	}
+}
+
+func ListAttachmentsHandler(db *pgxpool.Pool, signer *links.Signer) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		jobID, err := uuid.Parse(chi.URLParam(r, "id"))
+		if err != nil {
+			http.Error(w, "invalid job id", http.StatusBadRequest)
+			return
+		}
+
+		ctx := context.Background()
+
+		if !jobExists(ctx, db, jobID) {
+			http.Error(w, "job not found", http.StatusNotFound)
+			return
+		}
+
+		attachments, err := listAttachments(ctx, db, signer, jobID)
+		if err != nil {
+			http.Error(w, "failed to fetch attachments: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		json.NewEncoder(w).Encode(attachments)
+	}
+}
+
+// saveAttachment checks and stores an attachment. Images lose their
+// location, as job photos do, since attachments are shared as they are.
+func saveAttachment(ctx context.Context, db *pgxpool.Pool, store storage.Storage, signer *links.Signer, jobID uuid.UUID, fileName string, data []byte) (JobAttachment, error) {
+	var contentType, ext string
+
+	if bytes.HasPrefix(data, []byte("%PDF-")) {
+		// A PDF cut short, e.g. by a bad connection, has no end marker
+		if !bytes.Contains(data[max(len(data)-1024, 0):], []byte("%%EOF")) {
+			return JobAttachment{}, rejectUpload(http.StatusBadRequest, "PDF is incomplete")
+		}
+		contentType, ext = "application/pdf", ".pdf"
+	} else {
+		format, err := photos.Sniff(data)
+		if err != nil {
+			return JobAttachment{}, rejectUpload(http.StatusUnsupportedMediaType, attachmentTypesMsg)
+		}
+
+		if err := photos.Validate(data, format); err != nil {
+			return JobAttachment{}, rejectUpload(http.StatusBadRequest, err.Error())
+		}
+
+		if data, err = photos.StripLocation(data, format); err != nil {
+			return JobAttachment{}, rejectUpload(http.StatusBadRequest, "failed to remove image location: "+err.Error())
+		}
+		contentType, ext = format.ContentType(), format.Ext()
+	}
+
+	// Stripping is repeatable, so a file sent again hashes the same
+	hash := storage.Hash(data)
+	if a, ok, err := duplicateAttachment(ctx, db, signer, jobID, hash); ok || err != nil {
+		return a, err
+	}
+
+	a := JobAttachment{
+		ID:          uuid.New(),
+		JobID:       jobID,
+		FileName:    fileName,
+		ContentType: contentType,
+		Size:        int64(len(data)),
+	}
+	if a.FileName == "" {
+		a.FileName = "attachment" + ext
+	}
+
+	key := "attachments/" + a.ID.String() + ext
+	if err := store.Put(ctx, key, bytes.NewReader(data), contentType); err != nil {
+		return JobAttachment{}, fmt.Errorf("failed to save file: %w", err)
+	}
+
+	var createdAt time.Time
+	err := db.QueryRow(ctx,
+		`INSERT INTO job_attachments (id, job_id, file_name, content_type, size_bytes, file_key, sha256, created_at)
+         VALUES ($1, $2, $3, $4, $5, $6, $7, NOW())
+         RETURNING created_at`,
+		a.ID,
+		a.JobID,
+		a.FileName,
+		a.ContentType,
+		a.Size,
+		key,
+		hash,
+	).Scan(&createdAt)
+
+	if err != nil {
+		store.Delete(ctx, key)
+	}
+
+	// Sent twice at once: the other upload won
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == "23505" {
+		a, _, err := duplicateAttachment(ctx, db, signer, jobID, hash)
+		return a, err
+	}
+	if err != nil {
+		return JobAttachment{}, fmt.Errorf("db insert failed: %w", err)
+	}
+
+	a.FileURL = signer.URL(attachmentPublicPath(a.ID))
+	a.CreatedAt = createdAt.Format(time.RFC3339)
+	return a, nil
+}
+
+const attachmentColumns = `id, job_id, file_name, content_type, size_bytes, created_at`
+
+func scanAttachment(row pgx.Row, signer *links.Signer) (JobAttachment, error) {
+	var a JobAttachment
+	var createdAt time.Time
+
+	if err := row.Scan(&a.ID, &a.JobID, &a.FileName, &a.ContentType, &a.Size, &createdAt); err != nil {
+		return JobAttachment{}, err
+	}
+
+	a.FileURL = signer.URL(attachmentPublicPath(a.ID))
+	a.CreatedAt = createdAt.Format(time.RFC3339)
+	return a, nil
+}
+
+// duplicateAttachment looks for an attachment of the job with the given
+// hash.
+func duplicateAttachment(ctx context.Context, db *pgxpool.Pool, signer *links.Signer, jobID uuid.UUID, hash string) (JobAttachment, bool, error) {
+	a, err := scanAttachment(db.QueryRow(ctx,
+		`SELECT `+attachmentColumns+` FROM job_attachments WHERE job_id = $1 AND sha256 = $2`,
+		jobID,
+		hash,
+	), signer)
+
+	if errors.Is(err, pgx.ErrNoRows) {
+		return JobAttachment{}, false, nil
+	}
+	if err != nil {
+		return JobAttachment{}, false, fmt.Errorf("failed to look for duplicates: %w", err)
+	}
+
+	a.Duplicate = true
+	return a, true, nil
+}
+
+func loadAttachment(ctx context.Context, db *pgxpool.Pool, signer *links.Signer, id uuid.UUID) (JobAttachment, error) {
+	return scanAttachment(db.QueryRow(ctx, `SELECT `+attachmentColumns+` FROM job_attachments WHERE id = $1`, id), signer)
+}
+
+func listAttachments(ctx context.Context, db *pgxpool.Pool, signer *links.Signer, jobID uuid.UUID) ([]JobAttachment, error) {
+	rows, err := db.Query(ctx,
+		`SELECT `+attachmentColumns+` FROM job_attachments WHERE job_id = $1 ORDER BY created_at DESC`,
+		jobID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	attachments := []JobAttachment{}
+	for rows.Next() {
+		a, err := scanAttachment(rows, signer)
+		if err != nil {
+			return nil, err
+		}
+		attachments = append(attachments, a)
+	}
+
+	return attachments, rows.Err()
+}
+
+// cleanFileName keeps the last element of a file name sent by a client,
+// without control characters, to name the file when it is downloaded.
+// It returns "" when nothing usable is left.
+func cleanFileName(name string) string {
+	name = path.Base(strings.ReplaceAll(name, `\`, "/"))
+
+	name = strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) || r == utf8.RuneError {
+			return -1
+		}
+		return r
+	}, name)
+	name = strings.TrimSpace(name)
+
+	if name == "." || name == ".." || name == "/" {
+		return ""
+	}
+
+	for len(name) > maxFileNameLength {
+		_, size := utf8.DecodeLastRuneInString(name)
+		name = name[:len(name)-size]
+	}
+
+	return name
+}
@@ -0,0 +1,50 @@
+package jobs
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"pistachio/internal/links"
+	"pistachio/internal/storage"
+)
+
+func TestDuplicateAttachment(t *testing.T) {
+	db := testDB(t)
+	ctx := context.Background()
+	signer := links.New(links.Config{Secret: "test", BaseURL: "http://localhost", TTL: time.Hour})
+	store := storage.NewLocal(t.TempDir(), signer)
+	jobID := seedJob(t, db)
+
+	first, err := saveAttachment(ctx, db, store, signer, jobID, "certificate.pdf", testPDF)
+	if err != nil {
+		t.Fatal(err)
+	}
+	again, err := saveAttachment(ctx, db, store, signer, jobID, "certificate (1).pdf", testPDF)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first.Duplicate || !again.Duplicate || again.ID != first.ID || again.FileName != "certificate.pdf" {
+		t.Errorf("got %+v again, want the first attachment", again)
+	}
+
+	var count int
+	db.QueryRow(ctx, `SELECT COUNT(*) FROM job_attachments WHERE job_id = $1`, jobID).Scan(&count)
+	if count != 1 {
+		t.Errorf("job has %d attachments, want 1", count)
+	}
+
+	var key, hash string
+	if err := db.QueryRow(ctx, `SELECT file_key, sha256 FROM job_attachments WHERE id = $1`, first.ID).Scan(&key, &hash); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := storage.HashFile(ctx, store, key); err != nil || got != hash || hash != storage.Hash(testPDF) {
+		t.Errorf("%s hashes to %s (%v), recorded %s", key, got, err, hash)
+	}
+
+	// Each job keeps its own copy
+	other, err := saveAttachment(ctx, db, store, signer, seedJob(t, db), "certificate.pdf", testPDF)
+	if err != nil || other.Duplicate || other.ID == first.ID {
+		t.Errorf("attachment on another job: got %+v (%v)", other, err)
+	}
+}
@@ -0,0 +1,186 @@
+package jobs
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"pistachio/internal/invoices"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+type BrandingSettings struct {
+	invoices.Branding
+	UpdatedAt string `json:"updated_at"`
+}
+
+func loadBranding(ctx context.Context, db pgxQuerier) (BrandingSettings, error) {
+	var s BrandingSettings
+	var updatedAt time.Time
+
+	err := db.QueryRow(ctx,
+		`SELECT template, primary_color, accent_color, font, logo_position, hidden_sections, footer_text, updated_at
+         FROM branding_settings WHERE id = 1`,
+	).Scan(
+		&s.Template,
+		&s.PrimaryColor,
+		&s.AccentColor,
+		&s.Font,
+		&s.LogoPosition,
+		&s.HiddenSections,
+		&s.FooterText,
+		&updatedAt,
+	)
+
+	s.UpdatedAt = updatedAt.Format(time.RFC3339)
+	return s, err
+}
+
+func GetBrandingSettingsHandler(db *pgxpool.Pool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		settings, err := loadBranding(context.Background(), db)
+		if err != nil {
+			http.Error(w, "failed to load branding settings: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		json.NewEncoder(w).Encode(settings)
+	}
+}
+
+// UpdateBrandingSettingsHandler replaces the template and branding used
+// for invoice, quote and credit note PDFs. Fields left out keep their
+// defaults rather than their current values.
+func UpdateBrandingSettingsHandler(db *pgxpool.Pool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		req := invoices.DefaultBranding()
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "invalid JSON", http.StatusBadRequest)
+			return
+		}
+
+		if req.HiddenSections == nil {
+			req.HiddenSections = []string{}
+		}
+
+		if err := req.Validate(); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		ctx := context.Background()
+
+		_, err := db.Exec(ctx,
+			`UPDATE branding_settings
+             SET template = $1, primary_color = $2, accent_color = $3, font = $4,
+                 logo_position = $5, hidden_sections = $6, footer_text = $7, updated_at = NOW()
+             WHERE id = 1`,
+			req.Template,
+			req.PrimaryColor,
+			req.AccentColor,
+			req.Font,
+			req.LogoPosition,
+			req.HiddenSections,
+			req.FooterText,
+		)
+
+		if err != nil {
+			http.Error(w, "failed to update branding settings: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		settings, err := loadBranding(ctx, db)
+		if err != nil {
+			http.Error(w, "failed to load branding settings: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		json.NewEncoder(w).Encode(settings)
+	}
+}
+
+// InvoicePreviewHandler renders an invoice PDF with the current branding
+// without saving it. ?template= previews another template before
+// switching to it, and ?language= another language than the customer's.
+func InvoicePreviewHandler(db *pgxpool.Pool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		invoiceID, err := uuid.Parse(chi.URLParam(r, "id"))
+		if err != nil {
+			http.Error(w, "invalid invoice id", http.StatusBadRequest)
+			return
+		}
+
+		ctx := context.Background()
+
+		data, err := loadInvoiceData(ctx, db, invoiceID)
+
+		if errors.Is(err, pgx.ErrNoRows) {
+			http.Error(w, "invoice not found", http.StatusNotFound)
+			return
+		}
+
+		if err != nil {
+			http.Error(w, "failed to load invoice: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		branding, err := loadBranding(ctx, db)
+		if err != nil {
+			http.Error(w, "failed to load branding settings: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		if t := r.URL.Query().Get("template"); t != "" {
+			branding.Template = t
+		}
+
+		if err := branding.Validate(); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		settings, err := loadBillingSettings(ctx, db)
+		if err != nil {
+			http.Error(w, "failed to load billing settings: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		lang := r.URL.Query().Get("language")
+		if lang == "" {
+			lang, err = invoiceLanguage(ctx, db, invoiceID)
+			if err != nil {
+				http.Error(w, "failed to load customer language: "+err.Error(), http.StatusInternalServerError)
+				return
+			}
+		}
+
+		if !invoices.SupportedLanguage(lang) {
+			http.Error(w, "language must be one of "+strings.Join(invoices.Languages(), ", "), http.StatusBadRequest)
+			return
+		}
+
+		opts := []invoices.Option{invoices.WithBranding(branding.Branding), invoices.WithLanguage(lang)}
+		if settings.PaymentQR {
+			opts = append(opts, invoices.WithPaymentQR())
+		}
+
+		var buf bytes.Buffer
+		if err := invoices.GenerateInvoicePDF(data, &buf, opts...); err != nil {
+			http.Error(w, "failed to render invoice: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/pdf")
+		w.Header().Set("Content-Disposition", fmt.Sprintf(`inline; filename="%s-preview.pdf"`, data.InvoiceNumber))
+		w.Write(buf.Bytes())
+	}
+}
@@ -0,0 +1,69 @@
+package jobs
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+)
+
+func TestBrandingSettingsAndPreview(t *testing.T) {
+	db := testDB(t)
+	invoiceID := seedInvoice(t, db, seedCustomer(t, db), 120, time.Now())
+
+	r := chi.NewRouter()
+	r.Get("/settings/branding", GetBrandingSettingsHandler(db))
+	r.Put("/settings/branding", UpdateBrandingSettingsHandler(db))
+	r.Get("/invoices/{id}/preview", InvoicePreviewHandler(db))
+
+	if rec := serve(r, http.MethodPut, "/settings/branding", `{"template": "fancy"}`); rec.Code != http.StatusBadRequest {
+		t.Errorf("unknown template: got status %d, want 400", rec.Code)
+	}
+
+	rec := serve(r, http.MethodPut, "/settings/branding",
+		`{"template": "compact", "primary_color": "#1F3A93", "hidden_sections": ["thank_you"], "footer_text": "VAT GB123456789"}`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("update branding: %d %s", rec.Code, rec.Body)
+	}
+
+	var got BrandingSettings
+	json.NewDecoder(serve(r, http.MethodGet, "/settings/branding", "").Body).Decode(&got)
+	if got.Template != "compact" || got.PrimaryColor != "#1F3A93" || got.FooterText != "VAT GB123456789" ||
+		len(got.HiddenSections) != 1 || got.HiddenSections[0] != "thank_you" {
+		t.Errorf("got %+v after the update", got)
+	}
+	// Left out, so back to the default
+	if got.AccentColor != "#E6E6E6" || got.LogoPosition != "right" {
+		t.Errorf("got accent %s and logo %s, want the defaults", got.AccentColor, got.LogoPosition)
+	}
+
+	tests := []struct {
+		query string
+		want  int
+	}{
+		{"", http.StatusOK},
+		{"?template=modern", http.StatusOK},
+		{"?template=modern&language=de", http.StatusOK},
+		{"?template=fancy", http.StatusBadRequest},
+		{"?language=xx", http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		rec := serve(r, http.MethodGet, "/invoices/"+invoiceID+"/preview"+tt.query, "")
+		if rec.Code != tt.want {
+			t.Errorf("preview%s: got status %d, want %d", tt.query, rec.Code, tt.want)
+			continue
+		}
+		if tt.want == http.StatusOK && !strings.HasPrefix(rec.Body.String(), "%PDF-") {
+			t.Errorf("preview%s: not a PDF", tt.query)
+		}
+	}
+
+	// Previewing doesn't change the saved template
+	json.NewDecoder(serve(r, http.MethodGet, "/settings/branding", "").Body).Decode(&got)
+	if got.Template != "compact" {
+		t.Errorf("got template %s after previewing another", got.Template)
+	}
+}
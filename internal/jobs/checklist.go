@@ -0,0 +1,212 @@
+package jobs
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"pistachio/internal/queue"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+type ChecklistItem struct {
+	ID        uuid.UUID `json:"id"`
+	Label     string    `json:"label"`
+	Required  bool      `json:"required"`
+	Checked   bool      `json:"checked"`
+	CheckedBy string    `json:"checked_by,omitempty"`
+	CheckedAt string    `json:"checked_at,omitempty"`
+}
+
+type TickChecklistItemRequest struct {
+	Checked bool   `json:"checked"`
+	User    string `json:"user"`
+}
+
+// copyTemplateChecklist gives a new job its own copy of the template's
+// checklist so it can be ticked off per job.
+func copyTemplateChecklist(ctx context.Context, db queue.Execer, templateID, jobID uuid.UUID) error {
+	_, err := db.Exec(ctx,
+		`INSERT INTO job_checklist_items (id, job_id, label, required, position)
+         SELECT gen_random_uuid(), $1, label, required, position
+         FROM job_template_checklist_items
+         WHERE template_id = $2`,
+		jobID,
+		templateID,
+	)
+	return err
+}
+
+func listChecklist(ctx context.Context, db *pgxpool.Pool, jobID uuid.UUID) ([]ChecklistItem, error) {
+	rows, err := db.Query(ctx,
+		`SELECT id, label, required, COALESCE(checked_by, ''), checked_at
+         FROM job_checklist_items WHERE job_id = $1 ORDER BY position`,
+		jobID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	items := []ChecklistItem{}
+	for rows.Next() {
+		var item ChecklistItem
+		var checkedAt *time.Time
+		if err := rows.Scan(&item.ID, &item.Label, &item.Required, &item.CheckedBy, &checkedAt); err != nil {
+			return nil, err
+		}
+		if checkedAt != nil {
+			item.Checked = true
+			item.CheckedAt = checkedAt.Format(time.RFC3339)
+		}
+		items = append(items, item)
+	}
+
+	return items, rows.Err()
+}
+
+func GetChecklistHandler(db *pgxpool.Pool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		jobID, err := uuid.Parse(chi.URLParam(r, "id"))
+		if err != nil {
+			http.Error(w, "invalid job id", http.StatusBadRequest)
+			return
+		}
+
+		ctx := context.Background()
+
+		if !jobExists(ctx, db, jobID) {
+			http.Error(w, "job not found", http.StatusNotFound)
+			return
+		}
+
+		items, err := listChecklist(ctx, db, jobID)
+		if err != nil {
+			http.Error(w, "failed to fetch checklist: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		json.NewEncoder(w).Encode(items)
+	}
+}
+
+// AddChecklistItemHandler adds a one-off item to a job's checklist.
+func AddChecklistItemHandler(db *pgxpool.Pool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		jobID, err := uuid.Parse(chi.URLParam(r, "id"))
+		if err != nil {
+			http.Error(w, "invalid job id", http.StatusBadRequest)
+			return
+		}
+
+		var req ChecklistItemInput
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "invalid JSON", http.StatusBadRequest)
+			return
+		}
+
+		if req.Label == "" {
+			http.Error(w, "label is required", http.StatusBadRequest)
+			return
+		}
+
+		ctx := context.Background()
+
+		if !jobExists(ctx, db, jobID) {
+			http.Error(w, "job not found", http.StatusNotFound)
+			return
+		}
+
+		item := ChecklistItem{
+			ID:       uuid.New(),
+			Label:    req.Label,
+			Required: req.Required == nil || *req.Required,
+		}
+
+		_, err = db.Exec(ctx,
+			`INSERT INTO job_checklist_items (id, job_id, label, required, position)
+             VALUES ($1, $2, $3, $4,
+                     (SELECT COALESCE(MAX(position) + 1, 0) FROM job_checklist_items WHERE job_id = $2))`,
+			item.ID,
+			jobID,
+			item.Label,
+			item.Required,
+		)
+
+		if err != nil {
+			http.Error(w, "failed to add checklist item: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		json.NewEncoder(w).Encode(item)
+	}
+}
+
+// TickChecklistItemHandler ticks or unticks an item, recording who
+// ticked it and when.
+func TickChecklistItemHandler(db *pgxpool.Pool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		jobID, err := uuid.Parse(chi.URLParam(r, "id"))
+		if err != nil {
+			http.Error(w, "invalid job id", http.StatusBadRequest)
+			return
+		}
+
+		itemID, err := uuid.Parse(chi.URLParam(r, "itemID"))
+		if err != nil {
+			http.Error(w, "invalid checklist item id", http.StatusBadRequest)
+			return
+		}
+
+		var req TickChecklistItemRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "invalid JSON", http.StatusBadRequest)
+			return
+		}
+
+		if req.Checked && req.User == "" {
+			http.Error(w, "user is required when ticking an item", http.StatusBadRequest)
+			return
+		}
+
+		ctx := context.Background()
+
+		var item ChecklistItem
+		var checkedAt *time.Time
+
+		err = db.QueryRow(ctx,
+			`UPDATE job_checklist_items
+             SET checked_by = CASE WHEN $1 THEN $2 END,
+                 checked_at = CASE WHEN $1 THEN NOW() END
+             WHERE id = $3 AND job_id = $4
+             RETURNING id, label, required, COALESCE(checked_by, ''), checked_at`,
+			req.Checked,
+			req.User,
+			itemID,
+			jobID,
+		).Scan(&item.ID, &item.Label, &item.Required, &item.CheckedBy, &checkedAt)
+
+		if errors.Is(err, pgx.ErrNoRows) {
+			http.Error(w, "checklist item not found", http.StatusNotFound)
+			return
+		}
+
+		if err != nil {
+			http.Error(w, "failed to update checklist item: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		if checkedAt != nil {
+			item.Checked = true
+			item.CheckedAt = checkedAt.Format(time.RFC3339)
+		}
+
+		json.NewEncoder(w).Encode(item)
+	}
+}
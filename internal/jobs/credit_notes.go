@@ -0,0 +1,460 @@
+package jobs
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"strings"
+	"time"
+
+	"pistachio/internal/links"
+	"pistachio/internal/models"
+	"pistachio/internal/queue"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+type CreateCreditNoteRequest struct {
+	Reason string               `json:"reason"`
+	Items  []models.InvoiceItem `json:"items"` // omit to credit the whole invoice
+}
+
+type CreditNote struct {
+	ID               uuid.UUID            `json:"id"`
+	CreditNoteNumber string               `json:"credit_note_number"`
+	InvoiceID        uuid.UUID            `json:"invoice_id"`
+	Reason           string               `json:"reason"`
+	Items            []models.InvoiceItem `json:"items"`
+	Subtotal         float64              `json:"subtotal"`
+	LineDiscounts    float64              `json:"line_discounts"`
+	Discount         float64              `json:"discount"`
+	Surcharges       float64              `json:"surcharges"`
+	TaxAmount        float64              `json:"tax_amount"`
+	Total            float64              `json:"total"`
+	PDFStatus        string               `json:"pdf_status"`
+	PDFURL           string               `json:"pdf_url"`
+	IssueDate        string               `json:"issue_date"`
+}
+
+type VoidInvoiceRequest struct {
+	Reason string `json:"reason"`
+}
+
+const creditNoteColumns = `id, credit_note_number, invoice_id, reason, items,
+    subtotal, line_discount_total, discount_amount, surcharge_total, tax_amount, total,
+    pdf_status, COALESCE(pdf_key, ''), issue_date`
+
+func scanCreditNote(row pgx.Row, signer *links.Signer) (CreditNote, error) {
+	var cn CreditNote
+	var pdfKey string
+	var issueDate time.Time
+
+	err := row.Scan(&cn.ID, &cn.CreditNoteNumber, &cn.InvoiceID, &cn.Reason, &cn.Items,
+		&cn.Subtotal, &cn.LineDiscounts, &cn.Discount, &cn.Surcharges, &cn.TaxAmount, &cn.Total,
+		&cn.PDFStatus, &pdfKey, &issueDate)
+	if err != nil {
+		return cn, err
+	}
+
+	cn.IssueDate = issueDate.Format(time.RFC3339)
+	if pdfKey != "" {
+		cn.PDFURL = signer.URL(creditNotePDF.publicPath(cn.ID))
+	}
+
+	return cn, nil
+}
+
+// CreateCreditNoteHandler issues a credit note against an invoice, in
+// full or for selected lines, and reduces the invoice's balance by its
+// total.
+func CreateCreditNoteHandler(db *pgxpool.Pool, signer *links.Signer) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		invoiceID, err := uuid.Parse(chi.URLParam(r, "id"))
+		if err != nil {
+			http.Error(w, "invalid invoice id", http.StatusBadRequest)
+			return
+		}
+
+		var req CreateCreditNoteRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "invalid JSON", http.StatusBadRequest)
+			return
+		}
+
+		req.Reason = strings.TrimSpace(req.Reason)
+		if req.Reason == "" {
+			http.Error(w, "reason is required", http.StatusBadRequest)
+			return
+		}
+
+		for _, item := range req.Items {
+			if item.Quantity <= 0 || item.UnitPrice < 0 {
+				http.Error(w, "credited items need a positive quantity and unit price", http.StatusBadRequest)
+				return
+			}
+		}
+
+		if err := validateAdjustments(req.Items, models.Discount{}, nil); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		ctx := context.Background()
+
+		tx, err := db.Begin(ctx)
+		if err != nil {
+			http.Error(w, "failed to start transaction: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		defer tx.Rollback(ctx)
+
+		// 1️⃣ Lock the invoice and work out what can still be credited
+		var status, currency string
+		var items []models.InvoiceItem
+		var discount models.Discount
+		var surcharges []models.Surcharge
+		var total, amountCredited float64
+
+		err = tx.QueryRow(ctx,
+			`SELECT status, items, COALESCE(discount_type, ''), discount_value, surcharges, total, amount_credited, currency
+             FROM invoices WHERE id = $1 FOR UPDATE`,
+			invoiceID,
+		).Scan(&status, &items, &discount.Type, &discount.Value, &surcharges, &total, &amountCredited, &currency)
+
+		if errors.Is(err, pgx.ErrNoRows) {
+			http.Error(w, "invoice not found", http.StatusNotFound)
+			return
+		}
+
+		if err != nil {
+			http.Error(w, "failed to load invoice: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		if status == InvoiceVoid {
+			http.Error(w, "invoice is void", http.StatusConflict)
+			return
+		}
+
+		// A full credit reverses the invoice's discount and surcharges as
+		// well; a partial one credits the listed lines only
+		if len(req.Items) == 0 {
+			if amountCredited > 0 {
+				http.Error(w, "invoice is already partly credited; list the items to credit", http.StatusConflict)
+				return
+			}
+			req.Items = items
+		} else {
+			discount = models.Discount{}
+			surcharges = nil
+		}
+
+		if surcharges == nil {
+			surcharges = []models.Surcharge{}
+		}
+
+		totals := models.CalculateInvoiceTotals(req.Items, discount, surcharges, 0)
+		creditable := math.Round((total-amountCredited)*100) / 100
+
+		if math.Round(totals.TotalAmount*100)/100 > creditable {
+			http.Error(w, fmt.Sprintf("credit of %.2f is more than the %.2f left to credit", totals.TotalAmount, creditable), http.StatusBadRequest)
+			return
+		}
+
+		// 2️⃣ Number and store the credit note
+		now := time.Now()
+
+		number, err := nextDocumentNumber(ctx, tx, "CRN", now)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		itemsJSON, err := json.Marshal(req.Items)
+		if err != nil {
+			http.Error(w, "cannot encode items json", http.StatusInternalServerError)
+			return
+		}
+
+		surchargesJSON, err := json.Marshal(surcharges)
+		if err != nil {
+			http.Error(w, "cannot encode surcharges json", http.StatusInternalServerError)
+			return
+		}
+
+		creditNote, err := scanCreditNote(tx.QueryRow(ctx,
+			`INSERT INTO credit_notes
+             (id, credit_note_number, invoice_id, reason, items,
+              subtotal, line_discount_total, discount_type, discount_value, discount_amount,
+              surcharges, surcharge_total, tax_rate, tax_amount, total,
+              pdf_status, issue_date, currency, created_at)
+             VALUES ($1, $2, $3, $4, $5, $6, $7, NULLIF($8, ''), $9, $10, $11, $12, $13, $14, $15, $16, $17, $18, NOW())
+             RETURNING `+creditNoteColumns,
+			uuid.New(),
+			number,
+			invoiceID,
+			req.Reason,
+			itemsJSON,
+			totals.Subtotal,
+			totals.LineDiscounts,
+			discount.Type,
+			discount.Value,
+			totals.Discount,
+			surchargesJSON,
+			totals.Surcharges,
+			totals.TaxRate,
+			totals.TaxAmount,
+			totals.TotalAmount,
+			PDFPending,
+			now,
+			currency,
+		), signer)
+
+		if err != nil {
+			http.Error(w, "failed to insert credit note: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		// 3️⃣ Reduce the invoice balance; a fully settled invoice stops
+		// being chased
+		_, err = tx.Exec(ctx,
+			`UPDATE invoices
+             SET amount_credited = amount_credited + $1,
+                 status = CASE
+                     WHEN `+invoiceBalanceSQL+` - $1 > 0 THEN status
+                     WHEN amount_paid > 0 OR deposit_applied > 0 THEN $2
+                     ELSE $3
+                 END
+             WHERE id = $4`,
+			totals.TotalAmount,
+			InvoicePaid,
+			InvoiceCredited,
+			invoiceID,
+		)
+
+		if err != nil {
+			http.Error(w, "failed to update invoice: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		if _, err := queue.Enqueue(ctx, tx, TaskCreditNotePDF, documentTask{ID: creditNote.ID}); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		if err := tx.Commit(ctx); err != nil {
+			http.Error(w, "failed to commit: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		json.NewEncoder(w).Encode(creditNote)
+	}
+}
+
+func ListCreditNotesHandler(db *pgxpool.Pool, signer *links.Signer) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		invoiceID, err := uuid.Parse(chi.URLParam(r, "id"))
+		if err != nil {
+			http.Error(w, "invalid invoice id", http.StatusBadRequest)
+			return
+		}
+
+		ctx := context.Background()
+
+		rows, err := db.Query(ctx,
+			`SELECT `+creditNoteColumns+` FROM credit_notes WHERE invoice_id = $1 ORDER BY issue_date`,
+			invoiceID,
+		)
+		if err != nil {
+			http.Error(w, "failed to query credit notes: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		defer rows.Close()
+
+		creditNotes := []CreditNote{}
+		for rows.Next() {
+			cn, err := scanCreditNote(rows, signer)
+			if err != nil {
+				http.Error(w, "scan error: "+err.Error(), http.StatusInternalServerError)
+				return
+			}
+			creditNotes = append(creditNotes, cn)
+		}
+
+		json.NewEncoder(w).Encode(creditNotes)
+	}
+}
+
+func GetCreditNoteHandler(db *pgxpool.Pool, signer *links.Signer) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		creditNoteID, err := uuid.Parse(chi.URLParam(r, "id"))
+		if err != nil {
+			http.Error(w, "invalid credit note id", http.StatusBadRequest)
+			return
+		}
+
+		ctx := context.Background()
+
+		cn, err := scanCreditNote(db.QueryRow(ctx, `SELECT `+creditNoteColumns+` FROM credit_notes WHERE id = $1`, creditNoteID), signer)
+
+		if errors.Is(err, pgx.ErrNoRows) {
+			http.Error(w, "credit note not found", http.StatusNotFound)
+			return
+		}
+
+		if err != nil {
+			http.Error(w, "failed to load credit note: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		json.NewEncoder(w).Encode(cn)
+	}
+}
+
+// VoidInvoiceHandler cancels an invoice that was issued in error. The
+// invoice is kept, marked void with the reason, for the audit trail, and
+// the time, parts and deposits it billed are freed for the replacement.
+// Invoices with payments or credits must be corrected with a credit note
+// instead.
+func VoidInvoiceHandler(db *pgxpool.Pool, signer *links.Signer) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		invoiceID, err := uuid.Parse(chi.URLParam(r, "id"))
+		if err != nil {
+			http.Error(w, "invalid invoice id", http.StatusBadRequest)
+			return
+		}
+
+		var req VoidInvoiceRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "invalid JSON", http.StatusBadRequest)
+			return
+		}
+
+		req.Reason = strings.TrimSpace(req.Reason)
+		if req.Reason == "" {
+			http.Error(w, "reason is required", http.StatusBadRequest)
+			return
+		}
+
+		ctx := context.Background()
+
+		tx, err := db.Begin(ctx)
+		if err != nil {
+			http.Error(w, "failed to start transaction: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		defer tx.Rollback(ctx)
+
+		// 1️⃣ Void the invoice
+		inv, err := scanInvoiceSummary(tx.QueryRow(ctx,
+			`UPDATE invoices
+             SET status = $1, voided_at = NOW(), void_reason = $2
+             WHERE id = $3 AND status IN ($4, $5) AND amount_paid = 0 AND amount_credited = 0
+             RETURNING `+invoiceSummaryColumns,
+			InvoiceVoid,
+			req.Reason,
+			invoiceID,
+			InvoiceIssued,
+			InvoiceOverdue,
+		), signer)
+
+		if errors.Is(err, pgx.ErrNoRows) {
+			current, err := scanInvoiceSummary(tx.QueryRow(ctx, `SELECT `+invoiceSummaryColumns+` FROM invoices WHERE id = $1`, invoiceID), signer)
+			if err != nil {
+				http.Error(w, "invoice not found", http.StatusNotFound)
+				return
+			}
+
+			if current.Status == InvoiceVoid {
+				http.Error(w, "invoice is already void", http.StatusConflict)
+				return
+			}
+
+			http.Error(w, "invoice has payments or credits; issue a credit note instead", http.StatusConflict)
+			return
+		}
+
+		if err != nil {
+			http.Error(w, "failed to void invoice: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		// 2️⃣ Deposits it deducted, and the time, parts and template lines
+		// it billed, go back to the job for the replacement
+		_, err = tx.Exec(ctx, `UPDATE invoices SET applied_to_invoice_id = NULL WHERE applied_to_invoice_id = $1`, invoiceID)
+		if err != nil {
+			http.Error(w, "failed to release deposits: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		_, err = tx.Exec(ctx, `UPDATE time_entries SET invoice_id = NULL WHERE invoice_id = $1`, invoiceID)
+		if err != nil {
+			http.Error(w, "failed to release time entries: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		_, err = tx.Exec(ctx, `UPDATE job_parts SET invoice_id = NULL WHERE invoice_id = $1`, invoiceID)
+		if err != nil {
+			http.Error(w, "failed to release parts: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		_, err = tx.Exec(ctx, `UPDATE jobs SET template_lines_invoice_id = NULL WHERE template_lines_invoice_id = $1`, invoiceID)
+		if err != nil {
+			http.Error(w, "failed to release template lines: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		if err := tx.Commit(ctx); err != nil {
+			http.Error(w, "failed to commit: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		json.NewEncoder(w).Encode(inv)
+	}
+}
+
+// loadCreditNoteData builds the document model a credit note PDF is
+// rendered from, taking the customer from the credited invoice.
+func loadCreditNoteData(ctx context.Context, db *pgxpool.Pool, creditNoteID uuid.UUID) (models.InvoiceData, error) {
+	var invoiceID uuid.UUID
+	var data models.InvoiceData
+	var reason string
+
+	err := db.QueryRow(ctx,
+		`SELECT invoice_id, credit_note_number, reason, items,
+                subtotal, line_discount_total, COALESCE(discount_type, ''), discount_value, discount_amount,
+                surcharges, surcharge_total, tax_rate, tax_amount, total, issue_date, currency
+         FROM credit_notes WHERE id = $1`,
+		creditNoteID,
+	).Scan(
+		&invoiceID, &data.InvoiceNumber, &reason, &data.Items,
+		&data.Totals.Subtotal, &data.Totals.LineDiscounts, &data.Discount.Type, &data.Discount.Value, &data.Totals.Discount,
+		&data.Surcharges, &data.Totals.Surcharges, &data.Totals.TaxRate, &data.Totals.TaxAmount, &data.Totals.TotalAmount,
+		&data.IssueDate, &data.Currency,
+	)
+	if err != nil {
+		return data, err
+	}
+
+	data.Totals.AmountDue = data.Totals.TotalAmount
+
+	invoice, err := loadInvoiceData(ctx, db, invoiceID)
+	if err != nil {
+		return data, fmt.Errorf("failed to load invoice: %w", err)
+	}
+
+	data.InvoiceID = creditNoteID.String()
+	data.Reference = invoice.InvoiceNumber
+	data.Business = invoice.Business
+	data.Customer = invoice.Customer
+	data.FooterNotes = fmt.Sprintf("This credit note is issued against invoice %s.\n\nReason: %s", invoice.InvoiceNumber, reason)
+
+	return data, nil
+}
@@ -0,0 +1,104 @@
+package jobs
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"pistachio/internal/links"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+)
+
+func TestVoidInvoiceFreesBilledWork(t *testing.T) {
+	db := testDB(t)
+	jobID := seedJob(t, db)
+	seedJobPart(t, db, jobID, 45)
+
+	signer := links.New(links.Config{Secret: "test", BaseURL: "http://localhost", TTL: time.Hour})
+
+	r := chi.NewRouter()
+	r.Post("/jobs/{id}/invoice", CreateJobInvoiceHandler(db))
+	r.Post("/invoices/{id}/void", VoidInvoiceHandler(db, signer))
+
+	do := func(method, url, body string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		r.ServeHTTP(rec, httptest.NewRequest(method, url, strings.NewReader(body)))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("%s %s: %d %s", method, url, rec.Code, rec.Body)
+		}
+		return rec
+	}
+
+	invoice := func() string {
+		var created struct {
+			InvoiceID string `json:"invoice_id"`
+		}
+		json.NewDecoder(do(http.MethodPost, "/jobs/"+jobID.String()+"/invoice", "").Body).Decode(&created)
+		return created.InvoiceID
+	}
+
+	first := invoice()
+	do(http.MethodPost, "/invoices/"+first+"/void", `{"reason": "Raised against the wrong customer"}`)
+
+	var unbilled int
+	if err := db.QueryRow(context.Background(), `SELECT COUNT(*) FROM job_parts WHERE job_id = $1 AND invoice_id IS NULL`, jobID).Scan(&unbilled); err != nil {
+		t.Fatal(err)
+	}
+	if unbilled != 1 {
+		t.Errorf("got %d unbilled parts after the void, want 1", unbilled)
+	}
+
+	// The replacement bills the part again
+	if second := invoice(); second == "" || second == first {
+		t.Errorf("got replacement invoice %q after voiding %q", second, first)
+	}
+}
+
+func TestCreditNoteTakesInvoiceCurrency(t *testing.T) {
+	db := testDB(t)
+	jobID := seedJob(t, db)
+	seedJobPart(t, db, jobID, 45)
+
+	signer := links.New(links.Config{Secret: "test", BaseURL: "http://localhost", TTL: time.Hour})
+
+	r := chi.NewRouter()
+	r.Put("/settings/billing", UpdateBillingSettingsHandler(db))
+	r.Post("/jobs/{id}/invoice", CreateJobInvoiceHandler(db))
+	r.Post("/invoices/{id}/credit-notes", CreateCreditNoteHandler(db, signer))
+
+	do := func(method, url, body string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		r.ServeHTTP(rec, httptest.NewRequest(method, url, strings.NewReader(body)))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("%s %s: %d %s", method, url, rec.Code, rec.Body)
+		}
+		return rec
+	}
+
+	do(http.MethodPut, "/settings/billing", `{"payment_terms_days": 14, "currency": "EUR"}`)
+
+	var invoice struct {
+		InvoiceID string `json:"invoice_id"`
+	}
+	json.NewDecoder(do(http.MethodPost, "/jobs/"+jobID.String()+"/invoice", "").Body).Decode(&invoice)
+
+	var cn CreditNote
+	json.NewDecoder(do(http.MethodPost, "/invoices/"+invoice.InvoiceID+"/credit-notes", `{"reason": "Part returned"}`).Body).Decode(&cn)
+	if cn.ID == uuid.Nil {
+		t.Fatal("no credit note id in the response")
+	}
+
+	data, err := loadCreditNoteData(context.Background(), db, cn.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data.Currency != "EUR" || data.CurrencyCode() != "EUR" {
+		t.Errorf("got currency %q (%s), want EUR", data.Currency, data.CurrencyCode())
+	}
+}
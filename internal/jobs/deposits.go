@@ -0,0 +1,110 @@
+package jobs
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"strings"
+
+	"pistachio/internal/models"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+type CreateDepositRequest struct {
+	Amount      float64 `json:"amount"`  // fixed amount, before tax
+	Percent     float64 `json:"percent"` // or a share of the job estimate
+	TaxRate     float64 `json:"tax_rate"`
+	Description string  `json:"description"` // default: "Deposit – <job title>"
+}
+
+// CreateJobDepositHandler issues a deposit invoice for a job. Once paid,
+// the deposit is deducted from the job's next standard invoice.
+func CreateJobDepositHandler(db *pgxpool.Pool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		jobID, err := uuid.Parse(chi.URLParam(r, "id"))
+		if err != nil {
+			http.Error(w, "invalid job id", http.StatusBadRequest)
+			return
+		}
+
+		var req CreateDepositRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "invalid JSON body", http.StatusBadRequest)
+			return
+		}
+
+		if (req.Amount > 0) == (req.Percent > 0) {
+			http.Error(w, "give either amount or percent", http.StatusBadRequest)
+			return
+		}
+
+		if req.Amount < 0 || req.Percent < 0 || req.Percent > 100 || req.TaxRate < 0 {
+			http.Error(w, "amount, percent and tax_rate must be positive; percent at most 100", http.StatusBadRequest)
+			return
+		}
+
+		ctx := context.Background()
+
+		// 1️⃣ Load job + customer
+		var title, customerName, customerEmail, customerAddress string
+		var estimate float64
+
+		err = db.QueryRow(ctx,
+			`SELECT j.title, COALESCE(j.estimate, 0), c.name, COALESCE(c.email, ''), COALESCE(c.address, '')
+             FROM jobs j
+             JOIN customers c ON j.customer_id = c.id
+             WHERE j.id = $1`,
+			jobID,
+		).Scan(&title, &estimate, &customerName, &customerEmail, &customerAddress)
+
+		if err != nil {
+			http.Error(w, "job not found", http.StatusNotFound)
+			return
+		}
+
+		// 2️⃣ Work out the deposit
+		amount := req.Amount
+		if req.Percent > 0 {
+			if estimate <= 0 {
+				http.Error(w, "job has no estimate to take a percentage of", http.StatusUnprocessableEntity)
+				return
+			}
+			amount = estimate * req.Percent / 100
+		}
+		amount = math.Round(amount*100) / 100
+
+		description := strings.TrimSpace(req.Description)
+		if description == "" {
+			description = "Deposit – " + title
+			if req.Percent > 0 {
+				description = fmt.Sprintf("%g%% deposit – %s", req.Percent, title)
+			}
+		}
+
+		// 3️⃣ Issue the deposit invoice
+		invoiceData, err := issueInvoice(ctx, db, invoiceInput{
+			Kind:            InvoiceDeposit,
+			CustomerName:    customerName,
+			CustomerEmail:   customerEmail,
+			CustomerAddress: models.CustomerAddress{Line1: customerAddress},
+			Items: []models.InvoiceItem{{
+				Description: description,
+				Quantity:    1,
+				UnitPrice:   amount,
+				TaxRate:     req.TaxRate,
+			}},
+			JobID: &jobID,
+		})
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		json.NewEncoder(w).Encode(invoiceCreatedResponse(invoiceData))
+	}
+}
@@ -3,15 +3,20 @@ package jobs
 import (
     "context"
     "encoding/json"
+    "errors"
+    "fmt"
     "net/http"
     "time"
 
+    "pistachio/internal/links"
+
     "github.com/go-chi/chi/v5"
     "github.com/google/uuid"
+    "github.com/jackc/pgx/v5"
     "github.com/jackc/pgx/v5/pgxpool"
 )
 
-func GetJobDetailHandler(db *pgxpool.Pool) http.HandlerFunc {
+func GetJobDetailHandler(db *pgxpool.Pool, signer *links.Signer) http.HandlerFunc {
     return func(w http.ResponseWriter, r *http.Request) {
         jobIDParam := chi.URLParam(r, "id")
         jobID, err := uuid.Parse(jobIDParam)
@@ -20,91 +25,132 @@ func GetJobDetailHandler(db *pgxpool.Pool) http.HandlerFunc {
             return
         }
 
-        ctx := context.Background()
-
-        // 1️⃣ Query job + customer
-        var detail JobDetail
-        var cust CustomerInfo
-        var createdAt time.Time
-
-        err = db.QueryRow(ctx,
-            `SELECT 
-                j.id, j.title, j.description, j.status, j.estimate, j.created_at,
-                c.id, c.name, c.email, c.phone, c.address
-             FROM jobs j
-             JOIN customers c ON j.customer_id = c.id
-             WHERE j.id = $1`,
-            jobID,
-        ).Scan(
-            &detail.ID, &detail.Title, &detail.Description, &detail.Status, &detail.Estimate, &createdAt,
-            &cust.ID, &cust.Name, &cust.Email, &cust.Phone, &cust.Address,
-        )
+        resp, err := loadJobDetail(context.Background(), db, signer, jobID)
 
-        if err != nil {
-            http.Error(w, "job not found: "+err.Error(), http.StatusNotFound)
+        if errors.Is(err, pgx.ErrNoRows) {
+            http.Error(w, "job not found", http.StatusNotFound)
             return
         }
 
-        detail.CreatedAt = createdAt.Format(time.RFC3339)
-
-        // 2️⃣ Query notes
-        notesRows, err := db.Query(ctx,
-            `SELECT id, text, created_at FROM job_notes WHERE job_id = $1 ORDER BY created_at DESC`,
-            jobID,
-        )
-
         if err != nil {
-            http.Error(w, "failed to fetch notes: "+err.Error(), http.StatusInternalServerError)
+            http.Error(w, err.Error(), http.StatusInternalServerError)
             return
         }
-        defer notesRows.Close()
-
-        notes := []JobNote{}
-        for notesRows.Next() {
-            var n JobNote
-            var noteCreated time.Time
-            err := notesRows.Scan(&n.ID, &n.Text, &noteCreated)
-            if err != nil {
-                http.Error(w, "failed to scan note: "+err.Error(), http.StatusInternalServerError)
-                return
-            }
-            n.CreatedAt = noteCreated.Format(time.RFC3339)
-            notes = append(notes, n)
-        }
 
-        // 3️⃣ Query photos
-        photosRows, err := db.Query(ctx,
-            `SELECT id, file_url, created_at FROM job_photos WHERE job_id = $1 ORDER BY created_at DESC`,
-            jobID,
-        )
+        json.NewEncoder(w).Encode(resp)
+    }
+}
 
+// loadJobDetail collects everything about a job, for the job detail and
+// the job export. It returns pgx.ErrNoRows if there is no such job.
+func loadJobDetail(ctx context.Context, db *pgxpool.Pool, signer *links.Signer, jobID uuid.UUID) (JobDetailResponse, error) {
+    // 1️⃣ Query job + customer
+    var detail JobDetail
+    var cust CustomerInfo
+    var createdAt time.Time
+
+    err := db.QueryRow(ctx,
+        `SELECT 
+            j.id, j.title, j.description, j.status, j.estimate, COALESCE(j.job_type, ''), `+labourMinutesSQL+`, j.created_at,
+            c.id, c.name, c.email, c.phone, c.address
+         FROM jobs j
+         JOIN customers c ON j.customer_id = c.id
+         WHERE j.id = $1`,
+        jobID,
+    ).Scan(
+        &detail.ID, &detail.Title, &detail.Description, &detail.Status, &detail.Estimate, &detail.JobType, &detail.LabourMinutes, &createdAt,
+        &cust.ID, &cust.Name, &cust.Email, &cust.Phone, &cust.Address,
+    )
+
+    if errors.Is(err, pgx.ErrNoRows) {
+        return JobDetailResponse{}, err
+    }
+
+    if err != nil {
+        return JobDetailResponse{}, fmt.Errorf("failed to fetch job: %w", err)
+    }
+
+    detail.CreatedAt = createdAt.Format(time.RFC3339)
+
+    // 2️⃣ Query notes
+    notesRows, err := db.Query(ctx,
+        `SELECT id, text, created_at FROM job_notes WHERE job_id = $1 ORDER BY created_at DESC`,
+        jobID,
+    )
+
+    if err != nil {
+        return JobDetailResponse{}, fmt.Errorf("failed to fetch notes: %w", err)
+    }
+    defer notesRows.Close()
+
+    notes := []JobNote{}
+    for notesRows.Next() {
+        var n JobNote
+        var noteCreated time.Time
+        err := notesRows.Scan(&n.ID, &n.Text, &noteCreated)
         if err != nil {
-            http.Error(w, "failed to fetch photos: "+err.Error(), http.StatusInternalServerError)
-            return
-        }
-        defer photosRows.Close()
-
-        photos := []JobPhoto{}
-        for photosRows.Next() {
-            var p JobPhoto
-            var photoCreated time.Time
-            err := photosRows.Scan(&p.ID, &p.FileURL, &photoCreated)
-            if err != nil {
-                http.Error(w, "failed to scan photo: "+err.Error(), http.StatusInternalServerError)
-                return
-            }
-            p.CreatedAt = photoCreated.Format(time.RFC3339)
-            photos = append(photos, p)
+            return JobDetailResponse{}, fmt.Errorf("failed to scan note: %w", err)
         }
+        n.CreatedAt = noteCreated.Format(time.RFC3339)
+        notes = append(notes, n)
+    }
 
-        // 4️⃣ Assemble full response
-        resp := JobDetailResponse{
-            Job:      detail,
-            Customer: cust,
-            Notes:    notes,
-            Photos:   photos,
-        }
+    // 3️⃣ Query status history
+    history, err := listStatusHistory(ctx, db, jobID)
+    if err != nil {
+        return JobDetailResponse{}, fmt.Errorf("failed to fetch status history: %w", err)
+    }
 
-        json.NewEncoder(w).Encode(resp)
+    // 4️⃣ Query photos, grouped by category and paired before/after
+    photos, err := listJobPhotos(ctx, db, signer, jobID)
+    if err != nil {
+        return JobDetailResponse{}, fmt.Errorf("failed to fetch photos: %w", err)
     }
+
+    photoPairs := pairPhotos(photos)
+
+    reportURL := ""
+    if len(photoPairs) > 0 {
+        reportURL = signer.URL(jobReportPublicPath(jobID))
+    }
+
+    // 5️⃣ Query attachments
+    attachments, err := listAttachments(ctx, db, signer, jobID)
+    if err != nil {
+        return JobDetailResponse{}, fmt.Errorf("failed to fetch attachments: %w", err)
+    }
+
+    // 6️⃣ Query time entries
+    timeEntries, err := listTimeEntries(ctx, db, jobID)
+    if err != nil {
+        return JobDetailResponse{}, fmt.Errorf("failed to fetch time entries: %w", err)
+    }
+
+    // 7️⃣ Query parts used
+    parts, err := listJobParts(ctx, db, jobID)
+    if err != nil {
+        return JobDetailResponse{}, fmt.Errorf("failed to fetch parts: %w", err)
+    }
+
+    // 8️⃣ Query checklist
+    checklist, err := listChecklist(ctx, db, jobID)
+    if err != nil {
+        return JobDetailResponse{}, fmt.Errorf("failed to fetch checklist: %w", err)
+    }
+
+    // 9️⃣ Assemble full response
+    return JobDetailResponse{
+        Job:           detail,
+        Customer:      cust,
+        Notes:         notes,
+        StatusHistory: history,
+        Photos:        photos,
+        PhotoGroups:   groupPhotos(photos),
+        PhotoPairs:    photoPairs,
+        ReportURL:     reportURL,
+        Attachments:   attachments,
+        TimeEntries:   timeEntries,
+        Parts:         parts,
+        Checklist:     checklist,
+    }, nil
 }
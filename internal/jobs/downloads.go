@@ -0,0 +1,225 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"path"
+	"strconv"
+	"time"
+
+	"pistachio/internal/storage"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// pdfDocument says where a downloadable document's number, PDF and URLs
+// are.
+type pdfDocument struct {
+	Kind   string // invoice / quote / credit note
+	Table  string
+	Number string // SQL for the document number, used as the file name
+	Path   string // URL path segment
+}
+
+var (
+	invoicePDF    = pdfDocument{Kind: "invoice", Table: "invoices", Number: "COALESCE(invoice_number, 'INV-' || LEFT(id::text, 8))", Path: "invoices"}
+	quotePDF      = pdfDocument{Kind: "quote", Table: "quotes", Number: "quote_number", Path: "quotes"}
+	creditNotePDF = pdfDocument{Kind: "credit note", Table: "credit_notes", Number: "credit_note_number", Path: "credit-notes"}
+)
+
+// publicPath is the path signed links to a document's PDF point to.
+func (d pdfDocument) publicPath(id uuid.UUID) string {
+	return "/public/" + d.Path + "/" + id.String() + "/pdf"
+}
+
+func photoPublicPath(id uuid.UUID) string {
+	return "/public/photos/" + id.String()
+}
+
+// InvoicePDFHandler downloads an invoice's PDF as <invoice number>.pdf.
+func InvoicePDFHandler(db *pgxpool.Pool, store storage.Storage) http.HandlerFunc {
+	return documentPDFHandler(db, store, invoicePDF)
+}
+
+func QuotePDFHandler(db *pgxpool.Pool, store storage.Storage) http.HandlerFunc {
+	return documentPDFHandler(db, store, quotePDF)
+}
+
+func CreditNotePDFHandler(db *pgxpool.Pool, store storage.Storage) http.HandlerFunc {
+	return documentPDFHandler(db, store, creditNotePDF)
+}
+
+func documentPDFHandler(db *pgxpool.Pool, store storage.Storage, doc pdfDocument) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		docID, err := uuid.Parse(chi.URLParam(r, "id"))
+		if err != nil {
+			http.Error(w, "invalid "+doc.Kind+" id", http.StatusBadRequest)
+			return
+		}
+
+		ctx := context.Background()
+
+		var number, pdfStatus, pdfKey string
+		err = db.QueryRow(ctx,
+			`SELECT `+doc.Number+`, pdf_status, COALESCE(pdf_key, '') FROM `+doc.Table+` WHERE id = $1`,
+			docID,
+		).Scan(&number, &pdfStatus, &pdfKey)
+
+		if errors.Is(err, pgx.ErrNoRows) {
+			http.Error(w, doc.Kind+" not found", http.StatusNotFound)
+			return
+		}
+
+		if err != nil {
+			http.Error(w, "failed to load "+doc.Kind+": "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		if pdfStatus != PDFReady || pdfKey == "" {
+			http.Error(w, doc.Kind+" PDF is not ready yet", http.StatusConflict)
+			return
+		}
+
+		serveStoredFile(w, r, store, pdfKey, number+".pdf", "application/pdf")
+	}
+}
+
+// PhotoHandler downloads a job photo, without its GPS coordinates.
+func PhotoHandler(db *pgxpool.Pool, store storage.Storage) http.HandlerFunc {
+	return photoHandler(db, store, "file_key", "content_type")
+}
+
+// PhotoOriginalHandler downloads a photo as it was uploaded, with all its
+// metadata, GPS coordinates included. It is only mounted behind the staff
+// token and has no signed links.
+func PhotoOriginalHandler(db *pgxpool.Pool, store storage.Storage) http.HandlerFunc {
+	return photoHandler(db, store, "COALESCE(original_key, file_key)", "content_type")
+}
+
+// PhotoVariantHandler downloads a resized copy of a photo, either
+// photos.Thumbnail or photos.Medium. Variants are always JPEGs.
+func PhotoVariantHandler(db *pgxpool.Pool, store storage.Storage, variant string) http.HandlerFunc {
+	return photoHandler(db, store, "COALESCE("+photoVariantColumns[variant]+", '')", "'image/jpeg'")
+}
+
+func photoHandler(db *pgxpool.Pool, store storage.Storage, keyColumn, contentTypeColumn string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		photoID, err := uuid.Parse(chi.URLParam(r, "id"))
+		if err != nil {
+			http.Error(w, "invalid photo id", http.StatusBadRequest)
+			return
+		}
+
+		ctx := context.Background()
+
+		var fileKey, contentType string
+		err = db.QueryRow(ctx,
+			`SELECT `+keyColumn+`, COALESCE(`+contentTypeColumn+`, '') FROM job_photos WHERE id = $1`,
+			photoID,
+		).Scan(&fileKey, &contentType)
+
+		if errors.Is(err, pgx.ErrNoRows) {
+			http.Error(w, "photo not found", http.StatusNotFound)
+			return
+		}
+
+		if err != nil {
+			http.Error(w, "failed to load photo: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		if fileKey == "" {
+			http.Error(w, "photo variant is not ready yet", http.StatusConflict)
+			return
+		}
+
+		// Photos uploaded before content types were recorded
+		if contentType == "" {
+			contentType = mime.TypeByExtension(path.Ext(fileKey))
+		}
+		if contentType == "" {
+			contentType = "application/octet-stream"
+		}
+
+		serveStoredFile(w, r, store, fileKey, path.Base(fileKey), contentType)
+	}
+}
+
+// AttachmentHandler downloads a job attachment under the name it was
+// uploaded with.
+func AttachmentHandler(db *pgxpool.Pool, store storage.Storage) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		attachmentID, err := uuid.Parse(chi.URLParam(r, "id"))
+		if err != nil {
+			http.Error(w, "invalid attachment id", http.StatusBadRequest)
+			return
+		}
+
+		var fileKey, fileName, contentType string
+		err = db.QueryRow(context.Background(),
+			`SELECT file_key, file_name, content_type FROM job_attachments WHERE id = $1`,
+			attachmentID,
+		).Scan(&fileKey, &fileName, &contentType)
+
+		if errors.Is(err, pgx.ErrNoRows) {
+			http.Error(w, "attachment not found", http.StatusNotFound)
+			return
+		}
+
+		if err != nil {
+			http.Error(w, "failed to load attachment: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		serveStoredFile(w, r, store, fileKey, fileName, contentType)
+	}
+}
+
+// serveStoredFile streams a stored file inline as filename. Files from
+// backends that can seek, such as local disk, answer Range and
+// conditional requests; other backends return a stream, which is copied
+// through whole rather than held in memory.
+func serveStoredFile(w http.ResponseWriter, r *http.Request, store storage.Storage, key, filename, contentType string) {
+	f, err := store.Get(r.Context(), key)
+	if errors.Is(err, storage.ErrNotFound) {
+		http.Error(w, "file not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "failed to read file: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer f.Close()
+
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("inline", map[string]string{"filename": filename}))
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Header().Set("Cache-Control", "private, no-store")
+
+	if content, ok := f.(io.ReadSeeker); ok {
+		http.ServeContent(w, r, filename, time.Time{}, content)
+		return
+	}
+
+	if sized, ok := f.(storage.Sized); ok && sized.Size() >= 0 {
+		w.Header().Set("Content-Length", strconv.FormatInt(sized.Size(), 10))
+	}
+	w.Header().Set("Accept-Ranges", "none")
+
+	if r.Method == http.MethodHead {
+		return
+	}
+
+	// Headers are sent by now, so a failure part way can only cut the
+	// response short
+	if _, err := io.Copy(w, f); err != nil {
+		log.Printf("download %s: %v", key, err)
+	}
+}
@@ -0,0 +1,74 @@
+package jobs
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"pistachio/internal/storage"
+)
+
+// streamStore returns files as S3 does: a stream that can't seek, with
+// the size the backend reported.
+type streamStore struct {
+	storage.Storage
+}
+
+type streamedFile struct {
+	io.ReadCloser
+	size int64
+}
+
+func (f streamedFile) Size() int64 { return f.size }
+
+func (s streamStore) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	data, err := readStoredFile(ctx, s.Storage, key)
+	if err != nil {
+		return nil, err
+	}
+	return streamedFile{io.NopCloser(strings.NewReader(string(data))), int64(len(data))}, nil
+}
+
+func TestServeStreamedFile(t *testing.T) {
+	store := streamStore{storage.NewLocal(t.TempDir(), nil)}
+	content := strings.Repeat("%PDF-1.4 ", 1000)
+
+	if err := store.Put(context.Background(), "invoices/a.pdf", strings.NewReader(content), "application/pdf"); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, method := range []string{http.MethodGet, http.MethodHead} {
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest(method, "/invoices/a/pdf", nil)
+		req.Header.Set("Range", "bytes=0-9")
+		serveStoredFile(rec, req, store, "invoices/a.pdf", "INV-0001.pdf", "application/pdf")
+
+		// No ranges without seeking; the whole file instead
+		if rec.Code != http.StatusOK {
+			t.Errorf("%s: got status %d, want 200", method, rec.Code)
+		}
+		if got := rec.Header().Get("Content-Length"); got != "9000" {
+			t.Errorf("%s: got Content-Length %q, want 9000", method, got)
+		}
+		if got := rec.Header().Get("Accept-Ranges"); got != "none" {
+			t.Errorf("%s: got Accept-Ranges %q, want none", method, got)
+		}
+
+		want := content
+		if method == http.MethodHead {
+			want = ""
+		}
+		if rec.Body.String() != want {
+			t.Errorf("%s: got a %d byte body, want %d", method, rec.Body.Len(), len(want))
+		}
+	}
+
+	rec := httptest.NewRecorder()
+	serveStoredFile(rec, httptest.NewRequest(http.MethodGet, "/invoices/b/pdf", nil), store, "invoices/b.pdf", "INV-0002.pdf", "application/pdf")
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("missing file: got status %d, want 404", rec.Code)
+	}
+}
@@ -0,0 +1,124 @@
+package jobs
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"pistachio/internal/einvoice"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// InvoiceXMLHandler exports an invoice as a Peppol BIS Billing 3.0 UBL
+// document. The invoice is checked against the Peppol rules first; if it
+// breaks any, they are returned as JSON with 422 instead of sending an
+// e-invoice the buyer's access point would reject.
+func InvoiceXMLHandler(db *pgxpool.Pool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		invoiceID, err := uuid.Parse(chi.URLParam(r, "id"))
+		if err != nil {
+			http.Error(w, "invalid invoice id", http.StatusBadRequest)
+			return
+		}
+
+		ctx := context.Background()
+
+		data, err := loadInvoiceData(ctx, db, invoiceID)
+
+		if errors.Is(err, pgx.ErrNoRows) {
+			http.Error(w, "invoice not found", http.StatusNotFound)
+			return
+		}
+
+		if err != nil {
+			http.Error(w, "failed to load invoice: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		inv := einvoice.BuildUBL(data)
+
+		if violations := einvoice.Validate(inv); len(violations) > 0 {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusUnprocessableEntity)
+			json.NewEncoder(w).Encode(map[string]any{
+				"error":      "invoice does not meet Peppol BIS Billing 3.0",
+				"violations": violations,
+			})
+			return
+		}
+
+		out, err := einvoice.Marshal(inv)
+		if err != nil {
+			http.Error(w, "failed to encode invoice: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/xml")
+		w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s.xml"`, data.InvoiceNumber))
+		w.Write(out)
+	}
+}
+
+type CustomerEInvoicingRequest struct {
+	FacturX bool `json:"facturx"`
+}
+
+// SetCustomerEInvoicingHandler turns Factur-X invoice PDFs on or off for
+// a customer. It applies to invoice PDFs rendered from then on.
+func SetCustomerEInvoicingHandler(db *pgxpool.Pool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		customerID, err := uuid.Parse(chi.URLParam(r, "id"))
+		if err != nil {
+			http.Error(w, "invalid customer id", http.StatusBadRequest)
+			return
+		}
+
+		var req CustomerEInvoicingRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "invalid JSON", http.StatusBadRequest)
+			return
+		}
+
+		ctx := context.Background()
+
+		result, err := db.Exec(ctx,
+			`UPDATE customers SET facturx = $1 WHERE id = $2`,
+			req.FacturX,
+			customerID,
+		)
+
+		if err != nil {
+			http.Error(w, "failed to update customer: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		if result.RowsAffected() == 0 {
+			http.Error(w, "customer not found", http.StatusNotFound)
+			return
+		}
+
+		json.NewEncoder(w).Encode(map[string]any{
+			"customer_id": customerID,
+			"facturx":     req.FacturX,
+		})
+	}
+}
+
+// wantsFacturX reports whether the invoice's customer receives Factur-X
+// PDFs. Invoices without a linked customer get plain PDFs.
+func wantsFacturX(ctx context.Context, db *pgxpool.Pool, invoiceID uuid.UUID) (bool, error) {
+	var facturX bool
+	err := db.QueryRow(ctx,
+		`SELECT COALESCE(c.facturx, FALSE)
+         FROM invoices i LEFT JOIN customers c ON c.id = i.customer_id
+         WHERE i.id = $1`,
+		invoiceID,
+	).Scan(&facturX)
+	return facturX, err
+}
@@ -0,0 +1,440 @@
+package jobs
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/mail"
+	"strings"
+	"time"
+
+	"pistachio/internal/invoices"
+	"pistachio/internal/mailer"
+	"pistachio/internal/models"
+	"pistachio/internal/queue"
+	"pistachio/internal/storage"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+type SendDocumentRequest struct {
+	To      string   `json:"to"` // default: the customer's email
+	Cc      []string `json:"cc"`
+	Bcc     []string `json:"bcc"`
+	Message string   `json:"message"` // optional note added to the email body
+}
+
+type DocumentEmail struct {
+	ID        uuid.UUID `json:"id"`
+	Template  string    `json:"template"`
+	To        string    `json:"to"`
+	Cc        []string  `json:"cc"`
+	Bcc       []string  `json:"bcc"`
+	Subject   string    `json:"subject"`
+	Status    string    `json:"status"`
+	Attempts  int       `json:"attempts"`
+	LastError string    `json:"last_error"`
+	CreatedAt string    `json:"created_at"`
+	SentAt    string    `json:"sent_at,omitempty"`
+}
+
+// Email delivery statuses
+const (
+	EmailQueued    = "queued"
+	EmailSent      = "sent"
+	EmailFailed    = "failed"
+	EmailCancelled = "cancelled" // e.g. a reminder for an invoice paid before it went out
+)
+
+// emailDocument says which table and document_emails column a sendable
+// document lives in.
+type emailDocument struct {
+	Kind   string // invoice / quote, also the default email template
+	Table  string
+	Column string
+}
+
+var (
+	invoiceEmailDocument = emailDocument{Kind: "invoice", Table: "invoices", Column: "invoice_id"}
+	quoteEmailDocument   = emailDocument{Kind: "quote", Table: "quotes", Column: "quote_id"}
+)
+
+const documentEmailColumns = `id, template, to_address, cc, bcc, COALESCE(subject, ''), status, attempts,
+    COALESCE(last_error, ''), created_at, sent_at`
+
+func scanDocumentEmail(row pgx.Row) (DocumentEmail, error) {
+	var e DocumentEmail
+	var createdAt time.Time
+	var sentAt *time.Time
+
+	err := row.Scan(&e.ID, &e.Template, &e.To, &e.Cc, &e.Bcc, &e.Subject, &e.Status, &e.Attempts,
+		&e.LastError, &createdAt, &sentAt)
+
+	e.CreatedAt = createdAt.Format(time.RFC3339)
+	if sentAt != nil {
+		e.SentAt = sentAt.Format(time.RFC3339)
+	}
+
+	return e, err
+}
+
+// validateRecipients checks every address parses, so bad input is
+// rejected up front rather than failing in the background.
+func validateRecipients(lists ...[]string) error {
+	for _, list := range lists {
+		for _, addr := range list {
+			if _, err := mail.ParseAddress(addr); err != nil {
+				return fmt.Errorf("invalid email address %q", addr)
+			}
+		}
+	}
+	return nil
+}
+
+// queueDocumentEmail records an email in the send history and queues it
+// for delivery, as part of the caller's transaction.
+func queueDocumentEmail(ctx context.Context, tx pgx.Tx, doc emailDocument, docID uuid.UUID, template string, to string, req SendDocumentRequest) (DocumentEmail, error) {
+	if req.Cc == nil {
+		req.Cc = []string{}
+	}
+	if req.Bcc == nil {
+		req.Bcc = []string{}
+	}
+
+	email, err := scanDocumentEmail(tx.QueryRow(ctx,
+		`INSERT INTO document_emails (id, `+doc.Column+`, template, to_address, cc, bcc, message, status, created_at)
+         VALUES ($1, $2, $3, $4, $5, $6, $7, $8, NOW())
+         RETURNING `+documentEmailColumns,
+		uuid.New(),
+		docID,
+		template,
+		to,
+		req.Cc,
+		req.Bcc,
+		req.Message,
+		EmailQueued,
+	))
+	if err != nil {
+		return email, fmt.Errorf("failed to record email: %w", err)
+	}
+
+	_, err = tx.Exec(ctx, `UPDATE `+doc.Table+` SET email_status = $1 WHERE id = $2`, EmailQueued, docID)
+	if err != nil {
+		return email, fmt.Errorf("failed to update email status: %w", err)
+	}
+
+	if _, err := queue.Enqueue(ctx, tx, TaskSendEmail, documentTask{ID: email.ID}); err != nil {
+		return email, err
+	}
+
+	return email, nil
+}
+
+func SendInvoiceHandler(db *pgxpool.Pool) http.HandlerFunc {
+	return sendDocumentHandler(db, invoiceEmailDocument)
+}
+
+func SendQuoteHandler(db *pgxpool.Pool) http.HandlerFunc {
+	return sendDocumentHandler(db, quoteEmailDocument)
+}
+
+// sendDocumentHandler emails a document to its customer with the PDF
+// attached. Delivery happens in the background; the response is the
+// queued entry in the send history.
+func sendDocumentHandler(db *pgxpool.Pool, doc emailDocument) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		docID, err := uuid.Parse(chi.URLParam(r, "id"))
+		if err != nil {
+			http.Error(w, "invalid "+doc.Kind+" id", http.StatusBadRequest)
+			return
+		}
+
+		var req SendDocumentRequest
+		if r.ContentLength != 0 {
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				http.Error(w, "invalid JSON", http.StatusBadRequest)
+				return
+			}
+		}
+
+		ctx := context.Background()
+
+		// 1️⃣ Work out who it goes to
+		var customerEmail string
+		err = db.QueryRow(ctx,
+			`SELECT COALESCE(customer_email, '') FROM `+doc.Table+` WHERE id = $1`,
+			docID,
+		).Scan(&customerEmail)
+
+		if errors.Is(err, pgx.ErrNoRows) {
+			http.Error(w, doc.Kind+" not found", http.StatusNotFound)
+			return
+		}
+
+		if err != nil {
+			http.Error(w, "failed to load "+doc.Kind+": "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		to := strings.TrimSpace(req.To)
+		if to == "" {
+			to = customerEmail
+		}
+
+		if to == "" {
+			http.Error(w, doc.Kind+" has no customer_email; pass \"to\"", http.StatusBadRequest)
+			return
+		}
+
+		if err := validateRecipients([]string{to}, req.Cc, req.Bcc); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		// 2️⃣ Queue it
+		tx, err := db.Begin(ctx)
+		if err != nil {
+			http.Error(w, "failed to start transaction: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		defer tx.Rollback(ctx)
+
+		email, err := queueDocumentEmail(ctx, tx, doc, docID, doc.Kind, to, req)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		if err := tx.Commit(ctx); err != nil {
+			http.Error(w, "failed to commit: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.WriteHeader(http.StatusAccepted)
+		json.NewEncoder(w).Encode(email)
+	}
+}
+
+func ListInvoiceEmailsHandler(db *pgxpool.Pool) http.HandlerFunc {
+	return listDocumentEmailsHandler(db, invoiceEmailDocument)
+}
+
+func ListQuoteEmailsHandler(db *pgxpool.Pool) http.HandlerFunc {
+	return listDocumentEmailsHandler(db, quoteEmailDocument)
+}
+
+// listDocumentEmailsHandler returns a document's send history, newest
+// first.
+func listDocumentEmailsHandler(db *pgxpool.Pool, doc emailDocument) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		docID, err := uuid.Parse(chi.URLParam(r, "id"))
+		if err != nil {
+			http.Error(w, "invalid "+doc.Kind+" id", http.StatusBadRequest)
+			return
+		}
+
+		ctx := context.Background()
+
+		rows, err := db.Query(ctx,
+			`SELECT `+documentEmailColumns+` FROM document_emails
+             WHERE `+doc.Column+` = $1
+             ORDER BY created_at DESC`,
+			docID,
+		)
+		if err != nil {
+			http.Error(w, "failed to query emails: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		defer rows.Close()
+
+		emails := []DocumentEmail{}
+		for rows.Next() {
+			e, err := scanDocumentEmail(rows)
+			if err != nil {
+				http.Error(w, "scan error: "+err.Error(), http.StatusInternalServerError)
+				return
+			}
+			emails = append(emails, e)
+		}
+
+		json.NewEncoder(w).Encode(emails)
+	}
+}
+
+// documentEmailData is what the email templates can refer to.
+type documentEmailData struct {
+	CustomerName   string
+	BusinessName   string
+	DocumentNumber string
+	Total          string
+	DueDate        string
+	DaysOverdue    int    // negative: days until due
+	Balance        string // invoices: amount still owed
+	Message        string
+	Link           string
+}
+
+// sendDocumentEmail delivers one queued email. A document whose PDF is
+// still rendering is retried later by the queue.
+func sendDocumentEmail(ctx context.Context, db *pgxpool.Pool, m *mailer.Mailer, store storage.Storage, publicBaseURL string, payload json.RawMessage) error {
+	task, err := decodeDocumentTask(payload)
+	if err != nil {
+		return err
+	}
+
+	// 1️⃣ Load the email
+	var invoiceID, quoteID *uuid.UUID
+	var template, to, message, status string
+	var cc, bcc []string
+
+	err = db.QueryRow(ctx,
+		`SELECT invoice_id, quote_id, template, to_address, cc, bcc, COALESCE(message, ''), status
+         FROM document_emails WHERE id = $1`,
+		task.ID,
+	).Scan(&invoiceID, &quoteID, &template, &to, &cc, &bcc, &message, &status)
+
+	if errors.Is(err, pgx.ErrNoRows) {
+		return queue.Permanent(fmt.Errorf("email %s not found", task.ID))
+	}
+	if err != nil {
+		return fmt.Errorf("failed to load email: %w", err)
+	}
+
+	if status == EmailSent || status == EmailCancelled {
+		return nil
+	}
+
+	// 2️⃣ Load the document and its PDF
+	doc := invoiceEmailDocument
+	docID := invoiceID
+
+	var balance float64
+	if invoiceID != nil {
+		var invoiceStatus string
+		err := db.QueryRow(ctx,
+			`SELECT status, `+invoiceBalanceSQL+` FROM invoices WHERE id = $1`,
+			invoiceID,
+		).Scan(&invoiceStatus, &balance)
+		if err != nil {
+			return fmt.Errorf("failed to load invoice status: %w", err)
+		}
+
+		// Reminders stop once the invoice is settled, even if already queued
+		if template == reminderTemplate && invoiceStatus != InvoiceIssued && invoiceStatus != InvoiceOverdue {
+			return recordEmailResult(ctx, db, doc, *docID, task.ID, "", EmailCancelled, "invoice was "+invoiceStatus+" before the reminder was sent")
+		}
+	}
+
+	var data models.InvoiceData
+	var pdfStatus, pdfKey, link string
+
+	if quoteID != nil {
+		doc = quoteEmailDocument
+		docID = quoteID
+		data, err = loadQuoteData(ctx, db, *quoteID, publicBaseURL)
+	} else {
+		data, err = loadInvoiceData(ctx, db, *invoiceID)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to load %s: %w", doc.Kind, err)
+	}
+
+	err = db.QueryRow(ctx,
+		`SELECT pdf_status, COALESCE(pdf_key, '') FROM `+doc.Table+` WHERE id = $1`,
+		docID,
+	).Scan(&pdfStatus, &pdfKey)
+	if err != nil {
+		return fmt.Errorf("failed to load %s PDF: %w", doc.Kind, err)
+	}
+
+	if quoteID != nil {
+		var token string
+		if err := db.QueryRow(ctx, `SELECT public_token FROM quotes WHERE id = $1`, quoteID).Scan(&token); err != nil {
+			return fmt.Errorf("failed to load quote link: %w", err)
+		}
+		link = publicBaseURL + quotePublicPath(token)
+	}
+
+	if pdfStatus != PDFReady || pdfKey == "" {
+		return fmt.Errorf("%s PDF is not ready yet", doc.Kind)
+	}
+
+	pdf, err := readStoredFile(ctx, store, pdfKey)
+	if err != nil {
+		return fmt.Errorf("failed to read PDF: %w", err)
+	}
+
+	// 3️⃣ Render and send
+	msg, err := mailer.Render(template, documentEmailData{
+		CustomerName:   data.Customer.Name,
+		BusinessName:   data.Business.Name,
+		DocumentNumber: data.InvoiceNumber,
+		Total:          invoices.FormatMoney(data.Totals.TotalAmount, data.CurrencyCode()),
+		DueDate:        data.DueDate.Format("2 January 2006"),
+		DaysOverdue:    daysBetween(data.DueDate, time.Now()),
+		Balance:        invoices.FormatMoney(balance, data.CurrencyCode()),
+		Message:        message,
+		Link:           link,
+	})
+	if err != nil {
+		return queue.Permanent(err)
+	}
+
+	msg.To = []string{to}
+	msg.Cc = cc
+	msg.Bcc = bcc
+	msg.Attachments = []mailer.Attachment{{
+		Filename:    data.InvoiceNumber + ".pdf",
+		ContentType: "application/pdf",
+		Data:        pdf,
+	}}
+
+	sendErr := m.Send(msg)
+
+	// 4️⃣ Record the outcome on the email and the document
+	status, lastError := EmailSent, ""
+	if sendErr != nil {
+		status, lastError = EmailFailed, sendErr.Error()
+	}
+
+	if err := recordEmailResult(ctx, db, doc, *docID, task.ID, msg.Subject, status, lastError); err != nil {
+		return err
+	}
+
+	return sendErr
+}
+
+func recordEmailResult(ctx context.Context, db *pgxpool.Pool, doc emailDocument, docID, emailID uuid.UUID, subject, status, lastError string) error {
+	_, err := db.Exec(ctx,
+		`UPDATE document_emails
+         SET status = $1, subject = COALESCE(NULLIF($2, ''), subject), last_error = NULLIF($3, ''), attempts = attempts + 1,
+             sent_at = CASE WHEN $1 = 'sent' THEN NOW() END
+         WHERE id = $4`,
+		status,
+		subject,
+		lastError,
+		emailID,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to record email result: %w", err)
+	}
+
+	_, err = db.Exec(ctx,
+		`UPDATE `+doc.Table+`
+         SET email_status = $1,
+             last_emailed_at = CASE WHEN $1 = 'sent' THEN NOW() ELSE last_emailed_at END
+         WHERE id = $2`,
+		status,
+		docID,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to update email status: %w", err)
+	}
+
+	return nil
+}
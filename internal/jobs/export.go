@@ -0,0 +1,326 @@
+package jobs
+
+import (
+	"archive/zip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html/template"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"path"
+	"strings"
+	"time"
+
+	"pistachio/internal/links"
+	"pistachio/internal/storage"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// JobExport is the summary in a job's export: the job detail, its
+// invoices, and where each file is in the archive.
+type JobExport struct {
+	JobDetailResponse
+	Invoices   []InvoiceSummary `json:"invoices"`
+	Files      []ExportedFile   `json:"files"`
+	ExportedAt string           `json:"exported_at"`
+}
+
+type ExportedFile struct {
+	Kind    string    `json:"kind"` // photo / attachment / invoice
+	ID      uuid.UUID `json:"id"`
+	Path    string    `json:"path"`              // in the archive
+	Missing bool      `json:"missing,omitempty"` // not found in storage, so left out
+}
+
+// exportFile is a file to copy into an export from storage.
+type exportFile struct {
+	ExportedFile
+	key string
+}
+
+// JobExportHandler streams a ZIP of everything about a job: its photos,
+// attachments and invoice PDFs, then a summary as JSON and as an HTML
+// page showing the files. Files are copied from storage one at a time,
+// so the archive is never held in memory.
+func JobExportHandler(db *pgxpool.Pool, store storage.Storage, signer *links.Signer) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		jobID, err := uuid.Parse(chi.URLParam(r, "id"))
+		if err != nil {
+			http.Error(w, "invalid job id", http.StatusBadRequest)
+			return
+		}
+
+		ctx := context.Background()
+
+		// 1️⃣ Load everything before sending anything, so errors still get
+		// a status
+		detail, err := loadJobDetail(ctx, db, signer, jobID)
+		if errors.Is(err, pgx.ErrNoRows) {
+			http.Error(w, "job not found", http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		invoices, err := listJobInvoices(ctx, db, signer, jobID)
+		if err != nil {
+			http.Error(w, "failed to fetch invoices: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		files, err := listExportFiles(ctx, db, jobID)
+		if err != nil {
+			http.Error(w, "failed to fetch files: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		// 2️⃣ Stream the files. A failure from here on can only cut the
+		// archive short, which unzipping it reports.
+		filename := "job-" + strings.ToUpper(jobID.String()[:8]) + ".zip"
+		w.Header().Set("Content-Type", "application/zip")
+		w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": filename}))
+		w.Header().Set("Cache-Control", "private, no-store")
+
+		now := time.Now()
+		export := JobExport{
+			JobDetailResponse: detail,
+			Invoices:          invoices,
+			Files:             []ExportedFile{},
+			ExportedAt:        now.Format(time.RFC3339),
+		}
+
+		zw := zip.NewWriter(w)
+
+		for _, f := range files {
+			found, err := copyToZip(ctx, zw, store, f.key, f.Path, now)
+			if err != nil {
+				log.Printf("job %s export: %v", jobID, err)
+				return
+			}
+			f.Missing = !found
+			export.Files = append(export.Files, f.ExportedFile)
+		}
+
+		// 3️⃣ The summary goes last, so it can say which files were missing
+		if err := writeExportSummary(zw, export, now); err != nil {
+			log.Printf("job %s export: %v", jobID, err)
+			return
+		}
+
+		if err := zw.Close(); err != nil {
+			log.Printf("job %s export: %v", jobID, err)
+		}
+	}
+}
+
+func listJobInvoices(ctx context.Context, db *pgxpool.Pool, signer *links.Signer, jobID uuid.UUID) ([]InvoiceSummary, error) {
+	rows, err := db.Query(ctx,
+		`SELECT `+invoiceSummaryColumns+` FROM invoices WHERE job_id = $1 ORDER BY created_at`,
+		jobID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	invoices := []InvoiceSummary{}
+	for rows.Next() {
+		inv, err := scanInvoiceSummary(rows, signer)
+		if err != nil {
+			return nil, err
+		}
+		invoices = append(invoices, inv)
+	}
+
+	return invoices, rows.Err()
+}
+
+// exportQueries list each kind of file in an export, in order, as id,
+// name and storage key.
+var exportQueries = []struct {
+	kind string
+	sql  string
+	path func(n int, id uuid.UUID, name, key string) string
+}{
+	{
+		kind: "photo",
+		sql:  `SELECT id, COALESCE(category, 'photo'), file_key FROM job_photos WHERE job_id = $1 ORDER BY ` + photoOrder,
+		path: func(n int, id uuid.UUID, category, key string) string {
+			return fmt.Sprintf("photos/%02d-%s-%s%s", n, category, id.String()[:8], path.Ext(key))
+		},
+	},
+	{
+		kind: "attachment",
+		sql:  `SELECT id, file_name, file_key FROM job_attachments WHERE job_id = $1 ORDER BY created_at`,
+		path: func(n int, id uuid.UUID, fileName, key string) string {
+			return fmt.Sprintf("attachments/%02d-%s", n, fileName)
+		},
+	},
+	{
+		kind: "invoice",
+		sql: `SELECT id, ` + invoicePDF.Number + `, pdf_key FROM invoices
+              WHERE job_id = $1 AND pdf_status = '` + PDFReady + `' AND pdf_key <> ''
+              ORDER BY created_at`,
+		path: func(n int, id uuid.UUID, number, key string) string {
+			return "invoices/" + strings.ReplaceAll(number, "/", "-") + ".pdf"
+		},
+	},
+}
+
+func listExportFiles(ctx context.Context, db *pgxpool.Pool, jobID uuid.UUID) ([]exportFile, error) {
+	var files []exportFile
+
+	for _, q := range exportQueries {
+		rows, err := db.Query(ctx, q.sql, jobID)
+		if err != nil {
+			return nil, err
+		}
+
+		for n := 1; rows.Next(); n++ {
+			f := exportFile{ExportedFile: ExportedFile{Kind: q.kind}}
+			var name string
+			if err := rows.Scan(&f.ID, &name, &f.key); err != nil {
+				rows.Close()
+				return nil, err
+			}
+			f.Path = q.path(n, f.ID, name, f.key)
+			files = append(files, f)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return nil, err
+		}
+	}
+
+	return files, nil
+}
+
+// copyToZip copies a stored file into the archive. It adds nothing and
+// returns false if the file is missing.
+func copyToZip(ctx context.Context, zw *zip.Writer, store storage.Storage, key, name string, modified time.Time) (bool, error) {
+	r, err := store.Get(ctx, key)
+	if errors.Is(err, storage.ErrNotFound) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to read %s: %w", key, err)
+	}
+	defer r.Close()
+
+	// Photos and PDFs are compressed already
+	fw, err := zw.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Store, Modified: modified})
+	if err != nil {
+		return false, err
+	}
+
+	if _, err := io.Copy(fw, r); err != nil {
+		return false, fmt.Errorf("failed to copy %s: %w", key, err)
+	}
+	return true, nil
+}
+
+func writeExportSummary(zw *zip.Writer, export JobExport, modified time.Time) error {
+	fw, err := zw.CreateHeader(&zip.FileHeader{Name: "summary.json", Method: zip.Deflate, Modified: modified})
+	if err != nil {
+		return err
+	}
+
+	enc := json.NewEncoder(fw)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(export); err != nil {
+		return fmt.Errorf("failed to write summary.json: %w", err)
+	}
+
+	fw, err = zw.CreateHeader(&zip.FileHeader{Name: "summary.html", Method: zip.Deflate, Modified: modified})
+	if err != nil {
+		return err
+	}
+
+	page := exportPage{JobExport: export, Paths: map[uuid.UUID]string{}}
+	for _, f := range export.Files {
+		if !f.Missing {
+			page.Paths[f.ID] = f.Path
+		}
+	}
+
+	if err := exportSummaryTemplate.Execute(fw, page); err != nil {
+		return fmt.Errorf("failed to write summary.html: %w", err)
+	}
+	return nil
+}
+
+// exportPage is what summary.html is rendered from. Paths has the
+// archive path of each file that is in the archive, by ID.
+type exportPage struct {
+	JobExport
+	Paths map[uuid.UUID]string
+}
+
+var exportSummaryTemplate = template.Must(template.New("summary.html").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>{{.Job.Title}}</title>
+<style>
+  body { font-family: sans-serif; margin: 2em; color: #222; }
+  table { border-collapse: collapse; margin-bottom: 1.5em; }
+  th, td { text-align: left; padding: 4px 12px 4px 0; vertical-align: top; }
+  figure { display: inline-block; width: 320px; margin: 0 12px 12px 0; vertical-align: top; }
+  figure img { max-width: 320px; max-height: 320px; }
+  .missing { color: #a00; }
+</style>
+</head>
+<body>
+<h1>{{.Job.Title}}</h1>
+<p>{{.Job.Description}}</p>
+<table>
+  <tr><th>Status</th><td>{{.Job.Status}}</td></tr>
+  <tr><th>Created</th><td>{{.Job.CreatedAt}}</td></tr>
+  <tr><th>Customer</th><td>{{.Customer.Name}}<br>{{.Customer.Address}}<br>{{.Customer.Email}} {{.Customer.Phone}}</td></tr>
+  <tr><th>Exported</th><td>{{.ExportedAt}}</td></tr>
+</table>
+
+<h2>Status history</h2>
+{{if .StatusHistory}}<table>
+  <tr><th>Changed</th><th>From</th><th>To</th></tr>
+  {{range .StatusHistory}}<tr><td>{{.ChangedAt}}</td><td>{{.FromStatus}}</td><td>{{.Status}}</td></tr>
+  {{end}}
+</table>{{else}}<p>No changes since the job was created.</p>{{end}}
+
+<h2>Notes</h2>
+{{range .Notes}}<p><strong>{{.CreatedAt}}</strong><br>{{.Text}}</p>
+{{else}}<p>No notes.</p>{{end}}
+
+<h2>Photos</h2>
+{{range .Photos}}<figure>
+  {{with index $.Paths .ID}}<a href="{{.}}"><img src="{{.}}" alt=""></a>{{else}}<p class="missing">File missing</p>{{end}}
+  <figcaption>{{if .Category}}<strong>{{.Category}}</strong> {{end}}{{.Caption}}{{if .TakenAt}}<br>Taken {{.TakenAt}}{{end}}</figcaption>
+</figure>
+{{else}}<p>No photos.</p>{{end}}
+
+<h2>Attachments</h2>
+{{range $a := .Attachments}}<p>{{with index $.Paths $a.ID}}<a href="{{.}}">{{$a.FileName}}</a>{{else}}<span class="missing">{{$a.FileName}} (file missing)</span>{{end}}</p>
+{{else}}<p>No attachments.</p>{{end}}
+
+<h2>Invoices</h2>
+{{if .Invoices}}<table>
+  <tr><th>Invoice</th><th>Issued</th><th>Status</th><th>Total</th><th>Balance</th></tr>
+  {{range .Invoices}}<tr>
+    <td>{{$path := index $.Paths .ID}}{{if $path}}<a href="{{$path}}">{{.InvoiceNumber}}</a>{{else}}{{.InvoiceNumber}}{{end}}</td>
+    <td>{{.IssueDate}}</td><td>{{.Status}}</td><td>{{printf "%.2f" .Total}}</td><td>{{printf "%.2f" .Balance}}</td>
+  </tr>
+  {{end}}
+</table>{{else}}<p>No invoices.</p>{{end}}
+</body>
+</html>
+`))
@@ -0,0 +1,223 @@
+package jobs
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"pistachio/internal/models"
+	"pistachio/internal/storage"
+
+	"github.com/google/uuid"
+)
+
+// readZip returns the files in an archive by name, and their
+// compression methods.
+func readZip(t *testing.T, data []byte) (map[string][]byte, map[string]uint16) {
+	t.Helper()
+
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatalf("not a ZIP: %v", err)
+	}
+
+	files := map[string][]byte{}
+	methods := map[string]uint16{}
+	for _, f := range zr.File {
+		r, err := f.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		files[f.Name], err = io.ReadAll(r)
+		r.Close()
+		if err != nil {
+			t.Fatalf("%s: %v", f.Name, err)
+		}
+		methods[f.Name] = f.Method
+	}
+	return files, methods
+}
+
+// TestExportSummary writes an archive from a store with one of two files
+// missing, without a database.
+func TestExportSummary(t *testing.T) {
+	ctx := context.Background()
+	store := storage.NewLocal(t.TempDir(), nil)
+	now := time.Date(2026, 10, 19, 9, 0, 0, 0, time.UTC)
+
+	if err := store.Put(ctx, "photos/a.jpg", strings.NewReader("jpeg"), "image/jpeg"); err != nil {
+		t.Fatal(err)
+	}
+
+	photo := JobPhoto{ID: uuid.New(), Category: PhotoBefore, Caption: "Leaking <valve>"}
+	attachment := JobAttachment{ID: uuid.New(), FileName: "certificate.pdf"}
+
+	export := JobExport{
+		JobDetailResponse: JobDetailResponse{
+			Job:           JobDetail{Title: `Boiler <script>alert(1)</script>`, Status: "completed"},
+			Customer:      CustomerInfo{Name: "Ada Customer"},
+			StatusHistory: []JobStatusChange{{FromStatus: "new", Status: "completed", ChangedAt: now.Format(time.RFC3339)}},
+			Photos:        []JobPhoto{photo},
+			Attachments:   []JobAttachment{attachment},
+		},
+		Invoices:   []InvoiceSummary{},
+		ExportedAt: now.Format(time.RFC3339),
+	}
+
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+
+	for _, f := range []exportFile{
+		{ExportedFile{Kind: "photo", ID: photo.ID, Path: "photos/01-before-a.jpg"}, "photos/a.jpg"},
+		{ExportedFile{Kind: "attachment", ID: attachment.ID, Path: "attachments/01-certificate.pdf"}, "attachments/gone.pdf"},
+	} {
+		found, err := copyToZip(ctx, zw, store, f.key, f.Path, now)
+		if err != nil {
+			t.Fatal(err)
+		}
+		f.Missing = !found
+		export.Files = append(export.Files, f.ExportedFile)
+	}
+
+	if err := writeExportSummary(zw, export, now); err != nil {
+		t.Fatal(err)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	files, methods := readZip(t, buf.Bytes())
+
+	if string(files["photos/01-before-a.jpg"]) != "jpeg" || methods["photos/01-before-a.jpg"] != zip.Store {
+		t.Error("photo isn't in the archive as stored")
+	}
+	if _, ok := files["attachments/01-certificate.pdf"]; ok {
+		t.Error("missing attachment has an entry")
+	}
+
+	var summary JobExport
+	if err := json.Unmarshal(files["summary.json"], &summary); err != nil {
+		t.Fatalf("summary.json: %v", err)
+	}
+	if len(summary.Files) != 2 || summary.Files[0].Missing || !summary.Files[1].Missing {
+		t.Errorf("got files %+v, want the attachment marked missing", summary.Files)
+	}
+	if summary.Job.Title != export.Job.Title || len(summary.StatusHistory) != 1 {
+		t.Errorf("summary.json doesn't have the job and its history")
+	}
+
+	html := string(files["summary.html"])
+	for _, want := range []string{
+		`<img src="photos/01-before-a.jpg"`,
+		`certificate.pdf (file missing)`,
+		`Leaking &lt;valve&gt;`,
+		`&lt;script&gt;`,
+		`<td>new</td><td>completed</td>`,
+	} {
+		if !strings.Contains(html, want) {
+			t.Errorf("summary.html doesn't contain %s", want)
+		}
+	}
+	if strings.Contains(html, "<script>") {
+		t.Error("summary.html doesn't escape the job title")
+	}
+}
+
+func TestJobExport(t *testing.T) {
+	p := newPhotoTest(t)
+	p.router.Get("/jobs/{id}/export.zip", JobExportHandler(p.db, p.store, p.signer))
+	ctx := context.Background()
+
+	jobID := seedJob(t, p.db)
+	_, err := p.db.Exec(ctx, `UPDATE jobs SET description = 'Annual service', estimate = 90 WHERE id = $1`, jobID)
+	if err == nil {
+		_, err = p.db.Exec(ctx, `UPDATE customers SET phone = '0117 496 0000' WHERE id = (SELECT customer_id FROM jobs WHERE id = $1)`, jobID)
+	}
+	if err == nil {
+		_, err = p.db.Exec(ctx, `INSERT INTO job_notes (id, job_id, text) VALUES ($1, $2, 'Customer away until 2pm')`, uuid.New(), jobID)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := setJobStatus(ctx, p.db, jobID, "completed"); err != nil {
+		t.Fatal(err)
+	}
+
+	before := p.mustUpload(jobID, testJPEG(t, 40, 30), map[string]string{"category": PhotoBefore})
+	gone := p.mustUpload(jobID, testJPEG(t, 50, 30), nil)
+	var goneKey string
+	p.db.QueryRow(ctx, `SELECT file_key FROM job_photos WHERE id = $1`, gone.ID).Scan(&goneKey)
+	if err := p.store.Delete(ctx, goneKey); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := saveAttachment(ctx, p.db, p.store, p.signer, jobID, "gas-safe.pdf", testPDF); err != nil {
+		t.Fatal(err)
+	}
+
+	inv, err := issueInvoice(ctx, p.db, invoiceInput{
+		CustomerName: "Ada Customer",
+		JobID:        &jobID,
+		Items:        []models.InvoiceItem{{Description: "Annual service", Quantity: 1, UnitPrice: 90}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	payload, _ := json.Marshal(documentTask{ID: uuid.MustParse(inv.InvoiceID)})
+	if err := renderInvoicePDF(ctx, p.db, p.store, payload); err != nil {
+		t.Fatal(err)
+	}
+
+	rec := serve(p.router, http.MethodGet, "/jobs/"+jobID.String()+"/export.zip", "")
+	if rec.Code != http.StatusOK || rec.Header().Get("Content-Type") != "application/zip" {
+		t.Fatalf("export: %d %s", rec.Code, rec.Body)
+	}
+	if !strings.Contains(rec.Header().Get("Content-Disposition"), "job-"+strings.ToUpper(jobID.String()[:8])+".zip") {
+		t.Errorf("got Content-Disposition %q", rec.Header().Get("Content-Disposition"))
+	}
+
+	files, _ := readZip(t, rec.Body.Bytes())
+
+	var summary JobExport
+	if err := json.Unmarshal(files["summary.json"], &summary); err != nil {
+		t.Fatalf("summary.json: %v", err)
+	}
+
+	paths := map[uuid.UUID]ExportedFile{}
+	for _, f := range summary.Files {
+		paths[f.ID] = f
+		if _, ok := files[f.Path]; ok == f.Missing {
+			t.Errorf("%s: in the archive %v, marked missing %v", f.Path, ok, f.Missing)
+		}
+	}
+	if f := paths[before.ID]; f.Kind != "photo" || !strings.HasPrefix(f.Path, "photos/01-before-") || !strings.HasSuffix(f.Path, ".jpg") {
+		t.Errorf("before photo at %q", f.Path)
+	}
+	if !paths[gone.ID].Missing {
+		t.Error("photo whose file is gone isn't marked missing")
+	}
+	if pdf := files["invoices/"+inv.InvoiceNumber+".pdf"]; !bytes.HasPrefix(pdf, []byte("%PDF-")) {
+		t.Errorf("no PDF for invoice %s", inv.InvoiceNumber)
+	}
+	if !bytes.Equal(files["attachments/01-gas-safe.pdf"], testPDF) {
+		t.Error("attachment isn't in the archive")
+	}
+
+	if len(summary.Notes) != 1 || len(summary.StatusHistory) != 1 || len(summary.Invoices) != 1 || len(summary.Photos) != 2 {
+		t.Errorf("got %d notes, %d status changes, %d invoices and %d photos, want 1, 1, 1 and 2",
+			len(summary.Notes), len(summary.StatusHistory), len(summary.Invoices), len(summary.Photos))
+	}
+	if !strings.Contains(string(files["summary.html"]), "Customer away until 2pm") {
+		t.Error("summary.html has no notes")
+	}
+
+	if rec := serve(p.router, http.MethodGet, "/jobs/"+uuid.NewString()+"/export.zip", ""); rec.Code != http.StatusNotFound {
+		t.Errorf("unknown job: got status %d, want 404", rec.Code)
+	}
+}
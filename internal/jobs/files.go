@@ -0,0 +1,78 @@
+package jobs
+
+import (
+	"context"
+	"io"
+	"mime"
+	"net/http"
+	"path"
+	"strings"
+
+	"pistachio/internal/storage"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// readStoredFile reads a whole file, such as a PDF to attach to an email.
+func readStoredFile(ctx context.Context, store storage.Storage, key string) ([]byte, error) {
+	r, err := store.Get(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	return io.ReadAll(r)
+}
+
+// publicFilePrefixes are the storage key prefixes of files that may be
+// shared through signed links. Original photos, under photos/originals/,
+// still have their GPS data and are deliberately missing; so are upload
+// chunks.
+var publicFilePrefixes = []string{
+	"invoices/",
+	"quotes/",
+	"credit-notes/",
+	"attachments/",
+	"photos/variants/",
+}
+
+// isPublicFile reports whether a stored file may be served through a
+// signed link.
+func isPublicFile(key string) bool {
+	if path.Clean(key) != key {
+		return false
+	}
+
+	// Photos without their location are stored directly under photos/
+	if path.Dir(key) == "photos" {
+		return true
+	}
+
+	for _, prefix := range publicFilePrefixes {
+		if strings.HasPrefix(key, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// StoredFileHandler serves a local storage file by key, for the signed
+// links storage.Local.SignedURL makes. Mount it under storage.FilesPath
+// behind the link signer. Only files isPublicFile allows are served; a
+// valid signature for any other key still gets 404.
+func StoredFileHandler(store storage.Storage) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		key := chi.URLParam(r, "*")
+		if !isPublicFile(key) {
+			http.Error(w, "file not found", http.StatusNotFound)
+			return
+		}
+
+		contentType := mime.TypeByExtension(path.Ext(key))
+		if contentType == "" {
+			contentType = "application/octet-stream"
+		}
+
+		serveStoredFile(w, r, store, key, path.Base(key), contentType)
+	}
+}
@@ -0,0 +1,102 @@
+package jobs
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"pistachio/internal/links"
+	"pistachio/internal/storage"
+
+	"github.com/go-chi/chi/v5"
+)
+
+func TestStoredFileSignedLink(t *testing.T) {
+	signer := links.New(links.Config{Secret: "test", BaseURL: "", TTL: time.Hour})
+	store := storage.NewLocal(t.TempDir(), signer)
+
+	ctx := context.Background()
+	if err := store.Put(ctx, "invoices/a.pdf", strings.NewReader("%PDF-1.4"), "application/pdf"); err != nil {
+		t.Fatal(err)
+	}
+
+	r := chi.NewRouter()
+	r.With(signer.Require).Get(storage.FilesPath+"*", StoredFileHandler(store))
+
+	get := func(target string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		r.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, target, nil))
+		return rec
+	}
+
+	link, err := store.SignedURL(ctx, "invoices/a.pdf", time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rec := get(link)
+	if rec.Code != http.StatusOK || rec.Body.String() != "%PDF-1.4" {
+		t.Fatalf("got %d %q, want the file", rec.Code, rec.Body)
+	}
+	if got := rec.Header().Get("Content-Type"); got != "application/pdf" {
+		t.Errorf("got Content-Type %q", got)
+	}
+
+	if rec := get(storage.FilesPath + "invoices/a.pdf"); rec.Code != http.StatusForbidden {
+		t.Errorf("unsigned: got status %d, want 403", rec.Code)
+	}
+	if rec := get(strings.Replace(link, "a.pdf", "b.pdf", 1)); rec.Code != http.StatusForbidden {
+		t.Errorf("link to another file: got status %d, want 403", rec.Code)
+	}
+
+}
+
+// TestStoredFileNotPublic checks that a valid signature is not enough for
+// files that mustn't be shared, such as photos that still have their GPS
+// data.
+func TestStoredFileNotPublic(t *testing.T) {
+	signer := links.New(links.Config{Secret: "test", BaseURL: "", TTL: time.Hour})
+	store := storage.NewLocal(t.TempDir(), signer)
+
+	ctx := context.Background()
+	for _, key := range []string{
+		"photos/a.jpg",
+		"photos/originals/a.jpg",
+		"photos/variants/a/thumbnail.jpg",
+		"uploads/a/b",
+	} {
+		if err := store.Put(ctx, key, strings.NewReader(key), "application/octet-stream"); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	r := chi.NewRouter()
+	r.With(signer.Require).Get(storage.FilesPath+"*", StoredFileHandler(store))
+
+	tests := []struct {
+		key  string
+		want int
+	}{
+		{"photos/a.jpg", http.StatusOK},
+		{"photos/variants/a/thumbnail.jpg", http.StatusOK},
+		{"photos/originals/a.jpg", http.StatusNotFound},
+		{"uploads/a/b", http.StatusNotFound},
+		{"photos/variants/../originals/a.jpg", http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		rec := httptest.NewRecorder()
+		link := signer.URLFor(storage.FilesPath+tt.key, time.Hour)
+		r.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, link, nil))
+
+		if rec.Code != tt.want {
+			t.Errorf("%s: got status %d, want %d", tt.key, rec.Code, tt.want)
+		}
+		if rec.Code != http.StatusOK && strings.Contains(rec.Body.String(), tt.key) {
+			t.Errorf("%s: served the file", tt.key)
+		}
+	}
+}
@@ -22,6 +22,28 @@ func CreateJobHandler(db *pgxpool.Pool) http.HandlerFunc {
 
 		ctx := context.Background()
 
+		// Fill in anything left blank from the template
+		if req.TemplateID != nil {
+			template, err := loadJobTemplate(ctx, db, *req.TemplateID)
+			if err != nil {
+				http.Error(w, "template not found", http.StatusBadRequest)
+				return
+			}
+
+			if req.Title == "" {
+				req.Title = template.Title
+			}
+			if req.Description == "" {
+				req.Description = template.Description
+			}
+			if req.Estimate == 0 {
+				req.Estimate = template.Estimate
+			}
+			if req.JobType == "" {
+				req.JobType = template.JobType
+			}
+		}
+
 		// 1️⃣ Create customer
 		customerID := uuid.New()
 
@@ -44,13 +66,15 @@ func CreateJobHandler(db *pgxpool.Pool) http.HandlerFunc {
 		jobID := uuid.New()
 
 		_, err = db.Exec(ctx,
-			`INSERT INTO jobs (id, customer_id, title, description, estimate, status, created_at, updated_at)
-             VALUES ($1, $2, $3, $4, $5, 'new', NOW(), NOW())`,
+			`INSERT INTO jobs (id, customer_id, title, description, estimate, job_type, template_id, status, created_at, updated_at)
+             VALUES ($1, $2, $3, $4, $5, NULLIF($6, ''), $7, 'new', NOW(), NOW())`,
 			jobID,
 			customerID,
 			req.Title,
 			req.Description,
 			req.Estimate,
+			req.JobType,
+			req.TemplateID,
 		)
 
 		if err != nil {
@@ -58,6 +82,14 @@ func CreateJobHandler(db *pgxpool.Pool) http.HandlerFunc {
 			return
 		}
 
+		// Copy the template's checklist onto the job
+		if req.TemplateID != nil {
+			if err := copyTemplateChecklist(ctx, db, *req.TemplateID, jobID); err != nil {
+				http.Error(w, "failed to create checklist: "+err.Error(), http.StatusInternalServerError)
+				return
+			}
+		}
+
 		// 3️⃣ Return response
 		resp := CreateJobResponse{
 			JobID:      jobID,
@@ -3,14 +3,21 @@ package jobs
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"math"
 	"net/http"
-	"path/filepath"
-	"pistachio/internal/invoices"
+	"net/url"
+	"os"
+	"pistachio/internal/links"
 	"pistachio/internal/models"
+	"pistachio/internal/queue"
+	"strings"
 	"time"
 
+	"github.com/go-chi/chi/v5"
 	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
 )
 
@@ -20,153 +27,613 @@ type CreateInvoiceRequest struct {
 	CustomerEmail   string                 `json:"customer_email"`
 	CustomerAddress models.CustomerAddress `json:"customer_address"`
 	Items           []models.InvoiceItem   `json:"items"`
+	CustomerID      *uuid.UUID             `json:"customer_id"` // optional: sets payment terms
+	Discount        models.Discount        `json:"discount"`    // optional, whole invoice
+	Surcharges      []models.Surcharge     `json:"surcharges"`  // optional, e.g. call-out fee
 }
 
-func CreateInvoiceHandler(db *pgxpool.Pool) http.HandlerFunc {
-	return func(w http.ResponseWriter, r *http.Request) {
+// invoiceInput is everything needed to issue an invoice, whichever
+// route it came in through. JobID and QuoteID link the invoice back to
+// the job or quote it was raised from. CustomerID defaults to the job's
+// customer. Kind is a standard invoice unless set to deposit.
+type invoiceInput struct {
+	Kind            string
+	CustomerName    string
+	CustomerEmail   string
+	CustomerAddress models.CustomerAddress
+	Items           []models.InvoiceItem
+	Discount        models.Discount
+	Surcharges      []models.Surcharge
+	CustomerID      *uuid.UUID
+	JobID           *uuid.UUID
+	QuoteID         *uuid.UUID
+	Currency        string // default: the billing currency
+}
 
-		var req CreateInvoiceRequest
+func defaultBusinessInfo() models.BusinessInfo {
+	return models.BusinessInfo{
+		Name: "Pistachio Ltd",
+		BusinessAddress: models.BusinessAddress{
+			Line1:   "123 Example Street",
+			City:    "London",
+			Country: "UK",
+		},
+		Email:     "support@pistachio.com",
+		Phone:     "+44 0000 000000",
+		Website:   "https://pistachio.example",
+		VATNumber: os.Getenv("VAT_NUMBER"),
+		LogoPath:  "assets/invoice.png",
+	}
+}
 
-		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-			http.Error(w, "invalid JSON body", http.StatusBadRequest)
-			return
+// defaultPaymentInfo returns the bank details, with the IBAN and BIC from
+// the billing settings and notes stating the invoice's actual terms so
+// they always match its due date.
+func defaultPaymentInfo(settings BillingSettings, issueDate, dueDate time.Time) models.PaymentInfo {
+	return models.PaymentInfo{
+		BankName:      "Barclays",
+		AccountName:   "Pistachio Ltd",
+		SortCode:      "00-00-00",
+		AccountNumber: "00000000",
+		IBAN:          settings.IBAN,
+		BIC:           settings.BIC,
+		Notes:         paymentNotes(issueDate, dueDate),
+	}
+}
+
+// paymentLink fills in the PAYMENT_LINK_URL template for one invoice,
+// e.g. https://pay.example.com/pistachio?ref={reference}&amount={amount}.
+// Without a {reference} placeholder the invoice number is added as the
+// reference query parameter, so payments can be matched to the invoice.
+func paymentLink(reference string, amount float64) string {
+	link := os.Getenv("PAYMENT_LINK_URL")
+	if link == "" {
+		return ""
+	}
+
+	if !strings.Contains(link, "{reference}") {
+		u, err := url.Parse(link)
+		if err != nil {
+			return ""
 		}
+		q := u.Query()
+		q.Set("reference", reference)
+		u.RawQuery = q.Encode()
+		link = u.String()
+	}
 
-		// Validation
-		if req.CustomerName == "" {
-			http.Error(w, "customer_name is required", http.StatusBadRequest)
-			return
+	return strings.NewReplacer(
+		"{reference}", url.QueryEscape(reference),
+		"{amount}", fmt.Sprintf("%.2f", amount),
+	).Replace(link)
+}
+
+func paymentNotes(issueDate, dueDate time.Time) string {
+	days := daysBetween(issueDate, dueDate)
+	if days <= 0 {
+		return "Payment due on receipt."
+	}
+	return fmt.Sprintf("Payment due within %d days, by %s.", days, dueDate.Format("2 January 2006"))
+}
+
+// daysBetween counts calendar days from a to b, ignoring time of day.
+func daysBetween(a, b time.Time) int {
+	a = time.Date(a.Year(), a.Month(), a.Day(), 0, 0, 0, 0, time.UTC)
+	b = time.Date(b.Year(), b.Month(), b.Day(), 0, 0, 0, 0, time.UTC)
+	return int(b.Sub(a).Hours() / 24)
+}
+
+// paymentTermsFor returns the number of days a customer has to pay: their
+// own terms if set, otherwise the business default.
+func paymentTermsFor(ctx context.Context, db pgxQuerier, customerID *uuid.UUID) (int, error) {
+	var days int
+	err := db.QueryRow(ctx,
+		`SELECT COALESCE(
+             (SELECT payment_terms_days FROM customers WHERE id = $1::uuid),
+             (SELECT payment_terms_days FROM billing_settings WHERE id = 1),
+             14)`,
+		customerID,
+	).Scan(&days)
+	return days, err
+}
+
+// Invoice statuses. Overdue is set by the daily reminders run. An
+// invoice settled by credit notes alone is credited; a void one is kept
+// for the record but no longer owed.
+const (
+	InvoiceIssued   = "issued"
+	InvoiceOverdue  = "overdue"
+	InvoicePaid     = "paid"
+	InvoiceCredited = "credited"
+	InvoiceVoid     = "void"
+)
+
+// Invoice kinds. A deposit is billed up front for a job and deducted,
+// once paid, from the job's next standard invoice.
+const (
+	InvoiceStandard = "standard"
+	InvoiceDeposit  = "deposit"
+)
+
+// invoiceBalanceSQL is what is still owed on an invoice row.
+const invoiceBalanceSQL = `(total - deposit_applied - amount_paid - amount_credited)`
+
+// validateAdjustments checks line and invoice discounts and surcharges
+// before anything is stored.
+func validateAdjustments(items []models.InvoiceItem, discount models.Discount, surcharges []models.Surcharge) error {
+	for _, item := range items {
+		if err := item.Discount.Validate(); err != nil {
+			return fmt.Errorf("%s: %w", item.Description, err)
 		}
+	}
 
-		if len(req.Items) == 0 {
-			http.Error(w, "invoice must include at least one item", http.StatusBadRequest)
-			return
+	if err := discount.Validate(); err != nil {
+		return err
+	}
+
+	for _, s := range surcharges {
+		if strings.TrimSpace(s.Description) == "" {
+			return fmt.Errorf("surcharges need a description")
+		}
+		if s.Amount < 0 || s.TaxRate < 0 {
+			return fmt.Errorf("surcharge %s cannot be negative", s.Description)
 		}
+	}
 
-		// --- Calculate totals ---
-		subtotal := 0.0
-		for i := range req.Items {
-			item := &req.Items[i]
-			item.LineTotal = float64(item.Quantity) * item.UnitPrice
-			subtotal += item.LineTotal
-		}
-
-		taxRate := 0.0 // no tax for now
-		taxAmount := 0.0
-		total := subtotal + taxAmount
-
-		invoiceID := uuid.New()
-		now := time.Now()
-		dueDate := now.Add(14 * 24 * time.Hour) // default: 14 days
-
-		// --- Build full invoice model ---
-		invoiceData := models.InvoiceData{
-			InvoiceID:     invoiceID.String(),
-			InvoiceNumber: fmt.Sprintf("INV-%s", invoiceID.String()[0:8]),
-			IssueDate:     now,
-			DueDate:       dueDate,
-
-			Business: models.BusinessInfo{
-				Name: "Pistachio Ltd",
-				BusinessAddress: models.BusinessAddress{
-					Line1:   "123 Example Street",
-					City:    "London",
-					Country: "UK",
-				},
-				Email:     "support@pistachio.com",
-				Phone:     "+44 0000 000000",
-				Website:   "https://pistachio.example",
-				VATNumber: "",
-				LogoPath:  "assets/invoice.png",
-			},
-
-			Customer: models.CustomerInfo{
-				Name:            req.CustomerName,
-				Email:           req.CustomerEmail,
-				CustomerAddress: req.CustomerAddress,
-			},
-
-			Items: req.Items,
-
-			Totals: models.InvoiceTotals{
-				Subtotal:    subtotal,
-				TaxRate:     taxRate,
-				TaxAmount:   taxAmount,
-				TotalAmount: total,
-			},
-
-			Payment: models.PaymentInfo{
-				BankName:      "Barclays",
-				AccountName:   "Pistachio Ltd",
-				SortCode:      "00-00-00",
-				AccountNumber: "00000000",
-				Notes:         "Payment due in 30 days.",
-			},
-
-			FooterNotes: "Please contact us if you have any questions regarding this invoice.",
-		}
-
-		// STEP 1 — Insert into DB (JSON items)
-		ctx := context.Background()
+	return nil
+}
 
-		itemsJSON, err := json.Marshal(req.Items)
-		if err != nil {
-			http.Error(w, "cannot encode items json", 500)
-			return
+// PDF statuses for invoices and quotes. The PDF is rendered by a
+// background task, so a freshly created document starts as pending.
+const (
+	PDFPending = "pending"
+	PDFReady   = "ready"
+)
+
+// errDepositsExceedTotal is returned when a job's paid deposits are more
+// than the invoice they would be deducted from. Deposits are applied
+// whole, so the excess would be lost.
+var errDepositsExceedTotal = errors.New("paid deposits are more than the invoice total")
+
+// issueInvoice stores the invoice and queues its PDF for rendering, in a
+// transaction of its own. See issueInvoiceTx.
+func issueInvoice(ctx context.Context, db *pgxpool.Pool, in invoiceInput) (models.InvoiceData, error) {
+	tx, err := db.Begin(ctx)
+	if err != nil {
+		return models.InvoiceData{}, fmt.Errorf("failed to start transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	invoiceData, err := issueInvoiceTx(ctx, tx, in)
+	if err != nil {
+		return invoiceData, err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return invoiceData, fmt.Errorf("failed to commit invoice: %w", err)
+	}
+
+	return invoiceData, nil
+}
+
+// issueInvoiceTx stores the invoice in tx, numbered from the yearly INV
+// series, and queues its PDF for rendering; pdf_key is filled in by the
+// invoice.pdf task once tx commits. Callers commit, so whatever the
+// invoice bills can be marked in the same transaction. A standard invoice
+// for a job deducts the job's paid deposits that have not been deducted
+// yet, and fails with errDepositsExceedTotal if they are more than it.
+func issueInvoiceTx(ctx context.Context, tx pgx.Tx, in invoiceInput) (models.InvoiceData, error) {
+	if in.Kind == "" {
+		in.Kind = InvoiceStandard
+	}
+	if in.Surcharges == nil {
+		in.Surcharges = []models.Surcharge{}
+	}
+
+	if in.CustomerID == nil && in.JobID != nil {
+		if err := tx.QueryRow(ctx, `SELECT customer_id FROM jobs WHERE id = $1`, in.JobID).Scan(&in.CustomerID); err != nil {
+			return models.InvoiceData{}, fmt.Errorf("failed to load job customer: %w", err)
 		}
+	}
+
+	termsDays, err := paymentTermsFor(ctx, tx, in.CustomerID)
+	if err != nil {
+		return models.InvoiceData{}, fmt.Errorf("failed to load payment terms: %w", err)
+	}
+
+	settings, err := loadBillingSettings(ctx, tx)
+	if err != nil {
+		return models.InvoiceData{}, fmt.Errorf("failed to load billing settings: %w", err)
+	}
+
+	if in.Currency == "" {
+		in.Currency = settings.Currency
+	}
+
+	invoiceID := uuid.New()
+	now := time.Now()
+	dueDate := now.AddDate(0, 0, termsDays)
+
+	// Numbered in the transaction, so a rolled-back invoice leaves no gap
+	invoiceNumber, err := nextDocumentNumber(ctx, tx, "INV", now)
+	if err != nil {
+		return models.InvoiceData{}, err
+	}
+
+	// --- Build full invoice model ---
+	invoiceData := models.InvoiceData{
+		InvoiceID:     invoiceID.String(),
+		InvoiceNumber: invoiceNumber,
+		IssueDate:     now,
+		DueDate:       dueDate,
+		Currency:      in.Currency,
+
+		Business: defaultBusinessInfo(),
 
-		placeholderPDF := "pending"
+		Customer: models.CustomerInfo{
+			Name:            in.CustomerName,
+			Email:           in.CustomerEmail,
+			CustomerAddress: in.CustomerAddress,
+		},
 
-		addressJSON, err := json.Marshal(req.CustomerAddress)
+		Items:      in.Items,
+		Discount:   in.Discount,
+		Surcharges: in.Surcharges,
+		Payment:    defaultPaymentInfo(settings, now, dueDate),
+
+		FooterNotes: invoiceFooterNotes,
+	}
+
+	// STEP 1 — Claim the job's paid deposits, locked so two invoices
+	// can't both deduct them
+	deposits := []uuid.UUID{}
+	depositPaid := 0.0
+
+	if in.Kind == InvoiceStandard && in.JobID != nil {
+		rows, err := tx.Query(ctx,
+			`SELECT id, amount_paid FROM invoices
+             WHERE job_id = $1 AND kind = $2 AND applied_to_invoice_id IS NULL AND amount_paid > 0
+             FOR UPDATE`,
+			in.JobID,
+			InvoiceDeposit,
+		)
 		if err != nil {
-			http.Error(w, "cannot encode address json", http.StatusInternalServerError)
-			return
+			return invoiceData, fmt.Errorf("failed to load deposits: %w", err)
+		}
+
+		for rows.Next() {
+			var id uuid.UUID
+			var paid float64
+			if err := rows.Scan(&id, &paid); err != nil {
+				rows.Close()
+				return invoiceData, fmt.Errorf("failed to scan deposit: %w", err)
+			}
+			deposits = append(deposits, id)
+			depositPaid += paid
 		}
+		rows.Close()
+
+		if err := rows.Err(); err != nil {
+			return invoiceData, fmt.Errorf("failed to load deposits: %w", err)
+		}
+	}
+
+	totals := models.CalculateInvoiceTotals(in.Items, in.Discount, in.Surcharges, depositPaid)
+	invoiceData.Totals = totals
+
+	if math.Round(depositPaid*100) > math.Round(totals.TotalAmount*100) {
+		return invoiceData, fmt.Errorf("%w: %.2f paid, invoice total %.2f; add the remaining work or refund the difference",
+			errDepositsExceedTotal, depositPaid, totals.TotalAmount)
+	}
+
+	// STEP 2 — Insert into DB (JSON items)
+	itemsJSON, err := json.Marshal(in.Items)
+	if err != nil {
+		return invoiceData, fmt.Errorf("cannot encode items json: %w", err)
+	}
 
-		_, err = db.Exec(ctx, `
-            INSERT INTO invoices 
-            (id, customer_name, customer_email, customer_address, items, total, pdf_url, created_at)
-            VALUES ($1,$2,$3,$4,$5,$6,$7,$8)
-        `,
+	addressJSON, err := json.Marshal(in.CustomerAddress)
+	if err != nil {
+		return invoiceData, fmt.Errorf("cannot encode address json: %w", err)
+	}
+
+	surchargesJSON, err := json.Marshal(in.Surcharges)
+	if err != nil {
+		return invoiceData, fmt.Errorf("cannot encode surcharges json: %w", err)
+	}
+
+	_, err = tx.Exec(ctx, `
+        INSERT INTO invoices
+        (id, invoice_number, kind, customer_name, customer_email, customer_address, items,
+         subtotal, line_discount_total, discount_type, discount_value, discount_amount,
+         surcharges, surcharge_total, tax_rate, tax_amount, total, deposit_applied,
+         pdf_status, issue_date, due_date, customer_id, job_id, quote_id, status, currency, created_at)
+        VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$9,NULLIF($10, ''),$11,$12,$13,$14,$15,$16,$17,$18,
+                $19,$20,$21,$22,$23,$24,$25,$26,$27)
+    `,
+		invoiceID,
+		invoiceData.InvoiceNumber,
+		in.Kind,
+		in.CustomerName,
+		in.CustomerEmail,
+		addressJSON,
+		itemsJSON,
+		totals.Subtotal,
+		totals.LineDiscounts,
+		in.Discount.Type,
+		in.Discount.Value,
+		totals.Discount,
+		surchargesJSON,
+		totals.Surcharges,
+		totals.TaxRate,
+		totals.TaxAmount,
+		totals.TotalAmount,
+		totals.DepositApplied,
+		PDFPending,
+		now,
+		dueDate,
+		in.CustomerID,
+		in.JobID,
+		in.QuoteID,
+		InvoiceIssued,
+		invoiceData.Currency,
+		now,
+	)
+
+	if err != nil {
+		return invoiceData, fmt.Errorf("failed to insert invoice: %w", err)
+	}
+
+	if len(deposits) > 0 {
+		_, err = tx.Exec(ctx,
+			`UPDATE invoices SET applied_to_invoice_id = $1 WHERE id = ANY($2)`,
 			invoiceID,
-			req.CustomerName,
-			req.CustomerEmail,
-			addressJSON,
-			itemsJSON,
-			total,
-			placeholderPDF,
-			now,
+			deposits,
 		)
+		if err != nil {
+			return invoiceData, fmt.Errorf("failed to apply deposits: %w", err)
+		}
+	}
+
+	// STEP 3 — Queue PDF rendering in the same transaction, so an invoice
+	// never exists without a task to render it
+	if _, err := queue.Enqueue(ctx, tx, TaskInvoicePDF, documentTask{ID: invoiceID}); err != nil {
+		return invoiceData, err
+	}
+
+	return invoiceData, nil
+}
+
+const invoiceFooterNotes = "Please contact us if you have any questions regarding this invoice."
+
+// loadInvoiceData rebuilds the full invoice model from its row, for
+// rendering. Invoices created before numbering and due dates existed fall
+// back to sensible values.
+func loadInvoiceData(ctx context.Context, db *pgxpool.Pool, invoiceID uuid.UUID) (models.InvoiceData, error) {
+	var data models.InvoiceData
+	var address string
+
+	err := db.QueryRow(ctx,
+		`SELECT COALESCE(invoice_number, 'INV-' || LEFT(id::text, 8)),
+                customer_name, COALESCE(customer_email, ''), COALESCE(customer_address, ''), items,
+                COALESCE(subtotal, total), line_discount_total,
+                COALESCE(discount_type, ''), discount_value, discount_amount, surcharges, surcharge_total,
+                COALESCE(tax_rate, 0), COALESCE(tax_amount, 0), total, deposit_applied,
+                COALESCE(issue_date, created_at), COALESCE(due_date, created_at + INTERVAL '14 days'), currency
+         FROM invoices WHERE id = $1`,
+		invoiceID,
+	).Scan(
+		&data.InvoiceNumber,
+		&data.Customer.Name, &data.Customer.Email, &address, &data.Items,
+		&data.Totals.Subtotal, &data.Totals.LineDiscounts,
+		&data.Discount.Type, &data.Discount.Value, &data.Totals.Discount, &data.Surcharges, &data.Totals.Surcharges,
+		&data.Totals.TaxRate, &data.Totals.TaxAmount, &data.Totals.TotalAmount, &data.Totals.DepositApplied,
+		&data.IssueDate, &data.DueDate, &data.Currency,
+	)
+	if err != nil {
+		return data, err
+	}
+
+	settings, err := loadBillingSettings(ctx, db)
+	if err != nil {
+		return data, fmt.Errorf("failed to load billing settings: %w", err)
+	}
+
+	data.Totals.AmountDue = data.Totals.TotalAmount - data.Totals.DepositApplied
+
+	if address != "" {
+		if err := json.Unmarshal([]byte(address), &data.Customer.CustomerAddress); err != nil {
+			return data, fmt.Errorf("cannot decode address json: %w", err)
+		}
+	}
+
+	data.InvoiceID = invoiceID.String()
+	data.Business = defaultBusinessInfo()
+	data.Payment = defaultPaymentInfo(settings, data.IssueDate, data.DueDate)
+	data.Payment.PaymentLink = paymentLink(data.InvoiceNumber, data.Totals.AmountDue)
+	data.FooterNotes = invoiceFooterNotes
+
+	return data, nil
+}
+
+// loadInvoiceInput reads back the customer, items and adjustments an
+// invoice was issued with.
+func loadInvoiceInput(ctx context.Context, db *pgxpool.Pool, invoiceID uuid.UUID) (invoiceInput, error) {
+	var in invoiceInput
+	var address string
+
+	err := db.QueryRow(ctx,
+		`SELECT kind, customer_name, COALESCE(customer_email, ''), COALESCE(customer_address, ''), items,
+                COALESCE(discount_type, ''), discount_value, surcharges,
+                customer_id, job_id, quote_id
+         FROM invoices WHERE id = $1`,
+		invoiceID,
+	).Scan(&in.Kind, &in.CustomerName, &in.CustomerEmail, &address, &in.Items,
+		&in.Discount.Type, &in.Discount.Value, &in.Surcharges,
+		&in.CustomerID, &in.JobID, &in.QuoteID)
+	if err != nil {
+		return in, err
+	}
+
+	if address != "" {
+		if err := json.Unmarshal([]byte(address), &in.CustomerAddress); err != nil {
+			return in, fmt.Errorf("cannot decode address json: %w", err)
+		}
+	}
 
+	return in, nil
+}
+
+type InvoiceSummary struct {
+	ID             uuid.UUID  `json:"id"`
+	InvoiceNumber  string     `json:"invoice_number"`
+	Kind           string     `json:"kind"`
+	Status         string     `json:"status"`
+	CustomerName   string     `json:"customer_name"`
+	CustomerEmail  string     `json:"customer_email"`
+	Total          float64    `json:"total"`
+	DepositApplied float64    `json:"deposit_applied"`
+	AmountPaid     float64    `json:"amount_paid"`
+	AmountCredited float64    `json:"amount_credited"`
+	Balance        float64    `json:"balance"`
+	PDFStatus      string     `json:"pdf_status"`
+	PDFURL         string     `json:"pdf_url"`
+	EmailStatus    string     `json:"email_status"`
+	IssueDate      string     `json:"issue_date"`
+	DueDate        string     `json:"due_date"`
+	PaidAt         string     `json:"paid_at,omitempty"`
+	CustomerID     *uuid.UUID `json:"customer_id"`
+	JobID          *uuid.UUID `json:"job_id"`
+	QuoteID        *uuid.UUID `json:"quote_id"`
+	CreatedAt      string     `json:"created_at"`
+}
+
+const invoiceSummaryColumns = `id, COALESCE(invoice_number, 'INV-' || LEFT(id::text, 8)), kind, status,
+    customer_name, COALESCE(customer_email, ''), total, deposit_applied, amount_paid, amount_credited,
+    pdf_status, COALESCE(pdf_key, ''), COALESCE(email_status, ''),
+    COALESCE(issue_date, created_at), COALESCE(due_date, created_at + INTERVAL '14 days'), paid_at,
+    customer_id, job_id, quote_id, created_at`
+
+// scanInvoiceSummary scans invoiceSummaryColumns, with a signed link to
+// the PDF once it is ready.
+func scanInvoiceSummary(row pgx.Row, signer *links.Signer) (InvoiceSummary, error) {
+	var inv InvoiceSummary
+	var pdfKey string
+	var issueDate, dueDate, createdAt time.Time
+	var paidAt *time.Time
+
+	err := row.Scan(
+		&inv.ID, &inv.InvoiceNumber, &inv.Kind, &inv.Status,
+		&inv.CustomerName, &inv.CustomerEmail, &inv.Total, &inv.DepositApplied, &inv.AmountPaid, &inv.AmountCredited,
+		&inv.PDFStatus, &pdfKey, &inv.EmailStatus,
+		&issueDate, &dueDate, &paidAt,
+		&inv.CustomerID, &inv.JobID, &inv.QuoteID, &createdAt,
+	)
+	if err != nil {
+		return inv, err
+	}
+
+	inv.Balance = math.Round((inv.Total-inv.DepositApplied-inv.AmountPaid-inv.AmountCredited)*100) / 100
+	inv.IssueDate = issueDate.Format(time.RFC3339)
+	inv.DueDate = dueDate.Format(time.RFC3339)
+	inv.CreatedAt = createdAt.Format(time.RFC3339)
+	if paidAt != nil {
+		inv.PaidAt = paidAt.Format(time.RFC3339)
+	}
+
+	if pdfKey != "" {
+		inv.PDFURL = signer.URL(invoicePDF.publicPath(inv.ID))
+	}
+
+	return inv, nil
+}
+
+// GetInvoiceHandler returns an invoice's summary, including its payment
+// status and whether its PDF has been rendered yet.
+func GetInvoiceHandler(db *pgxpool.Pool, signer *links.Signer) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		invoiceID, err := uuid.Parse(chi.URLParam(r, "id"))
 		if err != nil {
-			http.Error(w, "failed to insert invoice: "+err.Error(), 500)
+			http.Error(w, "invalid invoice id", http.StatusBadRequest)
+			return
+		}
+
+		ctx := context.Background()
+
+		inv, err := scanInvoiceSummary(db.QueryRow(ctx, `SELECT `+invoiceSummaryColumns+` FROM invoices WHERE id = $1`, invoiceID), signer)
+
+		if errors.Is(err, pgx.ErrNoRows) {
+			http.Error(w, "invoice not found", http.StatusNotFound)
 			return
 		}
 
-		// STEP 2 — Generate PDF
-		pdfPath, err := invoices.GenerateInvoicePDF(invoiceData, "uploads/invoices")
 		if err != nil {
-			http.Error(w, "failed to generate PDF: "+err.Error(), 500)
+			http.Error(w, "failed to load invoice: "+err.Error(), http.StatusInternalServerError)
 			return
 		}
 
-		pdfURL := "/uploads/invoices/" + filepath.Base(pdfPath)
+		json.NewEncoder(w).Encode(inv)
+	}
+}
+
+func invoiceCreatedResponse(data models.InvoiceData) map[string]any {
+	return map[string]any{
+		"invoice_id":      data.InvoiceID,
+		"invoice_number":  data.InvoiceNumber,
+		"total":           data.Totals.TotalAmount,
+		"deposit_applied": data.Totals.DepositApplied,
+		"amount_due":      data.Totals.AmountDue,
+		"status":          InvoiceIssued,
+		"pdf_status":      PDFPending,
+		"pdf_url":         nil,
+		"issue_date":      data.IssueDate,
+		"due_date":        data.DueDate,
+	}
+}
 
-		// STEP 3 — Update DB with final PDF URL
-		_, err = db.Exec(ctx, `UPDATE invoices SET pdf_url=$1 WHERE id=$2`, pdfURL, invoiceID)
-		if err != nil {
-			http.Error(w, "failed to update pdf url: "+err.Error(), 500)
+func CreateInvoiceHandler(db *pgxpool.Pool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+
+		var req CreateInvoiceRequest
+
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "invalid JSON body", http.StatusBadRequest)
 			return
 		}
 
-		// STEP 4 — Respond
-		json.NewEncoder(w).Encode(map[string]any{
-			"invoice_id":     invoiceID.String(),
-			"invoice_number": invoiceData.InvoiceNumber,
-			"total":          invoiceData.Totals.TotalAmount,
-			"pdf_url":        pdfURL,
-			"issue_date":     now,
-			"due_date":       dueDate,
+		// Validation
+		if req.CustomerName == "" {
+			http.Error(w, "customer_name is required", http.StatusBadRequest)
+			return
+		}
+
+		if len(req.Items) == 0 {
+			http.Error(w, "invoice must include at least one item", http.StatusBadRequest)
+			return
+		}
+
+		if err := validateAdjustments(req.Items, req.Discount, req.Surcharges); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		ctx := context.Background()
+
+		invoiceData, err := issueInvoice(ctx, db, invoiceInput{
+			CustomerName:    req.CustomerName,
+			CustomerEmail:   req.CustomerEmail,
+			CustomerAddress: req.CustomerAddress,
+			Items:           req.Items,
+			Discount:        req.Discount,
+			Surcharges:      req.Surcharges,
+			CustomerID:      req.CustomerID,
 		})
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		// STEP 3 — Respond straight away; the PDF follows
+		json.NewEncoder(w).Encode(invoiceCreatedResponse(invoiceData))
 	}
 }
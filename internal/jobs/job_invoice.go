@@ -0,0 +1,241 @@
+package jobs
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"time"
+
+	"pistachio/internal/models"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+type CreateJobInvoiceRequest struct {
+	// Extra lines to bill alongside the job's recorded work
+	Items      []models.InvoiceItem `json:"items"`
+	Discount   models.Discount      `json:"discount"`
+	Surcharges []models.Surcharge   `json:"surcharges"` // e.g. a call-out fee
+}
+
+// labourLines turns billable, finished and not yet invoiced time on the
+// job into one labour line per technician, priced at their hourly rate.
+// The entries are locked until tx ends, so they can't be invoiced twice.
+// It also returns their ids.
+func labourLines(ctx context.Context, tx pgx.Tx, jobID uuid.UUID, jobType string) ([]models.InvoiceItem, []uuid.UUID, error) {
+	rows, err := tx.Query(ctx,
+		`SELECT id, user_name, started_at, ended_at, break_minutes
+         FROM time_entries
+         WHERE job_id = $1 AND billable AND ended_at IS NOT NULL AND invoice_id IS NULL
+         FOR UPDATE`,
+		jobID,
+	)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to fetch time entries: %w", err)
+	}
+
+	minutesByUser := map[string]int{}
+	entryIDs := []uuid.UUID{}
+
+	for rows.Next() {
+		var id uuid.UUID
+		var user string
+		var startedAt, endedAt time.Time
+		var breakMinutes int
+		if err := rows.Scan(&id, &user, &startedAt, &endedAt, &breakMinutes); err != nil {
+			rows.Close()
+			return nil, nil, fmt.Errorf("failed to scan time entry: %w", err)
+		}
+		minutesByUser[user] += workedMinutes(startedAt, endedAt, breakMinutes)
+		entryIDs = append(entryIDs, id)
+	}
+	rows.Close()
+
+	if err := rows.Err(); err != nil {
+		return nil, nil, fmt.Errorf("failed to fetch time entries: %w", err)
+	}
+
+	users := make([]string, 0, len(minutesByUser))
+	for user := range minutesByUser {
+		users = append(users, user)
+	}
+	sort.Strings(users)
+
+	items := []models.InvoiceItem{}
+	for _, user := range users {
+		rate, err := labourRateFor(ctx, tx, user, jobType)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		items = append(items, models.InvoiceItem{
+			Description: "Labour – " + user,
+			Quantity:    roundHours(minutesByUser[user]),
+			UnitPrice:   rate,
+		})
+	}
+
+	return items, entryIDs, nil
+}
+
+// CreateJobInvoiceHandler invoices a job's customer for the labour and
+// parts recorded against it, so neither has to be keyed in by hand.
+func CreateJobInvoiceHandler(db *pgxpool.Pool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		jobID, err := uuid.Parse(chi.URLParam(r, "id"))
+		if err != nil {
+			http.Error(w, "invalid job id", http.StatusBadRequest)
+			return
+		}
+
+		var req CreateJobInvoiceRequest
+		if r.ContentLength != 0 {
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				http.Error(w, "invalid JSON body", http.StatusBadRequest)
+				return
+			}
+		}
+
+		if err := validateAdjustments(req.Items, req.Discount, req.Surcharges); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		ctx := context.Background()
+
+		// Everything below runs in one transaction: the lines are built
+		// from locked rows and marked billed before it commits, so two
+		// requests can't bill the same work and a failure bills nothing
+		tx, err := db.Begin(ctx)
+		if err != nil {
+			http.Error(w, "failed to start transaction: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		defer tx.Rollback(ctx)
+
+		// 1️⃣ Load and lock job + customer, so invoices for the job are
+		// issued one at a time
+		var jobType, customerName, customerEmail, customerAddress string
+
+		err = tx.QueryRow(ctx,
+			`SELECT COALESCE(j.job_type, ''), c.name, COALESCE(c.email, ''), COALESCE(c.address, '')
+             FROM jobs j
+             JOIN customers c ON j.customer_id = c.id
+             WHERE j.id = $1
+             FOR UPDATE OF j`,
+			jobID,
+		).Scan(&jobType, &customerName, &customerEmail, &customerAddress)
+
+		if errors.Is(err, pgx.ErrNoRows) {
+			http.Error(w, "job not found", http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			http.Error(w, "failed to load job: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		// 2️⃣ Build line items
+		labour, entryIDs, err := labourLines(ctx, tx, jobID, jobType)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+			return
+		}
+
+		parts, jobPartIDs, err := partLines(ctx, tx, jobID)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		standard, err := templateLines(ctx, tx, jobID)
+		if err != nil {
+			http.Error(w, "failed to fetch template lines: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		items := append(standard, labour...)
+		items = append(items, parts...)
+		items = append(items, req.Items...)
+
+		if len(items) == 0 {
+			http.Error(w, "nothing to invoice: no billable time, parts or items", http.StatusBadRequest)
+			return
+		}
+
+		// 3️⃣ Issue invoice
+		invoiceData, err := issueInvoiceTx(ctx, tx, invoiceInput{
+			CustomerName:    customerName,
+			CustomerEmail:   customerEmail,
+			CustomerAddress: models.CustomerAddress{Line1: customerAddress},
+			Items:           items,
+			Discount:        req.Discount,
+			Surcharges:      req.Surcharges,
+			JobID:           &jobID,
+		})
+		if errors.Is(err, errDepositsExceedTotal) {
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		// 4️⃣ Mark billed work and the job as invoiced
+		_, err = tx.Exec(ctx,
+			`UPDATE time_entries SET invoice_id = $1 WHERE id = ANY($2)`,
+			invoiceData.InvoiceID,
+			entryIDs,
+		)
+		if err != nil {
+			http.Error(w, "failed to mark time as invoiced: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		_, err = tx.Exec(ctx,
+			`UPDATE job_parts SET invoice_id = $1 WHERE id = ANY($2)`,
+			invoiceData.InvoiceID,
+			jobPartIDs,
+		)
+		if err != nil {
+			http.Error(w, "failed to mark parts as invoiced: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		if len(standard) > 0 {
+			_, err = tx.Exec(ctx,
+				`UPDATE jobs SET template_lines_invoice_id = $1 WHERE id = $2`,
+				invoiceData.InvoiceID,
+				jobID,
+			)
+			if err != nil {
+				http.Error(w, "failed to mark template lines as invoiced: "+err.Error(), http.StatusInternalServerError)
+				return
+			}
+		}
+
+		_, err = setJobStatus(ctx, tx, jobID, "invoiced")
+		if errors.Is(err, errChecklistIncomplete) {
+			http.Error(w, "job can't be invoiced: "+err.Error(), http.StatusConflict)
+			return
+		}
+		if err != nil {
+			http.Error(w, "failed to update job: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		if err := tx.Commit(ctx); err != nil {
+			http.Error(w, "failed to commit invoice: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		json.NewEncoder(w).Encode(invoiceCreatedResponse(invoiceData))
+	}
+}
@@ -0,0 +1,62 @@
+package jobs
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+)
+
+func TestCreateJobInvoiceConcurrent(t *testing.T) {
+	db := testDB(t)
+	jobID := seedJob(t, db)
+	seedJobPart(t, db, jobID, 45)
+
+	r := chi.NewRouter()
+	r.Post("/jobs/{id}/invoice", CreateJobInvoiceHandler(db))
+
+	const requests = 2
+	codes := make([]int, requests)
+
+	var wg sync.WaitGroup
+	for i := range requests {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			rec := httptest.NewRecorder()
+			r.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/jobs/"+jobID.String()+"/invoice", nil))
+			codes[i] = rec.Code
+		}()
+	}
+	wg.Wait()
+
+	ok := 0
+	for _, code := range codes {
+		if code == http.StatusOK {
+			ok++
+		}
+	}
+	if ok != 1 {
+		t.Errorf("got statuses %v, want exactly one 200", codes)
+	}
+
+	var invoices, unbilled int
+	err := db.QueryRow(context.Background(),
+		`SELECT (SELECT COUNT(*) FROM invoices WHERE job_id = $1),
+                (SELECT COUNT(*) FROM job_parts WHERE job_id = $1 AND invoice_id IS NULL)`,
+		jobID,
+	).Scan(&invoices, &unbilled)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if invoices != 1 {
+		t.Errorf("got %d invoices for the job, want 1", invoices)
+	}
+	if unbilled != 0 {
+		t.Errorf("got %d parts left unbilled, want 0", unbilled)
+	}
+}
@@ -0,0 +1,105 @@
+package jobs
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"pistachio/internal/invoices"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+type CustomerLanguageRequest struct {
+	Language string `json:"language"` // en / cy / fr / de
+}
+
+// SetCustomerLanguageHandler sets the language of a customer's invoice
+// and credit note PDFs. It applies to PDFs rendered from then on.
+func SetCustomerLanguageHandler(db *pgxpool.Pool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		customerID, err := uuid.Parse(chi.URLParam(r, "id"))
+		if err != nil {
+			http.Error(w, "invalid customer id", http.StatusBadRequest)
+			return
+		}
+
+		var req CustomerLanguageRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "invalid JSON", http.StatusBadRequest)
+			return
+		}
+
+		if !invoices.SupportedLanguage(req.Language) {
+			http.Error(w, "language must be one of "+strings.Join(invoices.Languages(), ", "), http.StatusBadRequest)
+			return
+		}
+
+		ctx := context.Background()
+
+		result, err := db.Exec(ctx,
+			`UPDATE customers SET language = $1 WHERE id = $2`,
+			req.Language,
+			customerID,
+		)
+
+		if err != nil {
+			http.Error(w, "failed to update customer: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		if result.RowsAffected() == 0 {
+			http.Error(w, "customer not found", http.StatusNotFound)
+			return
+		}
+
+		json.NewEncoder(w).Encode(map[string]any{
+			"customer_id": customerID,
+			"language":    req.Language,
+		})
+	}
+}
+
+// invoiceLanguage is the language of the invoice's customer. Invoices
+// without a linked customer are in English.
+func invoiceLanguage(ctx context.Context, db pgxQuerier, invoiceID uuid.UUID) (string, error) {
+	var lang string
+	err := db.QueryRow(ctx,
+		`SELECT COALESCE(c.language, 'en')
+         FROM invoices i LEFT JOIN customers c ON c.id = i.customer_id
+         WHERE i.id = $1`,
+		invoiceID,
+	).Scan(&lang)
+	return lang, err
+}
+
+// customerLanguage is the language of the customer's documents.
+func customerLanguage(ctx context.Context, db pgxQuerier, customerID uuid.UUID) (string, error) {
+	var lang string
+	err := db.QueryRow(ctx, `SELECT language FROM customers WHERE id = $1`, customerID).Scan(&lang)
+	return lang, err
+}
+
+// creditNoteLanguage is the language of the credited invoice's customer.
+func creditNoteLanguage(ctx context.Context, db pgxQuerier, creditNoteID uuid.UUID) (string, error) {
+	var lang string
+	err := db.QueryRow(ctx,
+		`SELECT COALESCE(c.language, 'en')
+         FROM credit_notes cn
+         JOIN invoices i ON i.id = cn.invoice_id
+         LEFT JOIN customers c ON c.id = i.customer_id
+         WHERE cn.id = $1`,
+		creditNoteID,
+	).Scan(&lang)
+	return lang, err
+}
+
+// quoteLanguage is the language chosen when the quote was created.
+func quoteLanguage(ctx context.Context, db pgxQuerier, quoteID uuid.UUID) (string, error) {
+	var lang string
+	err := db.QueryRow(ctx, `SELECT language FROM quotes WHERE id = $1`, quoteID).Scan(&lang)
+	return lang, err
+}
@@ -19,7 +19,8 @@ func ListJobsHandler(db *pgxpool.Pool) http.HandlerFunc {
                 j.status,
                 j.estimate,
                 j.created_at,
-                c.name
+                c.name,
+                `+labourMinutesSQL+`
              FROM jobs j
              JOIN customers c ON c.id = j.customer_id
              ORDER BY j.created_at DESC`,
@@ -44,6 +45,7 @@ func ListJobsHandler(db *pgxpool.Pool) http.HandlerFunc {
 				&item.Estimate,
 				&createdAt,
 				&item.CustomerName,
+				&item.LabourMinutes,
 			)
 
 			if err != nil {
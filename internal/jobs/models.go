@@ -10,9 +10,11 @@ type CreateJobRequest struct {
         Address string `json:"address"`
     } `json:"customer"`
 
-    Title       string  `json:"title"`
-    Description string  `json:"description"`
-    Estimate    float64 `json:"estimate"`
+    Title       string     `json:"title"`
+    Description string     `json:"description"`
+    Estimate    float64    `json:"estimate"`
+    JobType     string     `json:"job_type"`
+    TemplateID  *uuid.UUID `json:"template_id"`
 }
 
 type CreateJobResponse struct {
@@ -23,21 +25,24 @@ type CreateJobResponse struct {
 }
 
 type JobListItem struct {
-    JobID        uuid.UUID `json:"job_id"`
-    Title        string    `json:"title"`
-    Status       string    `json:"status"`
-    Estimate     float64   `json:"estimate"`
-    CreatedAt    string    `json:"created_at"`
-    CustomerName string    `json:"customer_name"`
+    JobID         uuid.UUID `json:"job_id"`
+    Title         string    `json:"title"`
+    Status        string    `json:"status"`
+    Estimate      float64   `json:"estimate"`
+    CreatedAt     string    `json:"created_at"`
+    CustomerName  string    `json:"customer_name"`
+    LabourMinutes int       `json:"labour_minutes"`
 }
 
 type JobDetail struct {
-    ID          uuid.UUID `json:"id"`
-    Title       string    `json:"title"`
-    Description string    `json:"description"`
-    Status      string    `json:"status"`
-    Estimate    float64   `json:"estimate"`
-    CreatedAt   string    `json:"created_at"`
+    ID            uuid.UUID `json:"id"`
+    Title         string    `json:"title"`
+    Description   string    `json:"description"`
+    Status        string    `json:"status"`
+    Estimate      float64   `json:"estimate"`
+    JobType       string    `json:"job_type"`
+    LabourMinutes int       `json:"labour_minutes"`
+    CreatedAt     string    `json:"created_at"`
 }
 
 type CustomerInfo struct {
@@ -54,17 +59,52 @@ type JobNote struct {
     CreatedAt string    `json:"created_at"`
 }
 
+// Signed links to each size of a photo. Thumbnail and Medium are empty
+// until the variants have been made.
+type PhotoVariants struct {
+    Thumbnail string `json:"thumbnail,omitempty"`
+    Medium    string `json:"medium,omitempty"`
+    Original  string `json:"original"`
+}
+
 type JobPhoto struct {
-    ID        uuid.UUID `json:"id"`
-    FileURL   string    `json:"file_url"`
-    CreatedAt string    `json:"created_at"`
+    ID             uuid.UUID     `json:"id"`
+    FileURL        string        `json:"file_url"`
+    Variants       PhotoVariants `json:"variants"`
+    VariantsStatus string        `json:"variants_status"`
+    Caption        string        `json:"caption"`
+    Category       string        `json:"category"` // before / during / after / issue / receipt; empty if not set
+    SortOrder      int           `json:"sort_order"`
+    TakenAt        string        `json:"taken_at,omitempty"` // from EXIF, in the camera's local time
+    UploadedBy     string        `json:"uploaded_by"`
+    BeforePhotoID  *uuid.UUID    `json:"before_photo_id"` // after photos: the before photo they pair with
+    CreatedAt      string        `json:"created_at"`
+}
+
+// Photos of one category, in sort order.
+type PhotoGroup struct {
+    Category string     `json:"category"` // empty for photos without one
+    Photos   []JobPhoto `json:"photos"`
+}
+
+type PhotoPair struct {
+    Before JobPhoto `json:"before"`
+    After  JobPhoto `json:"after"`
 }
 
 type JobDetailResponse struct {
-    Job      JobDetail     `json:"job"`
-    Customer CustomerInfo  `json:"customer"`
-    Notes    []JobNote     `json:"notes"`
-    Photos   []JobPhoto    `json:"photos"`
+    Job           JobDetail         `json:"job"`
+    Customer      CustomerInfo      `json:"customer"`
+    Notes         []JobNote         `json:"notes"`
+    StatusHistory []JobStatusChange `json:"status_history"`
+    Photos        []JobPhoto        `json:"photos"`
+    PhotoGroups   []PhotoGroup      `json:"photo_groups"`
+    PhotoPairs    []PhotoPair       `json:"photo_pairs"`
+    ReportURL     string            `json:"report_url,omitempty"` // signed link to the before/after report, if there are pairs
+    Attachments   []JobAttachment   `json:"attachments"`
+    TimeEntries   []TimeEntry       `json:"time_entries"`
+    Parts         []JobPart         `json:"parts"`
+    Checklist     []ChecklistItem   `json:"checklist"`
 }
 
 type CreateNoteRequest struct {
@@ -79,10 +119,9 @@ type NoteResponse struct {
 }
 
 type PhotoResponse struct {
-    ID        uuid.UUID `json:"id"`
+    JobPhoto
     JobID     uuid.UUID `json:"job_id"`
-    FileURL   string    `json:"file_url"`
-    CreatedAt string    `json:"created_at"`
+    Duplicate bool      `json:"duplicate,omitempty"` // the job already had this photo, which is returned instead
 }
 
 type InvoiceResponse struct {
@@ -0,0 +1,32 @@
+package jobs
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// nextDocumentNumber hands out the next number in a yearly series,
+// e.g. QUO-2026-0042. The counter row is locked by the upsert, so
+// concurrent requests never receive the same number. Called inside a
+// transaction, a rolled-back document leaves no gap in the series.
+func nextDocumentNumber(ctx context.Context, db pgxQuerier, series string, at time.Time) (string, error) {
+	year := at.Year()
+
+	var n int
+	err := db.QueryRow(ctx,
+		`INSERT INTO document_counters (series, year, last_value)
+         VALUES ($1, $2, 1)
+         ON CONFLICT (series, year)
+         DO UPDATE SET last_value = document_counters.last_value + 1
+         RETURNING last_value`,
+		series,
+		year,
+	).Scan(&n)
+
+	if err != nil {
+		return "", fmt.Errorf("failed to allocate %s number: %w", series, err)
+	}
+
+	return fmt.Sprintf("%s-%d-%04d", series, year, n), nil
+}
@@ -0,0 +1,638 @@
+package jobs
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"time"
+
+	"pistachio/internal/models"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+type Part struct {
+	ID            uuid.UUID `json:"id"`
+	SKU           string    `json:"sku"`
+	Description   string    `json:"description"`
+	CostPrice     float64   `json:"cost_price"`
+	SellPrice     float64   `json:"sell_price"`
+	TaxRate       float64   `json:"tax_rate"`
+	StockQuantity float64   `json:"stock_quantity"`
+	ReorderLevel  float64   `json:"reorder_level"`
+	LowStock      bool      `json:"low_stock"`
+	LowStockSince *string   `json:"low_stock_since"` // when it fell to its reorder level
+}
+
+type PartRequest struct {
+	SKU           string  `json:"sku"`
+	Description   string  `json:"description"`
+	CostPrice     float64 `json:"cost_price"`
+	SellPrice     float64 `json:"sell_price"`
+	MarkupPercent float64 `json:"markup_percent"` // used when sell_price is not given
+	TaxRate       float64 `json:"tax_rate"`
+	StockQuantity float64 `json:"stock_quantity"`
+	ReorderLevel  float64 `json:"reorder_level"`
+}
+
+type AdjustStockRequest struct {
+	Quantity float64 `json:"quantity"` // positive for deliveries, negative for write-offs
+}
+
+type JobPart struct {
+	ID          uuid.UUID  `json:"id"`
+	JobID       uuid.UUID  `json:"job_id"`
+	PartID      uuid.UUID  `json:"part_id"`
+	SKU         string     `json:"sku"`
+	Description string     `json:"description"`
+	Quantity    float64    `json:"quantity"`
+	UnitCost    float64    `json:"unit_cost"`
+	UnitPrice   float64    `json:"unit_price"`
+	TaxRate     float64    `json:"tax_rate"`
+	UsedBy      string     `json:"used_by"`
+	InvoiceID   *uuid.UUID `json:"invoice_id"`
+	CreatedAt   string     `json:"created_at"`
+}
+
+type UsePartRequest struct {
+	PartID   uuid.UUID `json:"part_id"`
+	Quantity float64   `json:"quantity"`
+	User     string    `json:"user"`
+}
+
+type WaitForPartRequest struct {
+	PartID   uuid.UUID `json:"part_id"`
+	Quantity float64   `json:"quantity"`
+}
+
+type BlockedJob struct {
+	JobID        uuid.UUID `json:"job_id"`
+	Title        string    `json:"title"`
+	Status       string    `json:"status"`
+	CustomerName string    `json:"customer_name"`
+	Quantity     float64   `json:"quantity"`
+	WaitingSince string    `json:"waiting_since"`
+}
+
+const partColumns = `id, sku, description, cost_price, sell_price, tax_rate, stock_quantity, reorder_level, low_stock_since`
+
+// lowStockSinceSQL sets low_stock_since from a part's new stock and
+// reorder level: kept while the part stays low, set when it falls low
+// and cleared once it is restocked.
+func lowStockSinceSQL(stock, reorderLevel string) string {
+	return `CASE WHEN ` + stock + ` <= ` + reorderLevel + ` THEN COALESCE(low_stock_since, NOW()) END`
+}
+
+func scanPart(row pgx.Row) (Part, error) {
+	var p Part
+	var lowStockSince *time.Time
+	err := row.Scan(&p.ID, &p.SKU, &p.Description, &p.CostPrice, &p.SellPrice, &p.TaxRate, &p.StockQuantity, &p.ReorderLevel, &lowStockSince)
+	p.LowStock = p.StockQuantity <= p.ReorderLevel
+	if lowStockSince != nil {
+		since := lowStockSince.Format(time.RFC3339)
+		p.LowStockSince = &since
+	}
+	return p, err
+}
+
+// sellPrice returns the requested sell price, or the cost price plus the
+// markup percentage when no sell price was given.
+func (req PartRequest) sellPrice() float64 {
+	if req.SellPrice > 0 {
+		return req.SellPrice
+	}
+	return math.Round(req.CostPrice*(1+req.MarkupPercent/100)*100) / 100
+}
+
+func queryParts(ctx context.Context, db *pgxpool.Pool, where string, args ...any) ([]Part, error) {
+	rows, err := db.Query(ctx, `SELECT `+partColumns+` FROM parts `+where+` ORDER BY sku`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	parts := []Part{}
+	for rows.Next() {
+		p, err := scanPart(rows)
+		if err != nil {
+			return nil, err
+		}
+		parts = append(parts, p)
+	}
+
+	return parts, rows.Err()
+}
+
+func CreatePartHandler(db *pgxpool.Pool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req PartRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "invalid JSON", http.StatusBadRequest)
+			return
+		}
+
+		if req.SKU == "" || req.Description == "" {
+			http.Error(w, "sku and description are required", http.StatusBadRequest)
+			return
+		}
+
+		ctx := context.Background()
+
+		part, err := scanPart(db.QueryRow(ctx,
+			`INSERT INTO parts (id, sku, description, cost_price, sell_price, tax_rate, stock_quantity, reorder_level, low_stock_since, created_at, updated_at)
+             VALUES ($1, $2, $3, $4, $5, $6, $7, $8, CASE WHEN $7::numeric <= $8::numeric THEN NOW() END, NOW(), NOW())
+             RETURNING `+partColumns,
+			uuid.New(),
+			req.SKU,
+			req.Description,
+			req.CostPrice,
+			req.sellPrice(),
+			req.TaxRate,
+			req.StockQuantity,
+			req.ReorderLevel,
+		))
+
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == "23505" {
+			http.Error(w, "a part with sku "+req.SKU+" already exists", http.StatusConflict)
+			return
+		}
+
+		if err != nil {
+			http.Error(w, "failed to create part: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		json.NewEncoder(w).Encode(part)
+	}
+}
+
+// UpdatePartHandler replaces a part's catalogue details. Stock is changed
+// through AdjustStockHandler and job usage only.
+func UpdatePartHandler(db *pgxpool.Pool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		partID, err := uuid.Parse(chi.URLParam(r, "id"))
+		if err != nil {
+			http.Error(w, "invalid part id", http.StatusBadRequest)
+			return
+		}
+
+		var req PartRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "invalid JSON", http.StatusBadRequest)
+			return
+		}
+
+		if req.SKU == "" || req.Description == "" {
+			http.Error(w, "sku and description are required", http.StatusBadRequest)
+			return
+		}
+
+		ctx := context.Background()
+
+		part, err := scanPart(db.QueryRow(ctx,
+			`UPDATE parts
+             SET sku = $1, description = $2, cost_price = $3, sell_price = $4, tax_rate = $5,
+                 reorder_level = $6, low_stock_since = `+lowStockSinceSQL("stock_quantity", "$6")+`,
+                 updated_at = NOW()
+             WHERE id = $7
+             RETURNING `+partColumns,
+			req.SKU,
+			req.Description,
+			req.CostPrice,
+			req.sellPrice(),
+			req.TaxRate,
+			req.ReorderLevel,
+			partID,
+		))
+
+		if errors.Is(err, pgx.ErrNoRows) {
+			http.Error(w, "part not found", http.StatusNotFound)
+			return
+		}
+
+		if err != nil {
+			http.Error(w, "failed to update part: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		json.NewEncoder(w).Encode(part)
+	}
+}
+
+func ListPartsHandler(db *pgxpool.Pool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		parts, err := queryParts(context.Background(), db, "")
+		if err != nil {
+			http.Error(w, "failed to query parts: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		json.NewEncoder(w).Encode(parts)
+	}
+}
+
+// ListLowStockPartsHandler lists parts at or below their reorder level,
+// with when each fell there.
+func ListLowStockPartsHandler(db *pgxpool.Pool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		parts, err := queryParts(context.Background(), db, "WHERE stock_quantity <= reorder_level")
+		if err != nil {
+			http.Error(w, "failed to query parts: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		json.NewEncoder(w).Encode(parts)
+	}
+}
+
+func GetPartHandler(db *pgxpool.Pool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		partID, err := uuid.Parse(chi.URLParam(r, "id"))
+		if err != nil {
+			http.Error(w, "invalid part id", http.StatusBadRequest)
+			return
+		}
+
+		part, err := scanPart(db.QueryRow(context.Background(), `SELECT `+partColumns+` FROM parts WHERE id = $1`, partID))
+		if err != nil {
+			http.Error(w, "part not found", http.StatusNotFound)
+			return
+		}
+
+		json.NewEncoder(w).Encode(part)
+	}
+}
+
+func AdjustStockHandler(db *pgxpool.Pool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		partID, err := uuid.Parse(chi.URLParam(r, "id"))
+		if err != nil {
+			http.Error(w, "invalid part id", http.StatusBadRequest)
+			return
+		}
+
+		var req AdjustStockRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "invalid JSON", http.StatusBadRequest)
+			return
+		}
+
+		ctx := context.Background()
+
+		part, err := scanPart(db.QueryRow(ctx,
+			`UPDATE parts
+             SET stock_quantity = stock_quantity + $1,
+                 low_stock_since = `+lowStockSinceSQL("stock_quantity + $1", "reorder_level")+`,
+                 updated_at = NOW()
+             WHERE id = $2
+             RETURNING `+partColumns,
+			req.Quantity,
+			partID,
+		))
+
+		if errors.Is(err, pgx.ErrNoRows) {
+			http.Error(w, "part not found", http.StatusNotFound)
+			return
+		}
+
+		if err != nil {
+			http.Error(w, "failed to adjust stock: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		json.NewEncoder(w).Encode(part)
+	}
+}
+
+// ListBlockedJobsHandler lists jobs in waiting_parts that are still
+// waiting on the given part.
+func ListBlockedJobsHandler(db *pgxpool.Pool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		partID, err := uuid.Parse(chi.URLParam(r, "id"))
+		if err != nil {
+			http.Error(w, "invalid part id", http.StatusBadRequest)
+			return
+		}
+
+		ctx := context.Background()
+
+		rows, err := db.Query(ctx,
+			`SELECT j.id, j.title, j.status, c.name, SUM(w.quantity), MIN(w.created_at)
+             FROM job_part_waits w
+             JOIN jobs j ON j.id = w.job_id
+             JOIN customers c ON c.id = j.customer_id
+             WHERE w.part_id = $1 AND w.fulfilled_at IS NULL AND j.status = 'waiting_parts'
+             GROUP BY j.id, j.title, j.status, c.name
+             ORDER BY MIN(w.created_at)`,
+			partID,
+		)
+		if err != nil {
+			http.Error(w, "failed to query blocked jobs: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		defer rows.Close()
+
+		jobs := []BlockedJob{}
+		for rows.Next() {
+			var b BlockedJob
+			var since time.Time
+			if err := rows.Scan(&b.JobID, &b.Title, &b.Status, &b.CustomerName, &b.Quantity, &since); err != nil {
+				http.Error(w, "scan error: "+err.Error(), http.StatusInternalServerError)
+				return
+			}
+			b.WaitingSince = since.Format(time.RFC3339)
+			jobs = append(jobs, b)
+		}
+
+		json.NewEncoder(w).Encode(jobs)
+	}
+}
+
+func listJobParts(ctx context.Context, db *pgxpool.Pool, jobID uuid.UUID) ([]JobPart, error) {
+	rows, err := db.Query(ctx,
+		`SELECT jp.id, jp.job_id, jp.part_id, p.sku, p.description, jp.quantity,
+                jp.unit_cost, jp.unit_price, jp.tax_rate, COALESCE(jp.used_by, ''), jp.invoice_id, jp.created_at
+         FROM job_parts jp
+         JOIN parts p ON p.id = jp.part_id
+         WHERE jp.job_id = $1
+         ORDER BY jp.created_at`,
+		jobID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	parts := []JobPart{}
+	for rows.Next() {
+		var jp JobPart
+		var createdAt time.Time
+		err := rows.Scan(&jp.ID, &jp.JobID, &jp.PartID, &jp.SKU, &jp.Description, &jp.Quantity,
+			&jp.UnitCost, &jp.UnitPrice, &jp.TaxRate, &jp.UsedBy, &jp.InvoiceID, &createdAt)
+		if err != nil {
+			return nil, err
+		}
+		jp.CreatedAt = createdAt.Format(time.RFC3339)
+		parts = append(parts, jp)
+	}
+
+	return parts, rows.Err()
+}
+
+// partLines turns parts used on the job and not yet invoiced into
+// invoice lines at the sell price recorded when they were used. The
+// parts are locked until tx ends, so they can't be invoiced twice. It
+// also returns their ids.
+func partLines(ctx context.Context, tx pgx.Tx, jobID uuid.UUID) ([]models.InvoiceItem, []uuid.UUID, error) {
+	rows, err := tx.Query(ctx,
+		`SELECT jp.id, p.sku, p.description, jp.quantity, jp.unit_price, jp.tax_rate
+         FROM job_parts jp
+         JOIN parts p ON p.id = jp.part_id
+         WHERE jp.job_id = $1 AND jp.invoice_id IS NULL
+         ORDER BY jp.created_at
+         FOR UPDATE OF jp`,
+		jobID,
+	)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to fetch job parts: %w", err)
+	}
+	defer rows.Close()
+
+	items := []models.InvoiceItem{}
+	ids := []uuid.UUID{}
+	for rows.Next() {
+		var id uuid.UUID
+		var sku, description string
+		var item models.InvoiceItem
+		if err := rows.Scan(&id, &sku, &description, &item.Quantity, &item.UnitPrice, &item.TaxRate); err != nil {
+			return nil, nil, fmt.Errorf("failed to scan job part: %w", err)
+		}
+		item.Description = sku + " – " + description
+		items = append(items, item)
+		ids = append(ids, id)
+	}
+
+	return items, ids, rows.Err()
+}
+
+func ListJobPartsHandler(db *pgxpool.Pool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		jobID, err := uuid.Parse(chi.URLParam(r, "id"))
+		if err != nil {
+			http.Error(w, "invalid job id", http.StatusBadRequest)
+			return
+		}
+
+		ctx := context.Background()
+
+		if !jobExists(ctx, db, jobID) {
+			http.Error(w, "job not found", http.StatusNotFound)
+			return
+		}
+
+		parts, err := listJobParts(ctx, db, jobID)
+		if err != nil {
+			http.Error(w, "failed to fetch job parts: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		json.NewEncoder(w).Encode(parts)
+	}
+}
+
+// UsePartHandler records a part used on a job, taking it out of stock
+// and fulfilling any wait the job had on that part.
+func UsePartHandler(db *pgxpool.Pool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		jobID, err := uuid.Parse(chi.URLParam(r, "id"))
+		if err != nil {
+			http.Error(w, "invalid job id", http.StatusBadRequest)
+			return
+		}
+
+		var req UsePartRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "invalid JSON", http.StatusBadRequest)
+			return
+		}
+
+		if req.PartID == uuid.Nil || req.Quantity <= 0 {
+			http.Error(w, "part_id and a positive quantity are required", http.StatusBadRequest)
+			return
+		}
+
+		ctx := context.Background()
+
+		if !jobExists(ctx, db, jobID) {
+			http.Error(w, "job not found", http.StatusNotFound)
+			return
+		}
+
+		tx, err := db.Begin(ctx)
+		if err != nil {
+			http.Error(w, "failed to start transaction: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		defer tx.Rollback(ctx)
+
+		// 1️⃣ Take the part out of stock
+		part, err := scanPart(tx.QueryRow(ctx,
+			`UPDATE parts
+             SET stock_quantity = stock_quantity - $1,
+                 low_stock_since = `+lowStockSinceSQL("stock_quantity - $1", "reorder_level")+`,
+                 updated_at = NOW()
+             WHERE id = $2 AND stock_quantity >= $1
+             RETURNING `+partColumns,
+			req.Quantity,
+			req.PartID,
+		))
+
+		if errors.Is(err, pgx.ErrNoRows) {
+			if _, err := scanPart(tx.QueryRow(ctx, `SELECT `+partColumns+` FROM parts WHERE id = $1`, req.PartID)); err != nil {
+				http.Error(w, "part not found", http.StatusNotFound)
+				return
+			}
+			http.Error(w, "not enough stock for this part", http.StatusConflict)
+			return
+		}
+
+		if err != nil {
+			http.Error(w, "failed to update stock: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		// 2️⃣ Record usage at today's prices
+		usage := JobPart{
+			ID:          uuid.New(),
+			JobID:       jobID,
+			PartID:      part.ID,
+			SKU:         part.SKU,
+			Description: part.Description,
+			Quantity:    req.Quantity,
+			UnitCost:    part.CostPrice,
+			UnitPrice:   part.SellPrice,
+			TaxRate:     part.TaxRate,
+			UsedBy:      req.User,
+			CreatedAt:   time.Now().Format(time.RFC3339),
+		}
+
+		_, err = tx.Exec(ctx,
+			`INSERT INTO job_parts (id, job_id, part_id, quantity, unit_cost, unit_price, tax_rate, used_by, created_at)
+             VALUES ($1, $2, $3, $4, $5, $6, $7, NULLIF($8, ''), NOW())`,
+			usage.ID,
+			jobID,
+			part.ID,
+			usage.Quantity,
+			usage.UnitCost,
+			usage.UnitPrice,
+			usage.TaxRate,
+			usage.UsedBy,
+		)
+
+		if err != nil {
+			http.Error(w, "failed to record part usage: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		// 3️⃣ The job is no longer waiting on this part
+		_, err = tx.Exec(ctx,
+			`UPDATE job_part_waits SET fulfilled_at = NOW()
+             WHERE job_id = $1 AND part_id = $2 AND fulfilled_at IS NULL`,
+			jobID,
+			part.ID,
+		)
+
+		if err != nil {
+			http.Error(w, "failed to update part waits: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		if err := tx.Commit(ctx); err != nil {
+			http.Error(w, "failed to commit: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		json.NewEncoder(w).Encode(usage)
+	}
+}
+
+// WaitForPartHandler records that a job is blocked on a part and moves
+// the job to waiting_parts.
+func WaitForPartHandler(db *pgxpool.Pool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		jobID, err := uuid.Parse(chi.URLParam(r, "id"))
+		if err != nil {
+			http.Error(w, "invalid job id", http.StatusBadRequest)
+			return
+		}
+
+		var req WaitForPartRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "invalid JSON", http.StatusBadRequest)
+			return
+		}
+
+		if req.PartID == uuid.Nil || req.Quantity <= 0 {
+			http.Error(w, "part_id and a positive quantity are required", http.StatusBadRequest)
+			return
+		}
+
+		ctx := context.Background()
+
+		tx, err := db.Begin(ctx)
+		if err != nil {
+			http.Error(w, "failed to start transaction: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		defer tx.Rollback(ctx)
+
+		found, err := setJobStatus(ctx, tx, jobID, "waiting_parts")
+		if err != nil {
+			http.Error(w, "failed to update job: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		if !found {
+			http.Error(w, "job not found", http.StatusNotFound)
+			return
+		}
+
+		_, err = tx.Exec(ctx,
+			`INSERT INTO job_part_waits (id, job_id, part_id, quantity, created_at)
+             VALUES ($1, $2, $3, $4, NOW())`,
+			uuid.New(),
+			jobID,
+			req.PartID,
+			req.Quantity,
+		)
+
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == "23503" {
+			http.Error(w, "part not found", http.StatusNotFound)
+			return
+		}
+
+		if err != nil {
+			http.Error(w, "failed to record part wait: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		if err := tx.Commit(ctx); err != nil {
+			http.Error(w, "failed to commit: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		json.NewEncoder(w).Encode(UpdateStatusResponse{
+			JobID:  jobID,
+			Status: "waiting_parts",
+		})
+	}
+}
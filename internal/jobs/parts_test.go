@@ -0,0 +1,61 @@
+package jobs
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+)
+
+func TestLowStockRecorded(t *testing.T) {
+	db := testDB(t)
+	jobID := seedJob(t, db)
+
+	r := chi.NewRouter()
+	r.Post("/parts", CreatePartHandler(db))
+	r.Get("/parts/low-stock", ListLowStockPartsHandler(db))
+	r.Post("/parts/{id}/stock", AdjustStockHandler(db))
+	r.Post("/jobs/{id}/parts", UsePartHandler(db))
+
+	do := func(method, url, body string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		r.ServeHTTP(rec, httptest.NewRequest(method, url, strings.NewReader(body)))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("%s %s: %d %s", method, url, rec.Code, rec.Body)
+		}
+		return rec
+	}
+
+	lowStock := func() []Part {
+		var parts []Part
+		json.NewDecoder(do(http.MethodGet, "/parts/low-stock", "").Body).Decode(&parts)
+		return parts
+	}
+
+	var part Part
+	json.NewDecoder(do(http.MethodPost, "/parts",
+		`{"sku": "VAL-15", "description": "15mm valve", "sell_price": 6, "stock_quantity": 6, "reorder_level": 5}`,
+	).Body).Decode(&part)
+
+	if part.LowStockSince != nil || len(lowStock()) != 0 {
+		t.Fatalf("part above its reorder level is low stock")
+	}
+
+	// Using 2 takes it to 4, below the reorder level
+	do(http.MethodPost, "/jobs/"+jobID.String()+"/parts", `{"part_id": "`+part.ID.String()+`", "quantity": 2}`)
+
+	low := lowStock()
+	if len(low) != 1 || low[0].LowStockSince == nil {
+		t.Fatalf("got low stock %+v, want the part with low_stock_since", low)
+	}
+
+	// Restocking clears it
+	do(http.MethodPost, "/parts/"+part.ID.String()+"/stock", `{"quantity": 10}`)
+
+	if low := lowStock(); len(low) != 0 {
+		t.Errorf("got low stock %+v after restocking, want none", low)
+	}
+}
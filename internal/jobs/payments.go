@@ -0,0 +1,184 @@
+package jobs
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"math"
+	"net/http"
+	"time"
+
+	"pistachio/internal/links"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+type RecordPaymentRequest struct {
+	Amount    float64    `json:"amount"`
+	Method    string     `json:"method"`
+	Reference string     `json:"reference"`
+	PaidAt    *time.Time `json:"paid_at"` // default: now
+}
+
+type Payment struct {
+	ID        uuid.UUID `json:"id"`
+	InvoiceID uuid.UUID `json:"invoice_id"`
+	Amount    float64   `json:"amount"`
+	Method    string    `json:"method"`
+	Reference string    `json:"reference"`
+	PaidAt    string    `json:"paid_at"`
+	CreatedAt string    `json:"created_at"`
+}
+
+// RecordPaymentHandler records money received against an invoice. Once
+// the balance reaches zero the invoice is marked paid, which stops any
+// further reminders.
+func RecordPaymentHandler(db *pgxpool.Pool, signer *links.Signer) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		invoiceID, err := uuid.Parse(chi.URLParam(r, "id"))
+		if err != nil {
+			http.Error(w, "invalid invoice id", http.StatusBadRequest)
+			return
+		}
+
+		var req RecordPaymentRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "invalid JSON", http.StatusBadRequest)
+			return
+		}
+
+		req.Amount = math.Round(req.Amount*100) / 100
+		if req.Amount <= 0 {
+			http.Error(w, "amount must be greater than 0", http.StatusBadRequest)
+			return
+		}
+
+		paidAt := time.Now()
+		if req.PaidAt != nil {
+			paidAt = *req.PaidAt
+		}
+
+		ctx := context.Background()
+
+		tx, err := db.Begin(ctx)
+		if err != nil {
+			http.Error(w, "failed to start transaction: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		defer tx.Rollback(ctx)
+
+		// 1️⃣ Lock the invoice and check the payment fits the balance
+		var status string
+		var balance float64
+
+		err = tx.QueryRow(ctx,
+			`SELECT status, `+invoiceBalanceSQL+` FROM invoices WHERE id = $1 FOR UPDATE`,
+			invoiceID,
+		).Scan(&status, &balance)
+
+		if errors.Is(err, pgx.ErrNoRows) {
+			http.Error(w, "invoice not found", http.StatusNotFound)
+			return
+		}
+
+		if err != nil {
+			http.Error(w, "failed to load invoice: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		if status != InvoiceIssued && status != InvoiceOverdue {
+			http.Error(w, "invoice is "+status+" and has nothing left to pay", http.StatusConflict)
+			return
+		}
+
+		if req.Amount > math.Round(balance*100)/100 {
+			http.Error(w, "amount is more than the outstanding balance", http.StatusBadRequest)
+			return
+		}
+
+		// 2️⃣ Record the payment
+		_, err = tx.Exec(ctx,
+			`INSERT INTO invoice_payments (id, invoice_id, amount, method, reference, paid_at, created_at)
+             VALUES ($1, $2, $3, $4, $5, $6, NOW())`,
+			uuid.New(),
+			invoiceID,
+			req.Amount,
+			req.Method,
+			req.Reference,
+			paidAt,
+		)
+
+		if err != nil {
+			http.Error(w, "failed to record payment: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		// 3️⃣ Update the invoice balance and status
+		inv, err := scanInvoiceSummary(tx.QueryRow(ctx,
+			`UPDATE invoices
+             SET amount_paid = amount_paid + $1,
+                 status = CASE WHEN `+invoiceBalanceSQL+` - $1 <= 0 THEN $2 ELSE status END,
+                 paid_at = CASE WHEN `+invoiceBalanceSQL+` - $1 <= 0 THEN $3 ELSE paid_at END
+             WHERE id = $4
+             RETURNING `+invoiceSummaryColumns,
+			req.Amount,
+			InvoicePaid,
+			paidAt,
+			invoiceID,
+		), signer)
+
+		if err != nil {
+			http.Error(w, "failed to update invoice: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		if err := tx.Commit(ctx); err != nil {
+			http.Error(w, "failed to commit: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		json.NewEncoder(w).Encode(inv)
+	}
+}
+
+func ListPaymentsHandler(db *pgxpool.Pool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		invoiceID, err := uuid.Parse(chi.URLParam(r, "id"))
+		if err != nil {
+			http.Error(w, "invalid invoice id", http.StatusBadRequest)
+			return
+		}
+
+		ctx := context.Background()
+
+		rows, err := db.Query(ctx,
+			`SELECT id, invoice_id, amount, COALESCE(method, ''), COALESCE(reference, ''), paid_at, created_at
+             FROM invoice_payments WHERE invoice_id = $1
+             ORDER BY paid_at`,
+			invoiceID,
+		)
+		if err != nil {
+			http.Error(w, "failed to query payments: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		defer rows.Close()
+
+		payments := []Payment{}
+		for rows.Next() {
+			var p Payment
+			var paidAt, createdAt time.Time
+			if err := rows.Scan(&p.ID, &p.InvoiceID, &p.Amount, &p.Method, &p.Reference, &paidAt, &createdAt); err != nil {
+				http.Error(w, "scan error: "+err.Error(), http.StatusInternalServerError)
+				return
+			}
+			p.PaidAt = paidAt.Format(time.RFC3339)
+			p.CreatedAt = createdAt.Format(time.RFC3339)
+			payments = append(payments, p)
+		}
+
+		json.NewEncoder(w).Encode(payments)
+	}
+}
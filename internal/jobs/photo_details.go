@@ -0,0 +1,279 @@
+package jobs
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"pistachio/internal/links"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// Photo categories
+const (
+	PhotoBefore  = "before"
+	PhotoDuring  = "during"
+	PhotoAfter   = "after"
+	PhotoIssue   = "issue"
+	PhotoReceipt = "receipt"
+)
+
+// photoCategories is the order photo groups are listed in. Photos
+// without a category come last.
+var photoCategories = []string{PhotoBefore, PhotoDuring, PhotoAfter, PhotoIssue, PhotoReceipt, ""}
+
+const maxCaptionLength = 500
+
+// PhotoDetails are what the uploader tells us about a photo.
+type PhotoDetails struct {
+	Caption    string
+	Category   string
+	UploadedBy string
+}
+
+func (d PhotoDetails) validate() error {
+	return validatePhotoFields(d.Caption, d.Category)
+}
+
+func validatePhotoFields(caption, category string) error {
+	if !slices.Contains(photoCategories, category) {
+		return rejectUpload(http.StatusBadRequest, "category must be one of before, during, after, issue or receipt")
+	}
+	if len(caption) > maxCaptionLength {
+		return rejectUpload(http.StatusBadRequest, "caption is too long")
+	}
+	return nil
+}
+
+type UpdatePhotoRequest struct {
+	Caption       string     `json:"caption"`
+	Category      string     `json:"category"`
+	SortOrder     int        `json:"sort_order"`
+	BeforePhotoID *uuid.UUID `json:"before_photo_id"` // after photos only; null to unpair
+}
+
+const photoColumns = `id, job_id, variants_status, COALESCE(caption, ''), COALESCE(category, ''), sort_order,
+    taken_at, COALESCE(uploaded_by, ''), before_photo_id, created_at`
+
+// photoOrder lists photos as they were arranged, then in the order they
+// were taken.
+const photoOrder = `sort_order, COALESCE(taken_at, created_at), created_at`
+
+func scanPhoto(row pgx.Row, signer *links.Signer) (PhotoResponse, error) {
+	var p PhotoResponse
+	var takenAt *time.Time
+	var createdAt time.Time
+
+	err := row.Scan(
+		&p.ID, &p.JobID, &p.VariantsStatus, &p.Caption, &p.Category, &p.SortOrder,
+		&takenAt, &p.UploadedBy, &p.BeforePhotoID, &createdAt,
+	)
+	if err != nil {
+		return PhotoResponse{}, err
+	}
+
+	p.FileURL = signer.URL(photoPublicPath(p.ID))
+	p.Variants = photoVariantURLs(signer, p.ID, p.VariantsStatus)
+	if takenAt != nil {
+		p.TakenAt = takenAt.Format(time.RFC3339)
+	}
+	p.CreatedAt = createdAt.Format(time.RFC3339)
+	return p, nil
+}
+
+// loadPhoto reads back a saved photo, e.g. once a resumable upload of it
+// has finished.
+func loadPhoto(ctx context.Context, db pgxQuerier, signer *links.Signer, photoID uuid.UUID) (PhotoResponse, error) {
+	return scanPhoto(db.QueryRow(ctx, `SELECT `+photoColumns+` FROM job_photos WHERE id = $1`, photoID), signer)
+}
+
+func listJobPhotos(ctx context.Context, db *pgxpool.Pool, signer *links.Signer, jobID uuid.UUID) ([]JobPhoto, error) {
+	rows, err := db.Query(ctx,
+		`SELECT `+photoColumns+` FROM job_photos WHERE job_id = $1 ORDER BY `+photoOrder,
+		jobID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	photos := []JobPhoto{}
+	for rows.Next() {
+		p, err := scanPhoto(rows, signer)
+		if err != nil {
+			return nil, err
+		}
+		photos = append(photos, p.JobPhoto)
+	}
+
+	return photos, rows.Err()
+}
+
+// groupPhotos splits photos by category, keeping their order. Only
+// categories with photos are listed.
+func groupPhotos(photos []JobPhoto) []PhotoGroup {
+	groups := []PhotoGroup{}
+	for _, category := range photoCategories {
+		group := PhotoGroup{Category: category}
+		for _, p := range photos {
+			if p.Category == category {
+				group.Photos = append(group.Photos, p)
+			}
+		}
+		if len(group.Photos) > 0 {
+			groups = append(groups, group)
+		}
+	}
+	return groups
+}
+
+// pairPhotos matches after photos with their before photos, in the order
+// of the after photos.
+func pairPhotos(photos []JobPhoto) []PhotoPair {
+	byID := make(map[uuid.UUID]JobPhoto, len(photos))
+	for _, p := range photos {
+		byID[p.ID] = p
+	}
+
+	pairs := []PhotoPair{}
+	for _, p := range photos {
+		if p.BeforePhotoID == nil {
+			continue
+		}
+		if before, ok := byID[*p.BeforePhotoID]; ok {
+			pairs = append(pairs, PhotoPair{Before: before, After: p})
+		}
+	}
+	return pairs
+}
+
+// UpdatePhotoHandler sets a photo's caption, category and sort order, and
+// pairs an after photo with a before photo of the same job.
+func UpdatePhotoHandler(db *pgxpool.Pool, signer *links.Signer) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		photoID, err := uuid.Parse(chi.URLParam(r, "id"))
+		if err != nil {
+			http.Error(w, "invalid photo id", http.StatusBadRequest)
+			return
+		}
+
+		var req UpdatePhotoRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "invalid request body", http.StatusBadRequest)
+			return
+		}
+
+		req.Caption = strings.TrimSpace(req.Caption)
+		if err := validatePhotoFields(req.Caption, req.Category); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		if req.BeforePhotoID != nil && req.Category != PhotoAfter {
+			http.Error(w, "only after photos can be paired with a before photo", http.StatusBadRequest)
+			return
+		}
+
+		if req.BeforePhotoID != nil && *req.BeforePhotoID == photoID {
+			http.Error(w, "a photo can't be paired with itself", http.StatusBadRequest)
+			return
+		}
+
+		ctx := context.Background()
+
+		tx, err := db.Begin(ctx)
+		if err != nil {
+			http.Error(w, "failed to start transaction: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		defer tx.Rollback(ctx)
+
+		// 1️⃣ Load the photo
+		var jobID uuid.UUID
+		err = tx.QueryRow(ctx, `SELECT job_id FROM job_photos WHERE id = $1 FOR UPDATE`, photoID).Scan(&jobID)
+		if errors.Is(err, pgx.ErrNoRows) {
+			http.Error(w, "photo not found", http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			http.Error(w, "failed to load photo: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		// 2️⃣ The before photo must be a before photo of the same job
+		if req.BeforePhotoID != nil {
+			var beforeCategory string
+			err = tx.QueryRow(ctx,
+				`SELECT COALESCE(category, '') FROM job_photos WHERE id = $1 AND job_id = $2`,
+				*req.BeforePhotoID,
+				jobID,
+			).Scan(&beforeCategory)
+
+			if errors.Is(err, pgx.ErrNoRows) {
+				http.Error(w, "before photo not found on this job", http.StatusBadRequest)
+				return
+			}
+			if err != nil {
+				http.Error(w, "failed to load before photo: "+err.Error(), http.StatusInternalServerError)
+				return
+			}
+			if beforeCategory != PhotoBefore {
+				http.Error(w, "the photo to pair with is not a before photo", http.StatusBadRequest)
+				return
+			}
+		}
+
+		// 3️⃣ Update it
+		_, err = tx.Exec(ctx,
+			`UPDATE job_photos
+             SET caption = NULLIF($1, ''), category = NULLIF($2, ''), sort_order = $3, before_photo_id = $4
+             WHERE id = $5`,
+			req.Caption,
+			req.Category,
+			req.SortOrder,
+			req.BeforePhotoID,
+			photoID,
+		)
+
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == "23505" {
+			http.Error(w, "that before photo is already paired with another after photo", http.StatusConflict)
+			return
+		}
+		if err != nil {
+			http.Error(w, "failed to update photo: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		// A photo that is no longer a before photo loses its after photo
+		if req.Category != PhotoBefore {
+			_, err = tx.Exec(ctx, `UPDATE job_photos SET before_photo_id = NULL WHERE before_photo_id = $1`, photoID)
+			if err != nil {
+				http.Error(w, "failed to unpair photo: "+err.Error(), http.StatusInternalServerError)
+				return
+			}
+		}
+
+		photo, err := loadPhoto(ctx, tx, signer, photoID)
+		if err != nil {
+			http.Error(w, "failed to load photo: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		if err := tx.Commit(ctx); err != nil {
+			http.Error(w, "failed to commit: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		json.NewEncoder(w).Encode(photo)
+	}
+}
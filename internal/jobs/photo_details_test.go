@@ -0,0 +1,161 @@
+package jobs
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+func TestGroupPhotos(t *testing.T) {
+	photo := func(category string) JobPhoto {
+		return JobPhoto{ID: uuid.New(), Category: category}
+	}
+	list := []JobPhoto{photo(PhotoAfter), photo(""), photo(PhotoBefore), photo(PhotoAfter), photo(PhotoReceipt)}
+
+	groups := groupPhotos(list)
+
+	var got []string
+	for _, g := range groups {
+		got = append(got, fmt.Sprintf("%s:%d", g.Category, len(g.Photos)))
+	}
+	if want := "before:1 after:2 receipt:1 :1"; strings.Join(got, " ") != want {
+		t.Errorf("got groups %v, want %s", got, want)
+	}
+	if after := groups[1].Photos; after[0].ID != list[0].ID || after[1].ID != list[3].ID {
+		t.Error("after photos aren't in their listed order")
+	}
+
+	if got := groupPhotos(nil); got == nil || len(got) != 0 {
+		t.Errorf("no photos: got %v, want an empty list", got)
+	}
+}
+
+func TestPairPhotos(t *testing.T) {
+	before1 := JobPhoto{ID: uuid.New(), Category: PhotoBefore}
+	before2 := JobPhoto{ID: uuid.New(), Category: PhotoBefore}
+	gone := uuid.New()
+
+	after2 := JobPhoto{ID: uuid.New(), Category: PhotoAfter, BeforePhotoID: &before2.ID}
+	after1 := JobPhoto{ID: uuid.New(), Category: PhotoAfter, BeforePhotoID: &before1.ID}
+	unpaired := JobPhoto{ID: uuid.New(), Category: PhotoAfter}
+	orphan := JobPhoto{ID: uuid.New(), Category: PhotoAfter, BeforePhotoID: &gone}
+
+	pairs := pairPhotos([]JobPhoto{before1, after2, unpaired, before2, orphan, after1})
+
+	if len(pairs) != 2 {
+		t.Fatalf("got %d pairs, want 2", len(pairs))
+	}
+	// In the order of the after photos
+	if pairs[0].Before.ID != before2.ID || pairs[0].After.ID != after2.ID ||
+		pairs[1].Before.ID != before1.ID || pairs[1].After.ID != after1.ID {
+		t.Errorf("got pairs %+v", pairs)
+	}
+}
+
+func TestPhotoDetailsAndPairing(t *testing.T) {
+	p := newPhotoTest(t)
+	ctx := context.Background()
+
+	jobID := seedJob(t, p.db)
+	_, err := p.db.Exec(ctx, `UPDATE jobs SET description = 'Leak under the sink', estimate = 120 WHERE id = $1`, jobID)
+	if err == nil {
+		_, err = p.db.Exec(ctx, `UPDATE customers SET phone = '0117 496 0000' WHERE id = (SELECT customer_id FROM jobs WHERE id = $1)`, jobID)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if rec := p.upload(jobID, testJPEG(t, 30, 30), map[string]string{"category": "gallery"}); rec.Code != http.StatusBadRequest {
+		t.Errorf("unknown category: got status %d, want 400", rec.Code)
+	}
+
+	before := p.mustUpload(jobID, testJPEG(t, 40, 30), map[string]string{"category": PhotoBefore, "caption": "  Corroded valve ", "user": "sam"})
+	if before.Caption != "Corroded valve" || before.Category != PhotoBefore || before.UploadedBy != "sam" {
+		t.Errorf("got %q %q %q, want the details uploaded", before.Caption, before.Category, before.UploadedBy)
+	}
+	after := p.mustUpload(jobID, testJPEG(t, 50, 30), map[string]string{"category": PhotoAfter})
+	during := p.mustUpload(jobID, testJPEG(t, 60, 30), map[string]string{"category": PhotoDuring})
+	elsewhere := p.mustUpload(seedJob(t, p.db), testJPEG(t, 70, 30), map[string]string{"category": PhotoBefore})
+
+	update := func(id uuid.UUID, category string, beforeID *uuid.UUID) *httptest.ResponseRecorder {
+		body, _ := json.Marshal(UpdatePhotoRequest{Caption: "Valve replaced", Category: category, SortOrder: 1, BeforePhotoID: beforeID})
+		return serve(p.router, http.MethodPut, "/photos/"+id.String(), string(body))
+	}
+
+	tests := []struct {
+		name     string
+		category string
+		beforeID uuid.UUID
+		want     int
+	}{
+		{"not an after photo", PhotoDuring, before.ID, http.StatusBadRequest},
+		{"with itself", PhotoAfter, after.ID, http.StatusBadRequest},
+		{"another job's photo", PhotoAfter, elsewhere.ID, http.StatusBadRequest},
+		{"not a before photo", PhotoAfter, during.ID, http.StatusBadRequest},
+		{"unknown photo", PhotoAfter, uuid.New(), http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		if rec := update(after.ID, tt.category, &tt.beforeID); rec.Code != tt.want {
+			t.Errorf("pairing %s: got status %d, want %d", tt.name, rec.Code, tt.want)
+		}
+	}
+
+	rec := update(after.ID, PhotoAfter, &before.ID)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("pair: %d %s", rec.Code, rec.Body)
+	}
+	var paired PhotoResponse
+	json.NewDecoder(rec.Body).Decode(&paired)
+	if paired.BeforePhotoID == nil || *paired.BeforePhotoID != before.ID || paired.Caption != "Valve replaced" || paired.SortOrder != 1 {
+		t.Errorf("got %+v after pairing", paired.JobPhoto)
+	}
+
+	// A before photo pairs with one after photo
+	if rec := update(during.ID, PhotoAfter, &before.ID); rec.Code != http.StatusConflict {
+		t.Errorf("second after photo: got status %d, want 409", rec.Code)
+	}
+
+	rec = serve(p.router, http.MethodGet, "/jobs/"+jobID.String(), "")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("job detail: %d %s", rec.Code, rec.Body)
+	}
+	var detail JobDetailResponse
+	json.NewDecoder(rec.Body).Decode(&detail)
+
+	var groups []string
+	for _, g := range detail.PhotoGroups {
+		groups = append(groups, g.Category)
+	}
+	if got := strings.Join(groups, " "); got != "before during after" {
+		t.Errorf("got photo groups %q, want before, during and after", got)
+	}
+	if len(detail.PhotoPairs) != 1 || detail.PhotoPairs[0].After.ID != after.ID || detail.ReportURL == "" {
+		t.Errorf("got pairs %+v and report %q", detail.PhotoPairs, detail.ReportURL)
+	}
+
+	rec = serve(p.router, http.MethodGet, "/jobs/"+jobID.String()+"/report.pdf", "")
+	if rec.Code != http.StatusOK || rec.Header().Get("Content-Type") != "application/pdf" || !strings.HasPrefix(rec.Body.String(), "%PDF-") {
+		t.Errorf("report: got %d %s", rec.Code, rec.Header().Get("Content-Type"))
+	}
+
+	// No longer a before photo, so its after photo is unpaired
+	if rec := update(before.ID, PhotoIssue, nil); rec.Code != http.StatusOK {
+		t.Fatalf("recategorise: %d %s", rec.Code, rec.Body)
+	}
+	if got, err := loadPhoto(ctx, p.db, p.signer, after.ID); err != nil || got.BeforePhotoID != nil {
+		t.Errorf("after photo still paired with %v (%v)", got.BeforePhotoID, err)
+	}
+
+	if rec := serve(p.router, http.MethodGet, "/jobs/"+jobID.String()+"/report.pdf", ""); rec.Code != http.StatusConflict {
+		t.Errorf("report without pairs: got status %d, want 409", rec.Code)
+	}
+	if rec := serve(p.router, http.MethodGet, "/jobs/"+uuid.NewString()+"/report.pdf", ""); rec.Code != http.StatusNotFound {
+		t.Errorf("report for an unknown job: got status %d, want 404", rec.Code)
+	}
+}
@@ -0,0 +1,177 @@
+package jobs
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"pistachio/internal/links"
+	"pistachio/internal/photos"
+	"pistachio/internal/queue"
+	"pistachio/internal/storage"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// Photo variant statuses. Variants are made by a background task after
+// upload, so a new photo starts as pending.
+const (
+	VariantsPending     = "pending"
+	VariantsReady       = "ready"
+	VariantsFailed      = "failed"      // the photo could not be decoded
+	VariantsUnsupported = "unsupported" // HEIC, or a file type accepted before uploads were checked
+)
+
+// photoVariantColumns are the job_photos columns holding each resized
+// variant's storage key.
+var photoVariantColumns = map[string]string{
+	photos.Thumbnail: "thumbnail_key",
+	photos.Medium:    "medium_key",
+}
+
+func photoVariantKey(photoID uuid.UUID, variant string) string {
+	return "photos/variants/" + photoID.String() + "/" + variant + ".jpg"
+}
+
+// photoVariantURLs returns signed links to a photo's variants. Until the
+// resized variants are ready only the original is linked.
+func photoVariantURLs(signer *links.Signer, photoID uuid.UUID, status string) PhotoVariants {
+	v := PhotoVariants{Original: signer.URL(photoPublicPath(photoID))}
+	if status == VariantsReady {
+		v.Thumbnail = signer.URL(photoPublicPath(photoID) + "/" + photos.Thumbnail)
+		v.Medium = signer.URL(photoPublicPath(photoID) + "/" + photos.Medium)
+	}
+	return v
+}
+
+func renderPhotoVariants(ctx context.Context, db *pgxpool.Pool, store storage.Storage, payload json.RawMessage) error {
+	task, err := decodeDocumentTask(payload)
+	if err != nil {
+		return err
+	}
+	return ProcessPhoto(ctx, db, store, task.ID)
+}
+
+// ProcessPhoto makes a photo's thumbnail and medium variants. Photos
+// uploaded before locations were stripped are stripped first, and the
+// file as sent is kept as the original. It is run by the photo variants
+// task and by cmd/backfill-photos, and is safe to run again.
+func ProcessPhoto(ctx context.Context, db *pgxpool.Pool, store storage.Storage, photoID uuid.UUID) error {
+	var fileKey string
+	var originalKey *string
+
+	err := db.QueryRow(ctx,
+		`SELECT file_key, original_key FROM job_photos WHERE id = $1`,
+		photoID,
+	).Scan(&fileKey, &originalKey)
+
+	if errors.Is(err, pgx.ErrNoRows) {
+		return queue.Permanent(fmt.Errorf("photo %s not found", photoID))
+	}
+	if err != nil {
+		return fmt.Errorf("failed to load photo: %w", err)
+	}
+
+	data, err := readStoredFile(ctx, store, fileKey)
+	if errors.Is(err, storage.ErrNotFound) {
+		setVariantsStatus(ctx, db, photoID, VariantsFailed)
+		return queue.Permanent(fmt.Errorf("photo %s file is missing", photoID))
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read photo: %w", err)
+	}
+
+	format, err := photos.Sniff(data)
+	if err != nil {
+		return setVariantsStatus(ctx, db, photoID, VariantsUnsupported)
+	}
+
+	if originalKey == nil {
+		if data, err = stripLegacyPhoto(ctx, db, store, photoID, fileKey, data, format); err != nil {
+			return err
+		}
+	}
+
+	variants, err := photos.MakeVariants(data, format)
+	if errors.Is(err, photos.ErrNoDecoder) {
+		return setVariantsStatus(ctx, db, photoID, VariantsUnsupported)
+	}
+	if err != nil {
+		setVariantsStatus(ctx, db, photoID, VariantsFailed)
+		return queue.Permanent(fmt.Errorf("failed to resize photo: %w", err))
+	}
+
+	for name, variant := range variants {
+		if err := store.Put(ctx, photoVariantKey(photoID, name), bytes.NewReader(variant), "image/jpeg"); err != nil {
+			return fmt.Errorf("failed to store %s: %w", name, err)
+		}
+	}
+
+	// Photos from before taken_at was recorded get it here
+	var takenAt *time.Time
+	if t, ok := photos.TakenAt(data, format); ok {
+		takenAt = &t
+	}
+
+	_, err = db.Exec(ctx,
+		`UPDATE job_photos
+         SET thumbnail_key = $1, medium_key = $2, variants_status = $3, taken_at = COALESCE(taken_at, $4)
+         WHERE id = $5`,
+		photoVariantKey(photoID, photos.Thumbnail),
+		photoVariantKey(photoID, photos.Medium),
+		VariantsReady,
+		takenAt,
+		photoID,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to update photo: %w", err)
+	}
+
+	return nil
+}
+
+// stripLegacyPhoto keeps a photo uploaded before location stripping as
+// the original and replaces the customer copy with a stripped one.
+func stripLegacyPhoto(ctx context.Context, db *pgxpool.Pool, store storage.Storage, photoID uuid.UUID, fileKey string, data []byte, format photos.Format) ([]byte, error) {
+	stripped, err := photos.StripLocation(data, format)
+	if err != nil {
+		setVariantsStatus(ctx, db, photoID, VariantsFailed)
+		return nil, queue.Permanent(fmt.Errorf("failed to remove photo location: %w", err))
+	}
+
+	originalKey := "photos/originals/" + photoID.String() + format.Ext()
+	if err := store.Put(ctx, originalKey, bytes.NewReader(data), format.ContentType()); err != nil {
+		return nil, fmt.Errorf("failed to store original: %w", err)
+	}
+	if err := store.Put(ctx, fileKey, bytes.NewReader(stripped), format.ContentType()); err != nil {
+		return nil, fmt.Errorf("failed to store photo: %w", err)
+	}
+
+	// The original gets no hash: older uploads of the same photo to a job
+	// would clash on the de-duplication index
+	_, err = db.Exec(ctx,
+		`UPDATE job_photos SET original_key = $1, content_type = $2, file_sha256 = $3 WHERE id = $4`,
+		originalKey,
+		format.ContentType(),
+		storage.Hash(stripped),
+		photoID,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to update photo: %w", err)
+	}
+
+	return stripped, nil
+}
+
+func setVariantsStatus(ctx context.Context, db *pgxpool.Pool, photoID uuid.UUID, status string) error {
+	_, err := db.Exec(ctx, `UPDATE job_photos SET variants_status = $1 WHERE id = $2`, status, photoID)
+	if err != nil {
+		return fmt.Errorf("failed to update photo: %w", err)
+	}
+	return nil
+}
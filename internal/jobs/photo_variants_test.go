@@ -0,0 +1,252 @@
+package jobs
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"image"
+	"image/jpeg"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"pistachio/internal/links"
+	"pistachio/internal/photos"
+	"pistachio/internal/storage"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// testJPEG is a plain w x h JPEG with no metadata.
+func testJPEG(t *testing.T, w, h int) []byte {
+	t.Helper()
+
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, image.NewRGBA(image.Rect(0, 0, w, h)), nil); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+type photoTest struct {
+	t      *testing.T
+	db     *pgxpool.Pool
+	store  storage.Storage
+	signer *links.Signer
+	router chi.Router
+}
+
+func newPhotoTest(t *testing.T) *photoTest {
+	db := testDB(t)
+	signer := links.New(links.Config{Secret: "test", BaseURL: "http://localhost", TTL: time.Hour})
+	store := storage.NewLocal(t.TempDir(), signer)
+
+	r := chi.NewRouter()
+	r.Get("/jobs/{id}", GetJobDetailHandler(db, signer))
+	r.Post("/jobs/{id}/photos", UploadPhotoHandler(db, store, signer))
+	r.Get("/jobs/{id}/report.pdf", JobReportHandler(db, store))
+	r.Put("/photos/{id}", UpdatePhotoHandler(db, signer))
+	r.Get("/photos/{id}/thumbnail", PhotoVariantHandler(db, store, photos.Thumbnail))
+	r.Get("/photos/{id}/medium", PhotoVariantHandler(db, store, photos.Medium))
+
+	return &photoTest{t: t, db: db, store: store, signer: signer, router: r}
+}
+
+// upload posts a photo with the given form fields.
+func (p *photoTest) upload(jobID uuid.UUID, data []byte, fields map[string]string) *httptest.ResponseRecorder {
+	p.t.Helper()
+
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	for name, value := range fields {
+		mw.WriteField(name, value)
+	}
+	fw, err := mw.CreateFormFile("file", "photo.jpg")
+	if err != nil {
+		p.t.Fatal(err)
+	}
+	fw.Write(data)
+	mw.Close()
+
+	req := httptest.NewRequest(http.MethodPost, "/jobs/"+jobID.String()+"/photos", &body)
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+	rec := httptest.NewRecorder()
+	p.router.ServeHTTP(rec, req)
+	return rec
+}
+
+func (p *photoTest) mustUpload(jobID uuid.UUID, data []byte, fields map[string]string) PhotoResponse {
+	p.t.Helper()
+
+	rec := p.upload(jobID, data, fields)
+	if rec.Code != http.StatusOK {
+		p.t.Fatalf("upload photo: %d %s", rec.Code, rec.Body)
+	}
+	var resp PhotoResponse
+	if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+		p.t.Fatal(err)
+	}
+	return resp
+}
+
+func (p *photoTest) variantsStatus(photoID uuid.UUID) string {
+	p.t.Helper()
+
+	var status string
+	err := p.db.QueryRow(context.Background(), `SELECT variants_status FROM job_photos WHERE id = $1`, photoID).Scan(&status)
+	if err != nil {
+		p.t.Fatal(err)
+	}
+	return status
+}
+
+func TestPhotoVariants(t *testing.T) {
+	p := newPhotoTest(t)
+	ctx := context.Background()
+
+	photo := p.mustUpload(seedJob(t, p.db), testJPEG(t, 2000, 1500), nil)
+
+	// The upload only queues the variants
+	if photo.VariantsStatus != VariantsPending || photo.Variants.Thumbnail != "" || photo.Variants.Original == "" {
+		t.Errorf("got %s %+v, want pending with only the original linked", photo.VariantsStatus, photo.Variants)
+	}
+	var queued int
+	p.db.QueryRow(ctx,
+		`SELECT COUNT(*) FROM tasks WHERE kind = $1 AND payload->>'id' = $2`,
+		TaskPhotoVariants,
+		photo.ID.String(),
+	).Scan(&queued)
+	if queued != 1 {
+		t.Errorf("got %d variant tasks queued, want 1", queued)
+	}
+	if rec := serve(p.router, http.MethodGet, "/photos/"+photo.ID.String()+"/thumbnail", ""); rec.Code != http.StatusConflict {
+		t.Errorf("thumbnail before it's made: got status %d, want 409", rec.Code)
+	}
+
+	// Run twice, as a retried task would be
+	for i := 0; i < 2; i++ {
+		if err := ProcessPhoto(ctx, p.db, p.store, photo.ID); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got := p.variantsStatus(photo.ID); got != VariantsReady {
+		t.Fatalf("got variants %s, want ready", got)
+	}
+
+	for _, v := range photos.Variants {
+		rec := serve(p.router, http.MethodGet, "/photos/"+photo.ID.String()+"/"+v.Name, "")
+		if rec.Code != http.StatusOK || rec.Header().Get("Content-Type") != "image/jpeg" {
+			t.Errorf("%s: got %d %s", v.Name, rec.Code, rec.Header().Get("Content-Type"))
+			continue
+		}
+		cfg, err := jpeg.DecodeConfig(rec.Body)
+		if err != nil || cfg.Width != v.MaxSide {
+			t.Errorf("%s: got %d wide (%v), want %d", v.Name, cfg.Width, err, v.MaxSide)
+		}
+	}
+
+	urls := photoVariantURLs(p.signer, photo.ID, VariantsReady)
+	if !strings.Contains(urls.Thumbnail, "/thumbnail") || !strings.Contains(urls.Medium, "/medium") {
+		t.Errorf("ready photo links %+v", urls)
+	}
+}
+
+// TestPhotoVariantsFailures runs the task on photos it can't resize.
+func TestPhotoVariantsFailures(t *testing.T) {
+	p := newPhotoTest(t)
+	ctx := context.Background()
+	jobID := seedJob(t, p.db)
+
+	insert := func(fileKey string, data []byte) uuid.UUID {
+		t.Helper()
+
+		if data != nil {
+			if err := p.store.Put(ctx, fileKey, bytes.NewReader(data), "application/octet-stream"); err != nil {
+				t.Fatal(err)
+			}
+		}
+		photoID := uuid.New()
+		_, err := p.db.Exec(ctx,
+			`INSERT INTO job_photos (id, job_id, file_key, original_key, variants_status, created_at)
+             VALUES ($1, $2, $3, $3, $4, NOW())`,
+			photoID,
+			jobID,
+			fileKey,
+			VariantsPending,
+		)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return photoID
+	}
+
+	tests := []struct {
+		name    string
+		photoID uuid.UUID
+		wantErr bool
+		want    string
+	}{
+		{"missing file", insert("photos/gone.jpg", nil), true, VariantsFailed},
+		{"not a photo", insert("photos/notes.txt", []byte("not a photo")), false, VariantsUnsupported},
+		{"corrupt JPEG", insert("photos/broken.jpg", testJPEG(t, 64, 64)[:200]), true, VariantsFailed},
+	}
+
+	for _, tt := range tests {
+		err := ProcessPhoto(ctx, p.db, p.store, tt.photoID)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%s: got error %v, want one: %v", tt.name, err, tt.wantErr)
+		}
+		if got := p.variantsStatus(tt.photoID); got != tt.want {
+			t.Errorf("%s: got variants %s, want %s", tt.name, got, tt.want)
+		}
+	}
+
+	if err := ProcessPhoto(ctx, p.db, p.store, uuid.New()); err == nil {
+		t.Error("unknown photo: got no error")
+	}
+}
+
+// TestBackfillLegacyPhoto processes a photo uploaded before originals
+// were kept apart: the file as sent becomes the original.
+func TestBackfillLegacyPhoto(t *testing.T) {
+	p := newPhotoTest(t)
+	ctx := context.Background()
+
+	data := testJPEG(t, 400, 300)
+	photoID := uuid.New()
+	fileKey := "photos/" + photoID.String() + ".jpg"
+	if err := p.store.Put(ctx, fileKey, bytes.NewReader(data), "image/jpeg"); err != nil {
+		t.Fatal(err)
+	}
+	_, err := p.db.Exec(ctx,
+		`INSERT INTO job_photos (id, job_id, file_key, created_at) VALUES ($1, $2, $3, NOW())`,
+		photoID,
+		seedJob(t, p.db),
+		fileKey,
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := ProcessPhoto(ctx, p.db, p.store, photoID); err != nil {
+		t.Fatal(err)
+	}
+
+	var originalKey, contentType string
+	p.db.QueryRow(ctx, `SELECT COALESCE(original_key, ''), COALESCE(content_type, '') FROM job_photos WHERE id = $1`, photoID).
+		Scan(&originalKey, &contentType)
+	if originalKey == "" || contentType != "image/jpeg" {
+		t.Fatalf("got original %q and content type %q", originalKey, contentType)
+	}
+	if got, err := readStoredFile(ctx, p.store, originalKey); err != nil || !bytes.Equal(got, data) {
+		t.Errorf("original isn't the file as sent (%v)", err)
+	}
+	if got := p.variantsStatus(photoID); got != VariantsReady {
+		t.Errorf("got variants %s, want ready", got)
+	}
+}
@@ -1,21 +1,35 @@
 package jobs
 
 import (
+    "bytes"
     "context"
     "encoding/json"
+    "errors"
     "fmt"
     "io"
     "net/http"
-    "os"
-    "path/filepath"
+    "net/url"
+    "strings"
     "time"
 
+    "pistachio/internal/links"
+    "pistachio/internal/photos"
+    "pistachio/internal/queue"
+    "pistachio/internal/storage"
+
     "github.com/go-chi/chi/v5"
     "github.com/google/uuid"
+    "github.com/jackc/pgx/v5"
+    "github.com/jackc/pgx/v5/pgconn"
     "github.com/jackc/pgx/v5/pgxpool"
 )
 
-func UploadPhotoHandler(db *pgxpool.Pool, uploadDir string) http.HandlerFunc {
+const (
+    maxPhotoSize      = 20 << 20 // 20 MB
+    multipartOverhead = 1 << 20  // form boundaries and headers
+)
+
+func UploadPhotoHandler(db *pgxpool.Pool, store storage.Storage, signer *links.Signer) http.HandlerFunc {
     return func(w http.ResponseWriter, r *http.Request) {
         jobIDParam := chi.URLParam(r, "id")
         jobID, err := uuid.Parse(jobIDParam)
@@ -33,64 +47,217 @@ func UploadPhotoHandler(db *pgxpool.Pool, uploadDir string) http.HandlerFunc {
             return
         }
 
-        // 2️⃣ Parse multipart form
-        r.ParseMultipartForm(10 << 20) // 10MB
+        // 2️⃣ Parse multipart form, refusing anything over the limit
+        r.Body = http.MaxBytesReader(w, r.Body, maxPhotoSize+multipartOverhead)
+        err = r.ParseMultipartForm(maxPhotoSize)
+
+        var tooBig *http.MaxBytesError
+        if errors.As(err, &tooBig) {
+            http.Error(w, fmt.Sprintf("photo is larger than %d MB", maxPhotoSize>>20), http.StatusRequestEntityTooLarge)
+            return
+        }
 
-        file, header, err := r.FormFile("file")
+        if err != nil {
+            http.Error(w, "invalid upload: "+err.Error(), http.StatusBadRequest)
+            return
+        }
+
+        file, _, err := r.FormFile("file")
         if err != nil {
             http.Error(w, "file upload error: "+err.Error(), http.StatusBadRequest)
             return
         }
         defer file.Close()
 
-        // 3️⃣ Create unique file path
-        photoID := uuid.New()
-        ext := filepath.Ext(header.Filename)
-        fileName := fmt.Sprintf("%s%s", photoID.String(), ext)
-
-        savePath := filepath.Join(uploadDir, fileName)
+        original, err := io.ReadAll(file)
+        if err != nil {
+            http.Error(w, "failed to read file: "+err.Error(), http.StatusBadRequest)
+            return
+        }
 
-        // Ensure directory exists
-        os.MkdirAll(uploadDir, os.ModePerm)
+        // 3️⃣ Check, store and record the photo
+        details := PhotoDetails{
+            Caption:    strings.TrimSpace(r.FormValue("caption")),
+            Category:   r.FormValue("category"),
+            UploadedBy: r.FormValue("user"),
+        }
 
-        // 4️⃣ Save file locally
-        dst, err := os.Create(savePath)
+        resp, err := savePhoto(ctx, db, store, signer, jobID, original, details)
         if err != nil {
-            http.Error(w, "failed to save file: "+err.Error(), http.StatusInternalServerError)
+            http.Error(w, err.Error(), uploadErrorStatus(err))
             return
         }
-        defer dst.Close()
 
-        _, err = io.Copy(dst, file)
+        json.NewEncoder(w).Encode(resp)
+    }
+}
+
+// UploadPhotosHandler takes several photos in one request, each in its
+// own "file" field. Each file succeeds or fails on its own. "category" and
+// "user" fields apply to the files after them.
+func UploadPhotosHandler(db *pgxpool.Pool, store storage.Storage, signer *links.Signer) http.HandlerFunc {
+    return func(w http.ResponseWriter, r *http.Request) {
+        jobID, err := uuid.Parse(chi.URLParam(r, "id"))
         if err != nil {
-            http.Error(w, "failed to write file: "+err.Error(), http.StatusInternalServerError)
+            http.Error(w, "invalid job id", http.StatusBadRequest)
             return
         }
 
-        fileURL := "/uploads/photos/" + fileName
-
-        // 5️⃣ Insert DB entry
-        _, err = db.Exec(ctx,
-            `INSERT INTO job_photos (id, job_id, file_url, created_at)
-             VALUES ($1, $2, $3, NOW())`,
-            photoID,
-            jobID,
-            fileURL,
-        )
+        ctx := context.Background()
 
-        if err != nil {
-            http.Error(w, "db insert failed: "+err.Error(), http.StatusInternalServerError)
+        if !jobExists(ctx, db, jobID) {
+            http.Error(w, "job not found", http.StatusNotFound)
             return
         }
 
-        // 6️⃣ Respond
-        resp := PhotoResponse{
-            ID:        photoID,
-            JobID:     jobID,
-            FileURL:   fileURL,
-            CreatedAt: time.Now().Format(time.RFC3339),
+        resp := BatchUploadResponse{Files: []BatchUploadResult{}}
+        err = eachUploadedFile(w, r, maxPhotoSize, func(fileName string, data []byte, fields url.Values, err error) {
+            result := BatchUploadResult{FileName: fileName, Status: http.StatusOK}
+            if err == nil {
+                details := PhotoDetails{Category: fields.Get("category"), UploadedBy: fields.Get("user")}
+
+                var photo PhotoResponse
+                photo, err = savePhoto(ctx, db, store, signer, jobID, data, details)
+                result.Photo = &photo
+            }
+            if err != nil {
+                result = BatchUploadResult{FileName: fileName, Status: uploadErrorStatus(err), Error: err.Error()}
+            }
+            resp.Files = append(resp.Files, result)
+        })
+
+        if err != nil && len(resp.Files) == 0 {
+            http.Error(w, err.Error(), uploadErrorStatus(err))
+            return
+        }
+        if err != nil {
+            resp.Files = append(resp.Files, BatchUploadResult{Status: uploadErrorStatus(err), Error: err.Error()})
         }
 
         json.NewEncoder(w).Encode(resp)
     }
 }
+
+// savePhoto checks an uploaded photo and stores it twice: as sent, and
+// without its location for customers. Its variants are queued.
+func savePhoto(ctx context.Context, db *pgxpool.Pool, store storage.Storage, signer *links.Signer, jobID uuid.UUID, original []byte, details PhotoDetails) (PhotoResponse, error) {
+    if err := details.validate(); err != nil {
+        return PhotoResponse{}, err
+    }
+
+    // The same photo sent again, e.g. after a dropped connection, is
+    // kept once
+    hash := storage.Hash(original)
+    if resp, ok, err := duplicatePhoto(ctx, db, signer, jobID, hash); ok || err != nil {
+        return resp, err
+    }
+
+    // Check the content, whatever the file name says
+    format, err := photos.Sniff(original)
+    if err != nil {
+        return PhotoResponse{}, rejectUpload(http.StatusUnsupportedMediaType, err.Error())
+    }
+
+    if err := photos.Validate(original, format); err != nil {
+        return PhotoResponse{}, rejectUpload(http.StatusBadRequest, err.Error())
+    }
+
+    // Customers get a copy without GPS coordinates; the original,
+    // with all its metadata, is only served to staff
+    public, err := photos.StripLocation(original, format)
+    if err != nil {
+        return PhotoResponse{}, rejectUpload(http.StatusBadRequest, "failed to remove photo location: "+err.Error())
+    }
+
+    photoID := uuid.New()
+    fileKey := "photos/" + photoID.String() + format.Ext()
+    originalKey := "photos/originals/" + photoID.String() + format.Ext()
+
+    err = store.Put(ctx, originalKey, bytes.NewReader(original), format.ContentType())
+    if err == nil {
+        err = store.Put(ctx, fileKey, bytes.NewReader(public), format.ContentType())
+    }
+    if err != nil {
+        store.Delete(ctx, originalKey)
+        return PhotoResponse{}, fmt.Errorf("failed to save file: %w", err)
+    }
+
+    // Record it and queue the resized variants
+    var takenAt *time.Time
+    if t, ok := photos.TakenAt(original, format); ok {
+        takenAt = &t
+    }
+
+    err = insertPhoto(ctx, db, photoID, jobID, fileKey, originalKey, format, details, takenAt, hash, storage.Hash(public))
+    if err != nil {
+        store.Delete(ctx, fileKey)
+        store.Delete(ctx, originalKey)
+    }
+
+    // Sent twice at once: the other upload won
+    var pgErr *pgconn.PgError
+    if errors.As(err, &pgErr) && pgErr.Code == "23505" {
+        resp, _, err := duplicatePhoto(ctx, db, signer, jobID, hash)
+        return resp, err
+    }
+    if err != nil {
+        return PhotoResponse{}, fmt.Errorf("db insert failed: %w", err)
+    }
+
+    return loadPhoto(ctx, db, signer, photoID)
+}
+
+// duplicatePhoto looks for a photo of the job with the given hash.
+func duplicatePhoto(ctx context.Context, db *pgxpool.Pool, signer *links.Signer, jobID uuid.UUID, hash string) (PhotoResponse, bool, error) {
+    resp, err := scanPhoto(db.QueryRow(ctx,
+        `SELECT `+photoColumns+` FROM job_photos WHERE job_id = $1 AND sha256 = $2`,
+        jobID,
+        hash,
+    ), signer)
+
+    if errors.Is(err, pgx.ErrNoRows) {
+        return PhotoResponse{}, false, nil
+    }
+    if err != nil {
+        return PhotoResponse{}, false, fmt.Errorf("failed to look for duplicates: %w", err)
+    }
+
+    resp.Duplicate = true
+    return resp, true, nil
+}
+
+func insertPhoto(ctx context.Context, db *pgxpool.Pool, photoID, jobID uuid.UUID, fileKey, originalKey string, format photos.Format, details PhotoDetails, takenAt *time.Time, hash, fileHash string) error {
+    tx, err := db.Begin(ctx)
+    if err != nil {
+        return err
+    }
+    defer tx.Rollback(ctx)
+
+    _, err = tx.Exec(ctx,
+        `INSERT INTO job_photos
+         (id, job_id, file_key, original_key, content_type, variants_status,
+          caption, category, uploaded_by, taken_at, sha256, file_sha256, created_at)
+         VALUES ($1, $2, $3, $4, $5, $6, NULLIF($7, ''), NULLIF($8, ''), NULLIF($9, ''), $10, $11, $12, NOW())`,
+        photoID,
+        jobID,
+        fileKey,
+        originalKey,
+        format.ContentType(),
+        VariantsPending,
+        details.Caption,
+        details.Category,
+        details.UploadedBy,
+        takenAt,
+        hash,
+        fileHash,
+    )
+    if err != nil {
+        return err
+    }
+
+    if _, err := queue.Enqueue(ctx, tx, TaskPhotoVariants, documentTask{ID: photoID}); err != nil {
+        return err
+    }
+
+    return tx.Commit(ctx)
+}
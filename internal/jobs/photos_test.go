@@ -0,0 +1,53 @@
+package jobs
+
+import (
+	"context"
+	"testing"
+
+	"pistachio/internal/storage"
+)
+
+// TestDuplicatePhoto sends the same photo twice, as a phone on a flaky
+// connection might, and then to another job.
+func TestDuplicatePhoto(t *testing.T) {
+	p := newPhotoTest(t)
+	ctx := context.Background()
+	jobID := seedJob(t, p.db)
+	data := testJPEG(t, 40, 30)
+
+	first := p.mustUpload(jobID, data, nil)
+	again := p.mustUpload(jobID, data, map[string]string{"caption": "Sent again"})
+	if first.Duplicate || !again.Duplicate || again.ID != first.ID {
+		t.Errorf("got %v then %v (duplicate=%v), want the first photo back", first.ID, again.ID, again.Duplicate)
+	}
+
+	var count int
+	p.db.QueryRow(ctx, `SELECT COUNT(*) FROM job_photos WHERE job_id = $1`, jobID).Scan(&count)
+	if count != 1 {
+		t.Errorf("job has %d photos, want 1", count)
+	}
+
+	// Each job keeps its own copy
+	other := p.mustUpload(seedJob(t, p.db), data, nil)
+	if other.Duplicate || other.ID == first.ID {
+		t.Error("photo on another job taken for a duplicate")
+	}
+
+	// Hashes of both stored copies, for verify-storage
+	var fileKey, originalKey, fileHash, hash string
+	err := p.db.QueryRow(ctx,
+		`SELECT file_key, original_key, file_sha256, sha256 FROM job_photos WHERE id = $1`,
+		first.ID,
+	).Scan(&fileKey, &originalKey, &fileHash, &hash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hash != storage.Hash(data) {
+		t.Error("sha256 isn't the hash of the photo as sent")
+	}
+	for key, want := range map[string]string{fileKey: fileHash, originalKey: hash} {
+		if got, err := storage.HashFile(ctx, p.store, key); err != nil || got != want {
+			t.Errorf("%s hashes to %s (%v), recorded %s", key, got, err, want)
+		}
+	}
+}
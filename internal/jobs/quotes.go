@@ -0,0 +1,590 @@
+package jobs
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"pistachio/internal/invoices"
+	"pistachio/internal/links"
+	"pistachio/internal/models"
+	"pistachio/internal/queue"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+type CreateQuoteRequest struct {
+	CustomerName    string                 `json:"customer_name"`
+	CustomerEmail   string                 `json:"customer_email"`
+	CustomerPhone   string                 `json:"customer_phone"`
+	CustomerAddress models.CustomerAddress `json:"customer_address"`
+	Title           string                 `json:"title"`
+	Description     string                 `json:"description"`
+	Items           []models.InvoiceItem   `json:"items"`
+	ValidDays       int                    `json:"valid_days"` // default: 30
+	Language        string                 `json:"language"`   // en / cy / fr / de, default: en
+}
+
+type QuoteResponse struct {
+	ID              uuid.UUID              `json:"id"`
+	QuoteNumber     string                 `json:"quote_number"`
+	Status          string                 `json:"status"`
+	Title           string                 `json:"title"`
+	Description     string                 `json:"description"`
+	CustomerName    string                 `json:"customer_name"`
+	CustomerEmail   string                 `json:"customer_email"`
+	CustomerPhone   string                 `json:"customer_phone"`
+	CustomerAddress models.CustomerAddress `json:"customer_address"`
+	Items           []models.InvoiceItem   `json:"items"`
+	Subtotal        float64                `json:"subtotal"`
+	TaxAmount       float64                `json:"tax_amount"`
+	Total           float64                `json:"total"`
+	ExpiresAt       string                 `json:"expires_at"`
+	PublicURL       string                 `json:"public_url"`
+	PDFStatus       string                 `json:"pdf_status"`
+	PDFURL          string                 `json:"pdf_url"`
+	EmailStatus     string                 `json:"email_status"`
+	JobID           *uuid.UUID             `json:"job_id"`
+	InvoiceID       *uuid.UUID             `json:"invoice_id"`
+	CreatedAt       string                 `json:"created_at"`
+}
+
+// Quote statuses. "expired" is never stored; it is reported for open
+// quotes whose expiry date has passed.
+const (
+	QuoteOpen     = "open"
+	QuoteAccepted = "accepted"
+	QuoteDeclined = "declined"
+	QuoteExpired  = "expired"
+)
+
+const quoteColumns = `id, quote_number, status, title, COALESCE(description, ''),
+    customer_name, COALESCE(customer_email, ''), COALESCE(customer_phone, ''), customer_address,
+    items, COALESCE(subtotal, 0), COALESCE(tax_amount, 0), total,
+    public_token, expires_at, pdf_status, COALESCE(pdf_key, ''), COALESCE(email_status, ''), job_id, invoice_id, created_at`
+
+func scanQuote(row pgx.Row, publicBaseURL string, signer *links.Signer) (QuoteResponse, error) {
+	var q QuoteResponse
+	var token, pdfKey string
+	var expiresAt, createdAt time.Time
+
+	err := row.Scan(
+		&q.ID, &q.QuoteNumber, &q.Status, &q.Title, &q.Description,
+		&q.CustomerName, &q.CustomerEmail, &q.CustomerPhone, &q.CustomerAddress,
+		&q.Items, &q.Subtotal, &q.TaxAmount, &q.Total,
+		&token, &expiresAt, &q.PDFStatus, &pdfKey, &q.EmailStatus, &q.JobID, &q.InvoiceID, &createdAt,
+	)
+	if err != nil {
+		return q, err
+	}
+
+	if q.Status == QuoteOpen && time.Now().After(expiresAt) {
+		q.Status = QuoteExpired
+	}
+
+	q.ExpiresAt = expiresAt.Format(time.RFC3339)
+	q.CreatedAt = createdAt.Format(time.RFC3339)
+	q.PublicURL = publicBaseURL + quotePublicPath(token)
+
+	if pdfKey != "" {
+		q.PDFURL = signer.URL(quotePDF.publicPath(q.ID))
+	}
+
+	return q, nil
+}
+
+// loadQuoteData builds the document model a quote PDF is rendered from.
+func loadQuoteData(ctx context.Context, db *pgxpool.Pool, quoteID uuid.UUID, publicBaseURL string) (models.InvoiceData, error) {
+	var data models.InvoiceData
+	var title, token string
+
+	err := db.QueryRow(ctx,
+		`SELECT quote_number, title, customer_name, COALESCE(customer_email, ''), customer_address,
+                items, COALESCE(subtotal, total), COALESCE(tax_rate, 0), COALESCE(tax_amount, 0), total,
+                public_token, created_at, expires_at, currency
+         FROM quotes WHERE id = $1`,
+		quoteID,
+	).Scan(
+		&data.InvoiceNumber, &title, &data.Customer.Name, &data.Customer.Email, &data.Customer.CustomerAddress,
+		&data.Items, &data.Totals.Subtotal, &data.Totals.TaxRate, &data.Totals.TaxAmount, &data.Totals.TotalAmount,
+		&token, &data.IssueDate, &data.DueDate, &data.Currency,
+	)
+	if err != nil {
+		return data, err
+	}
+
+	data.InvoiceID = quoteID.String()
+	data.Business = defaultBusinessInfo()
+	data.FooterNotes = fmt.Sprintf(
+		"%s\n\nTo accept or decline this quote, visit %s",
+		title,
+		publicBaseURL+quotePublicPath(token),
+	)
+
+	return data, nil
+}
+
+func quotePublicPath(token string) string {
+	return "/public/quotes/" + token
+}
+
+func newPublicToken() (string, error) {
+	b := make([]byte, 24)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+func CreateQuoteHandler(db *pgxpool.Pool, publicBaseURL string, signer *links.Signer) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req CreateQuoteRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "invalid JSON body", http.StatusBadRequest)
+			return
+		}
+
+		// Validation
+		if req.CustomerName == "" {
+			http.Error(w, "customer_name is required", http.StatusBadRequest)
+			return
+		}
+
+		if req.Title == "" {
+			http.Error(w, "title is required", http.StatusBadRequest)
+			return
+		}
+
+		if len(req.Items) == 0 {
+			http.Error(w, "quote must include at least one item", http.StatusBadRequest)
+			return
+		}
+
+		if req.ValidDays <= 0 {
+			req.ValidDays = 30
+		}
+
+		if req.Language == "" {
+			req.Language = invoices.DefaultLanguage
+		}
+
+		if !invoices.SupportedLanguage(req.Language) {
+			http.Error(w, "language must be one of "+strings.Join(invoices.Languages(), ", "), http.StatusBadRequest)
+			return
+		}
+
+		ctx := context.Background()
+
+		totals := models.CalculateTotals(req.Items)
+
+		quoteID := uuid.New()
+		now := time.Now()
+		expiresAt := now.AddDate(0, 0, req.ValidDays)
+
+		token, err := newPublicToken()
+		if err != nil {
+			http.Error(w, "failed to create quote link: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		addressJSON, err := json.Marshal(req.CustomerAddress)
+		if err != nil {
+			http.Error(w, "cannot encode address json", http.StatusInternalServerError)
+			return
+		}
+
+		itemsJSON, err := json.Marshal(req.Items)
+		if err != nil {
+			http.Error(w, "cannot encode items json", http.StatusInternalServerError)
+			return
+		}
+
+		tx, err := db.Begin(ctx)
+		if err != nil {
+			http.Error(w, "failed to start transaction: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		defer tx.Rollback(ctx)
+
+		// 1️⃣ Allocate number, in the transaction so a failed insert
+		// leaves no gap
+		quoteNumber, err := nextDocumentNumber(ctx, tx, "QUO", now)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		// Quoted in the billing currency, which the quote keeps
+		settings, err := loadBillingSettings(ctx, tx)
+		if err != nil {
+			http.Error(w, "failed to load billing settings: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		// 2️⃣ Insert quote
+		_, err = tx.Exec(ctx, `
+            INSERT INTO quotes
+            (id, quote_number, customer_name, customer_email, customer_phone, customer_address,
+             title, description, items, subtotal, tax_rate, tax_amount, total,
+             status, public_token, expires_at, pdf_status, language, currency, created_at)
+            VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$9,$10,$11,$12,$13,$14,$15,$16,$17,$18,$19,$20)
+        `,
+			quoteID,
+			quoteNumber,
+			req.CustomerName,
+			req.CustomerEmail,
+			req.CustomerPhone,
+			addressJSON,
+			req.Title,
+			req.Description,
+			itemsJSON,
+			totals.Subtotal,
+			totals.TaxRate,
+			totals.TaxAmount,
+			totals.TotalAmount,
+			QuoteOpen,
+			token,
+			expiresAt,
+			PDFPending,
+			req.Language,
+			settings.Currency,
+			now,
+		)
+
+		if err != nil {
+			http.Error(w, "failed to insert quote: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		// 3️⃣ Queue PDF rendering
+		if _, err := queue.Enqueue(ctx, tx, TaskQuotePDF, documentTask{ID: quoteID}); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		if err := tx.Commit(ctx); err != nil {
+			http.Error(w, "failed to commit: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		// 4️⃣ Respond
+		quote, err := scanQuote(db.QueryRow(ctx, `SELECT `+quoteColumns+` FROM quotes WHERE id = $1`, quoteID), publicBaseURL, signer)
+		if err != nil {
+			http.Error(w, "failed to load quote: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		json.NewEncoder(w).Encode(quote)
+	}
+}
+
+func ListQuotesHandler(db *pgxpool.Pool, publicBaseURL string, signer *links.Signer) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := context.Background()
+
+		rows, err := db.Query(ctx, `SELECT `+quoteColumns+` FROM quotes ORDER BY created_at DESC`)
+		if err != nil {
+			http.Error(w, "failed to query quotes: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		defer rows.Close()
+
+		quotes := []QuoteResponse{}
+		for rows.Next() {
+			q, err := scanQuote(rows, publicBaseURL, signer)
+			if err != nil {
+				http.Error(w, "scan error: "+err.Error(), http.StatusInternalServerError)
+				return
+			}
+			quotes = append(quotes, q)
+		}
+
+		json.NewEncoder(w).Encode(quotes)
+	}
+}
+
+func GetQuoteHandler(db *pgxpool.Pool, publicBaseURL string, signer *links.Signer) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		quoteID, err := uuid.Parse(chi.URLParam(r, "id"))
+		if err != nil {
+			http.Error(w, "invalid quote id", http.StatusBadRequest)
+			return
+		}
+
+		ctx := context.Background()
+
+		quote, err := scanQuote(db.QueryRow(ctx, `SELECT `+quoteColumns+` FROM quotes WHERE id = $1`, quoteID), publicBaseURL, signer)
+		if err != nil {
+			http.Error(w, "quote not found", http.StatusNotFound)
+			return
+		}
+
+		json.NewEncoder(w).Encode(quote)
+	}
+}
+
+// GetPublicQuoteHandler shows a quote to the customer holding its link.
+func GetPublicQuoteHandler(db *pgxpool.Pool, publicBaseURL string, signer *links.Signer) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		token := chi.URLParam(r, "token")
+
+		ctx := context.Background()
+
+		quote, err := scanQuote(db.QueryRow(ctx, `SELECT `+quoteColumns+` FROM quotes WHERE public_token = $1`, token), publicBaseURL, signer)
+		if err != nil {
+			http.Error(w, "quote not found", http.StatusNotFound)
+			return
+		}
+
+		json.NewEncoder(w).Encode(quote)
+	}
+}
+
+func AcceptQuoteHandler(db *pgxpool.Pool, publicBaseURL string, signer *links.Signer) http.HandlerFunc {
+	return respondToQuote(db, publicBaseURL, signer, QuoteAccepted)
+}
+
+func DeclineQuoteHandler(db *pgxpool.Pool, publicBaseURL string, signer *links.Signer) http.HandlerFunc {
+	return respondToQuote(db, publicBaseURL, signer, QuoteDeclined)
+}
+
+func respondToQuote(db *pgxpool.Pool, publicBaseURL string, signer *links.Signer, status string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		token := chi.URLParam(r, "token")
+
+		ctx := context.Background()
+
+		// Only open, unexpired quotes can be answered
+		result, err := db.Exec(ctx,
+			`UPDATE quotes
+             SET status = $1, responded_at = NOW()
+             WHERE public_token = $2 AND status = $3 AND expires_at > NOW()`,
+			status,
+			token,
+			QuoteOpen,
+		)
+
+		if err != nil {
+			http.Error(w, "failed to update quote: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		quote, err := scanQuote(db.QueryRow(ctx, `SELECT `+quoteColumns+` FROM quotes WHERE public_token = $1`, token), publicBaseURL, signer)
+		if err != nil {
+			http.Error(w, "quote not found", http.StatusNotFound)
+			return
+		}
+
+		if result.RowsAffected() == 0 {
+			http.Error(w, "quote is "+quote.Status+" and can no longer be answered", http.StatusConflict)
+			return
+		}
+
+		json.NewEncoder(w).Encode(quote)
+	}
+}
+
+// ConvertQuoteToJobHandler creates the customer and job for an accepted
+// quote. The job's estimate is the quote total.
+func ConvertQuoteToJobHandler(db *pgxpool.Pool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		quoteID, err := uuid.Parse(chi.URLParam(r, "id"))
+		if err != nil {
+			http.Error(w, "invalid quote id", http.StatusBadRequest)
+			return
+		}
+
+		ctx := context.Background()
+
+		tx, err := db.Begin(ctx)
+		if err != nil {
+			http.Error(w, "failed to start transaction: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		defer tx.Rollback(ctx)
+
+		// 1️⃣ Lock the quote and check it can be converted
+		var status, title, description, name, email, phone string
+		var address models.CustomerAddress
+		var total float64
+		var existingJobID *uuid.UUID
+
+		err = tx.QueryRow(ctx,
+			`SELECT status, title, COALESCE(description, ''), customer_name,
+                    COALESCE(customer_email, ''), COALESCE(customer_phone, ''), customer_address,
+                    total, job_id
+             FROM quotes WHERE id = $1 FOR UPDATE`,
+			quoteID,
+		).Scan(&status, &title, &description, &name, &email, &phone, &address, &total, &existingJobID)
+
+		if err != nil {
+			http.Error(w, "quote not found", http.StatusNotFound)
+			return
+		}
+
+		if status != QuoteAccepted {
+			http.Error(w, "only accepted quotes can be converted", http.StatusConflict)
+			return
+		}
+
+		if existingJobID != nil {
+			http.Error(w, "quote already converted to job "+existingJobID.String(), http.StatusConflict)
+			return
+		}
+
+		// 2️⃣ Create customer
+		customerID := uuid.New()
+
+		_, err = tx.Exec(ctx,
+			`INSERT INTO customers (id, name, email, phone, address, created_at)
+             VALUES ($1, $2, $3, $4, $5, NOW())`,
+			customerID,
+			name,
+			email,
+			phone,
+			address.String(),
+		)
+
+		if err != nil {
+			http.Error(w, "failed to create customer: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		// 3️⃣ Create job
+		jobID := uuid.New()
+
+		_, err = tx.Exec(ctx,
+			`INSERT INTO jobs (id, customer_id, title, description, estimate, status, created_at, updated_at)
+             VALUES ($1, $2, $3, $4, $5, 'new', NOW(), NOW())`,
+			jobID,
+			customerID,
+			title,
+			description,
+			total,
+		)
+
+		if err != nil {
+			http.Error(w, "failed to create job: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		// 4️⃣ Link quote to job
+		_, err = tx.Exec(ctx, `UPDATE quotes SET job_id = $1 WHERE id = $2`, jobID, quoteID)
+		if err != nil {
+			http.Error(w, "failed to link quote: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		if err := tx.Commit(ctx); err != nil {
+			http.Error(w, "failed to commit: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		json.NewEncoder(w).Encode(CreateJobResponse{
+			JobID:      jobID,
+			CustomerID: customerID,
+			Title:      title,
+			Status:     "new",
+		})
+	}
+}
+
+// ConvertQuoteToInvoiceHandler invoices the line items of an accepted
+// quote, linking the invoice to the quote's job when there is one.
+func ConvertQuoteToInvoiceHandler(db *pgxpool.Pool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		quoteID, err := uuid.Parse(chi.URLParam(r, "id"))
+		if err != nil {
+			http.Error(w, "invalid quote id", http.StatusBadRequest)
+			return
+		}
+
+		ctx := context.Background()
+
+		tx, err := db.Begin(ctx)
+		if err != nil {
+			http.Error(w, "failed to start transaction: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		defer tx.Rollback(ctx)
+
+		// 1️⃣ Lock the quote and check it can be invoiced
+		var status, name, email, currency string
+		var address models.CustomerAddress
+		var items []models.InvoiceItem
+		var jobID, existingInvoiceID *uuid.UUID
+
+		err = tx.QueryRow(ctx,
+			`SELECT status, customer_name, COALESCE(customer_email, ''), customer_address,
+                    items, job_id, invoice_id, currency
+             FROM quotes WHERE id = $1 FOR UPDATE`,
+			quoteID,
+		).Scan(&status, &name, &email, &address, &items, &jobID, &existingInvoiceID, &currency)
+
+		if err != nil {
+			http.Error(w, "quote not found", http.StatusNotFound)
+			return
+		}
+
+		if status != QuoteAccepted {
+			http.Error(w, "only accepted quotes can be invoiced", http.StatusConflict)
+			return
+		}
+
+		if existingInvoiceID != nil {
+			http.Error(w, "quote already invoiced as "+existingInvoiceID.String(), http.StatusConflict)
+			return
+		}
+
+		// 2️⃣ Issue invoice
+		invoiceData, err := issueInvoiceTx(ctx, tx, invoiceInput{
+			CustomerName:    name,
+			CustomerEmail:   email,
+			CustomerAddress: address,
+			Items:           items,
+			JobID:           jobID,
+			QuoteID:         &quoteID,
+			Currency:        currency,
+		})
+		if errors.Is(err, errDepositsExceedTotal) {
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		// 3️⃣ Link quote to invoice
+		result, err := tx.Exec(ctx,
+			`UPDATE quotes SET invoice_id = $1 WHERE id = $2 AND invoice_id IS NULL`,
+			invoiceData.InvoiceID,
+			quoteID,
+		)
+		if err != nil {
+			http.Error(w, "failed to link quote: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		if result.RowsAffected() == 0 {
+			http.Error(w, "quote already invoiced", http.StatusConflict)
+			return
+		}
+
+		if err := tx.Commit(ctx); err != nil {
+			http.Error(w, "failed to commit: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		json.NewEncoder(w).Encode(invoiceCreatedResponse(invoiceData))
+	}
+}
@@ -0,0 +1,191 @@
+package jobs
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"pistachio/internal/links"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+const quoteBody = `{"customer_name": "Ada Customer", "customer_email": "ada@example.com", "title": "%s",
+    "items": [{"description": "Boiler", "quantity": 1, "unitPrice": 1500, "taxRate": 20},
+              {"description": "Fitting", "quantity": 4, "unitPrice": 75, "taxRate": 20}]}`
+
+func quoteRouter(db *pgxpool.Pool) chi.Router {
+	signer := links.New(links.Config{Secret: "test", BaseURL: "http://localhost", TTL: time.Hour})
+
+	r := chi.NewRouter()
+	r.Post("/quotes", CreateQuoteHandler(db, "http://localhost", signer))
+	r.Post("/quotes/{id}/job", ConvertQuoteToJobHandler(db))
+	r.Post("/quotes/{id}/invoice", ConvertQuoteToInvoiceHandler(db))
+	r.Get("/public/quotes/{token}", GetPublicQuoteHandler(db, "http://localhost", signer))
+	r.Post("/public/quotes/{token}/accept", AcceptQuoteHandler(db, "http://localhost", signer))
+	r.Post("/public/quotes/{token}/decline", DeclineQuoteHandler(db, "http://localhost", signer))
+	return r
+}
+
+func serve(r http.Handler, method, url, body string) *httptest.ResponseRecorder {
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, httptest.NewRequest(method, url, strings.NewReader(body)))
+	return rec
+}
+
+func createQuote(t *testing.T, r http.Handler, title string) QuoteResponse {
+	t.Helper()
+
+	rec := serve(r, http.MethodPost, "/quotes", fmt.Sprintf(quoteBody, title))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("create quote: %d %s", rec.Code, rec.Body)
+	}
+
+	var q QuoteResponse
+	if err := json.NewDecoder(rec.Body).Decode(&q); err != nil {
+		t.Fatal(err)
+	}
+	return q
+}
+
+// TestQuoteNumbersHaveNoGaps makes the second insert fail after its
+// number is taken, and checks the next quote gets that number.
+func TestQuoteNumbersHaveNoGaps(t *testing.T) {
+	db := testDB(t)
+	r := quoteRouter(db)
+
+	_, err := db.Exec(context.Background(), `
+        CREATE FUNCTION fail_quote() RETURNS trigger AS $$
+        BEGIN
+            RAISE EXCEPTION 'insert refused';
+        END $$ LANGUAGE plpgsql;
+
+        CREATE TRIGGER fail_quote BEFORE INSERT ON quotes
+        FOR EACH ROW WHEN (NEW.title = 'Fails') EXECUTE FUNCTION fail_quote();
+    `)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	year := time.Now().Year()
+
+	if q := createQuote(t, r, "Boiler replacement"); q.QuoteNumber != fmt.Sprintf("QUO-%d-0001", year) {
+		t.Errorf("first quote: got %s", q.QuoteNumber)
+	}
+
+	if rec := serve(r, http.MethodPost, "/quotes", fmt.Sprintf(quoteBody, "Fails")); rec.Code != http.StatusInternalServerError {
+		t.Fatalf("failing insert: got status %d, want 500", rec.Code)
+	}
+
+	if q := createQuote(t, r, "Radiator"); q.QuoteNumber != fmt.Sprintf("QUO-%d-0002", year) {
+		t.Errorf("quote after a failed insert: got %s, want QUO-%d-0002", q.QuoteNumber, year)
+	}
+}
+
+func TestQuoteAcceptAndConvert(t *testing.T) {
+	db := testDB(t)
+	r := quoteRouter(db)
+
+	q := createQuote(t, r, "Boiler replacement")
+	if q.Status != QuoteOpen || q.Total != 2160 {
+		t.Fatalf("got status %s and total %.2f, want open and 2160.00", q.Status, q.Total)
+	}
+
+	public := strings.TrimPrefix(q.PublicURL, "http://localhost")
+	if rec := serve(r, http.MethodGet, public, ""); rec.Code != http.StatusOK {
+		t.Fatalf("public quote: %d %s", rec.Code, rec.Body)
+	}
+	if rec := serve(r, http.MethodGet, "/public/quotes/not-a-token", ""); rec.Code != http.StatusNotFound {
+		t.Errorf("unknown token: got status %d, want 404", rec.Code)
+	}
+
+	// Open quotes can't be converted yet
+	if rec := serve(r, http.MethodPost, "/quotes/"+q.ID.String()+"/job", ""); rec.Code != http.StatusConflict {
+		t.Errorf("converting an open quote: got status %d, want 409", rec.Code)
+	}
+
+	rec := serve(r, http.MethodPost, public+"/accept", "")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("accept: %d %s", rec.Code, rec.Body)
+	}
+	var accepted QuoteResponse
+	json.NewDecoder(rec.Body).Decode(&accepted)
+	if accepted.Status != QuoteAccepted {
+		t.Errorf("got status %s after accepting", accepted.Status)
+	}
+
+	// An answered quote can't be answered again
+	if rec := serve(r, http.MethodPost, public+"/decline", ""); rec.Code != http.StatusConflict {
+		t.Errorf("declining an accepted quote: got status %d, want 409", rec.Code)
+	}
+
+	// To a job, once
+	rec = serve(r, http.MethodPost, "/quotes/"+q.ID.String()+"/job", "")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("convert to job: %d %s", rec.Code, rec.Body)
+	}
+	var job CreateJobResponse
+	json.NewDecoder(rec.Body).Decode(&job)
+
+	var estimate float64
+	if err := db.QueryRow(context.Background(), `SELECT estimate FROM jobs WHERE id = $1`, job.JobID).Scan(&estimate); err != nil {
+		t.Fatal(err)
+	}
+	if estimate != q.Total {
+		t.Errorf("got job estimate %.2f, want the quote total %.2f", estimate, q.Total)
+	}
+	if rec := serve(r, http.MethodPost, "/quotes/"+q.ID.String()+"/job", ""); rec.Code != http.StatusConflict {
+		t.Errorf("converting twice: got status %d, want 409", rec.Code)
+	}
+
+	// To an invoice for the quoted lines, once
+	rec = serve(r, http.MethodPost, "/quotes/"+q.ID.String()+"/invoice", "")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("convert to invoice: %d %s", rec.Code, rec.Body)
+	}
+	var invoice struct {
+		InvoiceID string  `json:"invoice_id"`
+		Total     float64 `json:"total"`
+	}
+	json.NewDecoder(rec.Body).Decode(&invoice)
+	if invoice.Total != q.Total {
+		t.Errorf("got invoice total %.2f, want the quote total %.2f", invoice.Total, q.Total)
+	}
+
+	var quoteID, jobID string
+	err := db.QueryRow(context.Background(),
+		`SELECT quote_id::text, job_id::text FROM invoices WHERE id = $1`, invoice.InvoiceID,
+	).Scan(&quoteID, &jobID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if quoteID != q.ID.String() || jobID != job.JobID.String() {
+		t.Errorf("invoice is linked to quote %s and job %s, want %s and %s", quoteID, jobID, q.ID, job.JobID)
+	}
+
+	if rec := serve(r, http.MethodPost, "/quotes/"+q.ID.String()+"/invoice", ""); rec.Code != http.StatusConflict {
+		t.Errorf("invoicing twice: got status %d, want 409", rec.Code)
+	}
+}
+
+func TestExpiredQuoteCantBeAccepted(t *testing.T) {
+	db := testDB(t)
+	r := quoteRouter(db)
+
+	q := createQuote(t, r, "Boiler replacement")
+	if _, err := db.Exec(context.Background(), `UPDATE quotes SET expires_at = NOW() - INTERVAL '1 day' WHERE id = $1`, q.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	public := strings.TrimPrefix(q.PublicURL, "http://localhost")
+	rec := serve(r, http.MethodPost, public+"/accept", "")
+	if rec.Code != http.StatusConflict || !strings.Contains(rec.Body.String(), QuoteExpired) {
+		t.Errorf("got %d %q, want 409 saying the quote has expired", rec.Code, rec.Body)
+	}
+}
@@ -0,0 +1,530 @@
+package jobs
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"pistachio/internal/recurrence"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// Jobs are created this far ahead so they can be planned; invoices are
+// only issued once their date arrives.
+const recurringJobLookahead = 14 * 24 * time.Hour
+
+type CreateRecurrenceRequest struct {
+	Kind       string     `json:"kind"` // job / invoice
+	Rule       string     `json:"rule"` // e.g. FREQ=MONTHLY;INTERVAL=6;BYMONTHDAY=1;COUNT=4
+	StartsAt   time.Time  `json:"starts_at"`
+	TemplateID *uuid.UUID `json:"template_id"` // kind = job
+	CustomerID *uuid.UUID `json:"customer_id"` // kind = job
+	InvoiceID  *uuid.UUID `json:"invoice_id"`  // kind = invoice
+}
+
+type Recurrence struct {
+	ID         uuid.UUID    `json:"id"`
+	Kind       string       `json:"kind"`
+	Rule       string       `json:"rule"`
+	StartsAt   string       `json:"starts_at"`
+	TemplateID *uuid.UUID   `json:"template_id"`
+	CustomerID *uuid.UUID   `json:"customer_id"`
+	InvoiceID  *uuid.UUID   `json:"invoice_id"`
+	Status     string       `json:"status"`
+	Upcoming   []Occurrence `json:"upcoming"`
+	CreatedAt  string       `json:"created_at"`
+}
+
+type Occurrence struct {
+	OccursAt  string     `json:"occurs_at"`
+	Status    string     `json:"status"` // scheduled / pending / created / skipped
+	JobID     *uuid.UUID `json:"job_id,omitempty"`
+	InvoiceID *uuid.UUID `json:"invoice_id,omitempty"`
+}
+
+type SkipOccurrenceRequest struct {
+	OccursAt *time.Time `json:"occurs_at"` // default: the next scheduled occurrence
+}
+
+type recurrenceRow struct {
+	ID         uuid.UUID
+	Kind       string
+	Rule       recurrence.Rule
+	StartsAt   time.Time
+	TemplateID *uuid.UUID
+	CustomerID *uuid.UUID
+	InvoiceID  *uuid.UUID
+	Status     string
+	ResumedAt  *time.Time
+	CreatedAt  time.Time
+}
+
+const recurrenceColumns = `id, kind, rule, starts_at, template_id, customer_id, invoice_id, status, resumed_at, created_at`
+
+func scanRecurrence(row pgx.Row) (recurrenceRow, error) {
+	var rec recurrenceRow
+	var rule string
+
+	err := row.Scan(&rec.ID, &rec.Kind, &rule, &rec.StartsAt, &rec.TemplateID, &rec.CustomerID,
+		&rec.InvoiceID, &rec.Status, &rec.ResumedAt, &rec.CreatedAt)
+	if err != nil {
+		return rec, err
+	}
+
+	rec.Rule, err = recurrence.Parse(rule)
+	return rec, err
+}
+
+func queryRecurrences(ctx context.Context, db *pgxpool.Pool, where string, args ...any) ([]recurrenceRow, error) {
+	rows, err := db.Query(ctx, `SELECT `+recurrenceColumns+` FROM recurrences `+where+` ORDER BY created_at`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	recs := []recurrenceRow{}
+	for rows.Next() {
+		rec, err := scanRecurrence(rows)
+		if err != nil {
+			return nil, err
+		}
+		recs = append(recs, rec)
+	}
+
+	return recs, rows.Err()
+}
+
+// recurrenceView lists the next few occurrences alongside any already
+// created or skipped.
+func recurrenceView(ctx context.Context, db *pgxpool.Pool, rec recurrenceRow) (Recurrence, error) {
+	view := Recurrence{
+		ID:         rec.ID,
+		Kind:       rec.Kind,
+		Rule:       rec.Rule.String(),
+		StartsAt:   rec.StartsAt.Format(time.RFC3339),
+		TemplateID: rec.TemplateID,
+		CustomerID: rec.CustomerID,
+		InvoiceID:  rec.InvoiceID,
+		Status:     rec.Status,
+		Upcoming:   []Occurrence{},
+		CreatedAt:  rec.CreatedAt.Format(time.RFC3339),
+	}
+
+	known := map[time.Time]Occurrence{}
+
+	rows, err := db.Query(ctx,
+		`SELECT occurs_at, status, job_id, invoice_id FROM recurrence_occurrences
+         WHERE recurrence_id = $1 AND occurs_at >= $2`,
+		rec.ID,
+		time.Now().Add(-24*time.Hour),
+	)
+	if err != nil {
+		return view, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var at time.Time
+		var o Occurrence
+		if err := rows.Scan(&at, &o.Status, &o.JobID, &o.InvoiceID); err != nil {
+			return view, err
+		}
+		o.OccursAt = at.Format(time.RFC3339)
+		known[at.UTC()] = o
+	}
+
+	for _, at := range rec.Rule.Next(rec.StartsAt, time.Now().Add(-24*time.Hour), 5) {
+		o, ok := known[at.UTC()]
+		if !ok {
+			o = Occurrence{OccursAt: at.Format(time.RFC3339), Status: "scheduled"}
+		}
+		view.Upcoming = append(view.Upcoming, o)
+	}
+
+	return view, rows.Err()
+}
+
+func CreateRecurrenceHandler(db *pgxpool.Pool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req CreateRecurrenceRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "invalid JSON", http.StatusBadRequest)
+			return
+		}
+
+		// Validation
+		rule, err := recurrence.Parse(req.Rule)
+		if err != nil {
+			http.Error(w, "invalid rule: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		switch req.Kind {
+		case "job":
+			if req.TemplateID == nil || req.CustomerID == nil {
+				http.Error(w, "recurring jobs need template_id and customer_id", http.StatusBadRequest)
+				return
+			}
+			req.InvoiceID = nil
+		case "invoice":
+			if req.InvoiceID == nil {
+				http.Error(w, "recurring invoices need invoice_id", http.StatusBadRequest)
+				return
+			}
+			req.TemplateID, req.CustomerID = nil, nil
+		default:
+			http.Error(w, "kind must be job or invoice", http.StatusBadRequest)
+			return
+		}
+
+		if req.StartsAt.IsZero() {
+			req.StartsAt = time.Now()
+		}
+
+		ctx := context.Background()
+
+		rec, err := scanRecurrence(db.QueryRow(ctx,
+			`INSERT INTO recurrences (id, kind, rule, starts_at, template_id, customer_id, invoice_id, status, created_at)
+             VALUES ($1, $2, $3, $4, $5, $6, $7, 'active', NOW())
+             RETURNING `+recurrenceColumns,
+			uuid.New(),
+			req.Kind,
+			rule.String(),
+			req.StartsAt,
+			req.TemplateID,
+			req.CustomerID,
+			req.InvoiceID,
+		))
+
+		if err != nil {
+			http.Error(w, "failed to create recurrence: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		view, err := recurrenceView(ctx, db, rec)
+		if err != nil {
+			http.Error(w, "failed to load occurrences: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		json.NewEncoder(w).Encode(view)
+	}
+}
+
+func ListRecurrencesHandler(db *pgxpool.Pool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := context.Background()
+
+		recs, err := queryRecurrences(ctx, db, "")
+		if err != nil {
+			http.Error(w, "failed to query recurrences: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		views := []Recurrence{}
+		for _, rec := range recs {
+			view, err := recurrenceView(ctx, db, rec)
+			if err != nil {
+				http.Error(w, "failed to load occurrences: "+err.Error(), http.StatusInternalServerError)
+				return
+			}
+			views = append(views, view)
+		}
+
+		json.NewEncoder(w).Encode(views)
+	}
+}
+
+func PauseRecurrenceHandler(db *pgxpool.Pool) http.HandlerFunc {
+	return setRecurrenceStatus(db, "paused")
+}
+
+// ResumeRecurrenceHandler restarts a paused recurrence. Occurrences that
+// fell due while it was paused are not created.
+func ResumeRecurrenceHandler(db *pgxpool.Pool) http.HandlerFunc {
+	return setRecurrenceStatus(db, "active")
+}
+
+func setRecurrenceStatus(db *pgxpool.Pool, status string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		recID, err := uuid.Parse(chi.URLParam(r, "id"))
+		if err != nil {
+			http.Error(w, "invalid recurrence id", http.StatusBadRequest)
+			return
+		}
+
+		ctx := context.Background()
+
+		rec, err := scanRecurrence(db.QueryRow(ctx,
+			`UPDATE recurrences
+             SET status = $1,
+                 resumed_at = CASE WHEN $1 = 'active' AND status = 'paused' THEN NOW() ELSE resumed_at END
+             WHERE id = $2
+             RETURNING `+recurrenceColumns,
+			status,
+			recID,
+		))
+
+		if errors.Is(err, pgx.ErrNoRows) {
+			http.Error(w, "recurrence not found", http.StatusNotFound)
+			return
+		}
+
+		if err != nil {
+			http.Error(w, "failed to update recurrence: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		view, err := recurrenceView(ctx, db, rec)
+		if err != nil {
+			http.Error(w, "failed to load occurrences: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		json.NewEncoder(w).Encode(view)
+	}
+}
+
+// SkipOccurrenceHandler skips one occurrence, by default the next one
+// that has not been created yet.
+func SkipOccurrenceHandler(db *pgxpool.Pool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		recID, err := uuid.Parse(chi.URLParam(r, "id"))
+		if err != nil {
+			http.Error(w, "invalid recurrence id", http.StatusBadRequest)
+			return
+		}
+
+		var req SkipOccurrenceRequest
+		if r.ContentLength != 0 {
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				http.Error(w, "invalid JSON", http.StatusBadRequest)
+				return
+			}
+		}
+
+		ctx := context.Background()
+
+		rec, err := scanRecurrence(db.QueryRow(ctx, `SELECT `+recurrenceColumns+` FROM recurrences WHERE id = $1`, recID))
+		if err != nil {
+			http.Error(w, "recurrence not found", http.StatusNotFound)
+			return
+		}
+
+		// 1️⃣ Work out which occurrence to skip
+		var occursAt time.Time
+
+		if req.OccursAt != nil {
+			matches := rec.Rule.Between(rec.StartsAt, *req.OccursAt, *req.OccursAt)
+			if len(matches) == 0 {
+				http.Error(w, "occurs_at is not an occurrence of this recurrence", http.StatusBadRequest)
+				return
+			}
+			occursAt = matches[0]
+		} else {
+			for _, at := range rec.Rule.Next(rec.StartsAt, time.Now(), 50) {
+				var exists bool
+				err := db.QueryRow(ctx,
+					`SELECT EXISTS(SELECT 1 FROM recurrence_occurrences WHERE recurrence_id = $1 AND occurs_at = $2)`,
+					recID,
+					at,
+				).Scan(&exists)
+				if err != nil {
+					http.Error(w, "failed to check occurrences: "+err.Error(), http.StatusInternalServerError)
+					return
+				}
+				if !exists {
+					occursAt = at
+					break
+				}
+			}
+
+			if occursAt.IsZero() {
+				http.Error(w, "no upcoming occurrence to skip", http.StatusConflict)
+				return
+			}
+		}
+
+		// 2️⃣ Record the skip; created occurrences cannot be skipped
+		result, err := db.Exec(ctx,
+			`INSERT INTO recurrence_occurrences (recurrence_id, occurs_at, status, created_at)
+             VALUES ($1, $2, 'skipped', NOW())
+             ON CONFLICT (recurrence_id, occurs_at) DO NOTHING`,
+			recID,
+			occursAt,
+		)
+
+		if err != nil {
+			http.Error(w, "failed to skip occurrence: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		if result.RowsAffected() == 0 {
+			http.Error(w, "occurrence has already been created or skipped", http.StatusConflict)
+			return
+		}
+
+		view, err := recurrenceView(ctx, db, rec)
+		if err != nil {
+			http.Error(w, "failed to load occurrences: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		json.NewEncoder(w).Encode(view)
+	}
+}
+
+// MaterialiseRecurrences creates the jobs and invoices that active
+// recurrences are due to produce by now. Each occurrence is claimed in
+// recurrence_occurrences before anything is created, so running it
+// again, or from several processes at once, never duplicates work.
+func MaterialiseRecurrences(ctx context.Context, db *pgxpool.Pool, now time.Time) error {
+	recs, err := queryRecurrences(ctx, db, "WHERE status = 'active'")
+	if err != nil {
+		return fmt.Errorf("failed to query recurrences: %w", err)
+	}
+
+	for _, rec := range recs {
+		to := now
+		if rec.Kind == "job" {
+			to = now.Add(recurringJobLookahead)
+		}
+
+		// Nothing is backfilled from before the recurrence was set up or
+		// from while it was paused
+		from := rec.StartsAt
+		if rec.CreatedAt.Truncate(24 * time.Hour).After(from) {
+			from = rec.CreatedAt.Truncate(24 * time.Hour)
+		}
+		if rec.ResumedAt != nil && rec.ResumedAt.After(from) {
+			from = *rec.ResumedAt
+		}
+
+		for _, at := range rec.Rule.Between(rec.StartsAt, from, to) {
+			if err := materialiseOccurrence(ctx, db, rec, at); err != nil {
+				log.Printf("recurrence %s: occurrence %s failed: %v", rec.ID, at.Format(time.RFC3339), err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// materialiseOccurrence claims, creates and records an occurrence in one
+// transaction, so a failure leaves it unclaimed for the next run to retry
+// and never leaves a job or invoice behind without its occurrence.
+func materialiseOccurrence(ctx context.Context, db *pgxpool.Pool, rec recurrenceRow, at time.Time) error {
+	tx, err := db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	// 1️⃣ Claim the occurrence. A claim held by another run blocks here
+	// until that run commits or rolls back.
+	result, err := tx.Exec(ctx,
+		`INSERT INTO recurrence_occurrences (recurrence_id, occurs_at, status, created_at)
+         VALUES ($1, $2, 'pending', NOW())
+         ON CONFLICT (recurrence_id, occurs_at) DO NOTHING`,
+		rec.ID,
+		at,
+	)
+	if err != nil {
+		return err
+	}
+
+	if result.RowsAffected() == 0 {
+		return nil // already created or skipped
+	}
+
+	// 2️⃣ Create the job or invoice
+	var jobID, invoiceID *uuid.UUID
+	var id uuid.UUID
+
+	switch rec.Kind {
+	case "job":
+		id, err = createRecurringJob(ctx, db, tx, rec)
+		jobID = &id
+	case "invoice":
+		id, err = createRecurringInvoice(ctx, db, tx, rec)
+		invoiceID = &id
+	default:
+		err = fmt.Errorf("unknown recurrence kind %q", rec.Kind)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	// 3️⃣ Record what was created
+	_, err = tx.Exec(ctx,
+		`UPDATE recurrence_occurrences SET status = 'created', job_id = $1, invoice_id = $2
+         WHERE recurrence_id = $3 AND occurs_at = $4`,
+		jobID,
+		invoiceID,
+		rec.ID,
+		at,
+	)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
+
+// createRecurringInvoice issues a fresh copy of the recurrence's invoice
+// in tx.
+func createRecurringInvoice(ctx context.Context, db *pgxpool.Pool, tx pgx.Tx, rec recurrenceRow) (uuid.UUID, error) {
+	in, err := loadInvoiceInput(ctx, db, *rec.InvoiceID)
+	if err != nil {
+		return uuid.Nil, fmt.Errorf("failed to load invoice: %w", err)
+	}
+	in.QuoteID = nil
+
+	data, err := issueInvoiceTx(ctx, tx, in)
+	if err != nil {
+		return uuid.Nil, err
+	}
+
+	return uuid.Parse(data.InvoiceID)
+}
+
+// createRecurringJob creates a new job for the recurrence's customer from
+// its template, checklist included, in tx.
+func createRecurringJob(ctx context.Context, db *pgxpool.Pool, tx pgx.Tx, rec recurrenceRow) (uuid.UUID, error) {
+	template, err := loadJobTemplate(ctx, db, *rec.TemplateID)
+	if err != nil {
+		return uuid.Nil, fmt.Errorf("failed to load template: %w", err)
+	}
+
+	jobID := uuid.New()
+
+	_, err = tx.Exec(ctx,
+		`INSERT INTO jobs (id, customer_id, title, description, estimate, job_type, template_id, status, created_at, updated_at)
+         VALUES ($1, $2, $3, $4, $5, NULLIF($6, ''), $7, 'new', NOW(), NOW())`,
+		jobID,
+		rec.CustomerID,
+		template.Title,
+		template.Description,
+		template.Estimate,
+		template.JobType,
+		template.ID,
+	)
+	if err != nil {
+		return uuid.Nil, fmt.Errorf("failed to create job: %w", err)
+	}
+
+	if err := copyTemplateChecklist(ctx, tx, template.ID, jobID); err != nil {
+		return uuid.Nil, fmt.Errorf("failed to create checklist: %w", err)
+	}
+
+	return jobID, nil
+}
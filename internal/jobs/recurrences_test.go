@@ -0,0 +1,117 @@
+package jobs
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// seedRecurringJob sets up a monthly job recurrence from a template with
+// a two item checklist, starting an hour ago.
+func seedRecurringJob(t *testing.T, db *pgxpool.Pool, customerID *uuid.UUID) uuid.UUID {
+	t.Helper()
+
+	ctx := context.Background()
+	templateID, recID := uuid.New(), uuid.New()
+
+	_, err := db.Exec(ctx,
+		`INSERT INTO job_templates (id, name, title) VALUES ($1, $2, 'Annual boiler service')`,
+		templateID,
+		"Boiler service "+templateID.String()[:8],
+	)
+	if err != nil {
+		t.Fatalf("seed template: %v", err)
+	}
+
+	_, err = db.Exec(ctx,
+		`INSERT INTO job_template_checklist_items (id, template_id, label, position)
+         VALUES (gen_random_uuid(), $1, 'Flue gas analysis', 1), (gen_random_uuid(), $1, 'Clean condensate trap', 2)`,
+		templateID,
+	)
+	if err != nil {
+		t.Fatalf("seed checklist: %v", err)
+	}
+
+	_, err = db.Exec(ctx,
+		`INSERT INTO recurrences (id, kind, rule, starts_at, template_id, customer_id)
+         VALUES ($1, 'job', 'FREQ=MONTHLY', $2, $3, $4)`,
+		recID,
+		time.Now().UTC().Add(-time.Hour),
+		templateID,
+		customerID,
+	)
+	if err != nil {
+		t.Fatalf("seed recurrence: %v", err)
+	}
+
+	return recID
+}
+
+func TestMaterialiseRecurringJobOnce(t *testing.T) {
+	db := testDB(t)
+	ctx := context.Background()
+
+	var customerID uuid.UUID
+	if err := db.QueryRow(ctx, `SELECT customer_id FROM jobs WHERE id = $1`, seedJob(t, db)).Scan(&customerID); err != nil {
+		t.Fatal(err)
+	}
+	recID := seedRecurringJob(t, db, &customerID)
+
+	// Two schedulers running at once
+	var wg sync.WaitGroup
+	for range 2 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := MaterialiseRecurrences(ctx, db, time.Now().UTC()); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	var occurrences, jobs, items int
+	err := db.QueryRow(ctx,
+		`SELECT (SELECT COUNT(*) FROM recurrence_occurrences WHERE recurrence_id = $1 AND status = 'created'),
+                (SELECT COUNT(*) FROM jobs j JOIN recurrences r ON j.template_id = r.template_id WHERE r.id = $1),
+                (SELECT COUNT(*) FROM job_checklist_items i JOIN recurrence_occurrences o ON i.job_id = o.job_id WHERE o.recurrence_id = $1)`,
+		recID,
+	).Scan(&occurrences, &jobs, &items)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if occurrences != 1 || jobs != 1 || items != 2 {
+		t.Errorf("got %d occurrences, %d jobs and %d checklist items, want 1, 1 and 2", occurrences, jobs, items)
+	}
+}
+
+func TestMaterialiseRecurringJobFailureLeavesNothing(t *testing.T) {
+	db := testDB(t)
+	ctx := context.Background()
+
+	// No customer, so the job can't be created
+	recID := seedRecurringJob(t, db, nil)
+
+	if err := MaterialiseRecurrences(ctx, db, time.Now().UTC()); err != nil {
+		t.Fatal(err)
+	}
+
+	var occurrences, jobs int
+	err := db.QueryRow(ctx,
+		`SELECT (SELECT COUNT(*) FROM recurrence_occurrences WHERE recurrence_id = $1),
+                (SELECT COUNT(*) FROM jobs j JOIN recurrences r ON j.template_id = r.template_id WHERE r.id = $1)`,
+		recID,
+	).Scan(&occurrences, &jobs)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if occurrences != 0 || jobs != 0 {
+		t.Errorf("got %d occurrences and %d jobs after a failure, want none so the next run retries", occurrences, jobs)
+	}
+}
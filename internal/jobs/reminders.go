@@ -0,0 +1,432 @@
+package jobs
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// reminderTemplate is the email template used for payment reminders.
+const reminderTemplate = "invoice_reminder"
+
+type BillingSettings struct {
+	PaymentTermsDays int    `json:"payment_terms_days"`
+	ReminderOffsets  []int  `json:"reminder_offsets"` // days relative to the due date, e.g. [-3, 0, 7, 14]
+	RemindersEnabled bool   `json:"reminders_enabled"`
+	PaymentQR        bool   `json:"payment_qr"` // QR code on invoice PDFs
+	Currency         string `json:"currency"`   // ISO 4217, for invoices issued from now on; default GBP
+	IBAN             string `json:"iban"`       // printed on invoices; EUR invoices get an EPC QR code for it
+	BIC              string `json:"bic"`
+	UpdatedAt        string `json:"updated_at"`
+}
+
+type CustomerPaymentTermsRequest struct {
+	PaymentTermsDays *int `json:"payment_terms_days"` // null: use the business default
+}
+
+type InvoiceReminder struct {
+	ID         uuid.UUID  `json:"id"`
+	OffsetDays int        `json:"offset_days"`
+	Status     string     `json:"status"` // queued / skipped
+	EmailID    *uuid.UUID `json:"email_id"`
+	CreatedAt  string     `json:"created_at"`
+}
+
+// Reminder statuses. A reminder is skipped when a later one in the
+// schedule was already due, e.g. after downtime, so the customer only
+// gets the most recent.
+const (
+	ReminderQueued  = "queued"
+	ReminderSkipped = "skipped"
+)
+
+// maxTermsDays bounds payment terms and reminder offsets.
+const maxTermsDays = 365
+
+var (
+	currencyPattern = regexp.MustCompile(`^[A-Z]{3}$`)
+	bicPattern      = regexp.MustCompile(`^[A-Z0-9]{8}([A-Z0-9]{3})?$`)
+	ibanPattern     = regexp.MustCompile(`^[A-Z]{2}[0-9]{2}[A-Z0-9]{11,30}$`)
+)
+
+// validIBAN checks an IBAN, without spaces, by its ISO 13616 check
+// digits: moved to the end, with letters as 10-35, it is 1 mod 97.
+func validIBAN(iban string) bool {
+	if !ibanPattern.MatchString(iban) {
+		return false
+	}
+
+	remainder := 0
+	for _, c := range iban[4:] + iban[:4] {
+		digits := int(c - '0')
+		if c >= 'A' {
+			digits = int(c-'A') + 10
+			remainder = remainder * 100 % 97
+		} else {
+			remainder = remainder * 10 % 97
+		}
+		remainder = (remainder + digits) % 97
+	}
+	return remainder == 1
+}
+
+func loadBillingSettings(ctx context.Context, db pgxQuerier) (BillingSettings, error) {
+	var s BillingSettings
+	var updatedAt time.Time
+
+	err := db.QueryRow(ctx,
+		`SELECT payment_terms_days, reminder_offsets, reminders_enabled, payment_qr, currency, iban, bic, updated_at
+         FROM billing_settings WHERE id = 1`,
+	).Scan(&s.PaymentTermsDays, &s.ReminderOffsets, &s.RemindersEnabled, &s.PaymentQR, &s.Currency, &s.IBAN, &s.BIC, &updatedAt)
+
+	s.UpdatedAt = updatedAt.Format(time.RFC3339)
+	return s, err
+}
+
+func GetBillingSettingsHandler(db *pgxpool.Pool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		settings, err := loadBillingSettings(context.Background(), db)
+		if err != nil {
+			http.Error(w, "failed to load billing settings: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		json.NewEncoder(w).Encode(settings)
+	}
+}
+
+// UpdateBillingSettingsHandler replaces the business-wide payment terms,
+// reminder schedule, payment QR setting, currency and bank details. New
+// terms and currency apply to invoices issued from now on.
+func UpdateBillingSettingsHandler(db *pgxpool.Pool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req BillingSettings
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "invalid JSON", http.StatusBadRequest)
+			return
+		}
+
+		// Validation
+		if req.PaymentTermsDays < 0 || req.PaymentTermsDays > maxTermsDays {
+			http.Error(w, fmt.Sprintf("payment_terms_days must be between 0 and %d", maxTermsDays), http.StatusBadRequest)
+			return
+		}
+
+		if req.ReminderOffsets == nil {
+			req.ReminderOffsets = []int{}
+		}
+
+		for _, offset := range req.ReminderOffsets {
+			if offset < -maxTermsDays || offset > maxTermsDays {
+				http.Error(w, fmt.Sprintf("reminder_offsets must be between -%d and %d", maxTermsDays, maxTermsDays), http.StatusBadRequest)
+				return
+			}
+		}
+
+		slices.Sort(req.ReminderOffsets)
+		req.ReminderOffsets = slices.Compact(req.ReminderOffsets)
+
+		req.Currency = strings.ToUpper(strings.TrimSpace(req.Currency))
+		if req.Currency == "" {
+			req.Currency = "GBP"
+		}
+		if !currencyPattern.MatchString(req.Currency) {
+			http.Error(w, "currency must be an ISO 4217 code, e.g. GBP or EUR", http.StatusBadRequest)
+			return
+		}
+
+		req.IBAN = strings.ToUpper(strings.ReplaceAll(req.IBAN, " ", ""))
+		if req.IBAN != "" && !validIBAN(req.IBAN) {
+			http.Error(w, "iban is not a valid IBAN", http.StatusBadRequest)
+			return
+		}
+
+		req.BIC = strings.ToUpper(strings.ReplaceAll(req.BIC, " ", ""))
+		if req.BIC != "" && !bicPattern.MatchString(req.BIC) {
+			http.Error(w, "bic must be 8 or 11 letters and digits", http.StatusBadRequest)
+			return
+		}
+
+		ctx := context.Background()
+
+		_, err := db.Exec(ctx,
+			`UPDATE billing_settings
+             SET payment_terms_days = $1, reminder_offsets = $2, reminders_enabled = $3, payment_qr = $4,
+                 currency = $5, iban = $6, bic = $7, updated_at = NOW()
+             WHERE id = 1`,
+			req.PaymentTermsDays,
+			req.ReminderOffsets,
+			req.RemindersEnabled,
+			req.PaymentQR,
+			req.Currency,
+			req.IBAN,
+			req.BIC,
+		)
+
+		if err != nil {
+			http.Error(w, "failed to update billing settings: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		settings, err := loadBillingSettings(ctx, db)
+		if err != nil {
+			http.Error(w, "failed to load billing settings: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		json.NewEncoder(w).Encode(settings)
+	}
+}
+
+// SetCustomerPaymentTermsHandler overrides the business payment terms for
+// one customer.
+func SetCustomerPaymentTermsHandler(db *pgxpool.Pool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		customerID, err := uuid.Parse(chi.URLParam(r, "id"))
+		if err != nil {
+			http.Error(w, "invalid customer id", http.StatusBadRequest)
+			return
+		}
+
+		var req CustomerPaymentTermsRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "invalid JSON", http.StatusBadRequest)
+			return
+		}
+
+		if req.PaymentTermsDays != nil && (*req.PaymentTermsDays < 0 || *req.PaymentTermsDays > maxTermsDays) {
+			http.Error(w, fmt.Sprintf("payment_terms_days must be between 0 and %d", maxTermsDays), http.StatusBadRequest)
+			return
+		}
+
+		ctx := context.Background()
+
+		result, err := db.Exec(ctx,
+			`UPDATE customers SET payment_terms_days = $1 WHERE id = $2`,
+			req.PaymentTermsDays,
+			customerID,
+		)
+
+		if err != nil {
+			http.Error(w, "failed to update customer: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		if result.RowsAffected() == 0 {
+			http.Error(w, "customer not found", http.StatusNotFound)
+			return
+		}
+
+		days, err := paymentTermsFor(ctx, db, &customerID)
+		if err != nil {
+			http.Error(w, "failed to load payment terms: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		json.NewEncoder(w).Encode(map[string]any{
+			"customer_id":        customerID,
+			"payment_terms_days": days,
+			"uses_default":       req.PaymentTermsDays == nil,
+		})
+	}
+}
+
+func ListInvoiceRemindersHandler(db *pgxpool.Pool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		invoiceID, err := uuid.Parse(chi.URLParam(r, "id"))
+		if err != nil {
+			http.Error(w, "invalid invoice id", http.StatusBadRequest)
+			return
+		}
+
+		ctx := context.Background()
+
+		rows, err := db.Query(ctx,
+			`SELECT id, offset_days, status, email_id, created_at
+             FROM invoice_reminders WHERE invoice_id = $1
+             ORDER BY offset_days`,
+			invoiceID,
+		)
+		if err != nil {
+			http.Error(w, "failed to query reminders: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		defer rows.Close()
+
+		reminders := []InvoiceReminder{}
+		for rows.Next() {
+			var rem InvoiceReminder
+			var createdAt time.Time
+			if err := rows.Scan(&rem.ID, &rem.OffsetDays, &rem.Status, &rem.EmailID, &createdAt); err != nil {
+				http.Error(w, "scan error: "+err.Error(), http.StatusInternalServerError)
+				return
+			}
+			rem.CreatedAt = createdAt.Format(time.RFC3339)
+			reminders = append(reminders, rem)
+		}
+
+		json.NewEncoder(w).Encode(reminders)
+	}
+}
+
+// RunInvoiceReminders marks unpaid invoices past their due date as
+// overdue and queues any reminders that have come due. It is run daily;
+// running it more often is harmless.
+func RunInvoiceReminders(ctx context.Context, db *pgxpool.Pool, now time.Time) error {
+	// 1️⃣ Overdue: unpaid and the due date has passed
+	_, err := db.Exec(ctx,
+		`UPDATE invoices SET status = $1
+         WHERE status = $2 AND due_date IS NOT NULL AND due_date::date < $3::date`,
+		InvoiceOverdue,
+		InvoiceIssued,
+		now,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to mark overdue invoices: %w", err)
+	}
+
+	settings, err := loadBillingSettings(ctx, db)
+	if err != nil {
+		return fmt.Errorf("failed to load billing settings: %w", err)
+	}
+
+	if !settings.RemindersEnabled || len(settings.ReminderOffsets) == 0 {
+		return nil
+	}
+
+	// 2️⃣ Unpaid invoices we can email, with the reminders already logged
+	rows, err := db.Query(ctx,
+		`SELECT i.id, i.customer_email, COALESCE(i.issue_date, i.created_at), i.due_date,
+                COALESCE(array_agg(r.offset_days) FILTER (WHERE r.id IS NOT NULL), '{}')
+         FROM invoices i
+         LEFT JOIN invoice_reminders r ON r.invoice_id = i.id
+         WHERE i.status IN ($1, $2) AND i.due_date IS NOT NULL AND COALESCE(i.customer_email, '') <> ''
+         GROUP BY i.id`,
+		InvoiceIssued,
+		InvoiceOverdue,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to query unpaid invoices: %w", err)
+	}
+
+	type unpaidInvoice struct {
+		ID        uuid.UUID
+		Email     string
+		IssueDate time.Time
+		DueDate   time.Time
+		Logged    []int
+	}
+
+	invoices := []unpaidInvoice{}
+	for rows.Next() {
+		var inv unpaidInvoice
+		if err := rows.Scan(&inv.ID, &inv.Email, &inv.IssueDate, &inv.DueDate, &inv.Logged); err != nil {
+			rows.Close()
+			return fmt.Errorf("failed to scan invoice: %w", err)
+		}
+		invoices = append(invoices, inv)
+	}
+	rows.Close()
+
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to query unpaid invoices: %w", err)
+	}
+
+	// 3️⃣ Send the latest reminder that has come due, skipping earlier
+	// ones that were missed. Reminders that would fall on or before the
+	// issue date, e.g. with short payment terms, are never sent.
+	for _, inv := range invoices {
+		daysPastDue := daysBetween(inv.DueDate, now)
+		termsDays := daysBetween(inv.IssueDate, inv.DueDate)
+
+		due := []int{}
+		for _, offset := range settings.ReminderOffsets {
+			if offset > -termsDays && offset <= daysPastDue && !slices.Contains(inv.Logged, offset) {
+				due = append(due, offset)
+			}
+		}
+
+		if len(due) == 0 {
+			continue
+		}
+
+		if err := queueReminder(ctx, db, inv.ID, inv.Email, due); err != nil {
+			log.Printf("invoice %s: reminder failed: %v", inv.ID, err)
+		}
+	}
+
+	return nil
+}
+
+// queueReminder logs the due reminders for an invoice and emails the last
+// of them. The unique (invoice_id, offset_days) constraint makes sure a
+// reminder is never sent twice, even by concurrent runs.
+func queueReminder(ctx context.Context, db *pgxpool.Pool, invoiceID uuid.UUID, to string, offsets []int) error {
+	tx, err := db.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to start transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	latest := offsets[len(offsets)-1]
+
+	for _, offset := range offsets[:len(offsets)-1] {
+		_, err := tx.Exec(ctx,
+			`INSERT INTO invoice_reminders (id, invoice_id, offset_days, status, created_at)
+             VALUES ($1, $2, $3, $4, NOW())`,
+			uuid.New(),
+			invoiceID,
+			offset,
+			ReminderSkipped,
+		)
+		if err != nil {
+			return reminderInsertError(err)
+		}
+	}
+
+	email, err := queueDocumentEmail(ctx, tx, invoiceEmailDocument, invoiceID, reminderTemplate, to, SendDocumentRequest{})
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(ctx,
+		`INSERT INTO invoice_reminders (id, invoice_id, offset_days, status, email_id, created_at)
+         VALUES ($1, $2, $3, $4, $5, NOW())`,
+		uuid.New(),
+		invoiceID,
+		latest,
+		ReminderQueued,
+		email.ID,
+	)
+	if err != nil {
+		return reminderInsertError(err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("failed to commit: %w", err)
+	}
+
+	return nil
+}
+
+// reminderInsertError treats a unique violation as another run having
+// logged the reminder first, which is not a failure.
+func reminderInsertError(err error) error {
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == "23505" {
+		return nil
+	}
+	return fmt.Errorf("failed to log reminder: %w", err)
+}
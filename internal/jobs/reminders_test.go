@@ -0,0 +1,141 @@
+package jobs
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"pistachio/internal/links"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+)
+
+func TestValidIBAN(t *testing.T) {
+	tests := []struct {
+		iban string
+		want bool
+	}{
+		{"DE89370400440532013000", true},
+		{"GB82WEST12345698765432", true},
+		{"FR1420041010050500013M02606", true},
+		{"DE89370400440532013001", false},
+		{"GB82WEST1234569876543", false},
+		{"de89370400440532013000", false},
+		{"", false},
+	}
+
+	for _, tt := range tests {
+		if got := validIBAN(tt.iban); got != tt.want {
+			t.Errorf("validIBAN(%q) = %v, want %v", tt.iban, got, tt.want)
+		}
+	}
+}
+
+func TestBillingSettingsCurrencyOnInvoice(t *testing.T) {
+	db := testDB(t)
+	jobID := seedJob(t, db)
+	seedJobPart(t, db, jobID, 45)
+
+	r := chi.NewRouter()
+	r.Put("/settings/billing", UpdateBillingSettingsHandler(db))
+	r.Post("/jobs/{id}/invoice", CreateJobInvoiceHandler(db))
+
+	put := func(body string) int {
+		rec := httptest.NewRecorder()
+		r.ServeHTTP(rec, httptest.NewRequest(http.MethodPut, "/settings/billing", strings.NewReader(body)))
+		return rec.Code
+	}
+
+	if code := put(`{"payment_terms_days": 14, "iban": "DE89 3704 0044 0532 0130 01"}`); code != http.StatusBadRequest {
+		t.Errorf("invalid IBAN: got status %d, want 400", code)
+	}
+	if code := put(`{"payment_terms_days": 14, "currency": "euro"}`); code != http.StatusBadRequest {
+		t.Errorf("invalid currency: got status %d, want 400", code)
+	}
+	if code := put(`{"payment_terms_days": 14, "currency": "eur", "iban": "de89 3704 0044 0532 0130 00", "bic": "cobadeffxxx"}`); code != http.StatusOK {
+		t.Fatalf("got status %d, want 200", code)
+	}
+
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/jobs/"+jobID.String()+"/invoice", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("create invoice: got status %d: %s", rec.Code, rec.Body)
+	}
+
+	ctx := context.Background()
+
+	var invoiceID uuid.UUID
+	if err := db.QueryRow(ctx, `SELECT id FROM invoices WHERE job_id = $1`, jobID).Scan(&invoiceID); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := loadInvoiceData(ctx, db, invoiceID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data.Currency != "EUR" {
+		t.Errorf("got currency %q, want EUR", data.Currency)
+	}
+	if data.Payment.IBAN != "DE89370400440532013000" || data.Payment.BIC != "COBADEFFXXX" {
+		t.Errorf("got IBAN %q and BIC %q", data.Payment.IBAN, data.Payment.BIC)
+	}
+}
+
+// TestQuoteKeepsItsCurrency checks that a quote, and the invoice made
+// from it, stay in the currency it was quoted in after the billing
+// currency changes.
+func TestQuoteKeepsItsCurrency(t *testing.T) {
+	db := testDB(t)
+	signer := links.New(links.Config{Secret: "test", BaseURL: "http://localhost", TTL: time.Hour})
+
+	r := chi.NewRouter()
+	r.Put("/settings/billing", UpdateBillingSettingsHandler(db))
+	r.Post("/quotes", CreateQuoteHandler(db, "http://localhost", signer))
+	r.Post("/quotes/{id}/invoice", ConvertQuoteToInvoiceHandler(db))
+
+	do := func(method, url, body string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		r.ServeHTTP(rec, httptest.NewRequest(method, url, strings.NewReader(body)))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("%s %s: %d %s", method, url, rec.Code, rec.Body)
+		}
+		return rec
+	}
+
+	do(http.MethodPut, "/settings/billing", `{"payment_terms_days": 14, "currency": "EUR"}`)
+
+	var quote QuoteResponse
+	json.NewDecoder(do(http.MethodPost, "/quotes",
+		`{"customer_name": "Ada Customer", "title": "New boiler", "items": [{"description": "Boiler", "quantity": 1, "unitPrice": 1800, "taxRate": 20}]}`,
+	).Body).Decode(&quote)
+
+	do(http.MethodPut, "/settings/billing", `{"payment_terms_days": 14, "currency": "GBP"}`)
+
+	ctx := context.Background()
+
+	data, err := loadQuoteData(ctx, db, quote.ID, "http://localhost")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data.Currency != "EUR" {
+		t.Errorf("quote: got currency %q, want EUR", data.Currency)
+	}
+
+	if _, err := db.Exec(ctx, `UPDATE quotes SET status = $1 WHERE id = $2`, QuoteAccepted, quote.ID); err != nil {
+		t.Fatal(err)
+	}
+	do(http.MethodPost, "/quotes/"+quote.ID.String()+"/invoice", "")
+
+	var currency string
+	if err := db.QueryRow(ctx, `SELECT currency FROM invoices WHERE quote_id = $1`, quote.ID).Scan(&currency); err != nil {
+		t.Fatal(err)
+	}
+	if currency != "EUR" {
+		t.Errorf("invoice from the quote: got currency %q, want EUR", currency)
+	}
+}
@@ -0,0 +1,176 @@
+package jobs
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"mime"
+	"net/http"
+	"strings"
+	"time"
+
+	"pistachio/internal/invoices"
+	"pistachio/internal/models"
+	"pistachio/internal/storage"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+func jobReportPublicPath(jobID uuid.UUID) string {
+	return "/public/jobs/" + jobID.String() + "/report.pdf"
+}
+
+// JobReportHandler renders a job's before/after report for its customer.
+// Reports are made on request from the current photos, like statements.
+func JobReportHandler(db *pgxpool.Pool, store storage.Storage) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		jobID, err := uuid.Parse(chi.URLParam(r, "id"))
+		if err != nil {
+			http.Error(w, "invalid job id", http.StatusBadRequest)
+			return
+		}
+
+		ctx := context.Background()
+
+		data, lang, err := loadJobReport(ctx, db, store, jobID)
+		if errors.Is(err, pgx.ErrNoRows) {
+			http.Error(w, "job not found", http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			http.Error(w, "failed to load report: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		if len(data.Pairs) == 0 {
+			http.Error(w, "job has no before and after photo pairs", http.StatusConflict)
+			return
+		}
+
+		branding, err := loadBranding(ctx, db)
+		if err != nil {
+			http.Error(w, "failed to load branding: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		var buf bytes.Buffer
+		err = invoices.GenerateJobReportPDF(data, &buf, invoices.WithBranding(branding.Branding), invoices.WithLanguage(lang))
+		if err != nil {
+			http.Error(w, "failed to render report: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		filename := "job-report-" + data.Reference + ".pdf"
+		w.Header().Set("Content-Type", "application/pdf")
+		w.Header().Set("Content-Disposition", mime.FormatMediaType("inline", map[string]string{"filename": filename}))
+		w.Header().Set("Cache-Control", "private, no-store")
+		w.Write(buf.Bytes())
+	}
+}
+
+// loadJobReport gathers a job's before/after pairs, with the language of
+// its customer.
+func loadJobReport(ctx context.Context, db *pgxpool.Pool, store storage.Storage, jobID uuid.UUID) (models.JobReportData, string, error) {
+	data := models.JobReportData{
+		Business:  defaultBusinessInfo(),
+		Reference: strings.ToUpper(jobID.String()[:8]),
+		Date:      time.Now(),
+	}
+
+	var address, lang string
+	err := db.QueryRow(ctx,
+		`SELECT j.title, COALESCE(j.description, ''), c.name, COALESCE(c.address, ''), COALESCE(c.language, 'en')
+         FROM jobs j JOIN customers c ON c.id = j.customer_id
+         WHERE j.id = $1`,
+		jobID,
+	).Scan(&data.JobTitle, &data.JobDescription, &data.Customer.Name, &address, &lang)
+	if err != nil {
+		return data, "", err
+	}
+	data.Customer.CustomerAddress = models.CustomerAddress{Line1: address}
+
+	rows, err := db.Query(ctx,
+		`SELECT b.file_key, COALESCE(b.content_type, ''), COALESCE(b.medium_key, ''), COALESCE(b.caption, ''), b.taken_at,
+                a.file_key, COALESCE(a.content_type, ''), COALESCE(a.medium_key, ''), COALESCE(a.caption, ''), a.taken_at
+         FROM job_photos a JOIN job_photos b ON b.id = a.before_photo_id
+         WHERE a.job_id = $1
+         ORDER BY a.sort_order, COALESCE(a.taken_at, a.created_at), a.created_at`,
+		jobID,
+	)
+	if err != nil {
+		return data, "", err
+	}
+
+	type reportRow struct {
+		before, after reportPhotoRow
+	}
+
+	var pairs []reportRow
+	for rows.Next() {
+		var p reportRow
+		err := rows.Scan(
+			&p.before.fileKey, &p.before.contentType, &p.before.mediumKey, &p.before.caption, &p.before.takenAt,
+			&p.after.fileKey, &p.after.contentType, &p.after.mediumKey, &p.after.caption, &p.after.takenAt,
+		)
+		if err != nil {
+			rows.Close()
+			return data, "", err
+		}
+		pairs = append(pairs, p)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return data, "", err
+	}
+
+	for _, p := range pairs {
+		before, err := p.before.load(ctx, store)
+		if err != nil {
+			return data, "", err
+		}
+		after, err := p.after.load(ctx, store)
+		if err != nil {
+			return data, "", err
+		}
+		data.Pairs = append(data.Pairs, models.ReportPhotoPair{Before: before, After: after})
+	}
+
+	return data, lang, nil
+}
+
+type reportPhotoRow struct {
+	fileKey     string
+	contentType string
+	mediumKey   string
+	caption     string
+	takenAt     *time.Time
+}
+
+// load reads the photo to print: the medium variant, which is always a
+// JPEG, or the photo itself if it is a JPEG without one yet. Other photos
+// are printed as unavailable.
+func (p reportPhotoRow) load(ctx context.Context, store storage.Storage) (models.ReportPhoto, error) {
+	photo := models.ReportPhoto{Caption: p.caption, TakenAt: p.takenAt}
+
+	key := p.mediumKey
+	if key == "" && p.contentType == "image/jpeg" {
+		key = p.fileKey
+	}
+	if key == "" {
+		return photo, nil
+	}
+
+	image, err := readStoredFile(ctx, store, key)
+	if errors.Is(err, storage.ErrNotFound) {
+		return photo, nil
+	}
+	if err != nil {
+		return photo, err
+	}
+
+	photo.Image = image
+	return photo, nil
+}
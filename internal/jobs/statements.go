@@ -0,0 +1,383 @@
+package jobs
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"time"
+
+	"pistachio/internal/invoices"
+	"pistachio/internal/models"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+const dateParamLayout = "2006-01-02"
+
+type StatementResponse struct {
+	CustomerID     uuid.UUID               `json:"customer_id"`
+	CustomerName   string                  `json:"customer_name"`
+	Currency       string                  `json:"currency"`
+	From           string                  `json:"from"`
+	To             string                  `json:"to"`
+	OpeningBalance float64                 `json:"opening_balance"`
+	Entries        []models.StatementEntry `json:"entries"`
+	ClosingBalance float64                 `json:"closing_balance"`
+}
+
+// dateParam reads a YYYY-MM-DD query parameter, or def when it is absent.
+func dateParam(r *http.Request, name string, def time.Time) (time.Time, error) {
+	value := r.URL.Query().Get(name)
+	if value == "" {
+		return def, nil
+	}
+
+	t, err := time.Parse(dateParamLayout, value)
+	if err != nil {
+		return t, fmt.Errorf("%s must be a date like 2026-01-31", name)
+	}
+	return t, nil
+}
+
+// errMixedCurrencies is returned for a customer invoiced in more than one
+// currency, whose balances can't be added up.
+var errMixedCurrencies = errors.New("customer has invoices in more than one currency; a statement needs a single currency")
+
+// loadStatement builds a customer's statement for the days from..to
+// inclusive. Everything before from is summed into the opening balance.
+// Void invoices are left out, as they were never owed. The statement is
+// in the currency of the customer's invoices, or the billing currency if
+// there are none.
+func loadStatement(ctx context.Context, db *pgxpool.Pool, customerID uuid.UUID, from, to time.Time) (models.StatementData, error) {
+	data := models.StatementData{
+		Business: defaultBusinessInfo(),
+		From:     from,
+		To:       to,
+		Entries:  []models.StatementEntry{},
+	}
+
+	var address string
+	err := db.QueryRow(ctx,
+		`SELECT name, COALESCE(email, ''), COALESCE(address, '') FROM customers WHERE id = $1`,
+		customerID,
+	).Scan(&data.Customer.Name, &data.Customer.Email, &address)
+	if err != nil {
+		return data, err
+	}
+	data.Customer.CustomerAddress = models.CustomerAddress{Line1: address}
+
+	currencies, err := db.Query(ctx,
+		`SELECT DISTINCT currency FROM invoices WHERE customer_id = $1 AND status <> $2`,
+		customerID,
+		InvoiceVoid,
+	)
+	if err != nil {
+		return data, fmt.Errorf("failed to query currencies: %w", err)
+	}
+
+	codes := []string{}
+	for currencies.Next() {
+		var code string
+		if err := currencies.Scan(&code); err != nil {
+			currencies.Close()
+			return data, fmt.Errorf("failed to scan currency: %w", err)
+		}
+		codes = append(codes, code)
+	}
+	currencies.Close()
+
+	if err := currencies.Err(); err != nil {
+		return data, fmt.Errorf("failed to query currencies: %w", err)
+	}
+
+	switch len(codes) {
+	case 0:
+		settings, err := loadBillingSettings(ctx, db)
+		if err != nil {
+			return data, fmt.Errorf("failed to load billing settings: %w", err)
+		}
+		data.Currency = settings.Currency
+	case 1:
+		data.Currency = codes[0]
+	default:
+		return data, errMixedCurrencies
+	}
+
+	rows, err := db.Query(ctx,
+		`SELECT entry_date, type, reference, description, debit, credit FROM (
+             SELECT COALESCE(issue_date, created_at) AS entry_date, 'invoice' AS type,
+                    COALESCE(invoice_number, 'INV-' || LEFT(id::text, 8)) AS reference,
+                    CASE kind WHEN $3 THEN 'Deposit invoice' ELSE 'Invoice' END AS description,
+                    total AS debit, 0 AS credit
+             FROM invoices WHERE customer_id = $1 AND status <> $4
+
+             UNION ALL
+             SELECT COALESCE(issue_date, created_at), 'deposit', COALESCE(invoice_number, 'INV-' || LEFT(id::text, 8)),
+                    'Deposits deducted', 0, deposit_applied
+             FROM invoices WHERE customer_id = $1 AND status <> $4 AND deposit_applied > 0
+
+             UNION ALL
+             SELECT p.paid_at, 'payment', COALESCE(i.invoice_number, 'INV-' || LEFT(i.id::text, 8)),
+                    'Payment' || COALESCE(' – ' || NULLIF(p.method, ''), ''), 0, p.amount
+             FROM invoice_payments p JOIN invoices i ON i.id = p.invoice_id
+             WHERE i.customer_id = $1
+
+             UNION ALL
+             SELECT c.issue_date, 'credit_note', c.credit_note_number,
+                    'Credit against ' || COALESCE(i.invoice_number, 'INV-' || LEFT(i.id::text, 8)), 0, c.total
+             FROM credit_notes c JOIN invoices i ON i.id = c.invoice_id
+             WHERE i.customer_id = $1
+         ) e
+         WHERE entry_date < $2
+         ORDER BY entry_date, type <> 'invoice'`,
+		customerID,
+		to.AddDate(0, 0, 1),
+		InvoiceDeposit,
+		InvoiceVoid,
+	)
+	if err != nil {
+		return data, fmt.Errorf("failed to query statement: %w", err)
+	}
+	defer rows.Close()
+
+	balance := 0.0
+	for rows.Next() {
+		var e models.StatementEntry
+		if err := rows.Scan(&e.Date, &e.Type, &e.Reference, &e.Description, &e.Debit, &e.Credit); err != nil {
+			return data, fmt.Errorf("failed to scan statement entry: %w", err)
+		}
+
+		balance = math.Round((balance+e.Debit-e.Credit)*100) / 100
+		e.Balance = balance
+
+		if e.Date.Before(from) {
+			data.OpeningBalance = balance
+			continue
+		}
+		data.Entries = append(data.Entries, e)
+	}
+
+	if err := rows.Err(); err != nil {
+		return data, fmt.Errorf("failed to read statement: %w", err)
+	}
+
+	data.ClosingBalance = balance
+	return data, nil
+}
+
+// CustomerStatementHandler returns a customer's statement of account as
+// JSON, or as a PDF with ?format=pdf. The period defaults to the last 90
+// days.
+func CustomerStatementHandler(db *pgxpool.Pool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		customerID, err := uuid.Parse(chi.URLParam(r, "id"))
+		if err != nil {
+			http.Error(w, "invalid customer id", http.StatusBadRequest)
+			return
+		}
+
+		today := time.Now().UTC().Truncate(24 * time.Hour)
+
+		to, err := dateParam(r, "to", today)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		from, err := dateParam(r, "from", to.AddDate(0, 0, -90))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		if from.After(to) {
+			http.Error(w, "from must be on or before to", http.StatusBadRequest)
+			return
+		}
+
+		ctx := context.Background()
+
+		data, err := loadStatement(ctx, db, customerID, from, to)
+
+		if errors.Is(err, pgx.ErrNoRows) {
+			http.Error(w, "customer not found", http.StatusNotFound)
+			return
+		}
+
+		if errors.Is(err, errMixedCurrencies) {
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		}
+
+		if err != nil {
+			http.Error(w, "failed to load statement: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		if r.URL.Query().Get("format") == "pdf" {
+			lang, err := customerLanguage(ctx, db, customerID)
+			if err != nil {
+				http.Error(w, "failed to load customer language: "+err.Error(), http.StatusInternalServerError)
+				return
+			}
+
+			var buf bytes.Buffer
+			if err := invoices.WriteStatementPDF(data, &buf, invoices.WithLanguage(lang)); err != nil {
+				http.Error(w, "failed to render statement: "+err.Error(), http.StatusInternalServerError)
+				return
+			}
+
+			w.Header().Set("Content-Type", "application/pdf")
+			w.Header().Set("Content-Disposition",
+				fmt.Sprintf(`inline; filename="statement-%s-%s.pdf"`, from.Format(dateParamLayout), to.Format(dateParamLayout)))
+			w.Write(buf.Bytes())
+			return
+		}
+
+		json.NewEncoder(w).Encode(StatementResponse{
+			CustomerID:     customerID,
+			CustomerName:   data.Customer.Name,
+			Currency:       data.Currency,
+			From:           from.Format(dateParamLayout),
+			To:             to.Format(dateParamLayout),
+			OpeningBalance: data.OpeningBalance,
+			Entries:        data.Entries,
+			ClosingBalance: data.ClosingBalance,
+		})
+	}
+}
+
+// AgingBuckets splits outstanding balances by how many days they are
+// past their due date.
+type AgingBuckets struct {
+	Current    float64 `json:"current"`
+	Days1To30  float64 `json:"days_1_30"`
+	Days31To60 float64 `json:"days_31_60"`
+	Days61To90 float64 `json:"days_61_90"`
+	Days90Plus float64 `json:"days_90_plus"`
+	Total      float64 `json:"total"`
+}
+
+func (b *AgingBuckets) add(daysOverdue int, amount float64) {
+	switch {
+	case daysOverdue <= 0:
+		b.Current += amount
+	case daysOverdue <= 30:
+		b.Days1To30 += amount
+	case daysOverdue <= 60:
+		b.Days31To60 += amount
+	case daysOverdue <= 90:
+		b.Days61To90 += amount
+	default:
+		b.Days90Plus += amount
+	}
+	b.Total += amount
+}
+
+func (b *AgingBuckets) round() {
+	for _, v := range []*float64{&b.Current, &b.Days1To30, &b.Days31To60, &b.Days61To90, &b.Days90Plus, &b.Total} {
+		*v = math.Round(*v*100) / 100
+	}
+}
+
+type CustomerAging struct {
+	CustomerID   *uuid.UUID `json:"customer_id"`
+	CustomerName string     `json:"customer_name"`
+	Invoices     int        `json:"invoices"`
+	AgingBuckets
+}
+
+type AgedReceivablesReport struct {
+	At        string          `json:"at"`
+	Customers []CustomerAging `json:"customers"`
+	Totals    AgingBuckets    `json:"totals"`
+}
+
+// AgedReceivablesHandler reports what every customer owes, bucketed by
+// days overdue as of ?at= (default today). Customers owing the most come
+// first.
+func AgedReceivablesHandler(db *pgxpool.Pool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		at, err := dateParam(r, "at", time.Now().UTC())
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		ctx := context.Background()
+
+		rows, err := db.Query(ctx,
+			`SELECT customer_id, customer_name, COALESCE(due_date, created_at + INTERVAL '14 days'),
+                    `+invoiceBalanceSQL+`
+             FROM invoices
+             WHERE status IN ($1, $2) AND `+invoiceBalanceSQL+` > 0`,
+			InvoiceIssued,
+			InvoiceOverdue,
+		)
+		if err != nil {
+			http.Error(w, "failed to query invoices: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		defer rows.Close()
+
+		report := AgedReceivablesReport{At: at.Format(dateParamLayout), Customers: []CustomerAging{}}
+		byCustomer := map[string]*CustomerAging{}
+
+		for rows.Next() {
+			var customerID *uuid.UUID
+			var name string
+			var dueDate time.Time
+			var balance float64
+
+			if err := rows.Scan(&customerID, &name, &dueDate, &balance); err != nil {
+				http.Error(w, "scan error: "+err.Error(), http.StatusInternalServerError)
+				return
+			}
+
+			// Invoices from before customer links are grouped by name
+			key := "name:" + name
+			if customerID != nil {
+				key = customerID.String()
+			}
+
+			c, ok := byCustomer[key]
+			if !ok {
+				c = &CustomerAging{CustomerID: customerID, CustomerName: name}
+				byCustomer[key] = c
+			}
+
+			days := daysBetween(dueDate, at)
+			c.Invoices++
+			c.add(days, balance)
+			report.Totals.add(days, balance)
+		}
+
+		if err := rows.Err(); err != nil {
+			http.Error(w, "failed to read invoices: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		for _, c := range byCustomer {
+			c.round()
+			report.Customers = append(report.Customers, *c)
+		}
+		report.Totals.round()
+
+		sort.Slice(report.Customers, func(i, j int) bool {
+			if report.Customers[i].Total != report.Customers[j].Total {
+				return report.Customers[i].Total > report.Customers[j].Total
+			}
+			return report.Customers[i].CustomerName < report.Customers[j].CustomerName
+		})
+
+		json.NewEncoder(w).Encode(report)
+	}
+}
@@ -0,0 +1,232 @@
+package jobs
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"pistachio/internal/links"
+	"pistachio/internal/models"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+func TestStatementCurrency(t *testing.T) {
+	db := testDB(t)
+	jobID := seedJob(t, db)
+	seedJobPart(t, db, jobID, 45)
+
+	var customerID uuid.UUID
+	if err := db.QueryRow(context.Background(), `SELECT customer_id FROM jobs WHERE id = $1`, jobID).Scan(&customerID); err != nil {
+		t.Fatal(err)
+	}
+
+	r := chi.NewRouter()
+	r.Put("/settings/billing", UpdateBillingSettingsHandler(db))
+	r.Post("/jobs/{id}/invoice", CreateJobInvoiceHandler(db))
+	r.Get("/customers/{id}/statement", CustomerStatementHandler(db))
+
+	do := func(method, url, body string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		r.ServeHTTP(rec, httptest.NewRequest(method, url, strings.NewReader(body)))
+		return rec
+	}
+	mustDo := func(method, url, body string) *httptest.ResponseRecorder {
+		rec := do(method, url, body)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("%s %s: %d %s", method, url, rec.Code, rec.Body)
+		}
+		return rec
+	}
+
+	statement := "/customers/" + customerID.String() + "/statement"
+
+	mustDo(http.MethodPut, "/settings/billing", `{"payment_terms_days": 14, "currency": "EUR"}`)
+	mustDo(http.MethodPost, "/jobs/"+jobID.String()+"/invoice", "")
+
+	var got StatementResponse
+	json.NewDecoder(mustDo(http.MethodGet, statement, "").Body).Decode(&got)
+	if got.Currency != "EUR" {
+		t.Errorf("got statement currency %q, want EUR", got.Currency)
+	}
+
+	// A second invoice in another currency can't share a balance with it
+	_, err := issueInvoice(context.Background(), db, invoiceInput{
+		CustomerName: "Ada Customer",
+		CustomerID:   &customerID,
+		Items:        []models.InvoiceItem{{Description: "Call-out", Quantity: 1, UnitPrice: 60, TaxRate: 20}},
+		Currency:     "GBP",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if rec := do(http.MethodGet, statement, ""); rec.Code != http.StatusConflict {
+		t.Errorf("mixed currencies: got status %d, want 409", rec.Code)
+	}
+	if rec := do(http.MethodGet, statement+"?format=pdf", ""); rec.Code != http.StatusConflict {
+		t.Errorf("mixed currencies as PDF: got status %d, want 409", rec.Code)
+	}
+}
+
+// seedInvoice issues an invoice for amount, without tax, dated issued and
+// due a month later, and returns its id.
+func seedInvoice(t *testing.T, db *pgxpool.Pool, customerID uuid.UUID, amount float64, issued time.Time) string {
+	t.Helper()
+
+	ctx := context.Background()
+	inv, err := issueInvoice(ctx, db, invoiceInput{
+		CustomerName: "Ada Customer",
+		CustomerID:   &customerID,
+		Items:        []models.InvoiceItem{{Description: "Works", Quantity: 1, UnitPrice: amount}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = db.Exec(ctx,
+		`UPDATE invoices SET issue_date = $1, due_date = $2 WHERE id = $3`,
+		issued, issued.AddDate(0, 1, 0), inv.InvoiceID,
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return inv.InvoiceID
+}
+
+func TestStatementRunningBalance(t *testing.T) {
+	db := testDB(t)
+	customerID := seedCustomer(t, db)
+	signer := links.New(links.Config{Secret: "test", BaseURL: "http://localhost", TTL: time.Hour})
+
+	r := chi.NewRouter()
+	r.Post("/invoices/{id}/payments", RecordPaymentHandler(db, signer))
+	r.Post("/invoices/{id}/void", VoidInvoiceHandler(db, signer))
+	r.Get("/customers/{id}/statement", CustomerStatementHandler(db))
+
+	mustDo := func(method, url, body string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		r.ServeHTTP(rec, httptest.NewRequest(method, url, strings.NewReader(body)))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("%s %s: %d %s", method, url, rec.Code, rec.Body)
+		}
+		return rec
+	}
+	pay := func(invoiceID string, amount float64, paidAt string) {
+		mustDo(http.MethodPost, "/invoices/"+invoiceID+"/payments",
+			fmt.Sprintf(`{"amount": %.2f, "method": "card", "paid_at": "%sT12:00:00Z"}`, amount, paidAt))
+	}
+
+	// Before the period
+	january := seedInvoice(t, db, customerID, 100, time.Date(2026, 1, 10, 0, 0, 0, 0, time.UTC))
+	pay(january, 40, "2026-01-20")
+
+	// In it
+	february := seedInvoice(t, db, customerID, 250, time.Date(2026, 2, 5, 0, 0, 0, 0, time.UTC))
+	pay(february, 100, "2026-02-10")
+	void := seedInvoice(t, db, customerID, 999, time.Date(2026, 2, 12, 0, 0, 0, 0, time.UTC))
+	mustDo(http.MethodPost, "/invoices/"+void+"/void", `{"reason": "Sent twice"}`)
+
+	// After it
+	pay(february, 50, "2026-03-05")
+
+	var got StatementResponse
+	json.NewDecoder(mustDo(http.MethodGet, "/customers/"+customerID.String()+"/statement?from=2026-02-01&to=2026-02-28", "").Body).Decode(&got)
+
+	if got.OpeningBalance != 60 {
+		t.Errorf("got opening balance %.2f, want 60.00", got.OpeningBalance)
+	}
+
+	want := []struct {
+		typ     string
+		balance float64
+	}{
+		{"invoice", 310},
+		{"payment", 210},
+	}
+	if len(got.Entries) != len(want) {
+		t.Fatalf("got entries %+v, want %d", got.Entries, len(want))
+	}
+	for i, w := range want {
+		if e := got.Entries[i]; e.Type != w.typ || e.Balance != w.balance {
+			t.Errorf("entry %d: got %s with balance %.2f, want %s with %.2f", i, e.Type, e.Balance, w.typ, w.balance)
+		}
+	}
+
+	if got.ClosingBalance != 210 {
+		t.Errorf("got closing balance %.2f, want 210.00", got.ClosingBalance)
+	}
+}
+
+func TestAgingBuckets(t *testing.T) {
+	var b AgingBuckets
+	for _, days := range []int{-5, 0, 1, 30, 31, 60, 61, 90, 91, 400} {
+		b.add(days, 1.005)
+	}
+	b.round()
+
+	want := AgingBuckets{Current: 2.01, Days1To30: 2.01, Days31To60: 2.01, Days61To90: 2.01, Days90Plus: 2.01, Total: 10.05}
+	if b != want {
+		t.Errorf("got %+v, want %+v", b, want)
+	}
+}
+
+func TestAgedReceivables(t *testing.T) {
+	db := testDB(t)
+	signer := links.New(links.Config{Secret: "test", BaseURL: "http://localhost", TTL: time.Hour})
+
+	r := chi.NewRouter()
+	r.Post("/invoices/{id}/payments", RecordPaymentHandler(db, signer))
+	r.Get("/reports/aged-receivables", AgedReceivablesHandler(db))
+
+	mustDo := func(method, url, body string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		r.ServeHTTP(rec, httptest.NewRequest(method, url, strings.NewReader(body)))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("%s %s: %d %s", method, url, rec.Code, rec.Body)
+		}
+		return rec
+	}
+
+	ada, bob := seedCustomer(t, db), seedCustomer(t, db)
+	due := func(y int, m time.Month, d int) time.Time {
+		// seedInvoice makes invoices due a month after they're issued
+		return time.Date(y, m, d, 0, 0, 0, 0, time.UTC).AddDate(0, -1, 0)
+	}
+
+	seedInvoice(t, db, ada, 100, due(2026, 7, 10))             // not due yet
+	partPaid := seedInvoice(t, db, ada, 200, due(2026, 6, 20)) // 10 days overdue
+	seedInvoice(t, db, bob, 300, due(2026, 5, 16))             // 45
+	seedInvoice(t, db, bob, 400, due(2026, 4, 16))             // 75
+	seedInvoice(t, db, bob, 500, due(2026, 3, 1))              // 121
+	paid := seedInvoice(t, db, ada, 600, due(2026, 3, 1))
+
+	mustDo(http.MethodPost, "/invoices/"+partPaid+"/payments", `{"amount": 50}`)
+	mustDo(http.MethodPost, "/invoices/"+paid+"/payments", `{"amount": 600}`)
+
+	var report AgedReceivablesReport
+	json.NewDecoder(mustDo(http.MethodGet, "/reports/aged-receivables?at=2026-06-30", "").Body).Decode(&report)
+
+	want := AgingBuckets{Current: 100, Days1To30: 150, Days31To60: 300, Days61To90: 400, Days90Plus: 500, Total: 1450}
+	if report.Totals != want {
+		t.Errorf("got totals %+v, want %+v", report.Totals, want)
+	}
+
+	if len(report.Customers) != 2 {
+		t.Fatalf("got %d customers, want 2", len(report.Customers))
+	}
+	// Most owed first
+	if c := report.Customers[0]; c.CustomerID == nil || *c.CustomerID != bob || c.Invoices != 3 || c.Total != 1200 {
+		t.Errorf("first customer: got %+v, want the customer owing 1200.00 on 3 invoices", c)
+	}
+	if c := report.Customers[1]; c.CustomerID == nil || *c.CustomerID != ada || c.Invoices != 2 || c.Total != 250 {
+		t.Errorf("second customer: got %+v, want the customer owing 250.00 on 2 invoices", c)
+	}
+}
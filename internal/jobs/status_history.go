@@ -0,0 +1,87 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// JobStatusChange is one change of a job's status.
+type JobStatusChange struct {
+	FromStatus string `json:"from_status"`
+	Status     string `json:"status"`
+	ChangedAt  string `json:"changed_at"`
+}
+
+// checklistStatuses are the statuses a job can't reach until its required
+// checklist items are ticked: completed and anything after it.
+var checklistStatuses = []string{"completed", "invoiced"}
+
+// errChecklistIncomplete is returned by setJobStatus when a job's required
+// checklist items aren't all ticked.
+var errChecklistIncomplete = errors.New("required checklist item(s) not done")
+
+// setJobStatus changes a job's status and, if it is a change, records it
+// in the job's history, in one statement. It returns false if there is
+// no such job. A job moving to one of checklistStatuses is left as it is
+// and errChecklistIncomplete returned while required items are unticked.
+func setJobStatus(ctx context.Context, db pgxQuerier, jobID uuid.UUID, status string) (bool, error) {
+	var found bool
+	var outstanding int
+	err := db.QueryRow(ctx,
+		`WITH previous AS (
+             SELECT status FROM jobs WHERE id = $1
+         ), outstanding AS (
+             SELECT COUNT(*) AS n FROM job_checklist_items
+             WHERE job_id = $1 AND required AND checked_at IS NULL AND $2 = ANY($4::text[])
+         ), updated AS (
+             UPDATE jobs SET status = $2, updated_at = NOW()
+             WHERE id = $1 AND (SELECT n FROM outstanding) = 0
+             RETURNING id
+         ), recorded AS (
+             INSERT INTO job_status_history (id, job_id, from_status, status, changed_at)
+             SELECT $3, $1, previous.status, $2, NOW() FROM previous, updated WHERE previous.status <> $2
+         )
+         SELECT EXISTS (SELECT 1 FROM previous), (SELECT n FROM outstanding)`,
+		jobID,
+		status,
+		uuid.New(),
+		checklistStatuses,
+	).Scan(&found, &outstanding)
+
+	if err != nil {
+		return false, err
+	}
+	if found && outstanding > 0 {
+		return true, fmt.Errorf("%d %w", outstanding, errChecklistIncomplete)
+	}
+	return found, nil
+}
+
+func listStatusHistory(ctx context.Context, db *pgxpool.Pool, jobID uuid.UUID) ([]JobStatusChange, error) {
+	rows, err := db.Query(ctx,
+		`SELECT from_status, status, changed_at FROM job_status_history WHERE job_id = $1 ORDER BY changed_at`,
+		jobID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	history := []JobStatusChange{}
+	for rows.Next() {
+		var c JobStatusChange
+		var changedAt time.Time
+		if err := rows.Scan(&c.FromStatus, &c.Status, &changedAt); err != nil {
+			return nil, err
+		}
+		c.ChangedAt = changedAt.Format(time.RFC3339)
+		history = append(history, c)
+	}
+
+	return history, rows.Err()
+}
@@ -0,0 +1,63 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+func TestStatusHistory(t *testing.T) {
+	db := testDB(t)
+	ctx := context.Background()
+	jobID := seedJob(t, db)
+
+	_, err := db.Exec(ctx,
+		`INSERT INTO job_checklist_items (id, job_id, label, required, position) VALUES ($1, $2, 'Flue gas analysis', TRUE, 1)`,
+		uuid.New(),
+		jobID,
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, status := range []string{"waiting_parts", "waiting_parts", "in_progress"} {
+		if found, err := setJobStatus(ctx, db, jobID, status); err != nil || !found {
+			t.Fatalf("set %s: found=%v, %v", status, found, err)
+		}
+	}
+
+	// Refused, so not a change
+	if _, err := setJobStatus(ctx, db, jobID, "completed"); !errors.Is(err, errChecklistIncomplete) {
+		t.Errorf("completing with the checklist unticked: got %v", err)
+	}
+
+	if found, err := setJobStatus(ctx, db, uuid.New(), "completed"); err != nil || found {
+		t.Errorf("unknown job: found=%v, %v", found, err)
+	}
+
+	history, err := listStatusHistory(ctx, db, jobID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []JobStatusChange{
+		{FromStatus: "in_progress", Status: "waiting_parts"},
+		{FromStatus: "waiting_parts", Status: "in_progress"},
+	}
+	if len(history) != len(want) {
+		t.Fatalf("got %d changes %+v, want %d", len(history), history, len(want))
+	}
+	for i, c := range history {
+		if c.FromStatus != want[i].FromStatus || c.Status != want[i].Status || c.ChangedAt == "" {
+			t.Errorf("change %d: got %+v, want %s to %s", i+1, c, want[i].FromStatus, want[i].Status)
+		}
+	}
+
+	var count int
+	db.QueryRow(ctx, `SELECT COUNT(*) FROM job_status_history`).Scan(&count)
+	if count != len(want) {
+		t.Errorf("got %d changes recorded in all, want %d", count, len(want))
+	}
+}
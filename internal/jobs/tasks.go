@@ -0,0 +1,227 @@
+package jobs
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+
+	"pistachio/internal/einvoice"
+	"pistachio/internal/invoices"
+	"pistachio/internal/mailer"
+	"pistachio/internal/queue"
+	"pistachio/internal/storage"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// Background task kinds
+const (
+	TaskInvoicePDF    = "invoice.pdf"
+	TaskQuotePDF      = "quote.pdf"
+	TaskCreditNotePDF = "credit_note.pdf"
+	TaskSendEmail     = "email.send"
+	TaskPhotoVariants = "photo.variants"
+)
+
+// documentTask is the payload of tasks that act on a single row, such
+// as an invoice, quote or email.
+type documentTask struct {
+	ID uuid.UUID `json:"id"`
+}
+
+// RegisterTasks registers the handlers for every task kind this package
+// enqueues. It is shared by the API's in-process worker and cmd/worker.
+func RegisterTasks(w *queue.Worker, db *pgxpool.Pool, publicBaseURL string, m *mailer.Mailer, store storage.Storage) {
+	w.Handle(TaskInvoicePDF, func(ctx context.Context, payload json.RawMessage) error {
+		return renderInvoicePDF(ctx, db, store, payload)
+	})
+
+	w.Handle(TaskQuotePDF, func(ctx context.Context, payload json.RawMessage) error {
+		return renderQuotePDF(ctx, db, store, payload, publicBaseURL)
+	})
+
+	w.Handle(TaskCreditNotePDF, func(ctx context.Context, payload json.RawMessage) error {
+		return renderCreditNotePDF(ctx, db, store, payload)
+	})
+
+	w.Handle(TaskSendEmail, func(ctx context.Context, payload json.RawMessage) error {
+		return sendDocumentEmail(ctx, db, m, store, publicBaseURL, payload)
+	})
+
+	w.Handle(TaskPhotoVariants, func(ctx context.Context, payload json.RawMessage) error {
+		return renderPhotoVariants(ctx, db, store, payload)
+	})
+}
+
+func decodeDocumentTask(payload json.RawMessage) (documentTask, error) {
+	var task documentTask
+	if err := json.Unmarshal(payload, &task); err != nil {
+		return task, queue.Permanent(fmt.Errorf("invalid payload: %w", err))
+	}
+	return task, nil
+}
+
+func renderInvoicePDF(ctx context.Context, db *pgxpool.Pool, store storage.Storage, payload json.RawMessage) error {
+	task, err := decodeDocumentTask(payload)
+	if err != nil {
+		return err
+	}
+
+	data, err := loadInvoiceData(ctx, db, task.ID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return queue.Permanent(fmt.Errorf("invoice %s not found", task.ID))
+	}
+	if err != nil {
+		return fmt.Errorf("failed to load invoice: %w", err)
+	}
+
+	facturX, err := wantsFacturX(ctx, db, task.ID)
+	if err != nil {
+		return fmt.Errorf("failed to load customer settings: %w", err)
+	}
+
+	settings, err := loadBillingSettings(ctx, db)
+	if err != nil {
+		return fmt.Errorf("failed to load billing settings: %w", err)
+	}
+
+	branding, err := loadBranding(ctx, db)
+	if err != nil {
+		return fmt.Errorf("failed to load branding settings: %w", err)
+	}
+
+	lang, err := invoiceLanguage(ctx, db, task.ID)
+	if err != nil {
+		return fmt.Errorf("failed to load customer language: %w", err)
+	}
+
+	opts := []invoices.Option{invoices.WithBranding(branding.Branding), invoices.WithLanguage(lang)}
+	if settings.PaymentQR {
+		opts = append(opts, invoices.WithPaymentQR())
+	}
+
+	var buf bytes.Buffer
+	if facturX {
+		err = invoices.GenerateInvoicePDF(data, &buf, append(opts, invoices.WithFacturX())...)
+	} else {
+		err = invoices.GenerateInvoicePDF(data, &buf, opts...)
+	}
+
+	// An invoice that can't be a valid e-invoice still goes out, as a
+	// plain PDF
+	var invalid einvoice.ValidationError
+	if errors.As(err, &invalid) {
+		log.Printf("invoice %s: sending plain PDF instead of Factur-X: %v", task.ID, err)
+		buf.Reset()
+		err = invoices.GenerateInvoicePDF(data, &buf, opts...)
+	}
+
+	if err != nil {
+		return fmt.Errorf("failed to generate PDF: %w", err)
+	}
+
+	return storeDocumentPDF(ctx, db, store, "invoices", task.ID, &buf)
+}
+
+func renderQuotePDF(ctx context.Context, db *pgxpool.Pool, store storage.Storage, payload json.RawMessage, publicBaseURL string) error {
+	task, err := decodeDocumentTask(payload)
+	if err != nil {
+		return err
+	}
+
+	data, err := loadQuoteData(ctx, db, task.ID, publicBaseURL)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return queue.Permanent(fmt.Errorf("quote %s not found", task.ID))
+	}
+	if err != nil {
+		return fmt.Errorf("failed to load quote: %w", err)
+	}
+
+	branding, err := loadBranding(ctx, db)
+	if err != nil {
+		return fmt.Errorf("failed to load branding settings: %w", err)
+	}
+
+	lang, err := quoteLanguage(ctx, db, task.ID)
+	if err != nil {
+		return fmt.Errorf("failed to load quote language: %w", err)
+	}
+
+	var buf bytes.Buffer
+	err = invoices.GenerateQuotePDF(data, &buf, invoices.WithBranding(branding.Branding), invoices.WithLanguage(lang))
+	if err != nil {
+		return fmt.Errorf("failed to generate PDF: %w", err)
+	}
+
+	return storeDocumentPDF(ctx, db, store, "quotes", task.ID, &buf)
+}
+
+func renderCreditNotePDF(ctx context.Context, db *pgxpool.Pool, store storage.Storage, payload json.RawMessage) error {
+	task, err := decodeDocumentTask(payload)
+	if err != nil {
+		return err
+	}
+
+	data, err := loadCreditNoteData(ctx, db, task.ID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return queue.Permanent(fmt.Errorf("credit note %s not found", task.ID))
+	}
+	if err != nil {
+		return fmt.Errorf("failed to load credit note: %w", err)
+	}
+
+	branding, err := loadBranding(ctx, db)
+	if err != nil {
+		return fmt.Errorf("failed to load branding settings: %w", err)
+	}
+
+	lang, err := creditNoteLanguage(ctx, db, task.ID)
+	if err != nil {
+		return fmt.Errorf("failed to load customer language: %w", err)
+	}
+
+	var buf bytes.Buffer
+	err = invoices.GenerateCreditNotePDF(data, &buf, invoices.WithBranding(branding.Branding), invoices.WithLanguage(lang))
+	if err != nil {
+		return fmt.Errorf("failed to generate PDF: %w", err)
+	}
+
+	return storeDocumentPDF(ctx, db, store, "credit_notes", task.ID, &buf)
+}
+
+// pdfKeyPrefixes are the storage key prefixes of each document table's
+// PDFs.
+var pdfKeyPrefixes = map[string]string{
+	"invoices":     "invoices/",
+	"quotes":       "quotes/",
+	"credit_notes": "credit-notes/",
+}
+
+// storeDocumentPDF saves a rendered PDF under <prefix><id>.pdf, with its
+// hash, and marks the document's PDF ready.
+func storeDocumentPDF(ctx context.Context, db *pgxpool.Pool, store storage.Storage, table string, id uuid.UUID, pdf *bytes.Buffer) error {
+	key := pdfKeyPrefixes[table] + id.String() + ".pdf"
+	hash := storage.Hash(pdf.Bytes())
+
+	if err := store.Put(ctx, key, pdf, "application/pdf"); err != nil {
+		return fmt.Errorf("failed to store PDF: %w", err)
+	}
+
+	_, err := db.Exec(ctx,
+		`UPDATE `+table+` SET pdf_key = $1, pdf_sha256 = $2, pdf_status = $3 WHERE id = $4`,
+		key,
+		hash,
+		PDFReady,
+		id,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to update pdf key: %w", err)
+	}
+
+	return nil
+}
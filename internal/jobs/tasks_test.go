@@ -0,0 +1,42 @@
+package jobs
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"pistachio/internal/storage"
+)
+
+// TestInvoicePDFHash renders an invoice's PDF as the worker does and
+// checks the hash recorded is the stored file's.
+func TestInvoicePDFHash(t *testing.T) {
+	db := testDB(t)
+	ctx := context.Background()
+	store := storage.NewLocal(t.TempDir(), nil)
+
+	invoiceID := seedInvoice(t, db, seedCustomer(t, db), 250, time.Now())
+	payload, _ := json.Marshal(map[string]string{"id": invoiceID})
+
+	if err := renderInvoicePDF(ctx, db, store, payload); err != nil {
+		t.Fatal(err)
+	}
+
+	var key, hash, status string
+	err := db.QueryRow(ctx,
+		`SELECT pdf_key, COALESCE(pdf_sha256, ''), pdf_status FROM invoices WHERE id = $1`,
+		invoiceID,
+	).Scan(&key, &hash, &status)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if status != PDFReady || !strings.HasPrefix(key, "invoices/") {
+		t.Errorf("got PDF %s at %q, want ready under invoices/", status, key)
+	}
+	if got, err := storage.HashFile(ctx, store, key); err != nil || got != hash {
+		t.Errorf("%s hashes to %s (%v), recorded %q", key, got, err, hash)
+	}
+}
@@ -0,0 +1,258 @@
+package jobs
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"pistachio/internal/models"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+type TemplateChecklistItem struct {
+	Label    string `json:"label"`
+	Required bool   `json:"required"`
+}
+
+type JobTemplate struct {
+	ID          uuid.UUID               `json:"id"`
+	Name        string                  `json:"name"`
+	JobType     string                  `json:"job_type"`
+	Title       string                  `json:"title"`
+	Description string                  `json:"description"`
+	Estimate    float64                 `json:"estimate"`
+	Checklist   []TemplateChecklistItem `json:"checklist"`
+	LineItems   []models.InvoiceItem    `json:"line_items"`
+	CreatedAt   string                  `json:"created_at"`
+}
+
+type CreateJobTemplateRequest struct {
+	Name        string               `json:"name"`
+	JobType     string               `json:"job_type"`
+	Title       string               `json:"title"`
+	Description string               `json:"description"`
+	Estimate    float64              `json:"estimate"`
+	Checklist   []ChecklistItemInput `json:"checklist"`
+	LineItems   []models.InvoiceItem `json:"line_items"`
+}
+
+type ChecklistItemInput struct {
+	Label    string `json:"label"`
+	Required *bool  `json:"required"` // default: true
+}
+
+func loadJobTemplate(ctx context.Context, db *pgxpool.Pool, templateID uuid.UUID) (JobTemplate, error) {
+	var t JobTemplate
+	var createdAt time.Time
+
+	err := db.QueryRow(ctx,
+		`SELECT id, name, COALESCE(job_type, ''), title, COALESCE(description, ''), COALESCE(estimate, 0), line_items, created_at
+         FROM job_templates WHERE id = $1`,
+		templateID,
+	).Scan(&t.ID, &t.Name, &t.JobType, &t.Title, &t.Description, &t.Estimate, &t.LineItems, &createdAt)
+	if err != nil {
+		return t, err
+	}
+
+	t.CreatedAt = createdAt.Format(time.RFC3339)
+
+	rows, err := db.Query(ctx,
+		`SELECT label, required FROM job_template_checklist_items WHERE template_id = $1 ORDER BY position`,
+		templateID,
+	)
+	if err != nil {
+		return t, err
+	}
+	defer rows.Close()
+
+	t.Checklist = []TemplateChecklistItem{}
+	for rows.Next() {
+		var item TemplateChecklistItem
+		if err := rows.Scan(&item.Label, &item.Required); err != nil {
+			return t, err
+		}
+		t.Checklist = append(t.Checklist, item)
+	}
+
+	return t, rows.Err()
+}
+
+func CreateJobTemplateHandler(db *pgxpool.Pool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req CreateJobTemplateRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "invalid JSON", http.StatusBadRequest)
+			return
+		}
+
+		if req.Name == "" || req.Title == "" {
+			http.Error(w, "name and title are required", http.StatusBadRequest)
+			return
+		}
+
+		for _, item := range req.Checklist {
+			if item.Label == "" {
+				http.Error(w, "checklist items need a label", http.StatusBadRequest)
+				return
+			}
+		}
+
+		if req.LineItems == nil {
+			req.LineItems = []models.InvoiceItem{}
+		}
+
+		ctx := context.Background()
+
+		tx, err := db.Begin(ctx)
+		if err != nil {
+			http.Error(w, "failed to start transaction: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		defer tx.Rollback(ctx)
+
+		// 1️⃣ Insert template
+		templateID := uuid.New()
+
+		lineItemsJSON, err := json.Marshal(req.LineItems)
+		if err != nil {
+			http.Error(w, "cannot encode line items json", http.StatusInternalServerError)
+			return
+		}
+
+		_, err = tx.Exec(ctx,
+			`INSERT INTO job_templates (id, name, job_type, title, description, estimate, line_items, created_at)
+             VALUES ($1, $2, NULLIF($3, ''), $4, $5, $6, $7, NOW())`,
+			templateID,
+			req.Name,
+			req.JobType,
+			req.Title,
+			req.Description,
+			req.Estimate,
+			lineItemsJSON,
+		)
+
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == "23505" {
+			http.Error(w, "a template named "+req.Name+" already exists", http.StatusConflict)
+			return
+		}
+
+		if err != nil {
+			http.Error(w, "failed to create template: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		// 2️⃣ Insert checklist items in order
+		for i, item := range req.Checklist {
+			_, err = tx.Exec(ctx,
+				`INSERT INTO job_template_checklist_items (id, template_id, label, required, position)
+                 VALUES ($1, $2, $3, $4, $5)`,
+				uuid.New(),
+				templateID,
+				item.Label,
+				item.Required == nil || *item.Required,
+				i,
+			)
+			if err != nil {
+				http.Error(w, "failed to create checklist item: "+err.Error(), http.StatusInternalServerError)
+				return
+			}
+		}
+
+		if err := tx.Commit(ctx); err != nil {
+			http.Error(w, "failed to commit: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		// 3️⃣ Respond
+		template, err := loadJobTemplate(ctx, db, templateID)
+		if err != nil {
+			http.Error(w, "failed to load template: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		json.NewEncoder(w).Encode(template)
+	}
+}
+
+func ListJobTemplatesHandler(db *pgxpool.Pool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := context.Background()
+
+		rows, err := db.Query(ctx, `SELECT id FROM job_templates ORDER BY name`)
+		if err != nil {
+			http.Error(w, "failed to query templates: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		ids := []uuid.UUID{}
+		for rows.Next() {
+			var id uuid.UUID
+			if err := rows.Scan(&id); err != nil {
+				rows.Close()
+				http.Error(w, "scan error: "+err.Error(), http.StatusInternalServerError)
+				return
+			}
+			ids = append(ids, id)
+		}
+		rows.Close()
+
+		templates := []JobTemplate{}
+		for _, id := range ids {
+			template, err := loadJobTemplate(ctx, db, id)
+			if err != nil {
+				http.Error(w, "failed to load template: "+err.Error(), http.StatusInternalServerError)
+				return
+			}
+			templates = append(templates, template)
+		}
+
+		json.NewEncoder(w).Encode(templates)
+	}
+}
+
+func GetJobTemplateHandler(db *pgxpool.Pool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		templateID, err := uuid.Parse(chi.URLParam(r, "id"))
+		if err != nil {
+			http.Error(w, "invalid template id", http.StatusBadRequest)
+			return
+		}
+
+		template, err := loadJobTemplate(context.Background(), db, templateID)
+		if err != nil {
+			http.Error(w, "template not found", http.StatusNotFound)
+			return
+		}
+
+		json.NewEncoder(w).Encode(template)
+	}
+}
+
+// templateLines returns the template's standard line items for the job,
+// unless an invoice that hasn't been voided has billed them already.
+func templateLines(ctx context.Context, db pgxQuerier, jobID uuid.UUID) ([]models.InvoiceItem, error) {
+	var items []models.InvoiceItem
+
+	err := db.QueryRow(ctx,
+		`SELECT COALESCE(t.line_items, '[]')
+         FROM jobs j
+         LEFT JOIN job_templates t ON t.id = j.template_id
+         WHERE j.id = $1
+           AND j.template_lines_invoice_id IS NULL`,
+		jobID,
+	).Scan(&items)
+
+	if errors.Is(err, pgx.ErrNoRows) {
+		return []models.InvoiceItem{}, nil
+	}
+
+	return items, err
+}
@@ -0,0 +1,87 @@
+package jobs
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"pistachio/internal/links"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+)
+
+func TestTemplateLinesBilledOnce(t *testing.T) {
+	db := testDB(t)
+	ctx := context.Background()
+	jobID := seedJob(t, db)
+
+	templateID := uuid.New()
+	_, err := db.Exec(ctx,
+		`INSERT INTO job_templates (id, name, title, line_items)
+         VALUES ($1, 'Boiler service', 'Annual boiler service', '[{"description": "Annual boiler service", "quantity": 1, "unitPrice": 90}]')`,
+		templateID,
+	)
+	if err != nil {
+		t.Fatalf("seed template: %v", err)
+	}
+	if _, err := db.Exec(ctx, `UPDATE jobs SET template_id = $1 WHERE id = $2`, templateID, jobID); err != nil {
+		t.Fatal(err)
+	}
+
+	signer := links.New(links.Config{Secret: "test", BaseURL: "http://localhost", TTL: time.Hour})
+
+	r := chi.NewRouter()
+	r.Post("/jobs/{id}/deposit", CreateJobDepositHandler(db))
+	r.Post("/jobs/{id}/invoice", CreateJobInvoiceHandler(db))
+	r.Post("/invoices/{id}/void", VoidInvoiceHandler(db, signer))
+
+	do := func(method, url, body string) (int, string) {
+		rec := httptest.NewRecorder()
+		r.ServeHTTP(rec, httptest.NewRequest(method, url, strings.NewReader(body)))
+		var created struct {
+			InvoiceID string `json:"invoice_id"`
+		}
+		json.NewDecoder(rec.Body).Decode(&created)
+		return rec.Code, created.InvoiceID
+	}
+
+	jobURL := "/jobs/" + jobID.String()
+
+	hasTemplateLine := func(invoiceID string) bool {
+		var items string
+		if err := db.QueryRow(ctx, `SELECT items::text FROM invoices WHERE id = $1`, invoiceID).Scan(&items); err != nil {
+			t.Fatal(err)
+		}
+		return strings.Contains(items, "Annual boiler service")
+	}
+
+	// A deposit doesn't use up the template lines
+	if code, _ := do(http.MethodPost, jobURL+"/deposit", `{"amount": 20}`); code != http.StatusOK {
+		t.Fatalf("deposit: got %d", code)
+	}
+
+	code, first := do(http.MethodPost, jobURL+"/invoice", "")
+	if code != http.StatusOK || !hasTemplateLine(first) {
+		t.Fatalf("first invoice: got %d, want 200 with the template line", code)
+	}
+
+	// The next invoice doesn't bill them again
+	if code, _ := do(http.MethodPost, jobURL+"/invoice", ""); code != http.StatusBadRequest {
+		t.Errorf("second invoice with nothing left to bill: got %d, want 400", code)
+	}
+
+	// Voiding the first puts them back
+	if code, _ := do(http.MethodPost, "/invoices/"+first+"/void", `{"reason": "Wrong customer"}`); code != http.StatusOK {
+		t.Fatalf("void: got %d", code)
+	}
+
+	code, replacement := do(http.MethodPost, jobURL+"/invoice", "")
+	if code != http.StatusOK || !hasTemplateLine(replacement) {
+		t.Errorf("replacement invoice: got %d, want 200 with the template line", code)
+	}
+}
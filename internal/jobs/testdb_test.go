@@ -0,0 +1,146 @@
+package jobs
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// TestMain runs the tests from the repository root, as the API runs, so
+// PDFs find the fonts in assets/font.
+func TestMain(m *testing.M) {
+	if err := os.Chdir("../.."); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	os.Exit(m.Run())
+}
+
+// testDB connects to TEST_DATABASE_URL and migrates a schema of its own,
+// dropped when the test ends. Tests that need it are skipped without it.
+func testDB(t *testing.T) *pgxpool.Pool {
+	t.Helper()
+
+	url := os.Getenv("TEST_DATABASE_URL")
+	if url == "" {
+		t.Skip("TEST_DATABASE_URL not set")
+	}
+
+	ctx := context.Background()
+	schema := "test_" + strings.ReplaceAll(uuid.NewString(), "-", "")
+
+	admin, err := pgxpool.New(ctx, url)
+	if err != nil {
+		t.Fatalf("connect: %v", err)
+	}
+	t.Cleanup(admin.Close)
+
+	if _, err := admin.Exec(ctx, `CREATE SCHEMA `+schema); err != nil {
+		t.Fatalf("create schema: %v", err)
+	}
+	t.Cleanup(func() {
+		admin.Exec(context.Background(), `DROP SCHEMA `+schema+` CASCADE`)
+	})
+
+	cfg, err := pgxpool.ParseConfig(url)
+	if err != nil {
+		t.Fatalf("parse config: %v", err)
+	}
+	cfg.ConnConfig.RuntimeParams["search_path"] = schema
+
+	db, err := pgxpool.NewWithConfig(ctx, cfg)
+	if err != nil {
+		t.Fatalf("connect: %v", err)
+	}
+	t.Cleanup(db.Close)
+
+	files, err := filepath.Glob("internal/database/*.sql")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sort.Strings(files)
+
+	for _, file := range files {
+		b, err := os.ReadFile(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		up, _, _ := strings.Cut(string(b), "-- +goose Down")
+		if _, err := db.Exec(ctx, up); err != nil {
+			t.Fatalf("migrate %s: %v", filepath.Base(file), err)
+		}
+	}
+
+	return db
+}
+
+// seedCustomer adds a customer and returns their id.
+func seedCustomer(t *testing.T, db *pgxpool.Pool) uuid.UUID {
+	t.Helper()
+
+	customerID := uuid.New()
+	_, err := db.Exec(context.Background(),
+		`INSERT INTO customers (id, name, email, address) VALUES ($1, 'Ada Customer', 'ada@example.com', '1 High Street')`,
+		customerID,
+	)
+	if err != nil {
+		t.Fatalf("seed customer: %v", err)
+	}
+
+	return customerID
+}
+
+// seedJob adds a customer and a job for them, and returns the job's id.
+func seedJob(t *testing.T, db *pgxpool.Pool) uuid.UUID {
+	t.Helper()
+
+	jobID := uuid.New()
+	_, err := db.Exec(context.Background(),
+		`INSERT INTO jobs (id, customer_id, title, status) VALUES ($1, $2, 'Boiler service', 'in_progress')`,
+		jobID,
+		seedCustomer(t, db),
+	)
+	if err != nil {
+		t.Fatalf("seed job: %v", err)
+	}
+
+	return jobID
+}
+
+// seedJobPart records a part used on a job, priced at price.
+func seedJobPart(t *testing.T, db *pgxpool.Pool, jobID uuid.UUID, price float64) {
+	t.Helper()
+
+	ctx := context.Background()
+	partID := uuid.New()
+
+	_, err := db.Exec(ctx,
+		`INSERT INTO parts (id, sku, description, cost_price, sell_price, stock_quantity)
+         VALUES ($1, $2, 'Pressure valve', $3, $3, 10)`,
+		partID,
+		fmt.Sprintf("PV-%s", partID.String()[:8]),
+		price,
+	)
+	if err != nil {
+		t.Fatalf("seed part: %v", err)
+	}
+
+	_, err = db.Exec(ctx,
+		`INSERT INTO job_parts (id, job_id, part_id, quantity, unit_cost, unit_price)
+         VALUES ($1, $2, $3, 1, $4, $4)`,
+		uuid.New(),
+		jobID,
+		partID,
+		price,
+	)
+	if err != nil {
+		t.Fatalf("seed job part: %v", err)
+	}
+}
@@ -0,0 +1,448 @@
+package jobs
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+type TimeEntry struct {
+	ID           uuid.UUID  `json:"id"`
+	JobID        uuid.UUID  `json:"job_id"`
+	User         string     `json:"user"`
+	StartedAt    string     `json:"started_at"`
+	EndedAt      string     `json:"ended_at,omitempty"` // empty while running
+	BreakMinutes int        `json:"break_minutes"`
+	Billable     bool       `json:"billable"`
+	Notes        string     `json:"notes"`
+	Minutes      int        `json:"minutes"` // worked time, excluding breaks
+	InvoiceID    *uuid.UUID `json:"invoice_id"`
+}
+
+type StartTimerRequest struct {
+	User     string `json:"user"`
+	Billable *bool  `json:"billable"` // default: true
+	Notes    string `json:"notes"`
+}
+
+type StopTimerRequest struct {
+	User         string `json:"user"`
+	BreakMinutes int    `json:"break_minutes"`
+}
+
+type LogTimeRequest struct {
+	User         string    `json:"user"`
+	StartedAt    time.Time `json:"started_at"`
+	EndedAt      time.Time `json:"ended_at"`
+	BreakMinutes int       `json:"break_minutes"`
+	Billable     *bool     `json:"billable"` // default: true
+	Notes        string    `json:"notes"`
+}
+
+type JobTimeResponse struct {
+	JobID             uuid.UUID   `json:"job_id"`
+	TotalMinutes      int         `json:"total_minutes"`
+	BillableMinutes   int         `json:"billable_minutes"`
+	UninvoicedMinutes int         `json:"uninvoiced_minutes"`
+	Entries           []TimeEntry `json:"entries"`
+}
+
+type LabourRate struct {
+	ID         uuid.UUID `json:"id"`
+	User       string    `json:"user"`     // empty: any technician
+	JobType    string    `json:"job_type"` // empty: any job type
+	HourlyRate float64   `json:"hourly_rate"`
+}
+
+// labourMinutesSQL sums worked minutes for finished entries of the job
+// aliased as j. Running timers are not counted until they are stopped.
+const labourMinutesSQL = `COALESCE((
+    SELECT SUM(GREATEST(EXTRACT(EPOCH FROM (te.ended_at - te.started_at)) / 60 - te.break_minutes, 0))
+    FROM time_entries te
+    WHERE te.job_id = j.id AND te.ended_at IS NOT NULL
+), 0)::INT`
+
+func workedMinutes(start, end time.Time, breakMinutes int) int {
+	minutes := int(end.Sub(start).Minutes()) - breakMinutes
+	if minutes < 0 {
+		return 0
+	}
+	return minutes
+}
+
+func listTimeEntries(ctx context.Context, db *pgxpool.Pool, jobID uuid.UUID) ([]TimeEntry, error) {
+	rows, err := db.Query(ctx,
+		`SELECT id, job_id, user_name, started_at, ended_at, break_minutes, billable, COALESCE(notes, ''), invoice_id
+         FROM time_entries WHERE job_id = $1 ORDER BY started_at DESC`,
+		jobID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	entries := []TimeEntry{}
+	for rows.Next() {
+		var e TimeEntry
+		var startedAt time.Time
+		var endedAt *time.Time
+
+		err := rows.Scan(&e.ID, &e.JobID, &e.User, &startedAt, &endedAt, &e.BreakMinutes, &e.Billable, &e.Notes, &e.InvoiceID)
+		if err != nil {
+			return nil, err
+		}
+
+		e.StartedAt = startedAt.Format(time.RFC3339)
+		if endedAt != nil {
+			e.EndedAt = endedAt.Format(time.RFC3339)
+			e.Minutes = workedMinutes(startedAt, *endedAt, e.BreakMinutes)
+		}
+
+		entries = append(entries, e)
+	}
+
+	return entries, rows.Err()
+}
+
+// jobExists reports whether the job with the given id exists.
+func jobExists(ctx context.Context, db *pgxpool.Pool, jobID uuid.UUID) bool {
+	var exists bool
+	err := db.QueryRow(ctx, `SELECT EXISTS(SELECT 1 FROM jobs WHERE id = $1)`, jobID).Scan(&exists)
+	return err == nil && exists
+}
+
+func StartTimerHandler(db *pgxpool.Pool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		jobID, err := uuid.Parse(chi.URLParam(r, "id"))
+		if err != nil {
+			http.Error(w, "invalid job id", http.StatusBadRequest)
+			return
+		}
+
+		var req StartTimerRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "invalid JSON", http.StatusBadRequest)
+			return
+		}
+
+		if req.User == "" {
+			http.Error(w, "user is required", http.StatusBadRequest)
+			return
+		}
+
+		billable := req.Billable == nil || *req.Billable
+
+		ctx := context.Background()
+
+		if !jobExists(ctx, db, jobID) {
+			http.Error(w, "job not found", http.StatusNotFound)
+			return
+		}
+
+		entryID := uuid.New()
+		now := time.Now()
+
+		_, err = db.Exec(ctx,
+			`INSERT INTO time_entries (id, job_id, user_name, started_at, billable, notes, created_at)
+             VALUES ($1, $2, $3, $4, $5, $6, NOW())`,
+			entryID,
+			jobID,
+			req.User,
+			now,
+			billable,
+			req.Notes,
+		)
+
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == "23505" {
+			http.Error(w, "a timer is already running for "+req.User+" on this job", http.StatusConflict)
+			return
+		}
+
+		if err != nil {
+			http.Error(w, "failed to start timer: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		json.NewEncoder(w).Encode(TimeEntry{
+			ID:        entryID,
+			JobID:     jobID,
+			User:      req.User,
+			StartedAt: now.Format(time.RFC3339),
+			Billable:  billable,
+			Notes:     req.Notes,
+		})
+	}
+}
+
+func StopTimerHandler(db *pgxpool.Pool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		jobID, err := uuid.Parse(chi.URLParam(r, "id"))
+		if err != nil {
+			http.Error(w, "invalid job id", http.StatusBadRequest)
+			return
+		}
+
+		var req StopTimerRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "invalid JSON", http.StatusBadRequest)
+			return
+		}
+
+		if req.User == "" {
+			http.Error(w, "user is required", http.StatusBadRequest)
+			return
+		}
+
+		if req.BreakMinutes < 0 {
+			http.Error(w, "break_minutes cannot be negative", http.StatusBadRequest)
+			return
+		}
+
+		ctx := context.Background()
+
+		var e TimeEntry
+		var startedAt, endedAt time.Time
+
+		err = db.QueryRow(ctx,
+			`UPDATE time_entries
+             SET ended_at = NOW(), break_minutes = $1
+             WHERE job_id = $2 AND user_name = $3 AND ended_at IS NULL
+             RETURNING id, job_id, user_name, started_at, ended_at, break_minutes, billable, COALESCE(notes, '')`,
+			req.BreakMinutes,
+			jobID,
+			req.User,
+		).Scan(&e.ID, &e.JobID, &e.User, &startedAt, &endedAt, &e.BreakMinutes, &e.Billable, &e.Notes)
+
+		if errors.Is(err, pgx.ErrNoRows) {
+			http.Error(w, "no running timer for "+req.User+" on this job", http.StatusNotFound)
+			return
+		}
+
+		if err != nil {
+			http.Error(w, "failed to stop timer: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		e.StartedAt = startedAt.Format(time.RFC3339)
+		e.EndedAt = endedAt.Format(time.RFC3339)
+		e.Minutes = workedMinutes(startedAt, endedAt, e.BreakMinutes)
+
+		json.NewEncoder(w).Encode(e)
+	}
+}
+
+func LogTimeHandler(db *pgxpool.Pool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		jobID, err := uuid.Parse(chi.URLParam(r, "id"))
+		if err != nil {
+			http.Error(w, "invalid job id", http.StatusBadRequest)
+			return
+		}
+
+		var req LogTimeRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "invalid JSON", http.StatusBadRequest)
+			return
+		}
+
+		// Validation
+		if req.User == "" {
+			http.Error(w, "user is required", http.StatusBadRequest)
+			return
+		}
+
+		if req.StartedAt.IsZero() || req.EndedAt.IsZero() || !req.EndedAt.After(req.StartedAt) {
+			http.Error(w, "started_at and ended_at are required and ended_at must be after started_at", http.StatusBadRequest)
+			return
+		}
+
+		if req.BreakMinutes < 0 {
+			http.Error(w, "break_minutes cannot be negative", http.StatusBadRequest)
+			return
+		}
+
+		billable := req.Billable == nil || *req.Billable
+
+		ctx := context.Background()
+
+		if !jobExists(ctx, db, jobID) {
+			http.Error(w, "job not found", http.StatusNotFound)
+			return
+		}
+
+		entryID := uuid.New()
+
+		_, err = db.Exec(ctx,
+			`INSERT INTO time_entries (id, job_id, user_name, started_at, ended_at, break_minutes, billable, notes, created_at)
+             VALUES ($1, $2, $3, $4, $5, $6, $7, $8, NOW())`,
+			entryID,
+			jobID,
+			req.User,
+			req.StartedAt,
+			req.EndedAt,
+			req.BreakMinutes,
+			billable,
+			req.Notes,
+		)
+
+		if err != nil {
+			http.Error(w, "failed to log time: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		json.NewEncoder(w).Encode(TimeEntry{
+			ID:           entryID,
+			JobID:        jobID,
+			User:         req.User,
+			StartedAt:    req.StartedAt.Format(time.RFC3339),
+			EndedAt:      req.EndedAt.Format(time.RFC3339),
+			BreakMinutes: req.BreakMinutes,
+			Billable:     billable,
+			Notes:        req.Notes,
+			Minutes:      workedMinutes(req.StartedAt, req.EndedAt, req.BreakMinutes),
+		})
+	}
+}
+
+func ListTimeEntriesHandler(db *pgxpool.Pool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		jobID, err := uuid.Parse(chi.URLParam(r, "id"))
+		if err != nil {
+			http.Error(w, "invalid job id", http.StatusBadRequest)
+			return
+		}
+
+		ctx := context.Background()
+
+		if !jobExists(ctx, db, jobID) {
+			http.Error(w, "job not found", http.StatusNotFound)
+			return
+		}
+
+		entries, err := listTimeEntries(ctx, db, jobID)
+		if err != nil {
+			http.Error(w, "failed to fetch time entries: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		resp := JobTimeResponse{JobID: jobID, Entries: entries}
+		for _, e := range entries {
+			resp.TotalMinutes += e.Minutes
+			if e.Billable {
+				resp.BillableMinutes += e.Minutes
+				if e.InvoiceID == nil {
+					resp.UninvoicedMinutes += e.Minutes
+				}
+			}
+		}
+
+		json.NewEncoder(w).Encode(resp)
+	}
+}
+
+func ListLabourRatesHandler(db *pgxpool.Pool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := context.Background()
+
+		rows, err := db.Query(ctx,
+			`SELECT id, COALESCE(user_name, ''), COALESCE(job_type, ''), hourly_rate
+             FROM labour_rates ORDER BY user_name NULLS FIRST, job_type NULLS FIRST`,
+		)
+		if err != nil {
+			http.Error(w, "failed to query labour rates: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		defer rows.Close()
+
+		rates := []LabourRate{}
+		for rows.Next() {
+			var rate LabourRate
+			if err := rows.Scan(&rate.ID, &rate.User, &rate.JobType, &rate.HourlyRate); err != nil {
+				http.Error(w, "scan error: "+err.Error(), http.StatusInternalServerError)
+				return
+			}
+			rates = append(rates, rate)
+		}
+
+		json.NewEncoder(w).Encode(rates)
+	}
+}
+
+// SetLabourRateHandler creates or replaces the rate for a technician
+// and/or job type. Leave both empty to set the default rate.
+func SetLabourRateHandler(db *pgxpool.Pool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req LabourRate
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "invalid JSON", http.StatusBadRequest)
+			return
+		}
+
+		if req.HourlyRate < 0 {
+			http.Error(w, "hourly_rate cannot be negative", http.StatusBadRequest)
+			return
+		}
+
+		ctx := context.Background()
+
+		err := db.QueryRow(ctx,
+			`INSERT INTO labour_rates (id, user_name, job_type, hourly_rate, created_at)
+             VALUES ($1, NULLIF($2, ''), NULLIF($3, ''), $4, NOW())
+             ON CONFLICT (user_name, job_type) DO UPDATE SET hourly_rate = EXCLUDED.hourly_rate
+             RETURNING id`,
+			uuid.New(),
+			req.User,
+			req.JobType,
+			req.HourlyRate,
+		).Scan(&req.ID)
+
+		if err != nil {
+			http.Error(w, "failed to save labour rate: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		json.NewEncoder(w).Encode(req)
+	}
+}
+
+// labourRateFor picks the most specific rate for the technician and job
+// type: technician and type, then technician, then type, then default.
+func labourRateFor(ctx context.Context, q pgxQuerier, user, jobType string) (float64, error) {
+	var rate float64
+	err := q.QueryRow(ctx,
+		`SELECT hourly_rate FROM labour_rates
+         WHERE (user_name = $1 OR user_name IS NULL)
+           AND (job_type = $2 OR job_type IS NULL)
+         ORDER BY (user_name IS NOT NULL) DESC, (job_type IS NOT NULL) DESC
+         LIMIT 1`,
+		user,
+		jobType,
+	).Scan(&rate)
+
+	if errors.Is(err, pgx.ErrNoRows) {
+		return 0, fmt.Errorf("no labour rate configured for %s", user)
+	}
+
+	return rate, err
+}
+
+// pgxQuerier is satisfied by both *pgxpool.Pool and pgx.Tx.
+type pgxQuerier interface {
+	QueryRow(ctx context.Context, sql string, args ...any) pgx.Row
+}
+
+// roundHours converts minutes to hours rounded to two decimal places.
+func roundHours(minutes int) float64 {
+	return math.Round(float64(minutes)/60*100) / 100
+}
@@ -3,8 +3,8 @@ package jobs
 import (
     "context"
     "encoding/json"
+    "errors"
     "net/http"
-    "time"
 
     "github.com/go-chi/chi/v5"
     "github.com/google/uuid"
@@ -54,22 +54,21 @@ func UpdateJobStatusHandler(db *pgxpool.Pool) http.HandlerFunc {
 
         ctx := context.Background()
 
-        // Update job status
-        result, err := db.Exec(ctx,
-            `UPDATE jobs 
-             SET status = $1, updated_at = $2
-             WHERE id = $3`,
-            req.Status,
-            time.Now(),
-            jobID,
-        )
+        // Update job status, keeping its history. Required checklist
+        // items must be done before completing.
+        found, err := setJobStatus(ctx, db, jobID, req.Status)
+
+        if errors.Is(err, errChecklistIncomplete) {
+            http.Error(w, err.Error(), http.StatusConflict)
+            return
+        }
 
         if err != nil {
             http.Error(w, "failed to update job: "+err.Error(), http.StatusInternalServerError)
             return
         }
 
-        if result.RowsAffected() == 0 {
+        if !found {
             http.Error(w, "job not found", http.StatusNotFound)
             return
         }
@@ -0,0 +1,71 @@
+package jobs
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+)
+
+func TestChecklistGatesCompletion(t *testing.T) {
+	db := testDB(t)
+	jobID := seedJob(t, db)
+	seedJobPart(t, db, jobID, 45)
+
+	ctx := context.Background()
+	itemID := uuid.New()
+	_, err := db.Exec(ctx,
+		`INSERT INTO job_checklist_items (id, job_id, label, required, position) VALUES ($1, $2, 'Flue gas analysis', TRUE, 1)`,
+		itemID,
+		jobID,
+	)
+	if err != nil {
+		t.Fatalf("seed checklist: %v", err)
+	}
+
+	r := chi.NewRouter()
+	r.Put("/jobs/{id}/status", UpdateJobStatusHandler(db))
+	r.Post("/jobs/{id}/invoice", CreateJobInvoiceHandler(db))
+
+	do := func(method, url, body string) int {
+		rec := httptest.NewRecorder()
+		r.ServeHTTP(rec, httptest.NewRequest(method, url, strings.NewReader(body)))
+		return rec.Code
+	}
+
+	jobURL := "/jobs/" + jobID.String()
+
+	for _, status := range checklistStatuses {
+		if code := do(http.MethodPut, jobURL+"/status", `{"status": "`+status+`"}`); code != http.StatusConflict {
+			t.Errorf("moving to %s with the checklist unticked: got %d, want 409", status, code)
+		}
+	}
+
+	if code := do(http.MethodPost, jobURL+"/invoice", ""); code != http.StatusConflict {
+		t.Errorf("invoicing with the checklist unticked: got %d, want 409", code)
+	}
+
+	var invoices int
+	db.QueryRow(ctx, `SELECT COUNT(*) FROM invoices WHERE job_id = $1`, jobID).Scan(&invoices)
+	if invoices != 0 {
+		t.Errorf("got %d invoices for a refused job, want 0", invoices)
+	}
+
+	if _, err := db.Exec(ctx, `UPDATE job_checklist_items SET checked_at = NOW() WHERE id = $1`, itemID); err != nil {
+		t.Fatal(err)
+	}
+
+	if code := do(http.MethodPost, jobURL+"/invoice", ""); code != http.StatusOK {
+		t.Errorf("invoicing with the checklist ticked: got %d, want 200", code)
+	}
+
+	var status string
+	db.QueryRow(ctx, `SELECT status FROM jobs WHERE id = $1`, jobID).Scan(&status)
+	if status != "invoiced" {
+		t.Errorf("got status %q, want invoiced", status)
+	}
+}
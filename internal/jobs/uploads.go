@@ -0,0 +1,744 @@
+package jobs
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"pistachio/internal/links"
+	"pistachio/internal/storage"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// Resumable uploads. The client says how big the file is, then sends it
+// in chunks with PATCH, each starting at the Upload-Offset the server
+// has reached. After a dropped connection it asks for the offset and
+// carries on from there. The file is checked and saved, as a photo or an
+// attachment, when the last byte arrives.
+
+type CreateUploadRequest struct {
+	Type     string `json:"type"` // photo / attachment
+	FileName string `json:"file_name"`
+	Size     int64  `json:"size"` // bytes
+
+	// Photos only
+	Caption  string `json:"caption"`
+	Category string `json:"category"`
+	User     string `json:"user"`
+}
+
+type UploadSession struct {
+	ID         uuid.UUID      `json:"id"`
+	JobID      uuid.UUID      `json:"job_id"`
+	Type       string         `json:"type"`
+	FileName   string         `json:"file_name"`
+	Size       int64          `json:"size"`
+	Offset     int64          `json:"offset"` // bytes received so far
+	Status     string         `json:"status"`
+	Error      string         `json:"error,omitempty"` // why the file was rejected
+	ExpiresAt  string         `json:"expires_at"`
+	Photo      *PhotoResponse `json:"photo,omitempty"`      // once a photo upload is complete
+	Attachment *JobAttachment `json:"attachment,omitempty"` // once an attachment upload is complete
+
+	details  PhotoDetails
+	resultID *uuid.UUID
+	expired  bool
+	stuck    bool // processing for longer than uploadStuckAfter
+}
+
+// Results of a multipart request carrying several files.
+type BatchUploadResult struct {
+	FileName   string         `json:"file_name"`
+	Status     int            `json:"status"` // HTTP status for this file
+	Error      string         `json:"error,omitempty"`
+	Photo      *PhotoResponse `json:"photo,omitempty"`
+	Attachment *JobAttachment `json:"attachment,omitempty"`
+}
+
+type BatchUploadResponse struct {
+	Files []BatchUploadResult `json:"files"`
+}
+
+// Upload types
+const (
+	UploadTypePhoto      = "photo"
+	UploadTypeAttachment = "attachment"
+)
+
+// Upload statuses. A rejected upload was received in full but the file
+// was not accepted, e.g. it was not an image.
+const (
+	UploadOpen       = "open"
+	UploadProcessing = "processing"
+	UploadComplete   = "complete"
+	UploadRejected   = "rejected"
+)
+
+const (
+	maxChunkSize  = 8 << 20 // 8 MB
+	maxBatchFiles = 20
+	maxFieldSize  = 1 << 10 // text fields sent with files
+	uploadTTL     = 24 * time.Hour
+
+	// uploadStuckAfter is how long an upload may stay processing before
+	// the request saving it is assumed to have died, and another may
+	// take over
+	uploadStuckAfter = 15 * time.Minute
+)
+
+var maxUploadSizes = map[string]int64{
+	UploadTypePhoto:      maxPhotoSize,
+	UploadTypeAttachment: maxAttachmentSize,
+}
+
+// uploadError is a file we won't accept, with the status to answer
+// with. Any other error saving a file is ours, and a 500.
+type uploadError struct {
+	status int
+	msg    string
+}
+
+func (e *uploadError) Error() string { return e.msg }
+
+func rejectUpload(status int, msg string) error {
+	return &uploadError{status: status, msg: msg}
+}
+
+func uploadErrorStatus(err error) int {
+	var rejected *uploadError
+	if errors.As(err, &rejected) {
+		return rejected.status
+	}
+	return http.StatusInternalServerError
+}
+
+// eachUploadedFile calls fn with every "file" part of a multipart
+// request, streaming one file at a time rather than holding the whole
+// request. fn also gets the other fields sent before that file. A file
+// over maxSize, or past the first maxBatchFiles, is passed to fn with an
+// error instead of its data. The error returned is for the request as a
+// whole, which may end after some files were taken.
+func eachUploadedFile(w http.ResponseWriter, r *http.Request, maxSize int64, fn func(fileName string, data []byte, fields url.Values, err error)) error {
+	r.Body = http.MaxBytesReader(w, r.Body, maxBatchFiles*(maxSize+multipartOverhead))
+
+	mr, err := r.MultipartReader()
+	if err != nil {
+		return rejectUpload(http.StatusBadRequest, "invalid upload: "+err.Error())
+	}
+
+	fields := url.Values{}
+	files := 0
+	for {
+		part, err := mr.NextPart()
+		if err == io.EOF {
+			if files == 0 {
+				return rejectUpload(http.StatusBadRequest, `no files in the "file" field`)
+			}
+			return nil
+		}
+		if err != nil {
+			return multipartError(err)
+		}
+
+		if part.FormName() != "file" {
+			value, err := io.ReadAll(io.LimitReader(part, maxFieldSize+1))
+			if err != nil {
+				return multipartError(err)
+			}
+			if len(value) > maxFieldSize {
+				return rejectUpload(http.StatusBadRequest, part.FormName()+" is too long")
+			}
+			fields.Set(part.FormName(), string(value))
+			continue
+		}
+
+		files++
+		fileName := cleanFileName(part.FileName())
+
+		if files > maxBatchFiles {
+			fn(fileName, nil, fields, rejectUpload(http.StatusBadRequest, fmt.Sprintf("at most %d files can be sent at once", maxBatchFiles)))
+			continue
+		}
+
+		data, err := io.ReadAll(io.LimitReader(part, maxSize+1))
+		if err != nil {
+			return multipartError(err)
+		}
+
+		if int64(len(data)) > maxSize {
+			fn(fileName, nil, fields, rejectUpload(http.StatusRequestEntityTooLarge, fmt.Sprintf("file is larger than %d MB", maxSize>>20)))
+			continue
+		}
+
+		fn(fileName, data, fields, nil)
+	}
+}
+
+func multipartError(err error) error {
+	var tooBig *http.MaxBytesError
+	if errors.As(err, &tooBig) {
+		return rejectUpload(http.StatusRequestEntityTooLarge, "upload is too large")
+	}
+	return rejectUpload(http.StatusBadRequest, "invalid upload: "+err.Error())
+}
+
+// uploadColumns takes the stuck threshold, in seconds, as $2.
+const uploadColumns = `id, job_id, upload_type, file_name, size_bytes, received_bytes, status,
+    COALESCE(error, ''), COALESCE(caption, ''), COALESCE(category, ''), COALESCE(uploaded_by, ''),
+    result_id, expires_at, expires_at < NOW(), status = 'processing' AND updated_at < NOW() - $2 * INTERVAL '1 second'`
+
+func loadUpload(ctx context.Context, db *pgxpool.Pool, signer *links.Signer, uploadID uuid.UUID) (UploadSession, error) {
+	var u UploadSession
+	var expiresAt time.Time
+
+	err := db.QueryRow(ctx, `SELECT `+uploadColumns+` FROM uploads WHERE id = $1`, uploadID, uploadStuckAfter.Seconds()).Scan(
+		&u.ID, &u.JobID, &u.Type, &u.FileName, &u.Size, &u.Offset, &u.Status,
+		&u.Error, &u.details.Caption, &u.details.Category, &u.details.UploadedBy,
+		&u.resultID, &expiresAt, &u.expired, &u.stuck,
+	)
+	if err != nil {
+		return UploadSession{}, err
+	}
+
+	u.ExpiresAt = expiresAt.Format(time.RFC3339)
+
+	if u.Status == UploadComplete && u.resultID != nil {
+		switch u.Type {
+		case UploadTypePhoto:
+			photo, err := loadPhoto(ctx, db, signer, *u.resultID)
+			if err != nil {
+				return UploadSession{}, err
+			}
+			u.Photo = &photo
+		case UploadTypeAttachment:
+			attachment, err := loadAttachment(ctx, db, signer, *u.resultID)
+			if err != nil {
+				return UploadSession{}, err
+			}
+			u.Attachment = &attachment
+		}
+	}
+
+	return u, nil
+}
+
+// CreateUploadHandler starts a resumable upload to a job.
+func CreateUploadHandler(db *pgxpool.Pool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		jobID, err := uuid.Parse(chi.URLParam(r, "id"))
+		if err != nil {
+			http.Error(w, "invalid job id", http.StatusBadRequest)
+			return
+		}
+
+		var req CreateUploadRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "invalid request body", http.StatusBadRequest)
+			return
+		}
+
+		maxSize, ok := maxUploadSizes[req.Type]
+		if !ok {
+			http.Error(w, `type must be "photo" or "attachment"`, http.StatusBadRequest)
+			return
+		}
+
+		if req.Size <= 0 {
+			http.Error(w, "size must be positive", http.StatusBadRequest)
+			return
+		}
+
+		if req.Size > maxSize {
+			http.Error(w, fmt.Sprintf("%s is larger than %d MB", req.Type, maxSize>>20), http.StatusRequestEntityTooLarge)
+			return
+		}
+
+		details := PhotoDetails{
+			Caption:    strings.TrimSpace(req.Caption),
+			Category:   req.Category,
+			UploadedBy: req.User,
+		}
+		if err := details.validate(); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		ctx := context.Background()
+
+		if !jobExists(ctx, db, jobID) {
+			http.Error(w, "job not found", http.StatusNotFound)
+			return
+		}
+
+		u := UploadSession{
+			ID:       uuid.New(),
+			JobID:    jobID,
+			Type:     req.Type,
+			FileName: cleanFileName(req.FileName),
+			Size:     req.Size,
+			Status:   UploadOpen,
+			details:  details,
+		}
+
+		expiresAt := time.Now().Add(uploadTTL)
+		_, err = db.Exec(ctx,
+			`INSERT INTO uploads
+             (id, job_id, upload_type, file_name, size_bytes, status, expires_at, caption, category, uploaded_by)
+             VALUES ($1, $2, $3, $4, $5, $6, $7, NULLIF($8, ''), NULLIF($9, ''), NULLIF($10, ''))`,
+			u.ID,
+			u.JobID,
+			u.Type,
+			u.FileName,
+			u.Size,
+			u.Status,
+			expiresAt,
+			details.Caption,
+			details.Category,
+			details.UploadedBy,
+		)
+
+		if err != nil {
+			http.Error(w, "failed to create upload: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		u.ExpiresAt = expiresAt.Format(time.RFC3339)
+
+		w.Header().Set("Upload-Offset", "0")
+		json.NewEncoder(w).Encode(u)
+	}
+}
+
+// GetUploadHandler reports how far an upload has got, so a client can
+// resume after losing its connection.
+func GetUploadHandler(db *pgxpool.Pool, signer *links.Signer) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		uploadID, err := uuid.Parse(chi.URLParam(r, "id"))
+		if err != nil {
+			http.Error(w, "invalid upload id", http.StatusBadRequest)
+			return
+		}
+
+		u, err := loadUpload(context.Background(), db, signer, uploadID)
+		if errors.Is(err, pgx.ErrNoRows) {
+			http.Error(w, "upload not found", http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			http.Error(w, "failed to load upload: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Upload-Offset", strconv.FormatInt(u.Offset, 10))
+		json.NewEncoder(w).Encode(u)
+	}
+}
+
+// UploadChunkHandler appends the request body to an upload. The
+// Upload-Offset header must match the bytes received so far; a chunk
+// that is cut off is dropped whole, and the client sends it again.
+func UploadChunkHandler(db *pgxpool.Pool, store storage.Storage, signer *links.Signer) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		uploadID, err := uuid.Parse(chi.URLParam(r, "id"))
+		if err != nil {
+			http.Error(w, "invalid upload id", http.StatusBadRequest)
+			return
+		}
+
+		offset, err := strconv.ParseInt(r.Header.Get("Upload-Offset"), 10, 64)
+		if err != nil || offset < 0 {
+			http.Error(w, "missing or invalid Upload-Offset header", http.StatusBadRequest)
+			return
+		}
+
+		ctx := context.Background()
+
+		// 1️⃣ Check the chunk is the next one
+		u, err := loadUpload(ctx, db, signer, uploadID)
+		if errors.Is(err, pgx.ErrNoRows) {
+			http.Error(w, "upload not found", http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			http.Error(w, "failed to load upload: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Upload-Offset", strconv.FormatInt(u.Offset, 10))
+
+		switch {
+		case u.Status == UploadComplete:
+			// The response to the last chunk was lost; answer it again
+			json.NewEncoder(w).Encode(u)
+			return
+		case u.expired:
+			http.Error(w, "upload has expired", http.StatusGone)
+			return
+		case u.Status == UploadRejected:
+			http.Error(w, "upload was rejected: "+u.Error, http.StatusConflict)
+			return
+		case u.Status == UploadProcessing && !u.stuck:
+			http.Error(w, "upload is being processed", http.StatusConflict)
+			return
+		case offset != u.Offset:
+			http.Error(w, fmt.Sprintf("upload is at offset %d", u.Offset), http.StatusConflict)
+			return
+		}
+
+		// 2️⃣ Read the chunk, which must not run past the declared size
+		remaining := u.Size - u.Offset
+		r.Body = http.MaxBytesReader(w, r.Body, min(remaining, maxChunkSize))
+		chunk, err := io.ReadAll(r.Body)
+
+		var tooBig *http.MaxBytesError
+		if errors.As(err, &tooBig) && remaining > maxChunkSize {
+			http.Error(w, fmt.Sprintf("chunks are at most %d MB", maxChunkSize>>20), http.StatusRequestEntityTooLarge)
+			return
+		}
+		if errors.As(err, &tooBig) {
+			http.Error(w, "chunk runs past the end of the upload", http.StatusRequestEntityTooLarge)
+			return
+		}
+		if err != nil {
+			http.Error(w, "failed to read chunk: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		// 3️⃣ Store it
+		if len(chunk) > 0 {
+			if err := appendChunk(ctx, db, store, u, chunk); err != nil {
+				http.Error(w, err.Error(), uploadErrorStatus(err))
+				return
+			}
+			u.Offset += int64(len(chunk))
+			w.Header().Set("Upload-Offset", strconv.FormatInt(u.Offset, 10))
+		}
+
+		// 4️⃣ Save the file once it is all here. If that fails on our
+		// side, or the request saving it died, an empty PATCH at the
+		// final offset tries again.
+		if u.Offset == u.Size {
+			u, err = finishUpload(ctx, db, store, signer, u)
+			if err != nil {
+				http.Error(w, err.Error(), uploadErrorStatus(err))
+				return
+			}
+		}
+
+		json.NewEncoder(w).Encode(u)
+	}
+}
+
+// CancelUploadHandler abandons an upload and deletes what was received.
+func CancelUploadHandler(db *pgxpool.Pool, store storage.Storage) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		uploadID, err := uuid.Parse(chi.URLParam(r, "id"))
+		if err != nil {
+			http.Error(w, "invalid upload id", http.StatusBadRequest)
+			return
+		}
+
+		ctx := context.Background()
+
+		var status string
+		var stuck bool
+		err = db.QueryRow(ctx,
+			`SELECT status, status = $2 AND updated_at < NOW() - $3 * INTERVAL '1 second' FROM uploads WHERE id = $1`,
+			uploadID,
+			UploadProcessing,
+			uploadStuckAfter.Seconds(),
+		).Scan(&status, &stuck)
+		if errors.Is(err, pgx.ErrNoRows) {
+			http.Error(w, "upload not found", http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			http.Error(w, "failed to load upload: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		if status == UploadProcessing && !stuck {
+			http.Error(w, "upload is being processed", http.StatusConflict)
+			return
+		}
+
+		if err := deleteUpload(ctx, db, store, uploadID); err != nil {
+			http.Error(w, "failed to delete upload: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// appendChunk stores a chunk and moves the upload's offset past it,
+// unless another request got there first.
+func appendChunk(ctx context.Context, db *pgxpool.Pool, store storage.Storage, u UploadSession, chunk []byte) error {
+	chunkID := uuid.New()
+	key := "uploads/" + u.ID.String() + "/" + chunkID.String()
+
+	if err := store.Put(ctx, key, bytes.NewReader(chunk), "application/octet-stream"); err != nil {
+		return fmt.Errorf("failed to store chunk: %w", err)
+	}
+
+	err := func() error {
+		tx, err := db.Begin(ctx)
+		if err != nil {
+			return err
+		}
+		defer tx.Rollback(ctx)
+
+		tag, err := tx.Exec(ctx,
+			`UPDATE uploads SET received_bytes = received_bytes + $1, updated_at = NOW()
+             WHERE id = $2 AND status = $3 AND received_bytes = $4`,
+			len(chunk),
+			u.ID,
+			UploadOpen,
+			u.Offset,
+		)
+		if err != nil {
+			return err
+		}
+		if tag.RowsAffected() == 0 {
+			return rejectUpload(http.StatusConflict, "another chunk was received at this offset")
+		}
+
+		_, err = tx.Exec(ctx,
+			`INSERT INTO upload_chunks (id, upload_id, offset_bytes, size_bytes, chunk_key)
+             VALUES ($1, $2, $3, $4, $5)`,
+			chunkID,
+			u.ID,
+			u.Offset,
+			len(chunk),
+			key,
+		)
+		if err != nil {
+			return err
+		}
+
+		return tx.Commit(ctx)
+	}()
+
+	if err != nil {
+		store.Delete(ctx, key)
+		return err
+	}
+	return nil
+}
+
+// finishUpload joins an upload's chunks and saves the file as a photo or
+// attachment. An upload left processing by a request that died is taken
+// over once it is stuck.
+func finishUpload(ctx context.Context, db *pgxpool.Pool, store storage.Storage, signer *links.Signer, u UploadSession) (UploadSession, error) {
+	// Only one request gets to save the file
+	tag, err := db.Exec(ctx,
+		`UPDATE uploads SET status = $1, updated_at = NOW()
+         WHERE id = $2 AND received_bytes = size_bytes
+           AND (status = $3 OR (status = $1 AND updated_at < NOW() - $4 * INTERVAL '1 second'))`,
+		UploadProcessing,
+		u.ID,
+		UploadOpen,
+		uploadStuckAfter.Seconds(),
+	)
+	if err != nil {
+		return u, fmt.Errorf("failed to update upload: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return u, rejectUpload(http.StatusConflict, "upload is being processed")
+	}
+
+	data, err := joinChunks(ctx, db, store, u)
+
+	var resultID uuid.UUID
+	if err == nil {
+		switch u.Type {
+		case UploadTypePhoto:
+			var photo PhotoResponse
+			if photo, err = savePhoto(ctx, db, store, signer, u.JobID, data, u.details); err == nil {
+				resultID, u.Photo = photo.ID, &photo
+			}
+		case UploadTypeAttachment:
+			var attachment JobAttachment
+			if attachment, err = saveAttachment(ctx, db, store, signer, u.JobID, u.FileName, data); err == nil {
+				resultID, u.Attachment = attachment.ID, &attachment
+			}
+		}
+	}
+
+	var rejected *uploadError
+	switch {
+	case errors.As(err, &rejected):
+		u.Status, u.Error = UploadRejected, rejected.msg
+		if _, err := db.Exec(ctx,
+			`UPDATE uploads SET status = $1, error = $2, updated_at = NOW() WHERE id = $3`,
+			u.Status, u.Error, u.ID,
+		); err != nil {
+			log.Printf("upload %s: failed to mark rejected: %v", u.ID, err)
+		}
+		deleteChunks(ctx, db, store, u.ID)
+		return u, rejected
+
+	case err != nil:
+		if _, err := db.Exec(ctx,
+			`UPDATE uploads SET status = $1, updated_at = NOW() WHERE id = $2`,
+			UploadOpen, u.ID,
+		); err != nil {
+			log.Printf("upload %s: failed to reopen: %v", u.ID, err)
+		}
+		return u, err
+	}
+
+	u.Status = UploadComplete
+	_, err = db.Exec(ctx,
+		`UPDATE uploads SET status = $1, result_id = $2, updated_at = NOW() WHERE id = $3`,
+		u.Status,
+		resultID,
+		u.ID,
+	)
+	if err != nil {
+		return u, fmt.Errorf("failed to update upload: %w", err)
+	}
+
+	if err := deleteChunks(ctx, db, store, u.ID); err != nil {
+		log.Printf("upload %s: failed to delete chunks: %v", u.ID, err)
+	}
+
+	return u, nil
+}
+
+func joinChunks(ctx context.Context, db *pgxpool.Pool, store storage.Storage, u UploadSession) ([]byte, error) {
+	rows, err := db.Query(ctx,
+		`SELECT offset_bytes, chunk_key FROM upload_chunks WHERE upload_id = $1 ORDER BY offset_bytes`,
+		u.ID,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	type chunk struct {
+		offset int64
+		key    string
+	}
+
+	var chunks []chunk
+	for rows.Next() {
+		var c chunk
+		if err := rows.Scan(&c.offset, &c.key); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		chunks = append(chunks, c)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	data := make([]byte, 0, u.Size)
+	for _, c := range chunks {
+		if c.offset != int64(len(data)) {
+			return nil, fmt.Errorf("upload %s is missing bytes at offset %d", u.ID, len(data))
+		}
+
+		b, err := readStoredFile(ctx, store, c.key)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read chunk: %w", err)
+		}
+		data = append(data, b...)
+	}
+
+	if int64(len(data)) != u.Size {
+		return nil, fmt.Errorf("upload %s has %d of %d bytes", u.ID, len(data), u.Size)
+	}
+
+	return data, nil
+}
+
+// deleteChunks removes the stored chunks of an upload, keeping the
+// upload itself.
+func deleteChunks(ctx context.Context, db *pgxpool.Pool, store storage.Storage, uploadID uuid.UUID) error {
+	rows, err := db.Query(ctx, `SELECT chunk_key FROM upload_chunks WHERE upload_id = $1`, uploadID)
+	if err != nil {
+		return err
+	}
+
+	var keys []string
+	for rows.Next() {
+		var key string
+		if err := rows.Scan(&key); err != nil {
+			rows.Close()
+			return err
+		}
+		keys = append(keys, key)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, key := range keys {
+		if err := store.Delete(ctx, key); err != nil {
+			return err
+		}
+	}
+
+	_, err = db.Exec(ctx, `DELETE FROM upload_chunks WHERE upload_id = $1`, uploadID)
+	return err
+}
+
+func deleteUpload(ctx context.Context, db *pgxpool.Pool, store storage.Storage, uploadID uuid.UUID) error {
+	if err := deleteChunks(ctx, db, store, uploadID); err != nil {
+		return err
+	}
+
+	_, err := db.Exec(ctx, `DELETE FROM uploads WHERE id = $1`, uploadID)
+	return err
+}
+
+// CleanUpUploads deletes expired uploads and their chunks, whether they
+// were finished or abandoned. The photos and attachments they made are
+// kept.
+func CleanUpUploads(ctx context.Context, db *pgxpool.Pool, store storage.Storage) error {
+	rows, err := db.Query(ctx, `SELECT id FROM uploads WHERE expires_at < NOW()`)
+	if err != nil {
+		return err
+	}
+
+	var ids []uuid.UUID
+	for rows.Next() {
+		var id uuid.UUID
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return err
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, id := range ids {
+		if err := deleteUpload(ctx, db, store, id); err != nil {
+			return fmt.Errorf("upload %s: %w", id, err)
+		}
+	}
+
+	if len(ids) > 0 {
+		log.Printf("uploads: deleted %d expired uploads", len(ids))
+	}
+	return nil
+}
@@ -0,0 +1,243 @@
+package jobs
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"pistachio/internal/links"
+	"pistachio/internal/storage"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// testPDF is a small PDF that passes the attachment checks.
+var testPDF = []byte("%PDF-1.4\n" + strings.Repeat("% filler\n", 100) + "%%EOF\n")
+
+type uploadTest struct {
+	t      *testing.T
+	db     *pgxpool.Pool
+	store  storage.Storage
+	signer *links.Signer
+	router chi.Router
+}
+
+func newUploadTest(t *testing.T) *uploadTest {
+	db := testDB(t)
+	signer := links.New(links.Config{Secret: "test", BaseURL: "http://localhost", TTL: time.Hour})
+	store := storage.NewLocal(t.TempDir(), signer)
+
+	r := chi.NewRouter()
+	r.Post("/jobs/{id}/uploads", CreateUploadHandler(db))
+	r.Get("/uploads/{id}", GetUploadHandler(db, signer))
+	r.Patch("/uploads/{id}", UploadChunkHandler(db, store, signer))
+	r.Delete("/uploads/{id}", CancelUploadHandler(db, store))
+
+	return &uploadTest{t: t, db: db, store: store, signer: signer, router: r}
+}
+
+func (u *uploadTest) create(jobID uuid.UUID, size int) UploadSession {
+	u.t.Helper()
+
+	body := fmt.Sprintf(`{"type": "attachment", "file_name": "certificate.pdf", "size": %d}`, size)
+	rec := serve(u.router, http.MethodPost, "/jobs/"+jobID.String()+"/uploads", body)
+	if rec.Code != http.StatusOK {
+		u.t.Fatalf("create upload: %d %s", rec.Code, rec.Body)
+	}
+
+	var s UploadSession
+	if err := json.NewDecoder(rec.Body).Decode(&s); err != nil {
+		u.t.Fatal(err)
+	}
+	return s
+}
+
+func (u *uploadTest) patch(id uuid.UUID, offset int, chunk []byte) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPatch, "/uploads/"+id.String(), bytes.NewReader(chunk))
+	req.Header.Set("Upload-Offset", strconv.Itoa(offset))
+	rec := httptest.NewRecorder()
+	u.router.ServeHTTP(rec, req)
+	return rec
+}
+
+func (u *uploadTest) offset(id uuid.UUID) int64 {
+	u.t.Helper()
+
+	rec := serve(u.router, http.MethodGet, "/uploads/"+id.String(), "")
+	if rec.Code != http.StatusOK {
+		u.t.Fatalf("get upload: %d %s", rec.Code, rec.Body)
+	}
+	var s UploadSession
+	json.NewDecoder(rec.Body).Decode(&s)
+	if header := rec.Header().Get("Upload-Offset"); header != strconv.FormatInt(s.Offset, 10) {
+		u.t.Errorf("Upload-Offset header %s doesn't match offset %d", header, s.Offset)
+	}
+	return s.Offset
+}
+
+func decodeUpload(t *testing.T, rec *httptest.ResponseRecorder) UploadSession {
+	t.Helper()
+
+	var s UploadSession
+	if err := json.NewDecoder(rec.Body).Decode(&s); err != nil {
+		t.Fatalf("decode upload: %v (%s)", err, rec.Body)
+	}
+	return s
+}
+
+// TestUploadResumes sends a file in chunks, with a chunk repeated and
+// one sent out of order, as a client on a dropped connection might.
+func TestUploadResumes(t *testing.T) {
+	u := newUploadTest(t)
+	s := u.create(seedJob(t, u.db), len(testPDF))
+
+	first, second, third := testPDF[:300], testPDF[300:600], testPDF[600:]
+
+	if rec := u.patch(s.ID, 0, first); rec.Code != http.StatusOK {
+		t.Fatalf("first chunk: %d %s", rec.Code, rec.Body)
+	}
+
+	// Sent again after its response was lost
+	rec := u.patch(s.ID, 0, first)
+	if rec.Code != http.StatusConflict || rec.Header().Get("Upload-Offset") != "300" {
+		t.Errorf("repeated chunk: got %d at offset %s, want 409 at 300", rec.Code, rec.Header().Get("Upload-Offset"))
+	}
+
+	// Ahead of the bytes received
+	if rec := u.patch(s.ID, 600, third); rec.Code != http.StatusConflict {
+		t.Errorf("out of order chunk: got status %d, want 409", rec.Code)
+	}
+
+	if got := u.offset(s.ID); got != 300 {
+		t.Fatalf("resuming at offset %d, want 300", got)
+	}
+
+	if rec := u.patch(s.ID, 300, second); rec.Code != http.StatusOK {
+		t.Fatalf("second chunk: %d %s", rec.Code, rec.Body)
+	}
+
+	rec = u.patch(s.ID, 600, third)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("last chunk: %d %s", rec.Code, rec.Body)
+	}
+	done := decodeUpload(t, rec)
+	if done.Status != UploadComplete || done.Attachment == nil {
+		t.Fatalf("got %+v, want a complete upload with its attachment", done)
+	}
+
+	var key string
+	if err := u.db.QueryRow(context.Background(), `SELECT file_key FROM job_attachments WHERE id = $1`, done.Attachment.ID).Scan(&key); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := readStoredFile(context.Background(), u.store, key); err != nil || !bytes.Equal(got, testPDF) {
+		t.Errorf("stored attachment isn't the file sent (%v)", err)
+	}
+
+	// The last response was lost too
+	rec = u.patch(s.ID, 600, third)
+	if again := decodeUpload(t, rec); rec.Code != http.StatusOK || again.Attachment == nil || again.Attachment.ID != done.Attachment.ID {
+		t.Errorf("repeated last chunk: got %d %+v, want the same attachment", rec.Code, again)
+	}
+
+	var chunks int
+	u.db.QueryRow(context.Background(), `SELECT COUNT(*) FROM upload_chunks WHERE upload_id = $1`, s.ID).Scan(&chunks)
+	if chunks != 0 {
+		t.Errorf("%d chunks left after the upload was saved", chunks)
+	}
+}
+
+func TestUploadSizeMismatch(t *testing.T) {
+	u := newUploadTest(t)
+	jobID := seedJob(t, u.db)
+
+	tests := []struct {
+		name string
+		body string
+		want int
+	}{
+		{"no size", `{"type": "attachment", "size": 0}`, http.StatusBadRequest},
+		{"over the limit", fmt.Sprintf(`{"type": "attachment", "size": %d}`, maxAttachmentSize+1), http.StatusRequestEntityTooLarge},
+		{"unknown type", `{"type": "video", "size": 10}`, http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		if rec := serve(u.router, http.MethodPost, "/jobs/"+jobID.String()+"/uploads", tt.body); rec.Code != tt.want {
+			t.Errorf("%s: got status %d, want %d", tt.name, rec.Code, tt.want)
+		}
+	}
+
+	// More bytes than were declared
+	s := u.create(jobID, len(testPDF)-1)
+	if rec := u.patch(s.ID, 0, testPDF); rec.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("chunk past the end: got status %d, want 413", rec.Code)
+	}
+	if got := u.offset(s.ID); got != 0 {
+		t.Errorf("chunk past the end moved the offset to %d", got)
+	}
+
+	// Fewer bytes than the file has: the PDF arrives cut short
+	rec := u.patch(s.ID, 0, testPDF[:len(testPDF)-1])
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("cut short: got %d %s, want 400", rec.Code, rec.Body)
+	}
+	rec = serve(u.router, http.MethodGet, "/uploads/"+s.ID.String(), "")
+	if rejected := decodeUpload(t, rec); rejected.Status != UploadRejected || rejected.Error != "PDF is incomplete" {
+		t.Errorf("got %s %q, want rejected as incomplete", rejected.Status, rejected.Error)
+	}
+	if rec := u.patch(s.ID, len(testPDF)-1, nil); rec.Code != http.StatusConflict {
+		t.Errorf("rejected upload: got status %d, want 409", rec.Code)
+	}
+}
+
+// TestStuckUploadIsFinished leaves an upload processing, as a request
+// that died while saving the file would, and checks it can be finished.
+func TestStuckUploadIsFinished(t *testing.T) {
+	u := newUploadTest(t)
+	ctx := context.Background()
+
+	s := u.create(seedJob(t, u.db), len(testPDF))
+	if rec := u.patch(s.ID, 0, testPDF[:500]); rec.Code != http.StatusOK {
+		t.Fatalf("first chunk: %d %s", rec.Code, rec.Body)
+	}
+
+	loaded, err := loadUpload(ctx, u.db, u.signer, s.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := appendChunk(ctx, u.db, u.store, loaded, testPDF[500:]); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := u.db.Exec(ctx, `UPDATE uploads SET status = $1 WHERE id = $2`, UploadProcessing, s.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	// Still being saved, as far as anyone can tell
+	if rec := u.patch(s.ID, len(testPDF), nil); rec.Code != http.StatusConflict {
+		t.Errorf("processing upload: got status %d, want 409", rec.Code)
+	}
+
+	_, err = u.db.Exec(ctx,
+		`UPDATE uploads SET updated_at = NOW() - $1 * INTERVAL '1 second' WHERE id = $2`,
+		(uploadStuckAfter + time.Minute).Seconds(),
+		s.ID,
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rec := u.patch(s.ID, len(testPDF), nil)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("finishing a stuck upload: %d %s", rec.Code, rec.Body)
+	}
+	if done := decodeUpload(t, rec); done.Status != UploadComplete || done.Attachment == nil {
+		t.Errorf("got %+v, want a complete upload with its attachment", done)
+	}
+}
@@ -0,0 +1,136 @@
+// Package links makes and checks HMAC-signed, expiring links, so that a
+// customer can download a document without an account.
+package links
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"time"
+)
+
+var (
+	ErrInvalid = errors.New("invalid link signature")
+	ErrExpired = errors.New("link has expired")
+)
+
+type Config struct {
+	Secret  string        // HMAC key; the API and every instance behind a load balancer need the same one
+	BaseURL string        // prepended to signed paths, e.g. https://api.example.com
+	TTL     time.Duration // how long links stay valid
+}
+
+// ConfigFromEnv reads LINK_SECRET and LINK_TTL (a Go duration such as
+// "72h"), with links going to baseURL.
+func ConfigFromEnv(baseURL string) Config {
+	cfg := Config{
+		Secret:  os.Getenv("LINK_SECRET"),
+		BaseURL: baseURL,
+	}
+
+	ttl, err := time.ParseDuration(os.Getenv("LINK_TTL"))
+	if err != nil || ttl <= 0 {
+		ttl = 7 * 24 * time.Hour
+	}
+	cfg.TTL = ttl
+
+	return cfg
+}
+
+// Signer signs paths for Config.TTL and checks the signatures.
+type Signer struct {
+	key     []byte
+	baseURL string
+	ttl     time.Duration
+}
+
+// New returns a Signer. Without a secret a random key is used, so links
+// stop working when the process restarts.
+func New(cfg Config) *Signer {
+	key := []byte(cfg.Secret)
+	if len(key) == 0 {
+		log.Printf("LINK_SECRET is not set; signed links will stop working on restart")
+		key = make([]byte, 32)
+		rand.Read(key)
+	}
+
+	return &Signer{key: key, baseURL: cfg.BaseURL, ttl: cfg.TTL}
+}
+
+// URL returns an absolute link to path that is valid until the TTL
+// passes.
+func (s *Signer) URL(path string) string {
+	return s.URLFor(path, s.ttl)
+}
+
+// URLFor is URL with a validity other than the TTL.
+func (s *Signer) URLFor(path string, ttl time.Duration) string {
+	return s.sign(path, time.Now().Add(ttl))
+}
+
+func (s *Signer) sign(path string, expires time.Time) string {
+	exp := strconv.FormatInt(expires.Unix(), 10)
+
+	q := url.Values{}
+	q.Set("expires", exp)
+	q.Set("signature", s.signature(path, exp))
+
+	return s.baseURL + path + "?" + q.Encode()
+}
+
+// Verify checks the expires and signature query parameters of a link to
+// path.
+func (s *Signer) Verify(path string, q url.Values, now time.Time) error {
+	exp := q.Get("expires")
+	expires, err := strconv.ParseInt(exp, 10, 64)
+	if err != nil {
+		return ErrInvalid
+	}
+
+	got, err := hex.DecodeString(q.Get("signature"))
+	if err != nil {
+		return ErrInvalid
+	}
+
+	want, _ := hex.DecodeString(s.signature(path, exp))
+	if !hmac.Equal(got, want) {
+		return ErrInvalid
+	}
+
+	if now.Unix() > expires {
+		return ErrExpired
+	}
+
+	return nil
+}
+
+func (s *Signer) signature(path, expires string) string {
+	h := hmac.New(sha256.New, s.key)
+	h.Write([]byte(path + "\n" + expires))
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// Require only lets through requests with a valid, unexpired signature
+// for their path.
+func (s *Signer) Require(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		err := s.Verify(r.URL.Path, r.URL.Query(), time.Now())
+		if errors.Is(err, ErrExpired) {
+			http.Error(w, err.Error(), http.StatusGone)
+			return
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusForbidden)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
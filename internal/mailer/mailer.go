@@ -0,0 +1,231 @@
+package mailer
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"net/textproto"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Config holds the SMTP server details. The defaults point at a local
+// MailHog (SMTP on 1025, web UI on 8025).
+type Config struct {
+	Host     string
+	Port     int
+	Username string // empty: no authentication
+	Password string
+	From     string // e.g. "Pistachio Ltd <support@pistachio.com>"
+}
+
+// ConfigFromEnv reads SMTP_HOST, SMTP_PORT, SMTP_USERNAME, SMTP_PASSWORD
+// and SMTP_FROM.
+func ConfigFromEnv() Config {
+	cfg := Config{
+		Host:     os.Getenv("SMTP_HOST"),
+		Username: os.Getenv("SMTP_USERNAME"),
+		Password: os.Getenv("SMTP_PASSWORD"),
+		From:     os.Getenv("SMTP_FROM"),
+	}
+
+	if cfg.Host == "" {
+		cfg.Host = "localhost"
+	}
+
+	port, err := strconv.Atoi(os.Getenv("SMTP_PORT"))
+	if err != nil || port <= 0 {
+		port = 1025
+	}
+	cfg.Port = port
+
+	if cfg.From == "" {
+		cfg.From = "Pistachio Ltd <support@pistachio.com>"
+	}
+
+	return cfg
+}
+
+type Attachment struct {
+	Filename    string
+	ContentType string
+	Data        []byte
+}
+
+// Message is one email. Bcc recipients receive it but are left out of
+// the headers.
+type Message struct {
+	To          []string
+	Cc          []string
+	Bcc         []string
+	Subject     string
+	Text        string
+	HTML        string
+	Attachments []Attachment
+}
+
+type Mailer struct {
+	cfg Config
+}
+
+func New(cfg Config) *Mailer {
+	return &Mailer{cfg: cfg}
+}
+
+// Send delivers msg, upgrading to TLS when the server offers STARTTLS.
+func (m *Mailer) Send(msg Message) error {
+	from, err := mail.ParseAddress(m.cfg.From)
+	if err != nil {
+		return fmt.Errorf("invalid SMTP_FROM: %w", err)
+	}
+
+	recipients := []string{}
+	for _, list := range [][]string{msg.To, msg.Cc, msg.Bcc} {
+		for _, raw := range list {
+			addr, err := mail.ParseAddress(raw)
+			if err != nil {
+				return fmt.Errorf("invalid recipient %q: %w", raw, err)
+			}
+			recipients = append(recipients, addr.Address)
+		}
+	}
+
+	if len(recipients) == 0 {
+		return fmt.Errorf("message has no recipients")
+	}
+
+	body, err := msg.build(m.cfg.From, from.Address)
+	if err != nil {
+		return err
+	}
+
+	var auth smtp.Auth
+	if m.cfg.Username != "" {
+		auth = smtp.PlainAuth("", m.cfg.Username, m.cfg.Password, m.cfg.Host)
+	}
+
+	addr := net.JoinHostPort(m.cfg.Host, strconv.Itoa(m.cfg.Port))
+	if err := smtp.SendMail(addr, auth, from.Address, recipients, body); err != nil {
+		return fmt.Errorf("smtp send failed: %w", err)
+	}
+
+	return nil
+}
+
+// build renders the message as MIME: a multipart/alternative text and
+// HTML body, wrapped in multipart/mixed when there are attachments.
+func (msg Message) build(fromHeader, fromAddress string) ([]byte, error) {
+	var buf bytes.Buffer
+
+	header := func(key, value string) {
+		fmt.Fprintf(&buf, "%s: %s\r\n", key, value)
+	}
+
+	header("From", fromHeader)
+	header("To", strings.Join(msg.To, ", "))
+	if len(msg.Cc) > 0 {
+		header("Cc", strings.Join(msg.Cc, ", "))
+	}
+	header("Subject", mime.QEncoding.Encode("utf-8", msg.Subject))
+	header("Date", time.Now().Format(time.RFC1123Z))
+	header("Message-ID", messageID(fromAddress))
+	header("MIME-Version", "1.0")
+
+	mixed := multipart.NewWriter(&buf)
+	header("Content-Type", `multipart/mixed; boundary="`+mixed.Boundary()+`"`)
+	buf.WriteString("\r\n")
+
+	// 1️⃣ Text and HTML alternatives
+	altBoundary := multipart.NewWriter(io.Discard).Boundary()
+	altPart, err := mixed.CreatePart(textproto.MIMEHeader{
+		"Content-Type": {`multipart/alternative; boundary="` + altBoundary + `"`},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	alt := multipart.NewWriter(altPart)
+	if err := alt.SetBoundary(altBoundary); err != nil {
+		return nil, err
+	}
+
+	for _, body := range []struct{ contentType, content string }{
+		{"text/plain; charset=utf-8", msg.Text},
+		{"text/html; charset=utf-8", msg.HTML},
+	} {
+		if body.content == "" {
+			continue
+		}
+
+		part, err := alt.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {body.contentType},
+			"Content-Transfer-Encoding": {"quoted-printable"},
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		qp := quotedprintable.NewWriter(part)
+		if _, err := qp.Write([]byte(body.content)); err != nil {
+			return nil, err
+		}
+		qp.Close()
+	}
+
+	if err := alt.Close(); err != nil {
+		return nil, err
+	}
+
+	// 2️⃣ Attachments
+	for _, a := range msg.Attachments {
+		contentType := a.ContentType
+		if contentType == "" {
+			contentType = "application/octet-stream"
+		}
+
+		part, err := mixed.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {mime.FormatMediaType(contentType, map[string]string{"name": a.Filename})},
+			"Content-Disposition":       {mime.FormatMediaType("attachment", map[string]string{"filename": a.Filename})},
+			"Content-Transfer-Encoding": {"base64"},
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		encoded := base64.StdEncoding.EncodeToString(a.Data)
+		for len(encoded) > 76 {
+			part.Write([]byte(encoded[:76] + "\r\n"))
+			encoded = encoded[76:]
+		}
+		part.Write([]byte(encoded + "\r\n"))
+	}
+
+	if err := mixed.Close(); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+func messageID(fromAddress string) string {
+	domain := "localhost"
+	if _, d, ok := strings.Cut(fromAddress, "@"); ok {
+		domain = d
+	}
+
+	b := make([]byte, 16)
+	rand.Read(b)
+
+	return "<" + hex.EncodeToString(b) + "@" + domain + ">"
+}
@@ -0,0 +1,175 @@
+package mailer
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/mail"
+	"net/url"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+var invoiceEmail = map[string]any{
+	"CustomerName":   "Ada Customer",
+	"BusinessName":   "Pistachio Ltd",
+	"DocumentNumber": "INV-2026-0001",
+	"Total":          "€1234.50",
+	"DueDate":        "2 November 2026",
+	"Message":        "",
+}
+
+// parts decodes a built message into its headers and the content of
+// each leaf part, keyed by content type or attachment file name.
+func parts(t *testing.T, raw []byte) (mail.Header, map[string]string) {
+	t.Helper()
+
+	msg, err := mail.ReadMessage(bytes.NewReader(raw))
+	if err != nil {
+		t.Fatalf("parse message: %v", err)
+	}
+
+	found := map[string]string{}
+
+	var walk func(r io.Reader, contentType string)
+	walk = func(r io.Reader, contentType string) {
+		mediaType, params, err := mime.ParseMediaType(contentType)
+		if err != nil {
+			t.Fatalf("parse content type %q: %v", contentType, err)
+		}
+
+		mr := multipart.NewReader(r, params["boundary"])
+		for {
+			p, err := mr.NextPart()
+			if err == io.EOF {
+				return
+			}
+			if err != nil {
+				t.Fatalf("read %s: %v", mediaType, err)
+			}
+
+			partType := p.Header.Get("Content-Type")
+			if strings.HasPrefix(partType, "multipart/") {
+				walk(p, partType)
+				continue
+			}
+
+			var body io.Reader = p
+			if p.Header.Get("Content-Transfer-Encoding") == "base64" {
+				body = base64.NewDecoder(base64.StdEncoding, p)
+			}
+
+			b, err := io.ReadAll(body)
+			if err != nil {
+				t.Fatalf("read %s: %v", partType, err)
+			}
+			key, _, _ := mime.ParseMediaType(partType)
+			if name := p.FileName(); name != "" {
+				key = name
+			}
+			found[key] = string(b)
+		}
+	}
+	walk(msg.Body, msg.Header.Get("Content-Type"))
+
+	return msg.Header, found
+}
+
+func TestBuild(t *testing.T) {
+	msg, err := Render("invoice", invoiceEmail)
+	if err != nil {
+		t.Fatal(err)
+	}
+	msg.To = []string{"ada@example.com"}
+	msg.Cc = []string{"accounts@example.com"}
+	msg.Bcc = []string{"archive@example.com"}
+	msg.Attachments = []Attachment{{Filename: "INV-2026-0001.pdf", ContentType: "application/pdf", Data: []byte("%PDF-1.4")}}
+
+	raw, err := msg.build("Pistachio Ltd <support@pistachio.com>", "support@pistachio.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	header, found := parts(t, raw)
+
+	subject, err := new(mime.WordDecoder).DecodeHeader(header.Get("Subject"))
+	if err != nil || subject != "Invoice INV-2026-0001 from Pistachio Ltd" {
+		t.Errorf("got subject %q (%v)", subject, err)
+	}
+	if header.Get("Bcc") != "" || strings.Contains(string(raw), "archive@example.com") {
+		t.Errorf("Bcc recipient is in the message")
+	}
+	if !strings.Contains(found["text/plain"], "for €1234.50, due on 2 November 2026") {
+		t.Errorf("text body is missing the total:\n%s", found["text/plain"])
+	}
+	if !strings.Contains(found["text/html"], "€1234.50") {
+		t.Errorf("HTML body is missing the total:\n%s", found["text/html"])
+	}
+	if found["INV-2026-0001.pdf"] != "%PDF-1.4" {
+		t.Errorf("got attachment %q", found["INV-2026-0001.pdf"])
+	}
+}
+
+// TestSendMailHog sends through a local MailHog and reads the message
+// back from its API. Set MAILHOG_URL, e.g. http://localhost:8025, and
+// SMTP_HOST / SMTP_PORT if MailHog isn't on localhost:1025.
+func TestSendMailHog(t *testing.T) {
+	api := os.Getenv("MAILHOG_URL")
+	if api == "" {
+		t.Skip("MAILHOG_URL not set")
+	}
+
+	to := "ada-" + time.Now().Format("150405.000000000") + "@example.com"
+
+	msg, err := Render("invoice", invoiceEmail)
+	if err != nil {
+		t.Fatal(err)
+	}
+	msg.To = []string{to}
+	msg.Attachments = []Attachment{{Filename: "INV-2026-0001.pdf", ContentType: "application/pdf", Data: []byte("%PDF-1.4")}}
+
+	if err := New(ConfigFromEnv()).Send(msg); err != nil {
+		t.Fatalf("send: %v", err)
+	}
+
+	var result struct {
+		Items []struct {
+			Raw struct {
+				Data string
+			}
+		}
+	}
+
+	// MailHog stores messages as they arrive; give it a moment
+	for attempt := 0; attempt < 20 && len(result.Items) == 0; attempt++ {
+		time.Sleep(100 * time.Millisecond)
+
+		resp, err := http.Get(api + "/api/v2/search?kind=to&query=" + url.QueryEscape(to))
+		if err != nil {
+			t.Fatalf("search MailHog: %v", err)
+		}
+		err = json.NewDecoder(resp.Body).Decode(&result)
+		resp.Body.Close()
+		if err != nil {
+			t.Fatalf("decode MailHog search: %v", err)
+		}
+	}
+
+	if len(result.Items) != 1 {
+		t.Fatalf("got %d messages to %s, want 1", len(result.Items), to)
+	}
+
+	_, found := parts(t, []byte(result.Items[0].Raw.Data))
+	if !strings.Contains(found["text/plain"], "€1234.50") {
+		t.Errorf("delivered text body is missing the total:\n%s", found["text/plain"])
+	}
+	if found["INV-2026-0001.pdf"] != "%PDF-1.4" {
+		t.Errorf("got delivered attachment %q", found["INV-2026-0001.pdf"])
+	}
+}
@@ -0,0 +1,52 @@
+package mailer
+
+import (
+	"bytes"
+	"embed"
+	"fmt"
+	htmltemplate "html/template"
+	"strings"
+	texttemplate "text/template"
+)
+
+// Each email has a <name>.txt template, which also defines
+// "<name>.subject", and a <name>.html template.
+//
+//go:embed templates/*
+var templateFS embed.FS
+
+var (
+	textTemplates = texttemplate.Must(texttemplate.ParseFS(templateFS, "templates/*.txt"))
+	htmlTemplates = htmltemplate.Must(htmltemplate.ParseFS(templateFS, "templates/*.html"))
+)
+
+// Render fills in the subject and bodies of the named email template.
+func Render(name string, data any) (Message, error) {
+	var msg Message
+
+	txt := textTemplates.Lookup(name + ".txt")
+	html := htmlTemplates.Lookup(name + ".html")
+	if txt == nil || html == nil {
+		return msg, fmt.Errorf("unknown email template %q", name)
+	}
+
+	var subject, text, body bytes.Buffer
+
+	if err := txt.Execute(&text, data); err != nil {
+		return msg, fmt.Errorf("failed to render %s text: %w", name, err)
+	}
+
+	if err := txt.ExecuteTemplate(&subject, name+".subject", data); err != nil {
+		return msg, fmt.Errorf("failed to render %s subject: %w", name, err)
+	}
+
+	if err := html.Execute(&body, data); err != nil {
+		return msg, fmt.Errorf("failed to render %s html: %w", name, err)
+	}
+
+	msg.Subject = strings.TrimSpace(subject.String())
+	msg.Text = text.String()
+	msg.HTML = body.String()
+
+	return msg, nil
+}
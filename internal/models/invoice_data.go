@@ -1,6 +1,11 @@
 package models
 
-import "time"
+import (
+	"fmt"
+	"math"
+	"strings"
+	"time"
+)
 
 // Business (Supplier)
 type BusinessInfo struct {
@@ -39,24 +44,155 @@ type CustomerAddress struct {
 	Country  string `json:"country"`
 }
 
+// String joins the non-empty address lines with commas, matching the
+// single-line format stored in customers.address.
+func (a CustomerAddress) String() string {
+	parts := []string{}
+	for _, line := range []string{a.Line1, a.Line2, a.City, a.Postcode, a.Country} {
+		if line != "" {
+			parts = append(parts, line)
+		}
+	}
+	return strings.Join(parts, ", ")
+}
+
 // Item
 type InvoiceItem struct {
-	Description string
-	Quantity    float64
-	UnitPrice   float64
-	LineTotal   float64
+	Description    string
+	Quantity       float64
+	UnitPrice      float64
+	TaxRate        float64  // percent, e.g. 20.0
+	Discount       Discount // optional line discount
+	DiscountAmount float64  // computed from Discount
+	LineTotal      float64  // after the line discount, before tax
+}
+
+// Discount is a percentage or fixed amount off, on a line or the whole
+// invoice. The zero value is no discount.
+type Discount struct {
+	Type  string  `json:"type"` // percent / fixed
+	Value float64 `json:"value"`
+}
+
+func (d Discount) Validate() error {
+	switch d.Type {
+	case "":
+		if d.Value != 0 {
+			return fmt.Errorf("discount type must be percent or fixed")
+		}
+	case "percent":
+		if d.Value < 0 || d.Value > 100 {
+			return fmt.Errorf("percent discount must be between 0 and 100")
+		}
+	case "fixed":
+		if d.Value < 0 {
+			return fmt.Errorf("fixed discount cannot be negative")
+		}
+	default:
+		return fmt.Errorf("discount type must be percent or fixed")
+	}
+	return nil
+}
+
+// amountOf returns the discount on base, never more than base itself.
+func (d Discount) amountOf(base float64) float64 {
+	amount := 0.0
+	switch d.Type {
+	case "percent":
+		amount = base * d.Value / 100
+	case "fixed":
+		amount = d.Value
+	}
+	return round2(math.Min(math.Max(amount, 0), math.Max(base, 0)))
+}
+
+// Surcharge is an extra charge added after discounts, e.g. a call-out fee.
+type Surcharge struct {
+	Description string  `json:"description"`
+	Amount      float64 `json:"amount"`
+	TaxRate     float64 `json:"tax_rate"` // percent
 }
 
 // Totals
 type InvoiceTotals struct {
-	Subtotal    float64
-	TaxRate     float64
-	TaxAmount   float64
-	TotalAmount float64
+	Subtotal       float64 // lines before any discount
+	LineDiscounts  float64
+	Discount       float64 // invoice-level discount
+	Surcharges     float64
+	TaxRate        float64
+	TaxAmount      float64
+	TotalAmount    float64
+	DepositApplied float64 // deposits already paid, deducted from the total
+	AmountDue      float64
+}
+
+func round2(v float64) float64 {
+	return math.Round(v*100) / 100
+}
+
+// CalculateTotals fills in each item's LineTotal and returns the totals.
+// Tax is charged per line; TaxRate is the effective rate across the
+// invoice, which is the line rate when all lines share one.
+func CalculateTotals(items []InvoiceItem) InvoiceTotals {
+	return CalculateInvoiceTotals(items, Discount{}, nil, 0)
+}
+
+// CalculateInvoiceTotals is CalculateTotals with the invoice-level
+// adjustments. Line discounts come off each line, then the invoice
+// discount is spread across the lines in proportion before tax. Deposits
+// are deducted after tax, as they were taxed on their own invoice.
+func CalculateInvoiceTotals(items []InvoiceItem, discount Discount, surcharges []Surcharge, deposit float64) InvoiceTotals {
+	var totals InvoiceTotals
+
+	net := 0.0
+	for i := range items {
+		item := &items[i]
+		gross := item.Quantity * item.UnitPrice
+		item.DiscountAmount = item.Discount.amountOf(gross)
+		item.LineTotal = round2(gross - item.DiscountAmount)
+
+		totals.Subtotal += gross
+		totals.LineDiscounts += item.DiscountAmount
+		net += item.LineTotal
+	}
+
+	totals.Discount = discount.amountOf(net)
+
+	// Share of each line left after the invoice discount
+	share := 0.0
+	if net > 0 {
+		share = (net - totals.Discount) / net
+	}
+
+	taxAmount := 0.0
+	for _, item := range items {
+		taxAmount += item.LineTotal * share * item.TaxRate / 100
+	}
+
+	for _, s := range surcharges {
+		totals.Surcharges += s.Amount
+		taxAmount += s.Amount * s.TaxRate / 100
+	}
+
+	totals.Subtotal = round2(totals.Subtotal)
+	totals.LineDiscounts = round2(totals.LineDiscounts)
+	totals.Surcharges = round2(totals.Surcharges)
+	totals.TaxAmount = round2(taxAmount)
+
+	taxable := net - totals.Discount + totals.Surcharges
+	if taxable != 0 {
+		totals.TaxRate = math.Round(totals.TaxAmount/taxable*1000) / 10
+	}
+
+	totals.TotalAmount = round2(taxable + totals.TaxAmount)
+	totals.DepositApplied = round2(math.Min(deposit, totals.TotalAmount))
+	totals.AmountDue = round2(totals.TotalAmount - totals.DepositApplied)
+
+	return totals
 }
 
 type TaxInfo struct {
-	Rate    float64 `json:"rate"` // e.g. 20.0
+	Rate float64 `json:"rate"` // e.g. 20.0
 }
 
 // Payment
@@ -78,14 +214,26 @@ type InvoiceData struct {
 
 	IssueDate time.Time
 	DueDate   time.Time
+	Reference string // e.g. the invoice a credit note corrects
+	Currency  string // ISO 4217; empty means GBP
 
 	Business BusinessInfo
 	Customer CustomerInfo
 
-	Items   []InvoiceItem
-	TaxInfo TaxInfo `json:"tax"`
-	Totals  InvoiceTotals
-	Payment PaymentInfo
+	Items      []InvoiceItem
+	Discount   Discount    // invoice-level discount
+	Surcharges []Surcharge // e.g. call-out fee
+	TaxInfo    TaxInfo     `json:"tax"`
+	Totals     InvoiceTotals
+	Payment    PaymentInfo
 
 	FooterNotes string // optional footer or custom text
 }
+
+// CurrencyCode returns the invoice currency, defaulting to GBP.
+func (d InvoiceData) CurrencyCode() string {
+	if d.Currency == "" {
+		return "GBP"
+	}
+	return d.Currency
+}
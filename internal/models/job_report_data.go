@@ -0,0 +1,30 @@
+package models
+
+import "time"
+
+// JobReportData is a job as shown to its customer: the work done, with
+// before and after photos side by side.
+type JobReportData struct {
+	Business BusinessInfo
+	Customer CustomerInfo
+
+	Reference      string // e.g. the start of the job id
+	JobTitle       string
+	JobDescription string
+	Date           time.Time
+
+	Pairs []ReportPhotoPair
+}
+
+type ReportPhotoPair struct {
+	Before ReportPhoto
+	After  ReportPhoto
+}
+
+// ReportPhoto is a photo to print. Image is JPEG data; a photo without
+// one is shown as unavailable.
+type ReportPhoto struct {
+	Image   []byte
+	Caption string
+	TakenAt *time.Time
+}
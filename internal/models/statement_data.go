@@ -0,0 +1,31 @@
+package models
+
+import "time"
+
+// StatementData is a customer's account over a period: everything billed
+// and received, with the balance carried in and out.
+type StatementData struct {
+	Business BusinessInfo
+	Customer CustomerInfo
+	Currency string // ISO 4217, the currency of the customer's invoices
+
+	From time.Time
+	To   time.Time
+
+	OpeningBalance float64
+	Entries        []StatementEntry
+	ClosingBalance float64
+}
+
+// StatementEntry is one line of a statement. Debits are amounts billed;
+// credits are payments, credit notes and deducted deposits. Balance is
+// the running balance after the entry.
+type StatementEntry struct {
+	Date        time.Time `json:"date"`
+	Type        string    `json:"type"` // invoice / payment / credit_note / deposit
+	Reference   string    `json:"reference"`
+	Description string    `json:"description"`
+	Debit       float64   `json:"debit"`
+	Credit      float64   `json:"credit"`
+	Balance     float64   `json:"balance"`
+}
@@ -0,0 +1,283 @@
+package photos
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"strings"
+	"time"
+)
+
+// EXIF data is a TIFF structure: a header giving the byte order and the
+// offset of the first IFD (image file directory), each IFD being a list
+// of 12-byte tagged entries. Values longer than four bytes live
+// elsewhere in the block, at an offset held in the entry.
+
+const (
+	tagGPSInfo = 0x8825 // IFD0 entry pointing to the GPS IFD
+	ifdEntry   = 12
+)
+
+var errBadEXIF = errors.New("malformed EXIF data")
+
+// exifPrefix starts EXIF blocks in JPEG APP1 segments, and sometimes in
+// WebP and HEIC.
+var exifPrefix = []byte("Exif\x00\x00")
+
+// tiffTypeSizes are the byte sizes of TIFF field types 1 to 12.
+var tiffTypeSizes = [...]int{0, 1, 1, 2, 4, 8, 1, 1, 2, 4, 8, 4, 8}
+
+type tiff struct {
+	b     []byte
+	order binary.ByteOrder
+}
+
+func parseTIFF(b []byte) (tiff, error) {
+	if len(b) < 8 {
+		return tiff{}, errBadEXIF
+	}
+
+	var order binary.ByteOrder
+	switch string(b[0:4]) {
+	case "II*\x00":
+		order = binary.LittleEndian
+	case "MM\x00*":
+		order = binary.BigEndian
+	default:
+		return tiff{}, errBadEXIF
+	}
+
+	return tiff{b: b, order: order}, nil
+}
+
+// ifd returns the offset and entry count of the IFD at off.
+func (t tiff) ifd(off uint32) (int, int, error) {
+	start := int(off)
+	if off == 0 || start+2 > len(t.b) {
+		return 0, 0, errBadEXIF
+	}
+
+	n := int(t.order.Uint16(t.b[start:]))
+	if start+2+n*ifdEntry > len(t.b) {
+		return 0, 0, errBadEXIF
+	}
+
+	return start, n, nil
+}
+
+// find returns the position of the entry for tag in the IFD at off, or
+// -1.
+func (t tiff) find(off uint32, tag uint16) (int, error) {
+	start, n, err := t.ifd(off)
+	if err != nil {
+		return -1, err
+	}
+
+	for i := 0; i < n; i++ {
+		e := start + 2 + i*ifdEntry
+		if t.order.Uint16(t.b[e:]) == tag {
+			return e, nil
+		}
+	}
+	return -1, nil
+}
+
+// stripGPS zeroes the GPS IFD of an EXIF block in place, with any values
+// stored outside it, and removes IFD0's pointer to it. The block keeps
+// its size, so containers need no other changes.
+func stripGPS(b []byte) error {
+	t, err := parseTIFF(b)
+	if err != nil {
+		return err
+	}
+
+	ifd0 := t.order.Uint32(b[4:])
+	ptr, err := t.find(ifd0, tagGPSInfo)
+	if err != nil || ptr < 0 {
+		return err
+	}
+
+	gps := t.order.Uint32(b[ptr+8:])
+	start, n, err := t.ifd(gps)
+	if err != nil {
+		return err
+	}
+
+	for i := 0; i < n; i++ {
+		e := start + 2 + i*ifdEntry
+		typ := int(t.order.Uint16(b[e+2:]))
+		count := int(t.order.Uint32(b[e+4:]))
+		if typ <= 0 || typ >= len(tiffTypeSizes) {
+			continue
+		}
+
+		size := tiffTypeSizes[typ] * count
+		if size > 4 {
+			off := int(t.order.Uint32(b[e+8:]))
+			if off >= 0 && size >= 0 && off+size <= len(b) {
+				clear(b[off : off+size])
+			}
+		}
+	}
+
+	// The GPS IFD becomes empty, and IFD0 loses its pointer to it: the
+	// entry is dropped and the following entries move up
+	clear(b[start+2 : start+2+n*ifdEntry])
+	t.order.PutUint16(b[start:], 0)
+
+	ifd0Start, ifd0Count, err := t.ifd(ifd0)
+	if err != nil {
+		return err
+	}
+	end := ifd0Start + 2 + ifd0Count*ifdEntry
+	if end+4 > len(b) {
+		return errBadEXIF
+	}
+	copy(b[ptr:], b[ptr+ifdEntry:end+4])
+	clear(b[end-ifdEntry+4 : end+4])
+	t.order.PutUint16(b[ifd0Start:], uint16(ifd0Count-1))
+
+	return nil
+}
+
+const tagOrientation = 0x0112
+
+// Orientation returns a photo's EXIF orientation, 1 (upright) to 8, or 1
+// if it has none.
+func Orientation(data []byte, format Format) int {
+	t, err := parseTIFF(findEXIF(data, format))
+	if err != nil {
+		return 1
+	}
+
+	e, err := t.find(t.order.Uint32(t.b[4:]), tagOrientation)
+	if err != nil || e < 0 {
+		return 1
+	}
+
+	o := int(t.order.Uint16(t.b[e+8:]))
+	if o < 1 || o > 8 {
+		return 1
+	}
+	return o
+}
+
+// findEXIF returns the TIFF block of a photo's EXIF data, or nil.
+func findEXIF(data []byte, format Format) []byte {
+	switch format {
+	case JPEG:
+		for pos := 2; pos+4 <= len(data) && data[pos] == 0xFF; {
+			marker := data[pos+1]
+			if marker == 0xDA || marker == 0xD9 {
+				break
+			}
+			end := pos + 2 + int(be16(data[pos+2:]))
+			if end > len(data) {
+				break
+			}
+			if payload := data[pos+4 : end]; marker == 0xE1 && bytes.HasPrefix(payload, exifPrefix) {
+				return payload[len(exifPrefix):]
+			}
+			pos = end
+		}
+
+	case PNG:
+		for pos := 8; pos+12 <= len(data); {
+			length := int(be32(data[pos:]))
+			end := pos + 12 + length
+			if end > len(data) {
+				break
+			}
+			if string(data[pos+4:pos+8]) == "eXIf" {
+				return data[pos+8 : pos+8+length]
+			}
+			pos = end
+		}
+
+	case WebP:
+		for pos := 12; pos+8 <= len(data); {
+			size := int(binary.LittleEndian.Uint32(data[pos+4:]))
+			end := pos + 8 + size + size%2
+			if end > len(data) {
+				break
+			}
+			if string(data[pos:pos+4]) == "EXIF" {
+				return bytes.TrimPrefix(data[pos+8:pos+8+size], exifPrefix)
+			}
+			pos = end
+		}
+
+	case HEIC:
+		f, err := parseHEIF(data)
+		if err != nil {
+			break
+		}
+		for _, item := range f.items {
+			if item.typ != "Exif" || len(item.extents) != 1 {
+				continue
+			}
+			// The item starts with the offset of the TIFF header
+			e := data[item.extents[0][0]:item.extents[0][1]]
+			if len(e) >= 4 && int(be32(e))+4 <= len(e) {
+				return e[4+int(be32(e)):]
+			}
+		}
+	}
+	return nil
+}
+
+const (
+	tagExifIFD            = 0x8769 // IFD0 entry pointing to the Exif IFD
+	tagDateTimeOriginal   = 0x9003
+	tagOffsetTimeOriginal = 0x9011
+
+	exifTimeLayout = "2006:01:02 15:04:05"
+)
+
+// TakenAt returns when a photo was taken, from its EXIF
+// DateTimeOriginal. Cameras record their local time; it is returned in
+// the recorded UTC offset if there is one, and as UTC otherwise.
+func TakenAt(data []byte, format Format) (time.Time, bool) {
+	t, err := parseTIFF(findEXIF(data, format))
+	if err != nil {
+		return time.Time{}, false
+	}
+
+	ptr, err := t.find(t.order.Uint32(t.b[4:]), tagExifIFD)
+	if err != nil || ptr < 0 {
+		return time.Time{}, false
+	}
+	exif := t.order.Uint32(t.b[ptr+8:])
+
+	value := t.ascii(exif, tagDateTimeOriginal)
+	loc := time.UTC
+	if offset, err := time.Parse("-07:00", t.ascii(exif, tagOffsetTimeOriginal)); err == nil {
+		_, secs := offset.Zone()
+		loc = time.FixedZone("", secs)
+	}
+
+	taken, err := time.ParseInLocation(exifTimeLayout, value, loc)
+	if err != nil || taken.Year() < 1900 {
+		return time.Time{}, false
+	}
+	return taken, true
+}
+
+// ascii returns the text of an ASCII entry in the IFD at off, or "".
+func (t tiff) ascii(off uint32, tag uint16) string {
+	e, err := t.find(off, tag)
+	if err != nil || e < 0 || t.order.Uint16(t.b[e+2:]) != 2 {
+		return ""
+	}
+
+	count := int(t.order.Uint32(t.b[e+4:]))
+	start := e + 8
+	if count > 4 {
+		start = int(t.order.Uint32(t.b[e+8:]))
+	}
+	if count < 0 || start < 0 || start+count > len(t.b) {
+		return ""
+	}
+
+	return strings.TrimRight(string(t.b[start:start+count]), "\x00 ")
+}
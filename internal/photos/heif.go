@@ -0,0 +1,307 @@
+package photos
+
+import (
+	"bytes"
+	"errors"
+)
+
+// HEIC photos are ISO base media files: nested boxes, each a 32-bit size
+// and a four-character type. The meta box lists the items (the image
+// tiles, EXIF, XMP) in iinf and where their bytes are in iloc.
+
+var errBadHEIF = errors.New("malformed HEIF container")
+
+type heifBox struct {
+	typ  string
+	data int // offset of the box's contents, after its header
+	end  int
+}
+
+// readBoxes reads the boxes between start and end.
+func readBoxes(b []byte, start, end int) ([]heifBox, error) {
+	var boxes []heifBox
+	for pos := start; pos < end; {
+		if pos+8 > end {
+			return nil, errBadHEIF
+		}
+
+		size := int(be32(b[pos:]))
+		typ := string(b[pos+4 : pos+8])
+		data := pos + 8
+
+		switch size {
+		case 0:
+			size = end - pos
+		case 1:
+			if pos+16 > end {
+				return nil, errBadHEIF
+			}
+			large := uint64(be32(b[pos+8:]))<<32 | uint64(be32(b[pos+12:]))
+			if large > uint64(end-pos) {
+				return nil, errBadHEIF
+			}
+			size = int(large)
+			data = pos + 16
+		}
+
+		if size < data-pos || pos+size > end {
+			return nil, errBadHEIF
+		}
+
+		boxes = append(boxes, heifBox{typ: typ, data: data, end: pos + size})
+		pos += size
+	}
+	return boxes, nil
+}
+
+func findBox(boxes []heifBox, typ string) (heifBox, bool) {
+	for _, bx := range boxes {
+		if bx.typ == typ {
+			return bx, true
+		}
+	}
+	return heifBox{}, false
+}
+
+type heifItem struct {
+	typ         string // e.g. hvc1, grid, Exif, mime
+	contentType string // mime items only
+	extents     [][2]int
+}
+
+type heifFile struct {
+	primary uint32
+	items   map[uint32]*heifItem
+}
+
+// reader reads big-endian fields from a box, remembering if it ran past
+// the end.
+type reader struct {
+	b   []byte
+	pos int
+	end int
+	err bool
+}
+
+func (r *reader) uint(n int) uint64 {
+	if n == 0 {
+		return 0
+	}
+	if r.pos+n > r.end {
+		r.err = true
+		return 0
+	}
+
+	var v uint64
+	for _, c := range r.b[r.pos : r.pos+n] {
+		v = v<<8 | uint64(c)
+	}
+	r.pos += n
+	return v
+}
+
+func (r *reader) fourCC() string {
+	if r.pos+4 > r.end {
+		r.err = true
+		return ""
+	}
+	s := string(r.b[r.pos : r.pos+4])
+	r.pos += 4
+	return s
+}
+
+func (r *reader) cstring() string {
+	i := bytes.IndexByte(r.b[r.pos:r.end], 0)
+	if i < 0 {
+		r.err = true
+		return ""
+	}
+	s := string(r.b[r.pos : r.pos+i])
+	r.pos += i + 1
+	return s
+}
+
+// parseHEIF reads the item list of a HEIC file and checks every item's
+// bytes are inside the file.
+func parseHEIF(b []byte) (heifFile, error) {
+	top, err := readBoxes(b, 0, len(b))
+	if err != nil {
+		return heifFile{}, err
+	}
+
+	meta, ok := findBox(top, "meta")
+	if !ok || meta.data+4 > meta.end {
+		return heifFile{}, errors.New("no meta box")
+	}
+
+	// meta is a full box: version and flags come before its children
+	children, err := readBoxes(b, meta.data+4, meta.end)
+	if err != nil {
+		return heifFile{}, err
+	}
+
+	f := heifFile{items: map[uint32]*heifItem{}}
+
+	pitm, ok := findBox(children, "pitm")
+	if !ok {
+		return f, errors.New("no primary item")
+	}
+	r := &reader{b: b, pos: pitm.data, end: pitm.end}
+	if r.uint(1) == 0 {
+		r.uint(3)
+		f.primary = uint32(r.uint(2))
+	} else {
+		r.uint(3)
+		f.primary = uint32(r.uint(4))
+	}
+
+	iinf, ok := findBox(children, "iinf")
+	if !ok {
+		return f, errors.New("no item info")
+	}
+	if err := f.readItemInfo(b, iinf); err != nil {
+		return f, err
+	}
+
+	iloc, ok := findBox(children, "iloc")
+	if !ok {
+		return f, errors.New("no item locations")
+	}
+	idat, _ := findBox(children, "idat")
+	if err := f.readItemLocations(b, iloc, idat); err != nil {
+		return f, err
+	}
+
+	if r.err || f.items[f.primary] == nil || len(f.items[f.primary].extents) == 0 && f.items[f.primary].typ != "grid" {
+		return f, errors.New("primary image is missing")
+	}
+
+	return f, nil
+}
+
+func (f *heifFile) readItemInfo(b []byte, iinf heifBox) error {
+	r := &reader{b: b, pos: iinf.data, end: iinf.end}
+	if r.uint(1) == 0 {
+		r.uint(3)
+		r.uint(2)
+	} else {
+		r.uint(3)
+		r.uint(4)
+	}
+	if r.err {
+		return errBadHEIF
+	}
+
+	entries, err := readBoxes(b, r.pos, iinf.end)
+	if err != nil {
+		return err
+	}
+
+	for _, infe := range entries {
+		if infe.typ != "infe" {
+			continue
+		}
+
+		r := &reader{b: b, pos: infe.data, end: infe.end}
+		version := r.uint(1)
+		r.uint(3)
+		if version < 2 {
+			// Version 0 and 1 entries predate item types
+			f.items[uint32(r.uint(2))] = &heifItem{}
+			continue
+		}
+
+		var id uint32
+		if version == 2 {
+			id = uint32(r.uint(2))
+		} else {
+			id = uint32(r.uint(4))
+		}
+		r.uint(2)
+
+		item := &heifItem{typ: r.fourCC()}
+		r.cstring()
+		if item.typ == "mime" {
+			item.contentType = r.cstring()
+		}
+		if r.err {
+			return errBadHEIF
+		}
+
+		f.items[id] = item
+	}
+	return nil
+}
+
+func (f *heifFile) readItemLocations(b []byte, iloc, idat heifBox) error {
+	r := &reader{b: b, pos: iloc.data, end: iloc.end}
+	version := r.uint(1)
+	r.uint(3)
+
+	sizes := r.uint(1)
+	offsetSize, lengthSize := int(sizes>>4), int(sizes&0xF)
+	sizes = r.uint(1)
+	baseOffsetSize, indexSize := int(sizes>>4), int(sizes&0xF)
+	if version == 0 {
+		indexSize = 0
+	}
+
+	var count uint64
+	if version < 2 {
+		count = r.uint(2)
+	} else {
+		count = r.uint(4)
+	}
+
+	for i := uint64(0); i < count && !r.err; i++ {
+		var id uint32
+		if version < 2 {
+			id = uint32(r.uint(2))
+		} else {
+			id = uint32(r.uint(4))
+		}
+
+		method := uint64(0)
+		if version > 0 {
+			method = r.uint(2) & 0xF
+		}
+		r.uint(2) // data reference index
+		base := r.uint(baseOffsetSize)
+
+		extents := int(r.uint(2))
+		for j := 0; j < extents && !r.err; j++ {
+			r.uint(indexSize)
+			off := base + r.uint(offsetSize)
+			length := r.uint(lengthSize)
+
+			// Construction method 0 is an offset into the file, 1 into the
+			// idat box; 2 (item references) carries no bytes of its own
+			switch method {
+			case 0:
+			case 1:
+				if idat.end == 0 {
+					return errBadHEIF
+				}
+				off += uint64(idat.data)
+			default:
+				continue
+			}
+
+			if length == 0 {
+				length = uint64(len(b)) - off
+			}
+			if off > uint64(len(b)) || length > uint64(len(b))-off {
+				return errBadHEIF
+			}
+
+			if item := f.items[id]; item != nil {
+				item.extents = append(item.extents, [2]int{int(off), int(off + length)})
+			}
+		}
+	}
+
+	if r.err {
+		return errBadHEIF
+	}
+	return nil
+}
@@ -0,0 +1,224 @@
+package photos
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+)
+
+// xmpPacket replaces XMP metadata that can't be removed without moving
+// other data, padded with spaces to the original length.
+const xmpPacket = `<x:xmpmeta xmlns:x="adobe:ns:meta/"/>`
+
+var (
+	jpegXMP         = []byte("http://ns.adobe.com/xap/1.0/\x00")
+	jpegExtendedXMP = []byte("http://ns.adobe.com/xmp/extension/\x00")
+)
+
+// StripLocation returns a copy of a photo without GPS coordinates, for
+// customers to see. The EXIF GPS data is removed and the rest of the
+// EXIF data, such as orientation and capture time, is kept. XMP, which
+// can repeat the coordinates, is removed entirely. If EXIF data can't be
+// parsed it is removed too.
+func StripLocation(data []byte, format Format) ([]byte, error) {
+	if sniffed, err := Sniff(data); err != nil || sniffed != format {
+		return nil, ErrUnsupported
+	}
+
+	switch format {
+	case JPEG:
+		return stripJPEG(data)
+	case PNG:
+		return stripPNG(data)
+	case WebP:
+		return stripWebP(data)
+	case HEIC:
+		return stripHEIC(data)
+	}
+	return nil, ErrUnsupported
+}
+
+// stripJPEG rewrites the APP segments before the image data.
+func stripJPEG(data []byte) ([]byte, error) {
+	out := bytes.NewBuffer(make([]byte, 0, len(data)))
+	out.Write(data[:2])
+
+	for pos := 2; ; {
+		if pos+2 > len(data) || data[pos] != 0xFF {
+			return nil, errors.New("malformed JPEG")
+		}
+
+		marker := data[pos+1]
+		switch {
+		case marker == 0xFF:
+			// Fill byte
+			pos++
+			continue
+		case marker == 0xD9 || marker == 0xDA:
+			// End of image, or start of scan: the rest is image data
+			out.Write(data[pos:])
+			return out.Bytes(), nil
+		case marker >= 0xD0 && marker <= 0xD7 || marker == 0x01:
+			out.Write(data[pos : pos+2])
+			pos += 2
+			continue
+		}
+
+		if pos+4 > len(data) {
+			return nil, errors.New("malformed JPEG")
+		}
+		end := pos + 2 + int(be16(data[pos+2:]))
+		if end > len(data) || end < pos+4 {
+			return nil, errors.New("malformed JPEG")
+		}
+		segment := data[pos:end]
+		payload := segment[4:]
+		pos = end
+
+		if marker == 0xE1 {
+			switch {
+			case bytes.HasPrefix(payload, exifPrefix):
+				segment = bytes.Clone(segment)
+				if err := stripGPS(segment[4+len(exifPrefix):]); err != nil {
+					continue
+				}
+			case bytes.HasPrefix(payload, jpegXMP), bytes.HasPrefix(payload, jpegExtendedXMP):
+				continue
+			}
+		}
+
+		out.Write(segment)
+	}
+}
+
+// stripPNG rewrites the eXIf chunk and drops XMP text chunks.
+func stripPNG(data []byte) ([]byte, error) {
+	out := bytes.NewBuffer(make([]byte, 0, len(data)))
+	out.Write(data[:8])
+
+	for pos := 8; pos < len(data); {
+		if pos+12 > len(data) {
+			return nil, errors.New("malformed PNG")
+		}
+		length := int(be32(data[pos:]))
+		end := pos + 12 + length
+		if length < 0 || end > len(data) {
+			return nil, errors.New("malformed PNG")
+		}
+
+		typ := string(data[pos+4 : pos+8])
+		chunk := data[pos:end]
+		pos = end
+
+		switch typ {
+		case "eXIf":
+			chunk = bytes.Clone(chunk)
+			if err := stripGPS(chunk[8 : 8+length]); err != nil {
+				continue
+			}
+			binary.BigEndian.PutUint32(chunk[8+length:], crc32.ChecksumIEEE(chunk[4:8+length]))
+		case "iTXt", "tEXt", "zTXt":
+			if bytes.HasPrefix(chunk[8:], []byte("XML:com.adobe.xmp\x00")) {
+				continue
+			}
+		}
+
+		out.Write(chunk)
+	}
+
+	return out.Bytes(), nil
+}
+
+// stripWebP rewrites the EXIF chunk and drops the XMP chunk, updating
+// the VP8X header's flags to match.
+func stripWebP(data []byte) ([]byte, error) {
+	out := bytes.NewBuffer(make([]byte, 0, len(data)))
+	out.Write(data[:12])
+
+	vp8x, hasEXIF := -1, false
+	for pos := 12; pos < len(data); {
+		if pos+8 > len(data) {
+			return nil, errors.New("malformed WebP")
+		}
+		size := int(binary.LittleEndian.Uint32(data[pos+4:]))
+		end := pos + 8 + size + size%2
+		if size < 0 || end > len(data) {
+			return nil, errors.New("malformed WebP")
+		}
+
+		chunk := data[pos:end]
+		pos = end
+
+		switch string(chunk[:4]) {
+		case "EXIF":
+			chunk = bytes.Clone(chunk)
+			if err := stripGPS(bytes.TrimPrefix(chunk[8:8+size], exifPrefix)); err != nil {
+				continue
+			}
+			hasEXIF = true
+		case "XMP ":
+			continue
+		case "VP8X":
+			if size >= 1 {
+				vp8x = out.Len() + 8
+			}
+		}
+
+		out.Write(chunk)
+	}
+
+	b := out.Bytes()
+	binary.LittleEndian.PutUint32(b[4:], uint32(len(b)-8))
+
+	// Flags: 0x08 EXIF, 0x04 XMP
+	if vp8x >= 0 {
+		b[vp8x] &^= 0x04
+		if !hasEXIF {
+			b[vp8x] &^= 0x08
+		}
+	}
+	return b, nil
+}
+
+// stripHEIC edits EXIF and XMP items in place, as removing them would
+// move the image data iloc points to.
+func stripHEIC(data []byte) ([]byte, error) {
+	f, err := parseHEIF(data)
+	if err != nil {
+		return nil, err
+	}
+
+	out := bytes.Clone(data)
+	for _, item := range f.items {
+		switch {
+		case item.typ == "Exif" && len(item.extents) == 1:
+			// The item starts with the offset of the TIFF header
+			e := out[item.extents[0][0]:item.extents[0][1]]
+			if len(e) >= 4 && int(be32(e))+4 <= len(e) {
+				if stripGPS(e[4+int(be32(e)):]) == nil {
+					continue
+				}
+			}
+			clear(e)
+
+		case item.typ == "Exif":
+			for _, ext := range item.extents {
+				clear(out[ext[0]:ext[1]])
+			}
+
+		case item.typ == "mime" && item.contentType == "application/rdf+xml":
+			for i, ext := range item.extents {
+				e := out[ext[0]:ext[1]]
+				for j := range e {
+					e[j] = ' '
+				}
+				if i == 0 && len(e) >= len(xmpPacket) {
+					copy(e, xmpPacket)
+				}
+			}
+		}
+	}
+
+	return out, nil
+}
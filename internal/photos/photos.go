@@ -0,0 +1,122 @@
+// Package photos checks uploaded job photos and removes the location
+// data phones write into them.
+package photos
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	_ "image/jpeg"
+	_ "image/png"
+
+	_ "golang.org/x/image/webp"
+)
+
+// Format is an accepted photo file format.
+type Format string
+
+const (
+	JPEG Format = "jpeg"
+	PNG  Format = "png"
+	WebP Format = "webp"
+	HEIC Format = "heic"
+)
+
+// ContentType is the format's MIME type.
+func (f Format) ContentType() string {
+	return "image/" + string(f)
+}
+
+// Ext is the file extension photos of the format are stored with.
+func (f Format) Ext() string {
+	if f == JPEG {
+		return ".jpg"
+	}
+	return "." + string(f)
+}
+
+// MaxPixels bounds the decoded size of a photo, so a small file that
+// claims huge dimensions can't exhaust memory. 100 megapixels is more
+// than any phone camera.
+const MaxPixels = 100_000_000
+
+var ErrUnsupported = errors.New("photo must be a JPEG, PNG, WebP or HEIC image")
+
+// heifBrands are the ftyp brands of HEIC/HEIF still images.
+var heifBrands = map[string]bool{
+	"heic": true, "heix": true, "heim": true, "heis": true,
+	"hevc": true, "hevx": true, "mif1": true, "msf1": true,
+}
+
+// Sniff returns the format of a photo from its first bytes, ignoring
+// whatever name or content type the client sent.
+func Sniff(data []byte) (Format, error) {
+	switch {
+	case bytes.HasPrefix(data, []byte{0xFF, 0xD8, 0xFF}):
+		return JPEG, nil
+	case bytes.HasPrefix(data, []byte("\x89PNG\r\n\x1a\n")):
+		return PNG, nil
+	case len(data) >= 12 && string(data[0:4]) == "RIFF" && string(data[8:12]) == "WEBP":
+		return WebP, nil
+	case len(data) >= 12 && string(data[4:8]) == "ftyp" && isHEIF(data):
+		return HEIC, nil
+	}
+	return "", ErrUnsupported
+}
+
+// isHEIF checks the major and compatible brands of an ftyp box.
+func isHEIF(data []byte) bool {
+	size := int(be32(data))
+	if size < 16 || size > len(data) {
+		return false
+	}
+
+	if heifBrands[string(data[8:12])] {
+		return true
+	}
+	for i := 16; i+4 <= size; i += 4 {
+		if heifBrands[string(data[i:i+4])] {
+			return true
+		}
+	}
+	return false
+}
+
+// Validate checks that a photo decodes as the sniffed format. HEIC has no
+// decoder in the standard library, so only its container structure is
+// checked.
+func Validate(data []byte, format Format) error {
+	if format == HEIC {
+		_, err := parseHEIF(data)
+		if err != nil {
+			return fmt.Errorf("invalid HEIC image: %w", err)
+		}
+		return nil
+	}
+
+	cfg, decoded, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return fmt.Errorf("invalid %s image: %w", format, err)
+	}
+
+	if Format(decoded) != format {
+		return fmt.Errorf("image content is %s, not %s", decoded, format)
+	}
+
+	if cfg.Width <= 0 || cfg.Height <= 0 || cfg.Width*cfg.Height > MaxPixels {
+		return fmt.Errorf("image is %dx%d, larger than %d pixels", cfg.Width, cfg.Height, MaxPixels)
+	}
+
+	// Decoding the whole image catches truncated and corrupt files
+	if _, _, err := image.Decode(bytes.NewReader(data)); err != nil {
+		return fmt.Errorf("invalid %s image: %w", format, err)
+	}
+
+	return nil
+}
+
+func be16(b []byte) uint16 { return uint16(b[0])<<8 | uint16(b[1]) }
+func be32(b []byte) uint32 {
+	return uint32(b[0])<<24 | uint32(b[1])<<16 | uint32(b[2])<<8 | uint32(b[3])
+}
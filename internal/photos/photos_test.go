@@ -0,0 +1,405 @@
+package photos
+
+import (
+	"bytes"
+	"encoding/binary"
+	"hash/crc32"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"os"
+	"testing"
+	"time"
+)
+
+// The fixtures are small images with the EXIF data a phone writes: a
+// make, an orientation, the capture time in the Exif IFD and the
+// coordinates in the GPS IFD. XMP repeats the coordinates.
+
+var takenAt = time.Date(2026, 10, 19, 9, 30, 0, 0, time.UTC)
+
+// latitudeSeconds is distinctive enough to search a whole file for.
+const latitudeSeconds = 123456789
+
+const xmpLocation = `<x:xmpmeta xmlns:x="adobe:ns:meta/"><exif:GPSLatitude>51,30.2058N</exif:GPSLatitude></x:xmpmeta>`
+
+// makeEXIF returns a TIFF block laid out as
+//
+//	  8 IFD0: Make, Orientation 6, Exif IFD, GPS IFD
+//	 62 "Apple"
+//	 68 Exif IFD: DateTimeOriginal
+//	 86 "2026:10:19 09:30:00"
+//	106 GPS IFD: GPSLatitudeRef, GPSLatitude
+//	136 latitude rationals
+func makeEXIF(order binary.AppendByteOrder) []byte {
+	var b []byte
+	if order == binary.AppendByteOrder(binary.LittleEndian) {
+		b = append(b, "II*\x00"...)
+	} else {
+		b = append(b, "MM\x00*"...)
+	}
+	b = order.AppendUint32(b, 8)
+
+	entry := func(tag, typ uint16, count uint32, value []byte) {
+		b = order.AppendUint16(b, tag)
+		b = order.AppendUint16(b, typ)
+		b = order.AppendUint32(b, count)
+		b = append(b, value...)
+	}
+	u32 := func(v uint32) []byte { return order.AppendUint32(nil, v) }
+
+	b = order.AppendUint16(b, 4)
+	entry(0x010F, 2, 6, u32(62))
+	entry(tagOrientation, 3, 1, order.AppendUint16(order.AppendUint16(nil, 6), 0))
+	entry(tagExifIFD, 4, 1, u32(68))
+	entry(tagGPSInfo, 4, 1, u32(106))
+	b = order.AppendUint32(b, 0)
+	b = append(b, "Apple\x00"...)
+
+	b = order.AppendUint16(b, 1)
+	entry(tagDateTimeOriginal, 2, 20, u32(86))
+	b = order.AppendUint32(b, 0)
+	b = append(b, takenAt.Format(exifTimeLayout)+"\x00"...)
+
+	b = order.AppendUint16(b, 2)
+	entry(0x0001, 2, 2, []byte("N\x00\x00\x00"))
+	entry(0x0002, 5, 3, u32(136))
+	b = order.AppendUint32(b, 0)
+	for _, v := range []uint32{51, 1, 30, 1, latitudeSeconds, 10000000} {
+		b = order.AppendUint32(b, v)
+	}
+
+	return b
+}
+
+// testImage is 16x8, so turning it for orientation 6 is visible.
+func testImage() image.Image {
+	m := image.NewRGBA(image.Rect(0, 0, 16, 8))
+	for x := 0; x < 16; x++ {
+		for y := 0; y < 8; y++ {
+			m.Set(x, y, color.RGBA{uint8(x * 16), uint8(y * 30), 99, 255})
+		}
+	}
+	return m
+}
+
+func jpegSegment(marker byte, payload []byte) []byte {
+	s := []byte{0xFF, marker}
+	s = binary.BigEndian.AppendUint16(s, uint16(len(payload)+2))
+	return append(s, payload...)
+}
+
+func jpegFixture(t *testing.T) []byte {
+	t.Helper()
+
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, testImage(), nil); err != nil {
+		t.Fatal(err)
+	}
+	j := buf.Bytes()
+
+	out := bytes.Clone(j[:2])
+	out = append(out, jpegSegment(0xE1, append(bytes.Clone(exifPrefix), makeEXIF(binary.BigEndian)...))...)
+	out = append(out, jpegSegment(0xE1, append(bytes.Clone(jpegXMP), xmpLocation...))...)
+	return append(out, j[2:]...)
+}
+
+func pngChunk(typ string, data []byte) []byte {
+	c := binary.BigEndian.AppendUint32(nil, uint32(len(data)))
+	c = append(c, typ...)
+	c = append(c, data...)
+	return binary.BigEndian.AppendUint32(c, crc32.ChecksumIEEE(c[4:]))
+}
+
+func pngFixture(t *testing.T) []byte {
+	t.Helper()
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, testImage()); err != nil {
+		t.Fatal(err)
+	}
+	p := buf.Bytes()
+
+	// After the signature and IHDR
+	out := bytes.Clone(p[:33])
+	out = append(out, pngChunk("eXIf", makeEXIF(binary.LittleEndian))...)
+	out = append(out, pngChunk("iTXt", append([]byte("XML:com.adobe.xmp\x00\x00\x00\x00\x00"), xmpLocation...))...)
+	return append(out, p[33:]...)
+}
+
+func riffChunk(typ string, data []byte) []byte {
+	c := append([]byte(typ), binary.LittleEndian.AppendUint32(nil, uint32(len(data)))...)
+	c = append(c, data...)
+	if len(data)%2 == 1 {
+		c = append(c, 0)
+	}
+	return c
+}
+
+// webpFixture wraps testdata/gopher.webp, a simple lossless WebP from
+// golang.org/x/image, in the extended format with EXIF and XMP chunks.
+func webpFixture(t *testing.T) []byte {
+	t.Helper()
+
+	src, err := os.ReadFile("testdata/gopher.webp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(src))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// VP8X: flags (EXIF and XMP), three reserved bytes, then the canvas
+	// width and height less one in 24 bits each
+	x := make([]byte, 10)
+	x[0] = 0x08 | 0x04
+	w, h := cfg.Width-1, cfg.Height-1
+	x[4], x[5], x[6] = byte(w), byte(w>>8), byte(w>>16)
+	x[7], x[8], x[9] = byte(h), byte(h>>8), byte(h>>16)
+
+	body := []byte("WEBP")
+	body = append(body, riffChunk("VP8X", x)...)
+	body = append(body, src[12:]...)
+	body = append(body, riffChunk("EXIF", makeEXIF(binary.LittleEndian))...)
+	body = append(body, riffChunk("XMP ", []byte(xmpLocation))...)
+
+	out := append([]byte("RIFF"), binary.LittleEndian.AppendUint32(nil, uint32(len(body)))...)
+	return append(out, body...)
+}
+
+func isoBox(typ string, data ...[]byte) []byte {
+	var d []byte
+	for _, x := range data {
+		d = append(d, x...)
+	}
+	return append(append(binary.BigEndian.AppendUint32(nil, uint32(8+len(d))), typ...), d...)
+}
+
+// heicImageData stands in for the HEVC bitstream, which nothing here
+// decodes.
+const heicImageData = "hevc-image-data"
+
+// heicFixture builds a HEIF file with an image item, an Exif item and an
+// XMP item, all stored in mdat.
+func heicFixture(t *testing.T) []byte {
+	t.Helper()
+
+	exif := append(binary.BigEndian.AppendUint32(nil, uint32(len(exifPrefix))), exifPrefix...)
+	exif = append(exif, makeEXIF(binary.BigEndian)...)
+	items := [][]byte{[]byte(heicImageData), exif, []byte(xmpLocation)}
+
+	infe := func(id uint16, typ, extra string) []byte {
+		d := []byte{2, 0, 0, 0}
+		d = binary.BigEndian.AppendUint16(d, id)
+		d = append(d, 0, 0)
+		d = append(d, typ+"\x00"+extra...)
+		return isoBox("infe", d)
+	}
+	iinf := isoBox("iinf", []byte{0, 0, 0, 0, 0, 3},
+		infe(1, "hvc1", ""), infe(2, "Exif", ""), infe(3, "mime", "application/rdf+xml\x00"))
+
+	// iloc version 0: 4-byte offsets and lengths, no base offset
+	meta := func(mdatStart uint32) []byte {
+		d := []byte{0, 0, 0, 0, 0x44, 0x00, 0, 3}
+		off := mdatStart + 8
+		for i, item := range items {
+			d = binary.BigEndian.AppendUint16(d, uint16(i+1))
+			d = binary.BigEndian.AppendUint16(d, 0)
+			d = binary.BigEndian.AppendUint16(d, 1)
+			d = binary.BigEndian.AppendUint32(d, off)
+			d = binary.BigEndian.AppendUint32(d, uint32(len(item)))
+			off += uint32(len(item))
+		}
+		return isoBox("meta", []byte{0, 0, 0, 0},
+			isoBox("hdlr", make([]byte, 8), []byte("pict"), make([]byte, 13)),
+			isoBox("pitm", []byte{0, 0, 0, 0, 0, 1}),
+			iinf,
+			isoBox("iloc", d))
+	}
+
+	ftyp := isoBox("ftyp", []byte("heic\x00\x00\x00\x00mif1heic"))
+	mdatStart := uint32(len(ftyp) + len(meta(0)))
+
+	out := append(ftyp, meta(mdatStart)...)
+	return append(out, isoBox("mdat", items...)...)
+}
+
+func fixtures(t *testing.T) map[Format][]byte {
+	return map[Format][]byte{
+		JPEG: jpegFixture(t),
+		PNG:  pngFixture(t),
+		WebP: webpFixture(t),
+		HEIC: heicFixture(t),
+	}
+}
+
+func TestStripLocation(t *testing.T) {
+	for format, data := range fixtures(t) {
+		t.Run(string(format), func(t *testing.T) {
+			if got, err := Sniff(data); err != nil || got != format {
+				t.Fatalf("sniffed %q (%v), want %q", got, err, format)
+			}
+			if err := Validate(data, format); err != nil {
+				t.Fatalf("fixture: %v", err)
+			}
+			if !hasGPS(data, format) {
+				t.Fatal("fixture has no GPS IFD")
+			}
+
+			out, err := StripLocation(data, format)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if err := Validate(out, format); err != nil {
+				t.Errorf("stripped photo doesn't decode: %v", err)
+			}
+			if format == HEIC && !bytes.Contains(out, []byte(heicImageData)) {
+				t.Error("stripped HEIC lost its image data")
+			}
+
+			if hasGPS(out, format) {
+				t.Error("IFD0 still points to a GPS IFD")
+			}
+			for _, order := range []binary.AppendByteOrder{binary.BigEndian, binary.LittleEndian} {
+				if bytes.Contains(out, order.AppendUint32(nil, latitudeSeconds)) {
+					t.Error("the GPS latitude is still in the file")
+				}
+			}
+			if bytes.Contains(out, []byte("GPSLatitude")) {
+				t.Error("the XMP location is still in the file")
+			}
+
+			if o := Orientation(out, format); o != 6 {
+				t.Errorf("got orientation %d, want 6", o)
+			}
+			if got, ok := TakenAt(out, format); !ok || !got.Equal(takenAt) {
+				t.Errorf("got DateTimeOriginal %v (%v), want %v", got, ok, takenAt)
+			}
+			if !bytes.Contains(out, []byte("Apple\x00")) {
+				t.Error("the EXIF Make is gone")
+			}
+
+			// Stripping twice changes nothing
+			again, err := StripLocation(out, format)
+			if err != nil || !bytes.Equal(again, out) {
+				t.Errorf("stripping again: %v, changed %v", err, !bytes.Equal(again, out))
+			}
+		})
+	}
+}
+
+// hasGPS reports whether IFD0 has a GPS IFD pointer.
+func hasGPS(data []byte, format Format) bool {
+	t, err := parseTIFF(findEXIF(data, format))
+	if err != nil {
+		return false
+	}
+	e, err := t.find(t.order.Uint32(t.b[4:]), tagGPSInfo)
+	return err == nil && e >= 0
+}
+
+func TestStripGPSKeepsIFD0(t *testing.T) {
+	for _, order := range []binary.AppendByteOrder{binary.BigEndian, binary.LittleEndian} {
+		b := makeEXIF(order)
+		if err := stripGPS(b); err != nil {
+			t.Fatal(err)
+		}
+
+		tf, err := parseTIFF(b)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ifd0 := tf.order.Uint32(b[4:])
+		start, n, err := tf.ifd(ifd0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n != 3 {
+			t.Errorf("%v: IFD0 has %d entries, want 3", order, n)
+		}
+		if next := tf.order.Uint32(b[start+2+n*ifdEntry:]); next != 0 {
+			t.Errorf("%v: IFD0's next IFD offset is %d, want 0", order, next)
+		}
+		for _, tag := range []uint16{0x010F, tagOrientation, tagExifIFD} {
+			if e, _ := tf.find(ifd0, tag); e < 0 {
+				t.Errorf("%v: tag %#04x is gone", order, tag)
+			}
+		}
+		if _, n, _ := tf.ifd(106); n != 0 {
+			t.Errorf("%v: GPS IFD has %d entries, want 0", order, n)
+		}
+	}
+}
+
+// TestMalformed feeds every prefix of each fixture, and each fixture
+// with every byte in turn set to 0xFF, to the functions uploads go
+// through. Errors are fine; panics are not.
+func TestMalformed(t *testing.T) {
+	try := func(t *testing.T, data []byte, format Format) {
+		defer func() {
+			if r := recover(); r != nil {
+				t.Fatalf("panic on %d bytes: %v", len(data), r)
+			}
+		}()
+
+		Sniff(data)
+		Orientation(data, format)
+		TakenAt(data, format)
+		if out, err := StripLocation(data, format); err == nil {
+			Validate(out, format)
+		}
+	}
+
+	for format, data := range fixtures(t) {
+		t.Run(string(format), func(t *testing.T) {
+			for i := range data {
+				try(t, data[:i], format)
+			}
+
+			for i := range data {
+				corrupt := bytes.Clone(data)
+				corrupt[i] = 0xFF
+				try(t, corrupt, format)
+			}
+		})
+	}
+
+	for _, order := range []binary.AppendByteOrder{binary.BigEndian, binary.LittleEndian} {
+		b := makeEXIF(order)
+		for i := range b {
+			stripGPS(bytes.Clone(b[:i]))
+
+			corrupt := bytes.Clone(b)
+			corrupt[i] = 0xFF
+			stripGPS(corrupt)
+		}
+	}
+}
+
+func TestMakeVariantsTurnsUpright(t *testing.T) {
+	for format, data := range fixtures(t) {
+		if format == HEIC || format == WebP {
+			continue
+		}
+
+		variants, err := MakeVariants(data, format)
+		if err != nil {
+			t.Fatalf("%s: %v", format, err)
+		}
+
+		cfg, err := jpeg.DecodeConfig(bytes.NewReader(variants[Thumbnail]))
+		if err != nil {
+			t.Fatalf("%s: %v", format, err)
+		}
+		if cfg.Width != 8 || cfg.Height != 16 {
+			t.Errorf("%s: got a %dx%d thumbnail, want 8x16", format, cfg.Width, cfg.Height)
+		}
+	}
+
+	if _, err := MakeVariants(heicFixture(t), HEIC); err != ErrNoDecoder {
+		t.Errorf("HEIC: got %v, want ErrNoDecoder", err)
+	}
+}
@@ -0,0 +1,128 @@
+package photos
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/jpeg"
+
+	"golang.org/x/image/draw"
+)
+
+// Variant names. The original variant is the uploaded photo without its
+// location, at full size.
+const (
+	Thumbnail = "thumbnail"
+	Medium    = "medium"
+	Original  = "original"
+)
+
+// Variant is a resized JPEG copy of a photo.
+type Variant struct {
+	Name    string
+	MaxSide int // longest side in pixels
+}
+
+// Variants are made largest first, each from the one before, which is
+// much faster than scaling every variant from the full-size photo.
+var Variants = []Variant{
+	{Name: Medium, MaxSide: 1280},
+	{Name: Thumbnail, MaxSide: 320},
+}
+
+const variantQuality = 82
+
+// ErrNoDecoder is returned for formats that can be stored but not
+// decoded, so have no variants.
+var ErrNoDecoder = errors.New("no decoder for this photo format")
+
+// MakeVariants decodes a photo, turns it upright according to its EXIF
+// orientation, and returns a JPEG for each of Variants, keyed by name.
+// Photos are never scaled up. The JPEGs carry no metadata.
+func MakeVariants(data []byte, format Format) (map[string][]byte, error) {
+	if format == HEIC {
+		return nil, ErrNoDecoder
+	}
+
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+
+	orientation := Orientation(data, format)
+	out := make(map[string][]byte, len(Variants))
+
+	for _, v := range Variants {
+		img = fit(img, v.MaxSide)
+
+		var buf bytes.Buffer
+		if err := jpeg.Encode(&buf, orient(img, orientation), &jpeg.Options{Quality: variantQuality}); err != nil {
+			return nil, err
+		}
+		out[v.Name] = buf.Bytes()
+	}
+
+	return out, nil
+}
+
+// fit scales img down so its longest side is at most maxSide.
+func fit(img image.Image, maxSide int) image.Image {
+	b := img.Bounds()
+	w, h := b.Dx(), b.Dy()
+	if w <= maxSide && h <= maxSide {
+		return img
+	}
+
+	if w >= h {
+		w, h = maxSide, max(1, h*maxSide/w)
+	} else {
+		w, h = max(1, w*maxSide/h), maxSide
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, w, h))
+	draw.CatmullRom.Scale(dst, dst.Bounds(), img, b, draw.Src, nil)
+	return dst
+}
+
+// orient applies an EXIF orientation (1-8) to img, so it displays
+// upright without the tag.
+func orient(img image.Image, orientation int) image.Image {
+	if orientation < 2 || orientation > 8 {
+		return img
+	}
+
+	b := img.Bounds()
+	w, h := b.Dx(), b.Dy()
+
+	// 5 to 8 are rotated a quarter turn, swapping width and height
+	dw, dh := w, h
+	if orientation >= 5 {
+		dw, dh = h, w
+	}
+	dst := image.NewRGBA(image.Rect(0, 0, dw, dh))
+
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			var dx, dy int
+			switch orientation {
+			case 2: // mirrored
+				dx, dy = w-1-x, y
+			case 3: // upside down
+				dx, dy = w-1-x, h-1-y
+			case 4: // upside down, mirrored
+				dx, dy = x, h-1-y
+			case 5: // mirrored, on its side
+				dx, dy = y, x
+			case 6: // needs a quarter turn clockwise
+				dx, dy = h-1-y, x
+			case 7: // mirrored, on its other side
+				dx, dy = h-1-y, w-1-x
+			case 8: // needs a quarter turn anticlockwise
+				dx, dy = y, w-1-x
+			}
+			dst.Set(dx, dy, img.At(b.Min.X+x, b.Min.Y+y))
+		}
+	}
+
+	return dst
+}
@@ -0,0 +1,114 @@
+package photos
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"testing"
+)
+
+func TestFit(t *testing.T) {
+	tests := []struct {
+		name         string
+		w, h         int
+		maxSide      int
+		wantW, wantH int
+	}{
+		{"landscape", 4000, 3000, 1280, 1280, 960},
+		{"portrait", 3000, 4000, 320, 240, 320},
+		{"square", 2000, 2000, 320, 320, 320},
+		{"smaller than the variant", 200, 100, 320, 200, 100},
+		{"exactly the variant", 320, 50, 320, 320, 50},
+		{"panorama keeps a pixel", 10000, 10, 320, 320, 1},
+	}
+
+	for _, tt := range tests {
+		got := fit(image.NewRGBA(image.Rect(0, 0, tt.w, tt.h)), tt.maxSide).Bounds()
+		if got.Dx() != tt.wantW || got.Dy() != tt.wantH {
+			t.Errorf("%s: got %dx%d, want %dx%d", tt.name, got.Dx(), got.Dy(), tt.wantW, tt.wantH)
+		}
+	}
+}
+
+// TestOrient marks two pixels of the top row of a 3x2 image and checks
+// where each orientation moves them.
+func TestOrient(t *testing.T) {
+	red := color.RGBA{255, 0, 0, 255}
+	green := color.RGBA{0, 255, 0, 255}
+
+	src := image.NewRGBA(image.Rect(0, 0, 3, 2))
+	src.Set(0, 0, red)
+	src.Set(1, 0, green)
+
+	tests := []struct {
+		orientation    int
+		w, h           int
+		redAt, greenAt image.Point
+	}{
+		{1, 3, 2, image.Pt(0, 0), image.Pt(1, 0)},
+		{2, 3, 2, image.Pt(2, 0), image.Pt(1, 0)},
+		{3, 3, 2, image.Pt(2, 1), image.Pt(1, 1)},
+		{4, 3, 2, image.Pt(0, 1), image.Pt(1, 1)},
+		{5, 2, 3, image.Pt(0, 0), image.Pt(0, 1)},
+		{6, 2, 3, image.Pt(1, 0), image.Pt(1, 1)},
+		{7, 2, 3, image.Pt(1, 2), image.Pt(1, 1)},
+		{8, 2, 3, image.Pt(0, 2), image.Pt(0, 1)},
+		{0, 3, 2, image.Pt(0, 0), image.Pt(1, 0)}, // missing
+		{9, 3, 2, image.Pt(0, 0), image.Pt(1, 0)}, // out of range
+	}
+
+	for _, tt := range tests {
+		got := orient(src, tt.orientation)
+		if b := got.Bounds(); b.Dx() != tt.w || b.Dy() != tt.h {
+			t.Errorf("orientation %d: got %dx%d, want %dx%d", tt.orientation, b.Dx(), b.Dy(), tt.w, tt.h)
+			continue
+		}
+		if c := color.RGBAModel.Convert(got.At(tt.redAt.X, tt.redAt.Y)); c != red {
+			t.Errorf("orientation %d: red pixel isn't at %v", tt.orientation, tt.redAt)
+		}
+		if c := color.RGBAModel.Convert(got.At(tt.greenAt.X, tt.greenAt.Y)); c != green {
+			t.Errorf("orientation %d: green pixel isn't at %v", tt.orientation, tt.greenAt)
+		}
+	}
+}
+
+func TestMakeVariantsSizes(t *testing.T) {
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, image.NewRGBA(image.Rect(0, 0, 2000, 1500)), nil); err != nil {
+		t.Fatal(err)
+	}
+
+	variants, err := MakeVariants(buf.Bytes(), JPEG)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(variants) != len(Variants) {
+		t.Errorf("got %d variants, want %d", len(variants), len(Variants))
+	}
+
+	for _, v := range Variants {
+		cfg, err := jpeg.DecodeConfig(bytes.NewReader(variants[v.Name]))
+		if err != nil {
+			t.Fatalf("%s: %v", v.Name, err)
+		}
+		if cfg.Width != v.MaxSide || cfg.Height != v.MaxSide*3/4 {
+			t.Errorf("%s: got %dx%d, want %d wide", v.Name, cfg.Width, cfg.Height, v.MaxSide)
+		}
+	}
+
+	// Variants are re-encoded without the original's metadata
+	variants, err = MakeVariants(jpegFixture(t), JPEG)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, data := range variants {
+		if findEXIF(data, JPEG) != nil {
+			t.Errorf("%s variant has EXIF data", name)
+		}
+	}
+
+	if _, err := MakeVariants([]byte("not a photo"), JPEG); err == nil {
+		t.Error("got no error for a photo that doesn't decode")
+	}
+}
@@ -0,0 +1,149 @@
+package queue
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+type TaskResponse struct {
+	ID          uuid.UUID       `json:"id"`
+	Kind        string          `json:"kind"`
+	Payload     json.RawMessage `json:"payload"`
+	Status      string          `json:"status"`
+	Attempts    int             `json:"attempts"`
+	MaxAttempts int             `json:"max_attempts"`
+	RunAt       string          `json:"run_at"`
+	LastError   string          `json:"last_error"`
+	CreatedAt   string          `json:"created_at"`
+	UpdatedAt   string          `json:"updated_at"`
+}
+
+const taskColumns = `id, kind, payload, status, attempts, max_attempts, run_at, COALESCE(last_error, ''), created_at, updated_at`
+
+func scanTask(row pgx.Row) (TaskResponse, error) {
+	var t TaskResponse
+	var runAt, createdAt, updatedAt time.Time
+
+	err := row.Scan(&t.ID, &t.Kind, &t.Payload, &t.Status, &t.Attempts, &t.MaxAttempts, &runAt, &t.LastError, &createdAt, &updatedAt)
+
+	t.RunAt = runAt.Format(time.RFC3339)
+	t.CreatedAt = createdAt.Format(time.RFC3339)
+	t.UpdatedAt = updatedAt.Format(time.RFC3339)
+
+	return t, err
+}
+
+// ListTasksHandler lists the most recent tasks, optionally filtered by
+// ?status= and ?kind=.
+func ListTasksHandler(db *pgxpool.Pool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := context.Background()
+
+		rows, err := db.Query(ctx,
+			`SELECT `+taskColumns+` FROM tasks
+             WHERE ($1 = '' OR status = $1) AND ($2 = '' OR kind = $2)
+             ORDER BY updated_at DESC
+             LIMIT 200`,
+			r.URL.Query().Get("status"),
+			r.URL.Query().Get("kind"),
+		)
+		if err != nil {
+			http.Error(w, "failed to query tasks: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		defer rows.Close()
+
+		tasks := []TaskResponse{}
+		for rows.Next() {
+			t, err := scanTask(rows)
+			if err != nil {
+				http.Error(w, "scan error: "+err.Error(), http.StatusInternalServerError)
+				return
+			}
+			tasks = append(tasks, t)
+		}
+
+		json.NewEncoder(w).Encode(tasks)
+	}
+}
+
+// RetryTaskHandler puts a dead or pending task back on the queue to run
+// now, with a fresh set of attempts.
+func RetryTaskHandler(db *pgxpool.Pool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		taskID, err := uuid.Parse(chi.URLParam(r, "id"))
+		if err != nil {
+			http.Error(w, "invalid task id", http.StatusBadRequest)
+			return
+		}
+
+		ctx := context.Background()
+
+		task, err := scanTask(db.QueryRow(ctx,
+			`UPDATE tasks
+             SET status = $1, attempts = 0, run_at = NOW(), updated_at = NOW()
+             WHERE id = $2 AND status IN ($1, $3)
+             RETURNING `+taskColumns,
+			StatusPending,
+			taskID,
+			StatusDead,
+		))
+
+		if errors.Is(err, pgx.ErrNoRows) {
+			http.Error(w, "task not found or not retryable", http.StatusConflict)
+			return
+		}
+
+		if err != nil {
+			http.Error(w, "failed to retry task: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		json.NewEncoder(w).Encode(task)
+	}
+}
+
+// CancelTaskHandler stops a pending or dead task from ever running. A
+// running task can't be cancelled.
+func CancelTaskHandler(db *pgxpool.Pool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		taskID, err := uuid.Parse(chi.URLParam(r, "id"))
+		if err != nil {
+			http.Error(w, "invalid task id", http.StatusBadRequest)
+			return
+		}
+
+		ctx := context.Background()
+
+		task, err := scanTask(db.QueryRow(ctx,
+			`UPDATE tasks
+             SET status = $1, updated_at = NOW()
+             WHERE id = $2 AND status IN ($3, $4)
+             RETURNING `+taskColumns,
+			StatusCancelled,
+			taskID,
+			StatusPending,
+			StatusDead,
+		))
+
+		if errors.Is(err, pgx.ErrNoRows) {
+			http.Error(w, "task not found or not cancellable", http.StatusConflict)
+			return
+		}
+
+		if err != nil {
+			http.Error(w, "failed to cancel task: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		json.NewEncoder(w).Encode(task)
+	}
+}
@@ -0,0 +1,154 @@
+package queue
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+func adminRouter(db *pgxpool.Pool) chi.Router {
+	r := chi.NewRouter()
+	r.Get("/admin/tasks", ListTasksHandler(db))
+	r.Post("/admin/tasks/{id}/retry", RetryTaskHandler(db))
+	r.Post("/admin/tasks/{id}/cancel", CancelTaskHandler(db))
+	return r
+}
+
+func post(r http.Handler, url string) *httptest.ResponseRecorder {
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, url, nil))
+	return rec
+}
+
+func setStatus(t *testing.T, db *pgxpool.Pool, id uuid.UUID, status string, attempts int) {
+	t.Helper()
+	_, err := db.Exec(context.Background(),
+		`UPDATE tasks SET status = $1, attempts = $2, last_error = 'boom' WHERE id = $3`,
+		status, attempts, id,
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestListTasksByStatus(t *testing.T) {
+	db := testDB(t)
+	r := adminRouter(db)
+
+	dead := enqueue(t, db, "test.admin", nil)
+	enqueue(t, db, "test.admin", nil)
+	setStatus(t, db, dead, StatusDead, 8)
+
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/admin/tasks?status=dead", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("list: %d %s", rec.Code, rec.Body)
+	}
+
+	var tasks []TaskResponse
+	if err := json.NewDecoder(rec.Body).Decode(&tasks); err != nil {
+		t.Fatal(err)
+	}
+	if len(tasks) != 1 || tasks[0].ID != dead || tasks[0].LastError != "boom" {
+		t.Errorf("got %+v, want only the dead task", tasks)
+	}
+}
+
+func TestRetryTask(t *testing.T) {
+	db := testDB(t)
+	r := adminRouter(db)
+
+	dead := enqueue(t, db, "test.admin", nil)
+	setStatus(t, db, dead, StatusDead, 8)
+
+	rec := post(r, "/admin/tasks/"+dead.String()+"/retry")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("retry: %d %s", rec.Code, rec.Body)
+	}
+	var task TaskResponse
+	json.NewDecoder(rec.Body).Decode(&task)
+	if task.Status != StatusPending || task.Attempts != 0 {
+		t.Errorf("got %s with %d attempts, want pending with 0", task.Status, task.Attempts)
+	}
+
+	// The worker picks it up again
+	w := NewWorker(db, 1)
+	w.Handle("test.admin", func(ctx context.Context, payload json.RawMessage) error { return nil })
+	if !runOne(t, w, "test.admin") {
+		t.Fatal("retried task wasn't claimed")
+	}
+	if s := loadTask(t, db, dead); s.Status != StatusDone {
+		t.Errorf("got %s, want done", s.Status)
+	}
+
+	tests := []struct {
+		name   string
+		status string
+		want   int
+	}{
+		{"done", StatusDone, http.StatusConflict},
+		{"running", StatusRunning, http.StatusConflict},
+		{"cancelled", StatusCancelled, http.StatusConflict},
+	}
+	for _, tt := range tests {
+		id := enqueue(t, db, "test.admin", nil)
+		setStatus(t, db, id, tt.status, 1)
+		if rec := post(r, "/admin/tasks/"+id.String()+"/retry"); rec.Code != tt.want {
+			t.Errorf("retry %s task: got status %d, want %d", tt.name, rec.Code, tt.want)
+		}
+	}
+
+	if rec := post(r, "/admin/tasks/not-a-uuid/retry"); rec.Code != http.StatusBadRequest {
+		t.Errorf("bad id: got status %d, want 400", rec.Code)
+	}
+}
+
+func TestCancelTask(t *testing.T) {
+	db := testDB(t)
+	r := adminRouter(db)
+
+	pending := enqueue(t, db, "test.admin", nil)
+
+	rec := post(r, "/admin/tasks/"+pending.String()+"/cancel")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("cancel: %d %s", rec.Code, rec.Body)
+	}
+	var task TaskResponse
+	json.NewDecoder(rec.Body).Decode(&task)
+	if task.Status != StatusCancelled {
+		t.Errorf("got %s, want cancelled", task.Status)
+	}
+
+	// A cancelled task is never claimed
+	w := NewWorker(db, 1)
+	w.Handle("test.admin", func(ctx context.Context, payload json.RawMessage) error {
+		t.Error("cancelled task ran")
+		return nil
+	})
+	if runOne(t, w, "test.admin") {
+		t.Error("a cancelled task was claimed")
+	}
+
+	tests := []struct {
+		name   string
+		status string
+		want   int
+	}{
+		{"dead", StatusDead, http.StatusOK},
+		{"running", StatusRunning, http.StatusConflict},
+		{"done", StatusDone, http.StatusConflict},
+	}
+	for _, tt := range tests {
+		id := enqueue(t, db, "test.admin", nil)
+		setStatus(t, db, id, tt.status, 1)
+		if rec := post(r, "/admin/tasks/"+id.String()+"/cancel"); rec.Code != tt.want {
+			t.Errorf("cancel %s task: got status %d, want %d", tt.name, rec.Code, tt.want)
+		}
+	}
+}
@@ -0,0 +1,292 @@
+package queue
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// Task statuses
+const (
+	StatusPending   = "pending"
+	StatusRunning   = "running"
+	StatusDone      = "done"
+	StatusDead      = "dead"      // gave up after max_attempts, or a permanent error
+	StatusCancelled = "cancelled" // cancelled from the admin endpoint; never run
+)
+
+const defaultMaxAttempts = 8
+
+// staleAfter is how long a task may stay running before it is assumed
+// its worker died and it is handed out again.
+const staleAfter = 15 * time.Minute
+
+// HandlerFunc does the work for one task. Returning an error schedules a
+// retry; wrap it with Permanent to dead-letter the task straight away.
+type HandlerFunc func(ctx context.Context, payload json.RawMessage) error
+
+// Execer is satisfied by *pgxpool.Pool and pgx.Tx, so tasks can be
+// enqueued in the same transaction as the rows they refer to.
+type Execer interface {
+	Exec(ctx context.Context, sql string, args ...any) (pgconn.CommandTag, error)
+}
+
+// Enqueue adds a task to run as soon as a worker is free.
+func Enqueue(ctx context.Context, db Execer, kind string, payload any) (uuid.UUID, error) {
+	return EnqueueAt(ctx, db, kind, payload, time.Now())
+}
+
+// EnqueueAt adds a task that will not run before runAt.
+func EnqueueAt(ctx context.Context, db Execer, kind string, payload any, runAt time.Time) (uuid.UUID, error) {
+	payloadJSON, err := json.Marshal(payload)
+	if err != nil {
+		return uuid.Nil, fmt.Errorf("cannot encode task payload: %w", err)
+	}
+
+	taskID := uuid.New()
+
+	_, err = db.Exec(ctx,
+		`INSERT INTO tasks (id, kind, payload, status, attempts, max_attempts, run_at, created_at, updated_at)
+         VALUES ($1, $2, $3, $4, 0, $5, $6, NOW(), NOW())`,
+		taskID,
+		kind,
+		payloadJSON,
+		StatusPending,
+		defaultMaxAttempts,
+		runAt,
+	)
+	if err != nil {
+		return uuid.Nil, fmt.Errorf("failed to enqueue %s task: %w", kind, err)
+	}
+
+	return taskID, nil
+}
+
+type permanentError struct{ err error }
+
+func (p permanentError) Error() string { return p.err.Error() }
+func (p permanentError) Unwrap() error { return p.err }
+
+// Permanent marks an error that retrying cannot fix, such as a missing row.
+func Permanent(err error) error {
+	return permanentError{err}
+}
+
+// Backoff is the delay before retry number attempt: 10s, 20s, 40s, ...
+// capped at one hour.
+func Backoff(attempt int) time.Duration {
+	if attempt < 1 {
+		attempt = 1
+	}
+	if attempt > 10 {
+		return time.Hour
+	}
+	d := 10 * time.Second << (attempt - 1)
+	if d > time.Hour {
+		return time.Hour
+	}
+	return d
+}
+
+// Worker claims tasks with SELECT ... FOR UPDATE SKIP LOCKED, so any
+// number of workers, in-process or in cmd/worker, can share the table.
+type Worker struct {
+	db           *pgxpool.Pool
+	handlers     map[string]HandlerFunc
+	concurrency  int
+	pollInterval time.Duration
+}
+
+func NewWorker(db *pgxpool.Pool, concurrency int) *Worker {
+	if concurrency < 1 {
+		concurrency = 1
+	}
+
+	return &Worker{
+		db:           db,
+		handlers:     map[string]HandlerFunc{},
+		concurrency:  concurrency,
+		pollInterval: time.Second,
+	}
+}
+
+// Handle registers the handler for a task kind. Only registered kinds
+// are claimed by this worker.
+func (w *Worker) Handle(kind string, fn HandlerFunc) {
+	w.handlers[kind] = fn
+}
+
+// Run processes tasks until ctx is cancelled, then waits for running
+// tasks to finish.
+func (w *Worker) Run(ctx context.Context) {
+	kinds := make([]string, 0, len(w.handlers))
+	for kind := range w.handlers {
+		kinds = append(kinds, kind)
+	}
+
+	log.Printf("worker: started %d goroutine(s) for %v", w.concurrency, kinds)
+
+	var wg sync.WaitGroup
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		w.reapStale(ctx)
+	}()
+
+	for i := 0; i < w.concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			w.loop(ctx, kinds)
+		}()
+	}
+
+	wg.Wait()
+}
+
+func (w *Worker) loop(ctx context.Context, kinds []string) {
+	for {
+		worked, err := w.runOne(ctx, kinds)
+		if err != nil && ctx.Err() == nil {
+			log.Printf("worker: %v", err)
+		}
+
+		if worked {
+			continue
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(w.pollInterval):
+		}
+	}
+}
+
+// runOne claims and runs a single task. It reports whether there was a
+// task to run.
+func (w *Worker) runOne(ctx context.Context, kinds []string) (bool, error) {
+	var taskID uuid.UUID
+	var kind string
+	var payload json.RawMessage
+	var attempts, maxAttempts int
+
+	// 1️⃣ Claim the oldest due task nobody else holds
+	err := w.db.QueryRow(ctx,
+		`UPDATE tasks
+         SET status = $1, attempts = attempts + 1, locked_at = NOW(), updated_at = NOW()
+         WHERE id = (
+             SELECT id FROM tasks
+             WHERE status = $2 AND run_at <= NOW() AND kind = ANY($3)
+             ORDER BY run_at
+             FOR UPDATE SKIP LOCKED
+             LIMIT 1
+         )
+         RETURNING id, kind, payload, attempts, max_attempts`,
+		StatusRunning,
+		StatusPending,
+		kinds,
+	).Scan(&taskID, &kind, &payload, &attempts, &maxAttempts)
+
+	if errors.Is(err, pgx.ErrNoRows) {
+		return false, nil
+	}
+
+	if err != nil {
+		return false, fmt.Errorf("failed to claim task: %w", err)
+	}
+
+	// 2️⃣ Run it, turning panics into failures
+	runErr := w.call(ctx, kind, payload)
+
+	// 3️⃣ Record the outcome
+	switch {
+	case runErr == nil:
+		_, err = w.db.Exec(context.Background(),
+			`UPDATE tasks SET status = $1, last_error = NULL, locked_at = NULL, updated_at = NOW() WHERE id = $2`,
+			StatusDone,
+			taskID,
+		)
+
+	case errors.As(runErr, new(permanentError)) || attempts >= maxAttempts:
+		log.Printf("worker: %s task %s dead after %d attempt(s): %v", kind, taskID, attempts, runErr)
+		_, err = w.db.Exec(context.Background(),
+			`UPDATE tasks SET status = $1, last_error = $2, locked_at = NULL, updated_at = NOW() WHERE id = $3`,
+			StatusDead,
+			runErr.Error(),
+			taskID,
+		)
+
+	default:
+		_, err = w.db.Exec(context.Background(),
+			`UPDATE tasks
+             SET status = $1, last_error = $2, run_at = NOW() + $3 * INTERVAL '1 second', locked_at = NULL, updated_at = NOW()
+             WHERE id = $4`,
+			StatusPending,
+			runErr.Error(),
+			Backoff(attempts).Seconds(),
+			taskID,
+		)
+	}
+
+	if err != nil {
+		return true, fmt.Errorf("failed to record %s task %s result: %w", kind, taskID, err)
+	}
+
+	return true, nil
+}
+
+func (w *Worker) call(ctx context.Context, kind string, payload json.RawMessage) (err error) {
+	defer func() {
+		if p := recover(); p != nil {
+			err = fmt.Errorf("panic: %v", p)
+		}
+	}()
+
+	return w.handlers[kind](ctx, payload)
+}
+
+// reapStale hands out again tasks that have been running for longer than
+// staleAfter, e.g. because the process was killed mid-task.
+func (w *Worker) reapStale(ctx context.Context) {
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		if err := w.reap(ctx); err != nil && ctx.Err() == nil {
+			log.Printf("worker: failed to reap stale tasks: %v", err)
+		}
+	}
+}
+
+// reap puts tasks whose lease has expired back on the queue, or
+// dead-letters them if they have no attempts left.
+func (w *Worker) reap(ctx context.Context) error {
+	_, err := w.db.Exec(ctx,
+		`UPDATE tasks
+         SET status = CASE WHEN attempts >= max_attempts THEN $1 ELSE $2 END,
+             last_error = 'worker stopped before finishing', locked_at = NULL, updated_at = NOW()
+         WHERE status = $3 AND locked_at < NOW() - $4 * INTERVAL '1 second'`,
+		StatusDead,
+		StatusPending,
+		StatusRunning,
+		staleAfter.Seconds(),
+	)
+	return err
+}
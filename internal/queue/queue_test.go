@@ -0,0 +1,285 @@
+package queue
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+func TestBackoff(t *testing.T) {
+	tests := []struct {
+		attempt int
+		want    time.Duration
+	}{
+		{0, 10 * time.Second},
+		{1, 10 * time.Second},
+		{2, 20 * time.Second},
+		{3, 40 * time.Second},
+		{9, 2560 * time.Second},
+		{10, time.Hour},
+		{50, time.Hour},
+	}
+
+	for _, tt := range tests {
+		if got := Backoff(tt.attempt); got != tt.want {
+			t.Errorf("Backoff(%d) = %v, want %v", tt.attempt, got, tt.want)
+		}
+	}
+}
+
+// taskState is a task's row, as the worker left it.
+type taskState struct {
+	Status    string
+	Attempts  int
+	LastError string
+	DueIn     time.Duration // run_at less now
+}
+
+func loadTask(t *testing.T, db *pgxpool.Pool, id uuid.UUID) taskState {
+	t.Helper()
+
+	var s taskState
+	var dueIn float64
+	err := db.QueryRow(context.Background(),
+		`SELECT status, attempts, COALESCE(last_error, ''), EXTRACT(EPOCH FROM run_at - NOW())::float8
+         FROM tasks WHERE id = $1`,
+		id,
+	).Scan(&s.Status, &s.Attempts, &s.LastError, &dueIn)
+	if err != nil {
+		t.Fatalf("load task: %v", err)
+	}
+	s.DueIn = time.Duration(dueIn * float64(time.Second))
+	return s
+}
+
+// makeDue moves a task's retry forward to now.
+func makeDue(t *testing.T, db *pgxpool.Pool, id uuid.UUID) {
+	t.Helper()
+	if _, err := db.Exec(context.Background(), `UPDATE tasks SET run_at = NOW() WHERE id = $1`, id); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func enqueue(t *testing.T, db *pgxpool.Pool, kind string, payload any) uuid.UUID {
+	t.Helper()
+	id, err := Enqueue(context.Background(), db, kind, payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return id
+}
+
+func runOne(t *testing.T, w *Worker, kind string) bool {
+	t.Helper()
+	worked, err := w.runOne(context.Background(), []string{kind})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return worked
+}
+
+// TestClaimSkipsLockedTasks runs two workers at once on two tasks whose
+// handler blocks. Each must claim a different task, and a third claim
+// must find nothing.
+func TestClaimSkipsLockedTasks(t *testing.T) {
+	db := testDB(t)
+
+	started := make(chan int, 2)
+	release := make(chan struct{})
+	handler := func(ctx context.Context, payload json.RawMessage) error {
+		var n int
+		json.Unmarshal(payload, &n)
+		started <- n
+		<-release
+		return nil
+	}
+
+	first := enqueue(t, db, "test.block", 1)
+	second := enqueue(t, db, "test.block", 2)
+
+	done := make(chan error, 2)
+	for i := 0; i < 2; i++ {
+		w := NewWorker(db, 1)
+		w.Handle("test.block", handler)
+		go func() {
+			_, err := w.runOne(context.Background(), []string{"test.block"})
+			done <- err
+		}()
+	}
+
+	claimed := map[int]bool{}
+	for i := 0; i < 2; i++ {
+		select {
+		case n := <-started:
+			claimed[n] = true
+		case <-time.After(10 * time.Second):
+			t.Fatal("both workers didn't start a task")
+		}
+	}
+	if !claimed[1] || !claimed[2] {
+		t.Errorf("workers claimed %v, want tasks 1 and 2", claimed)
+	}
+
+	idle := NewWorker(db, 1)
+	idle.Handle("test.block", handler)
+	if runOne(t, idle, "test.block") {
+		t.Error("a third worker claimed a task that was already running")
+	}
+
+	close(release)
+	for i := 0; i < 2; i++ {
+		if err := <-done; err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, id := range []uuid.UUID{first, second} {
+		if s := loadTask(t, db, id); s.Status != StatusDone || s.Attempts != 1 {
+			t.Errorf("task %s: got %s after %d attempt(s), want done after 1", id, s.Status, s.Attempts)
+		}
+	}
+}
+
+func TestRetryBackoff(t *testing.T) {
+	db := testDB(t)
+
+	w := NewWorker(db, 1)
+	w.Handle("test.fail", func(ctx context.Context, payload json.RawMessage) error {
+		return errors.New("mail server unavailable")
+	})
+
+	id := enqueue(t, db, "test.fail", nil)
+
+	for attempt := 1; attempt <= 3; attempt++ {
+		if !runOne(t, w, "test.fail") {
+			t.Fatalf("attempt %d: no task claimed", attempt)
+		}
+
+		s := loadTask(t, db, id)
+		if s.Status != StatusPending || s.Attempts != attempt || s.LastError != "mail server unavailable" {
+			t.Fatalf("attempt %d: got %+v", attempt, s)
+		}
+
+		want := Backoff(attempt)
+		if s.DueIn < want-5*time.Second || s.DueIn > want+time.Second {
+			t.Errorf("attempt %d: retry due in %v, want about %v", attempt, s.DueIn, want)
+		}
+
+		// Not due yet
+		if runOne(t, w, "test.fail") {
+			t.Fatalf("attempt %d: task ran again before its backoff", attempt)
+		}
+		makeDue(t, db, id)
+	}
+}
+
+func TestDeadAfterMaxAttempts(t *testing.T) {
+	db := testDB(t)
+
+	w := NewWorker(db, 1)
+	w.Handle("test.fail", func(ctx context.Context, payload json.RawMessage) error {
+		return errors.New("still failing")
+	})
+
+	id := enqueue(t, db, "test.fail", nil)
+	if _, err := db.Exec(context.Background(), `UPDATE tasks SET max_attempts = 3 WHERE id = $1`, id); err != nil {
+		t.Fatal(err)
+	}
+
+	for attempt := 1; attempt <= 3; attempt++ {
+		makeDue(t, db, id)
+		if !runOne(t, w, "test.fail") {
+			t.Fatalf("attempt %d: no task claimed", attempt)
+		}
+	}
+
+	if s := loadTask(t, db, id); s.Status != StatusDead || s.Attempts != 3 {
+		t.Errorf("got %s after %d attempts, want dead after 3", s.Status, s.Attempts)
+	}
+
+	makeDue(t, db, id)
+	if runOne(t, w, "test.fail") {
+		t.Error("a dead task was claimed")
+	}
+}
+
+func TestPermanentErrorSkipsRetries(t *testing.T) {
+	db := testDB(t)
+
+	w := NewWorker(db, 1)
+	w.Handle("test.permanent", func(ctx context.Context, payload json.RawMessage) error {
+		return Permanent(errors.New("invoice not found"))
+	})
+
+	id := enqueue(t, db, "test.permanent", nil)
+	runOne(t, w, "test.permanent")
+
+	if s := loadTask(t, db, id); s.Status != StatusDead || s.Attempts != 1 || s.LastError != "invoice not found" {
+		t.Errorf("got %+v, want dead after 1 attempt", s)
+	}
+}
+
+func TestPanicIsRetried(t *testing.T) {
+	db := testDB(t)
+
+	w := NewWorker(db, 1)
+	w.Handle("test.panic", func(ctx context.Context, payload json.RawMessage) error {
+		panic("nil map")
+	})
+
+	id := enqueue(t, db, "test.panic", nil)
+	runOne(t, w, "test.panic")
+
+	if s := loadTask(t, db, id); s.Status != StatusPending || s.LastError != "panic: nil map" {
+		t.Errorf("got %+v, want a pending retry", s)
+	}
+}
+
+func TestReapExpiredLeases(t *testing.T) {
+	db := testDB(t)
+	ctx := context.Background()
+
+	stale := enqueue(t, db, "test.reap", nil)
+	exhausted := enqueue(t, db, "test.reap", nil)
+	fresh := enqueue(t, db, "test.reap", nil)
+
+	_, err := db.Exec(ctx,
+		`UPDATE tasks SET status = $1, attempts = 1, locked_at = NOW() - $2 * INTERVAL '1 second' WHERE id = ANY($3)`,
+		StatusRunning,
+		(staleAfter + time.Minute).Seconds(),
+		[]uuid.UUID{stale, exhausted},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Exec(ctx, `UPDATE tasks SET max_attempts = 1 WHERE id = $1`, exhausted); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Exec(ctx, `UPDATE tasks SET status = $1, attempts = 1, locked_at = NOW() WHERE id = $2`, StatusRunning, fresh); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := NewWorker(db, 1).reap(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		id   uuid.UUID
+		want string
+	}{
+		{"expired lease", stale, StatusPending},
+		{"expired lease, no attempts left", exhausted, StatusDead},
+		{"lease still held", fresh, StatusRunning},
+	}
+	for _, tt := range tests {
+		if s := loadTask(t, db, tt.id); s.Status != tt.want {
+			t.Errorf("%s: got %s, want %s", tt.name, s.Status, tt.want)
+		}
+	}
+}
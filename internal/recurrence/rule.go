@@ -0,0 +1,203 @@
+package recurrence
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Rule is the subset of an iCalendar RRULE we support, e.g.
+// "FREQ=MONTHLY;INTERVAL=6;BYMONTHDAY=1;COUNT=4".
+type Rule struct {
+	Freq       string    // DAILY, WEEKLY, MONTHLY or YEARLY
+	Interval   int       // every N periods, default 1
+	ByMonthDay int       // MONTHLY/YEARLY only; 0 keeps the start day, -1 is the last day
+	Until      time.Time // zero: no end date
+	Count      int       // 0: no limit
+}
+
+// maxIterations guards against rules that never produce an occurrence.
+const maxIterations = 10000
+
+func Parse(s string) (Rule, error) {
+	r := Rule{Interval: 1}
+
+	for _, part := range strings.Split(strings.TrimPrefix(s, "RRULE:"), ";") {
+		if part == "" {
+			continue
+		}
+
+		key, value, ok := strings.Cut(part, "=")
+		if !ok {
+			return r, fmt.Errorf("invalid rule part %q", part)
+		}
+
+		var err error
+		switch strings.ToUpper(key) {
+		case "FREQ":
+			r.Freq = strings.ToUpper(value)
+		case "INTERVAL":
+			r.Interval, err = strconv.Atoi(value)
+		case "BYMONTHDAY":
+			r.ByMonthDay, err = strconv.Atoi(value)
+		case "COUNT":
+			r.Count, err = strconv.Atoi(value)
+		case "UNTIL":
+			r.Until, err = parseUntil(value)
+		default:
+			return r, fmt.Errorf("unsupported rule part %s", key)
+		}
+
+		if err != nil {
+			return r, fmt.Errorf("invalid %s: %w", key, err)
+		}
+	}
+
+	return r, r.Validate()
+}
+
+func parseUntil(value string) (time.Time, error) {
+	for _, layout := range []string{"20060102T150405Z", "20060102", "2006-01-02"} {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("unrecognised date %q", value)
+}
+
+func (r Rule) Validate() error {
+	switch r.Freq {
+	case "DAILY", "WEEKLY", "MONTHLY", "YEARLY":
+	default:
+		return fmt.Errorf("FREQ must be DAILY, WEEKLY, MONTHLY or YEARLY")
+	}
+
+	if r.Interval < 1 {
+		return fmt.Errorf("INTERVAL must be at least 1")
+	}
+
+	if r.ByMonthDay != 0 {
+		if r.Freq != "MONTHLY" && r.Freq != "YEARLY" {
+			return fmt.Errorf("BYMONTHDAY only applies to MONTHLY and YEARLY rules")
+		}
+		if r.ByMonthDay < -1 || r.ByMonthDay > 31 {
+			return fmt.Errorf("BYMONTHDAY must be between 1 and 31, or -1")
+		}
+	}
+
+	if r.Count < 0 {
+		return fmt.Errorf("COUNT cannot be negative")
+	}
+
+	return nil
+}
+
+func (r Rule) String() string {
+	parts := []string{"FREQ=" + r.Freq}
+	if r.Interval > 1 {
+		parts = append(parts, "INTERVAL="+strconv.Itoa(r.Interval))
+	}
+	if r.ByMonthDay != 0 {
+		parts = append(parts, "BYMONTHDAY="+strconv.Itoa(r.ByMonthDay))
+	}
+	if !r.Until.IsZero() {
+		parts = append(parts, "UNTIL="+r.Until.UTC().Format("20060102T150405Z"))
+	}
+	if r.Count > 0 {
+		parts = append(parts, "COUNT="+strconv.Itoa(r.Count))
+	}
+	return strings.Join(parts, ";")
+}
+
+// candidate returns the k-th period's date, keeping the start's time of day.
+// Month-based rules clamp the day to the length of the month.
+func (r Rule) candidate(start time.Time, k int) time.Time {
+	step := k * r.Interval
+
+	switch r.Freq {
+	case "DAILY":
+		return start.AddDate(0, 0, step)
+	case "WEEKLY":
+		return start.AddDate(0, 0, 7*step)
+	}
+
+	months := step
+	if r.Freq == "YEARLY" {
+		months = 12 * step
+	}
+
+	first := time.Date(start.Year(), start.Month(), 1, start.Hour(), start.Minute(), start.Second(), 0, start.Location())
+	first = first.AddDate(0, months, 0)
+	lastDay := first.AddDate(0, 1, -1).Day()
+
+	day := start.Day()
+	if r.ByMonthDay == -1 {
+		day = lastDay
+	} else if r.ByMonthDay > 0 {
+		day = r.ByMonthDay
+	}
+	if day > lastDay {
+		day = lastDay
+	}
+
+	return first.AddDate(0, 0, day-1)
+}
+
+// Between returns the occurrences of a rule starting at start that fall
+// in [from, to]. Occurrences before start are never produced, and Count
+// and Until are always measured from start.
+func (r Rule) Between(start, from, to time.Time) []time.Time {
+	occurrences := []time.Time{}
+	emitted := 0
+
+	for k := 0; k < maxIterations; k++ {
+		t := r.candidate(start, k)
+		if t.Before(start) {
+			continue
+		}
+
+		if t.After(to) || (!r.Until.IsZero() && t.After(r.Until)) {
+			break
+		}
+
+		emitted++
+		if r.Count > 0 && emitted > r.Count {
+			break
+		}
+
+		if !t.Before(from) {
+			occurrences = append(occurrences, t)
+		}
+	}
+
+	return occurrences
+}
+
+// Next returns up to n occurrences at or after from.
+func (r Rule) Next(start, from time.Time, n int) []time.Time {
+	occurrences := []time.Time{}
+	emitted := 0
+
+	for k := 0; k < maxIterations && len(occurrences) < n; k++ {
+		t := r.candidate(start, k)
+		if t.Before(start) {
+			continue
+		}
+
+		if !r.Until.IsZero() && t.After(r.Until) {
+			break
+		}
+
+		emitted++
+		if r.Count > 0 && emitted > r.Count {
+			break
+		}
+
+		if !t.Before(from) {
+			occurrences = append(occurrences, t)
+		}
+	}
+
+	return occurrences
+}
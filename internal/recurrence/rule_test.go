@@ -0,0 +1,292 @@
+package recurrence
+
+import (
+	"testing"
+	"time"
+	_ "time/tzdata" // Europe/London on machines without a zone database
+)
+
+func date(y int, m time.Month, d int) time.Time {
+	return time.Date(y, m, d, 9, 0, 0, 0, time.UTC)
+}
+
+func mustParse(t *testing.T, s string) Rule {
+	t.Helper()
+	r, err := Parse(s)
+	if err != nil {
+		t.Fatalf("Parse(%q): %v", s, err)
+	}
+	return r
+}
+
+func sameTimes(got, want []time.Time) bool {
+	if len(got) != len(want) {
+		return false
+	}
+	for i := range got {
+		if !got[i].Equal(want[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+func TestNext(t *testing.T) {
+	tests := []struct {
+		name  string
+		rule  string
+		start time.Time
+		from  time.Time // zero: start
+		n     int
+		want  []time.Time
+	}{
+		{
+			name:  "31st clamped to the end of shorter months",
+			rule:  "FREQ=MONTHLY",
+			start: date(2026, 1, 31),
+			n:     4,
+			want:  []time.Time{date(2026, 1, 31), date(2026, 2, 28), date(2026, 3, 31), date(2026, 4, 30)},
+		},
+		{
+			name:  "BYMONTHDAY=31 from mid-month",
+			rule:  "FREQ=MONTHLY;BYMONTHDAY=31",
+			start: date(2026, 1, 15),
+			n:     3,
+			want:  []time.Time{date(2026, 1, 31), date(2026, 2, 28), date(2026, 3, 31)},
+		},
+		{
+			name:  "last day of the month",
+			rule:  "FREQ=MONTHLY;BYMONTHDAY=-1",
+			start: date(2027, 12, 5),
+			n:     3,
+			want:  []time.Time{date(2027, 12, 31), date(2028, 1, 31), date(2028, 2, 29)},
+		},
+		{
+			name:  "31st in a leap year February",
+			rule:  "FREQ=MONTHLY",
+			start: date(2028, 1, 31),
+			n:     2,
+			want:  []time.Time{date(2028, 1, 31), date(2028, 2, 29)},
+		},
+		{
+			name:  "29 February yearly",
+			rule:  "FREQ=YEARLY",
+			start: date(2028, 2, 29),
+			n:     5,
+			want:  []time.Time{date(2028, 2, 29), date(2029, 2, 28), date(2030, 2, 28), date(2031, 2, 28), date(2032, 2, 29)},
+		},
+		{
+			// The 1 October period has passed, so the first is six months on
+			name:  "every six months, counted from the start's month",
+			rule:  "FREQ=MONTHLY;INTERVAL=6;BYMONTHDAY=1",
+			start: date(2026, 10, 19),
+			n:     3,
+			want:  []time.Time{date(2027, 4, 1), date(2027, 10, 1), date(2028, 4, 1)},
+		},
+		{
+			name:  "every two weeks",
+			rule:  "FREQ=WEEKLY;INTERVAL=2",
+			start: date(2026, 12, 21),
+			n:     3,
+			want:  []time.Time{date(2026, 12, 21), date(2027, 1, 4), date(2027, 1, 18)},
+		},
+		{
+			name:  "COUNT",
+			rule:  "FREQ=DAILY;COUNT=3",
+			start: date(2026, 1, 1),
+			n:     10,
+			want:  []time.Time{date(2026, 1, 1), date(2026, 1, 2), date(2026, 1, 3)},
+		},
+		{
+			name:  "COUNT is measured from the start, not from",
+			rule:  "FREQ=DAILY;COUNT=5",
+			start: date(2026, 1, 1),
+			from:  date(2026, 1, 4),
+			n:     10,
+			want:  []time.Time{date(2026, 1, 4), date(2026, 1, 5)},
+		},
+		{
+			name:  "UNTIL a date excludes later times that day",
+			rule:  "FREQ=DAILY;UNTIL=20260104",
+			start: date(2026, 1, 1),
+			n:     10,
+			want:  []time.Time{date(2026, 1, 1), date(2026, 1, 2), date(2026, 1, 3)},
+		},
+		{
+			name:  "UNTIL is inclusive",
+			rule:  "FREQ=WEEKLY;UNTIL=20260115T090000Z",
+			start: date(2026, 1, 1),
+			n:     10,
+			want:  []time.Time{date(2026, 1, 1), date(2026, 1, 8), date(2026, 1, 15)},
+		},
+		{
+			name:  "from after UNTIL",
+			rule:  "FREQ=DAILY;UNTIL=2026-01-04",
+			start: date(2026, 1, 1),
+			from:  date(2026, 2, 1),
+			n:     10,
+			want:  []time.Time{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			from := tt.from
+			if from.IsZero() {
+				from = tt.start
+			}
+			got := mustParse(t, tt.rule).Next(tt.start, from, tt.n)
+			if !sameTimes(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// TestDaylightSaving checks occurrences keep their time of day when the
+// clocks change, rather than their distance in hours.
+func TestDaylightSaving(t *testing.T) {
+	london, err := time.LoadLocation("Europe/London")
+	if err != nil {
+		t.Fatal(err)
+	}
+	at := func(m time.Month, d, hour, min int) time.Time {
+		return time.Date(2026, m, d, hour, min, 0, 0, london)
+	}
+
+	tests := []struct {
+		name  string
+		rule  string
+		start time.Time
+		want  []time.Time
+	}{
+		{
+			name:  "daily across the clocks going forward",
+			rule:  "FREQ=DAILY",
+			start: at(time.March, 28, 9, 0),
+			want:  []time.Time{at(time.March, 28, 9, 0), at(time.March, 29, 9, 0), at(time.March, 30, 9, 0)},
+		},
+		{
+			name:  "weekly across the clocks going back",
+			rule:  "FREQ=WEEKLY",
+			start: at(time.October, 18, 9, 0),
+			want:  []time.Time{at(time.October, 18, 9, 0), at(time.October, 25, 9, 0), at(time.November, 1, 9, 0)},
+		},
+		{
+			name:  "monthly from winter into summer time",
+			rule:  "FREQ=MONTHLY;BYMONTHDAY=-1",
+			start: at(time.February, 1, 9, 0),
+			want:  []time.Time{at(time.February, 28, 9, 0), at(time.March, 31, 9, 0), at(time.April, 30, 9, 0)},
+		},
+		{
+			// 01:30 doesn't exist on 29 March; later days are back at 01:30
+			name:  "a time skipped by the change",
+			rule:  "FREQ=DAILY",
+			start: at(time.March, 28, 1, 30),
+			want:  []time.Time{at(time.March, 28, 1, 30), at(time.March, 29, 2, 30), at(time.March, 30, 1, 30)},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := mustParse(t, tt.rule).Next(tt.start, tt.start, len(tt.want))
+			if !sameTimes(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBetween(t *testing.T) {
+	tests := []struct {
+		name     string
+		rule     string
+		start    time.Time
+		from, to time.Time
+		want     []time.Time
+	}{
+		{
+			name:  "window inside the rule",
+			rule:  "FREQ=MONTHLY",
+			start: date(2026, 1, 31),
+			from:  date(2026, 2, 1),
+			to:    date(2026, 4, 30),
+			want:  []time.Time{date(2026, 2, 28), date(2026, 3, 31), date(2026, 4, 30)},
+		},
+		{
+			name:  "window before the start",
+			rule:  "FREQ=DAILY",
+			start: date(2026, 6, 1),
+			from:  date(2026, 5, 1),
+			to:    date(2026, 5, 31),
+			want:  []time.Time{},
+		},
+		{
+			name:  "COUNT runs out inside the window",
+			rule:  "FREQ=WEEKLY;COUNT=2",
+			start: date(2026, 1, 1),
+			from:  date(2026, 1, 1),
+			to:    date(2026, 3, 1),
+			want:  []time.Time{date(2026, 1, 1), date(2026, 1, 8)},
+		},
+		{
+			name:  "UNTIL inside the window",
+			rule:  "FREQ=YEARLY;UNTIL=20280101",
+			start: date(2026, 3, 1),
+			from:  date(2026, 1, 1),
+			to:    date(2030, 12, 31),
+			want:  []time.Time{date(2026, 3, 1), date(2027, 3, 1)},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := mustParse(t, tt.rule).Between(tt.start, tt.from, tt.to)
+			if !sameTimes(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseInvalid(t *testing.T) {
+	for _, rule := range []string{
+		"",
+		"INTERVAL=2",
+		"FREQ=HOURLY",
+		"FREQ=DAILY;INTERVAL=0",
+		"FREQ=DAILY;INTERVAL=two",
+		"FREQ=WEEKLY;BYMONTHDAY=1",
+		"FREQ=MONTHLY;BYMONTHDAY=32",
+		"FREQ=MONTHLY;BYMONTHDAY=-2",
+		"FREQ=DAILY;COUNT=-1",
+		"FREQ=DAILY;UNTIL=tomorrow",
+		"FREQ=WEEKLY;BYDAY=MO",
+		"FREQ",
+	} {
+		if r, err := Parse(rule); err == nil {
+			t.Errorf("Parse(%q) = %+v, want an error", rule, r)
+		}
+	}
+}
+
+func TestParseString(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{"RRULE:freq=monthly;interval=6;bymonthday=1;count=4", "FREQ=MONTHLY;INTERVAL=6;BYMONTHDAY=1;COUNT=4"},
+		{"FREQ=WEEKLY;INTERVAL=1", "FREQ=WEEKLY"},
+		{"FREQ=YEARLY;UNTIL=2030-02-28", "FREQ=YEARLY;UNTIL=20300228T000000Z"},
+		{"FREQ=MONTHLY;BYMONTHDAY=-1;", "FREQ=MONTHLY;BYMONTHDAY=-1"},
+	}
+
+	for _, tt := range tests {
+		r := mustParse(t, tt.in)
+		if got := r.String(); got != tt.want {
+			t.Errorf("Parse(%q).String() = %q, want %q", tt.in, got, tt.want)
+		}
+		if again := mustParse(t, r.String()); again != r {
+			t.Errorf("%q doesn't parse back to the same rule", r.String())
+		}
+	}
+}
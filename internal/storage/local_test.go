@@ -0,0 +1,101 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+type fakeSigner struct{}
+
+func (fakeSigner) URLFor(path string, ttl time.Duration) string {
+	return "https://api.example.com" + path + "?ttl=" + ttl.String()
+}
+
+func TestLocalSignedURL(t *testing.T) {
+	ctx := context.Background()
+	l := NewLocal(t.TempDir(), fakeSigner{})
+
+	link, err := l.SignedURL(ctx, "invoices/a.pdf", time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "https://api.example.com/public/files/invoices/a.pdf?ttl=1h0m0s"; link != want {
+		t.Errorf("got %s, want %s", link, want)
+	}
+
+	if _, err := l.SignedURL(ctx, "../etc/passwd", time.Hour); err == nil {
+		t.Error("signed a key outside the storage root")
+	}
+
+	if _, err := NewLocal(t.TempDir(), nil).SignedURL(ctx, "invoices/a.pdf", time.Hour); err == nil || !strings.Contains(err.Error(), "signer") {
+		t.Errorf("got %v without a signer, want an error", err)
+	}
+}
+
+func TestHashFile(t *testing.T) {
+	ctx := context.Background()
+	l := NewLocal(t.TempDir(), nil)
+
+	// The SHA-256 of "abc", from FIPS 180-2
+	const abc = "ba7816bf8f01cfea414140de5dae2223b00361a396177a9cb410ff61f20015ad"
+	if got := Hash([]byte("abc")); got != abc {
+		t.Errorf("Hash(abc) = %s, want %s", got, abc)
+	}
+
+	content := strings.Repeat("photo", 100000)
+	if err := l.Put(ctx, "photos/a.jpg", strings.NewReader(content), "image/jpeg"); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := HashFile(ctx, l, "photos/a.jpg"); err != nil || got != Hash([]byte(content)) {
+		t.Errorf("HashFile = %s (%v), want %s", got, err, Hash([]byte(content)))
+	}
+
+	if _, err := HashFile(ctx, l, "photos/b.jpg"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("missing file: got %v, want ErrNotFound", err)
+	}
+}
+
+func TestLocalWalk(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	l := NewLocal(dir, nil)
+
+	keys := []string{"invoices/a.pdf", "photos/originals/b.jpg", "photos/variants/b/thumbnail.jpg", "top.txt"}
+	for _, key := range keys {
+		if err := l.Put(ctx, key, strings.NewReader(key), "text/plain"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// A write in progress
+	if err := os.WriteFile(filepath.Join(dir, "photos", ".upload-123"), []byte("part"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	var got []string
+	if err := l.Walk(ctx, func(key string) error { got = append(got, key); return nil }); err != nil {
+		t.Fatal(err)
+	}
+	sort.Strings(got)
+	if !slices.Equal(got, keys) {
+		t.Errorf("walked %v, want %v", got, keys)
+	}
+
+	stop := errors.New("stop")
+	calls := 0
+	err := l.Walk(ctx, func(key string) error { calls++; return stop })
+	if !errors.Is(err, stop) || calls != 1 {
+		t.Errorf("got %v after %d calls, want the first error returned", err, calls)
+	}
+
+	empty := NewLocal(filepath.Join(dir, "not-yet"), nil)
+	if err := empty.Walk(ctx, func(key string) error { t.Errorf("walked %s", key); return nil }); err != nil {
+		t.Errorf("missing directory: %v", err)
+	}
+}
@@ -0,0 +1,144 @@
+// Package storage keeps generated PDFs and uploaded photos on local disk
+// or in an S3-compatible bucket, addressed by keys such as
+// "invoices/<id>.pdf".
+package storage
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strings"
+	"time"
+)
+
+// Storage puts, gets and deletes files by key. SignedURL returns a URL
+// the file can be fetched from until the link expires.
+type Storage interface {
+	Put(ctx context.Context, key string, r io.Reader, contentType string) error
+	Get(ctx context.Context, key string) (io.ReadCloser, error)
+	Delete(ctx context.Context, key string) error
+	SignedURL(ctx context.Context, key string, expires time.Duration) (string, error)
+
+	// Walk calls fn with the key of every stored file, stopping at the
+	// first error fn returns.
+	Walk(ctx context.Context, fn func(key string) error) error
+}
+
+// Sized is implemented by the readers Get returns when the backend
+// knows the file's size without reading it, such as S3's Content-Length.
+type Sized interface {
+	Size() int64
+}
+
+// ErrNotFound is returned by Get for keys with no file.
+var ErrNotFound = errors.New("file not found")
+
+// Signer signs links to API paths, for backends that can't sign links
+// of their own. links.Signer is one.
+type Signer interface {
+	URLFor(path string, ttl time.Duration) string
+}
+
+// FilesPath is the API path local files are served from, through signed
+// links only.
+const FilesPath = "/public/files/"
+
+// Backends
+const (
+	BackendLocal = "local"
+	BackendS3    = "s3"
+)
+
+// Config selects and configures the backend. The defaults keep files in
+// ./uploads, as before storage was configurable.
+type Config struct {
+	Backend string // local / s3
+
+	Dir    string // local: directory files are kept in
+	Signer Signer // local: signs links to FilesPath; without one there are no links
+
+	Endpoint        string // s3: e.g. https://s3.eu-west-2.amazonaws.com or http://localhost:9000 for MinIO
+	Region          string
+	Bucket          string
+	AccessKeyID     string
+	SecretAccessKey string
+	PathStyle       bool // s3: bucket in the path rather than the host name, as MinIO expects
+}
+
+// ConfigFromEnv reads STORAGE_BACKEND and STORAGE_DIR, and for S3
+// S3_ENDPOINT, S3_REGION, S3_BUCKET, S3_ACCESS_KEY_ID,
+// S3_SECRET_ACCESS_KEY and S3_PATH_STYLE.
+func ConfigFromEnv() Config {
+	cfg := Config{
+		Backend:         os.Getenv("STORAGE_BACKEND"),
+		Dir:             os.Getenv("STORAGE_DIR"),
+		Endpoint:        os.Getenv("S3_ENDPOINT"),
+		Region:          os.Getenv("S3_REGION"),
+		Bucket:          os.Getenv("S3_BUCKET"),
+		AccessKeyID:     os.Getenv("S3_ACCESS_KEY_ID"),
+		SecretAccessKey: os.Getenv("S3_SECRET_ACCESS_KEY"),
+		PathStyle:       os.Getenv("S3_PATH_STYLE") != "false",
+	}
+
+	if cfg.Backend == "" {
+		cfg.Backend = BackendLocal
+	}
+
+	if cfg.Dir == "" {
+		cfg.Dir = "uploads"
+	}
+
+	if cfg.Region == "" {
+		cfg.Region = "us-east-1"
+	}
+
+	return cfg
+}
+
+// New returns the configured backend.
+func New(cfg Config) (Storage, error) {
+	switch cfg.Backend {
+	case BackendLocal:
+		return NewLocal(cfg.Dir, cfg.Signer), nil
+	case BackendS3:
+		return NewS3(cfg)
+	default:
+		return nil, fmt.Errorf("unknown storage backend %q, expected local or s3", cfg.Backend)
+	}
+}
+
+// Hash returns the hex SHA-256 hash of a file's content, as recorded
+// next to its key.
+func Hash(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// HashFile reads a stored file and returns its hash.
+func HashFile(ctx context.Context, s Storage, key string) (string, error) {
+	f, err := s.Get(ctx, key)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// validKey rejects keys that could escape the storage root, such as
+// "../x" or "/etc/passwd".
+func validKey(key string) error {
+	if key == "" || strings.HasPrefix(key, "/") || path.Clean(key) != key || strings.HasPrefix(key, "../") || key == ".." {
+		return fmt.Errorf("invalid storage key %q", key)
+	}
+	return nil
+}